@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLogLine(t *testing.T) {
+	long := strings.Repeat("x", maxLogLineBytes+1)
+	input := "first\n" + long + "\nsecond\nlast"
+	reader := bufio.NewReaderSize(strings.NewReader(input), 4096)
+
+	want := []struct {
+		line      string
+		oversized bool
+	}{
+		{"first", false},
+		{"", true},
+		{"second", false},
+		{"last", false},
+	}
+	for i, w := range want {
+		line, oversized, err := readLogLine(reader)
+		if err != nil && i < len(want)-1 {
+			t.Fatalf("line %d: unexpected error %v", i+1, err)
+		}
+		if string(line) != w.line || oversized != w.oversized {
+			t.Errorf("line %d: got (%q, %v), want (%q, %v)", i+1, line, oversized, w.line, w.oversized)
+		}
+	}
+	if _, _, err := readLogLine(reader); err == nil {
+		t.Error("expected EOF after the last line")
+	}
+}
+
+func TestLoadLogFileMalformedLines(t *testing.T) {
+	lines := []string{
+		`{"timestamp":"2026-01-02T10:00:00Z","level":"INFO","session_id":"s1","tool":"searchCode","data":{"operation":"search_complete","search_data":{"query":"foo","result_count":3,"success":true}}}`,
+		`not json at all`,
+		``,
+		`   `,
+		`{"timestamp":"2026-01-02T10:01:00Z","level":"INFO","session_id":"s1","tool":"searchCode","data":{"operation":"search_complete","search_data":{"query":"bar"}}}`,
+		`{"timestamp":"2026-01-02T10:02:00Z","level":"INFO","session_id":"s1","tool":"batchRetrievalTool","data":{"operation":"batch_retrieval_complete","batch_data":"oops"}}`,
+		`{"timestamp":"2026-01-02T10:03:00Z","level":"INFO","session_id":"s2","tool":"getFile","data":{"operation":"file_retrieval","repo":"a/b"}}`,
+		`{"timestamp":`,
+		strings.Repeat("y", maxLogLineBytes+1),
+		`{"timestamp":"2026-01-02T10:04:00Z","level":"WARN","session_id":"s2","message":"no data"}`,
+	}
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	la := NewLogAnalyzer()
+	if err := la.LoadLogs(path); err != nil {
+		t.Fatalf("LoadLogs: %v", err)
+	}
+	want := ParseHealth{Files: 1, Lines: 8, Parsed: 5, Malformed: 2, Oversized: 1, IncompleteRecords: 3}
+	if la.health != want {
+		t.Errorf("health = %+v, want %+v", la.health, want)
+	}
+	if la.health.Healthy() {
+		t.Error("expected unhealthy parse")
+	}
+	if len(la.entries) != 5 || len(la.sessions) != 2 {
+		t.Errorf("got %d entries in %d sessions, want 5 in 2", len(la.entries), len(la.sessions))
+	}
+}
+
+func TestFieldNumber(t *testing.T) {
+	data := map[string]interface{}{
+		"float":  float64(4),
+		"quoted": "12.5",
+		"word":   "many",
+		"bool":   true,
+		"object": map[string]interface{}{"n": float64(1)},
+	}
+	tests := []struct {
+		key  string
+		want float64
+		ok   bool
+	}{
+		{"float", 4, true},
+		{"quoted", 12.5, true},
+		{"word", 0, false},
+		{"bool", 0, false},
+		{"object", 0, false},
+		{"missing", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := fieldNumber(data, tt.key)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("fieldNumber(%q) = (%v, %v), want (%v, %v)", tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+	if _, ok := fieldNumber(nil, "float"); ok {
+		t.Error("fieldNumber on a nil map should report missing")
+	}
+}
+
+func TestRecordSucceeded(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want bool
+	}{
+		{"success true", map[string]interface{}{"success": true}, true},
+		{"success false", map[string]interface{}{"success": false}, false},
+		{"flag wins over error", map[string]interface{}{"success": true, "error": "boom"}, true},
+		{"no flag, no error", map[string]interface{}{}, true},
+		{"no flag, error", map[string]interface{}{"error": "boom"}, false},
+		{"non-bool flag", map[string]interface{}{"success": "false", "error": "boom"}, false},
+		{"nil data", nil, true},
+	}
+	for _, tt := range tests {
+		if got := recordSucceeded(tt.data); got != tt.want {
+			t.Errorf("%s: recordSucceeded = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	date := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		value   string
+		since   time.Time
+		until   time.Time
+		wantErr bool
+	}{
+		{value: "2026-01-01..2026-01-31", since: date("2026-01-01T00:00:00Z"), until: date("2026-02-01T00:00:00Z")},
+		{value: "2026-01-01T08:00:00Z..2026-01-01T09:30:00Z", since: date("2026-01-01T08:00:00Z"), until: date("2026-01-01T09:30:00Z")},
+		{value: "2026-01-05..", since: date("2026-01-05T00:00:00Z")},
+		{value: "..2026-01-05", until: date("2026-01-06T00:00:00Z")},
+		{value: ".."},
+		{value: "2026-01-05..2026-01-05", since: date("2026-01-05T00:00:00Z"), until: date("2026-01-06T00:00:00Z")},
+		{value: "2026-01-05", wantErr: true},
+		{value: "yesterday..today", wantErr: true},
+		{value: "2026-01-05..2026-13-01", wantErr: true},
+		{value: "2026-02-01..2026-01-01", wantErr: true},
+		{value: "2026-01-01T10:00:00Z..2026-01-01T10:00:00Z", wantErr: true},
+	}
+	for _, tt := range tests {
+		window, err := parseTimeWindow(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTimeWindow(%q): expected error, got %+v", tt.value, window)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTimeWindow(%q): %v", tt.value, err)
+			continue
+		}
+		if !window.Since.Equal(tt.since) || !window.Until.Equal(tt.until) {
+			t.Errorf("parseTimeWindow(%q) = %v..%v, want %v..%v", tt.value, window.Since, window.Until, tt.since, tt.until)
+		}
+		if window.Label != tt.value {
+			t.Errorf("parseTimeWindow(%q) label = %q", tt.value, window.Label)
+		}
+	}
+
+	window, err := parseTimeWindow("2026-01-01..2026-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ts, want := range map[string]bool{
+		"2025-12-31T23:59:59Z": false,
+		"2026-01-01T00:00:00Z": true,
+		"2026-01-01T23:59:59Z": true,
+		"2026-01-02T00:00:00Z": false,
+	} {
+		if got := window.Contains(date(ts)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ts, got, want)
+		}
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	at := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	entry := func(tool string, level LogLevel, data map[string]interface{}) LogEntry {
+		at = at.Add(time.Second)
+		return LogEntry{Timestamp: at, Level: level, SessionID: "s1", Tool: tool, Data: data}
+	}
+	la := NewLogAnalyzer()
+	la.entries = []LogEntry{
+		entry("searchCode", LogLevelInfo, map[string]interface{}{"operation": "search_complete", "search_data": map[string]interface{}{"query": "a", "result_count": float64(3), "success": true, "duration_ms": float64(200 * time.Millisecond)}}),
+		entry("searchCode", LogLevelInfo, map[string]interface{}{"operation": "search_complete", "search_data": map[string]interface{}{"query": "b", "result_count": "0", "success": true}}),
+		entry("searchCode", LogLevelError, map[string]interface{}{"operation": "search_complete", "search_data": map[string]interface{}{"query": "c", "error": "boom"}}),
+		entry("searchCode", LogLevelInfo, map[string]interface{}{"operation": "search_complete"}),
+		entry("batchRetrievalTool", LogLevelInfo, map[string]interface{}{"operation": "batch_retrieval_complete", "batch_data": map[string]interface{}{"success": true, "files_success": float64(2), "files_error": float64(1)}}),
+		entry("batchRetrievalTool", LogLevelInfo, map[string]interface{}{"operation": "batch_retrieval_complete", "batch_data": map[string]interface{}{"success": true, "files_success": "3"}}),
+		entry("batchRetrievalTool", LogLevelInfo, map[string]interface{}{"operation": "batch_retrieval_complete", "batch_data": map[string]interface{}{"success": true, "files_success": true}}),
+		entry("batchRetrievalTool", LogLevelInfo, map[string]interface{}{"operation": "batch_retrieval_complete", "batch_data": "oops"}),
+		entry("api", LogLevelInfo, map[string]interface{}{"operation": "api_request", "status_code": float64(200), "bytes": float64(1024), "retries": "1"}),
+		entry("api", LogLevelInfo, map[string]interface{}{"operation": "api_request"}),
+		entry("api", LogLevelError, map[string]interface{}{"operation": "api_request"}),
+		entry("cache", LogLevelInfo, map[string]interface{}{"operation": "cache_operation", "hit": true}),
+		entry("cache", LogLevelInfo, map[string]interface{}{"operation": "cache_operation", "hit": "yes"}),
+	}
+	la.sessions["s1"] = la.entries
+
+	var buf bytes.Buffer
+	if err := la.WriteOpenMetrics(&buf); err != nil {
+		t.Fatalf("WriteOpenMetrics: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`grepapp_log_searches_total{outcome="success"} 1` + "\n",
+		`grepapp_log_searches_total{outcome="zero_results"} 2` + "\n",
+		`grepapp_log_searches_total{outcome="error"} 1` + "\n",
+		`grepapp_log_search_duration_seconds_bucket{le="+Inf"} 1` + "\n",
+		"grepapp_log_search_duration_seconds_sum 0.2\n",
+		"grepapp_log_search_duration_seconds_count 1\n",
+		`grepapp_log_batch_retrievals_total{outcome="success"} 4` + "\n",
+		`grepapp_log_batch_files_total{result="success"} 5` + "\n",
+		`grepapp_log_batch_files_total{result="error"} 1` + "\n",
+		`grepapp_log_api_requests_total{status="200"} 1` + "\n",
+		`grepapp_log_api_requests_total{status="error"} 1` + "\n",
+		"grepapp_log_api_response_bytes_total 1024\n",
+		"grepapp_log_api_retries_total 1\n",
+		`grepapp_log_cache_lookups_total{result="hit"} 1` + "\n",
+		`grepapp_log_cache_lookups_total{result="miss"} 1` + "\n",
+		`grepapp_log_entries_total{level="ERROR"} 2` + "\n",
+		"grepapp_log_sessions 1\n",
+		"grepapp_log_last_entry_timestamp_seconds 1767348013.000\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("metrics should end with # EOF, got %q", out[max(0, len(out)-20):])
+	}
+	if strings.Count(out, "# EOF") != 1 {
+		t.Error("metrics should contain exactly one # EOF marker")
+	}
+}
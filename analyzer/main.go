@@ -2,15 +2,23 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log"
+	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 )
 
@@ -57,6 +65,32 @@ type SearchLogData struct {
 	Filters       map[string]string `json:"filters"`
 }
 
+// RecoverySuggestion and RecoveryKnowledgeBase mirror the server's knowledge.go; the
+// server's suggestQueries tool reads the file written by -export-kb.
+type RecoverySuggestion struct {
+	FailedQuery   string    `json:"failed_query"`
+	RecoveryQuery string    `json:"recovery_query"`
+	Occurrences   int       `json:"occurrences"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+type RecoveryKnowledgeBase struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	Suggestions []RecoverySuggestion `json:"suggestions"`
+}
+
+// ClientSessionData mirrors the server's per-client statistics, logged as periodic
+// "client_session" snapshots.
+type ClientSessionData struct {
+	SessionID      string    `json:"session_id"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+	TotalRequests  int       `json:"total_requests"`
+	SearchQueries  []string  `json:"search_queries"`
+	ZeroResults    int       `json:"zero_results"`
+	SuccessResults int       `json:"success_results"`
+}
+
 type BatchRetrievalLogData struct {
 	Query         string        `json:"query"`
 	RequestedNums []int         `json:"requested_numbers"`
@@ -97,6 +131,47 @@ type QueryRecovery struct {
 	RecoveryQuery string
 	TimeBetween   time.Duration
 	Successful    bool
+	At            time.Time // When the recovery query ran
+}
+
+// TimelineEvent is one tool call or error in a session timeline. Cache lookups and API
+// requests logged since the previous event are attributed to it.
+type TimelineEvent struct {
+	Time        time.Time
+	Offset      time.Duration // Time since the session's first log entry
+	Tool        string
+	Operation   string
+	Summary     string
+	Duration    time.Duration
+	Results     int
+	HasResults  bool
+	CacheHits   int
+	CacheMisses int
+	APIRequests int
+	Failed      bool
+}
+
+type SessionTimeline struct {
+	SessionID string
+	Start     time.Time
+	Duration  time.Duration
+	Events    []TimelineEvent
+	Truncated int // Events dropped beyond maxTimelineEvents
+}
+
+// ParseHealth counts log lines and records the analyzer could not use as expected.
+type ParseHealth struct {
+	Files             int
+	Lines             int
+	Parsed            int
+	Malformed         int // Lines that were not valid JSON log entries
+	Oversized         int // Lines longer than maxLogLineBytes, skipped unread
+	IncompleteRecords int // Search or batch records missing fields or with unexpected types
+}
+
+// Healthy reports whether every non-empty line was parsed into a complete record.
+func (h ParseHealth) Healthy() bool {
+	return h.Malformed == 0 && h.Oversized == 0 && h.IncompleteRecords == 0
 }
 
 type AnalysisReport struct {
@@ -112,7 +187,8 @@ type AnalysisReport struct {
 	ZeroResultQueries []QueryStats
 	
 	// Session analysis
-	Sessions []SessionAnalysis
+	Sessions  []SessionAnalysis
+	Timelines []SessionTimeline
 	
 	// Performance metrics
 	AvgDuration      time.Duration
@@ -121,7 +197,43 @@ type AnalysisReport struct {
 	ErrorRate        float64
 	
 	// Filter analysis
-	FilterEffectiveness map[string]float64
+	FilterEffectiveness []FilterStats
+
+	// Cache savings
+	CacheSavings CacheSavings
+
+	ParseHealth ParseHealth
+}
+
+// CacheSavings estimates what the search page cache saved and how other TTLs would change it.
+type CacheSavings struct {
+	Lookups         int
+	Hits            int
+	AvoidedRequests int           // Each hit replaces one grep.app request
+	AvgAPILatency   time.Duration // Mean latency of upstream requests that were made
+	LatencySaved    time.Duration
+	Projections     []TTLProjection
+}
+
+// TTLProjection is the hit count the logged lookups would have had under a different TTL.
+type TTLProjection struct {
+	TTL           time.Duration
+	Label         string
+	Hits          int
+	HitRate       float64
+	RequestsDelta int // Upstream requests compared with the logged behavior; negative is fewer
+}
+
+// FilterStats correlates the presence of one filter with search outcomes. The "none" row
+// is the baseline of searches without any filter.
+type FilterStats struct {
+	Filter      string
+	Searches    int
+	SuccessRate float64 // Searches that succeeded with at least one result
+	AvgResults  float64
+	AvgDuration time.Duration
+	// SuccessDelta is the success rate minus the no-filter baseline, in percentage points
+	SuccessDelta float64
 }
 
 //================================================================================
@@ -131,6 +243,65 @@ type AnalysisReport struct {
 type LogAnalyzer struct {
 	entries  []LogEntry
 	sessions map[string][]LogEntry
+	health   ParseHealth
+}
+
+// maxLogLineBytes bounds a single log line; search records embed tool arguments and
+// error payloads, so lines are often far longer than bufio.Scanner's 64KB default.
+const maxLogLineBytes = 16 << 20
+
+//================================================================================
+// Defensive Field Access
+//================================================================================
+
+// fieldMap returns data[key] as an object, or nil when missing or of another type.
+func fieldMap(data map[string]interface{}, key string) map[string]interface{} {
+	m, _ := data[key].(map[string]interface{})
+	return m
+}
+
+// fieldString returns data[key] as a string, or "" when missing or of another type.
+func fieldString(data map[string]interface{}, key string) string {
+	v, _ := data[key].(string)
+	return v
+}
+
+// fieldNumber returns data[key] as a number. Numeric strings are accepted since some
+// writers quote numbers.
+func fieldNumber(data map[string]interface{}, key string) (float64, bool) {
+	switch v := data[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		var f float64
+		if _, err := fmt.Sscan(v, &f); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// recordSucceeded reads a record's success flag. Records without one count as
+// successful unless they carry an error message.
+func recordSucceeded(data map[string]interface{}) bool {
+	if v, ok := data["success"].(bool); ok {
+		return v
+	}
+	return fieldString(data, "error") == ""
+}
+
+// apiRequestStatus returns the status label of an api_request entry and whether it counts
+// as a request. Current servers log one record per completed request; older ones logged
+// each request twice, first without a status code, so such entries only count when they
+// record a failure.
+func apiRequestStatus(entry LogEntry) (string, bool) {
+	if status, _ := entry.Data["status_code"].(float64); status != 0 {
+		return fmt.Sprint(int(status)), true
+	}
+	if entry.Level == LogLevelError {
+		return "error", true
+	}
+	return "", false
 }
 
 func NewLogAnalyzer() *LogAnalyzer {
@@ -185,32 +356,99 @@ func (la *LogAnalyzer) loadLogFile(filePath string) error {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer file.Close()
-	
-	scanner := bufio.NewScanner(file)
+	la.health.Files++
+
+	reader := bufio.NewReaderSize(file, 64*1024)
 	lineNum := 0
-	
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
+	for {
+		line, oversized, err := readLogLine(reader)
+		if len(line) > 0 || oversized {
+			lineNum++
+			la.health.Lines++
+			la.parseLogLine(filePath, lineNum, line, oversized)
 		}
-		
-		var entry LogEntry
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
-			log.Printf("Failed to parse line %d in %s: %v", lineNum, filePath, err)
-			continue
+		if err == io.EOF {
+			return nil
 		}
-		
-		la.entries = append(la.entries, entry)
-		
-		if la.sessions[entry.SessionID] == nil {
-			la.sessions[entry.SessionID] = make([]LogEntry, 0)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
 		}
-		la.sessions[entry.SessionID] = append(la.sessions[entry.SessionID], entry)
 	}
-	
-	return scanner.Err()
+}
+
+// readLogLine reads one line without its newline. Lines beyond maxLogLineBytes are
+// consumed and discarded, reporting oversized instead of failing the whole file.
+func readLogLine(reader *bufio.Reader) (line []byte, oversized bool, err error) {
+	for {
+		chunk, isPrefix, readErr := reader.ReadLine()
+		if !oversized {
+			if len(line)+len(chunk) > maxLogLineBytes {
+				oversized = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if readErr != nil {
+			return line, oversized, readErr
+		}
+		if !isPrefix {
+			return line, oversized, nil
+		}
+	}
+}
+
+// parseLogLine decodes one line and records it, counting anything unusable.
+func (la *LogAnalyzer) parseLogLine(filePath string, lineNum int, line []byte, oversized bool) {
+	if oversized {
+		la.health.Oversized++
+		log.Printf("Skipping line %d in %s: longer than %d bytes", lineNum, filePath, maxLogLineBytes)
+		return
+	}
+	line = []byte(strings.TrimSpace(string(line)))
+	if len(line) == 0 {
+		la.health.Lines--
+		return
+	}
+
+	var entry LogEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		la.health.Malformed++
+		log.Printf("Failed to parse line %d in %s: %v", lineNum, filePath, err)
+		return
+	}
+	la.health.Parsed++
+	if !recordComplete(entry) {
+		la.health.IncompleteRecords++
+	}
+
+	la.entries = append(la.entries, entry)
+	la.sessions[entry.SessionID] = append(la.sessions[entry.SessionID], entry)
+}
+
+// recordComplete checks that completion records carry the fields the reports depend on.
+func recordComplete(entry LogEntry) bool {
+	operation := fieldString(entry.Data, "operation")
+	switch operation {
+	case "search_complete":
+		data := fieldMap(entry.Data, "search_data")
+		if data == nil || fieldString(data, "query") == "" {
+			return false
+		}
+		_, hasResults := fieldNumber(data, "result_count")
+		_, hasSuccess := data["success"].(bool)
+		return hasResults && hasSuccess
+	case "batch_retrieval_complete":
+		data := fieldMap(entry.Data, "batch_data")
+		if data == nil {
+			return false
+		}
+		_, hasSuccess := data["success"].(bool)
+		return hasSuccess
+	case "file_retrieval":
+		return fieldString(entry.Data, "repo") != "" && fieldString(entry.Data, "path") != ""
+	}
+	return true
 }
 
 func (la *LogAnalyzer) AnalyzeSearchPatterns() []QueryStats {
@@ -238,7 +476,7 @@ func (la *LogAnalyzer) AnalyzeSearchPatterns() []QueryStats {
 			stat := queryMap[query]
 			stat.Count++
 			
-			if resultCount, ok := data["result_count"].(float64); ok {
+			if resultCount, ok := fieldNumber(data, "result_count"); ok {
 				if resultCount == 0 {
 					stat.ZeroResults++
 				}
@@ -318,7 +556,7 @@ func (la *LogAnalyzer) AnalyzeClientBehavior() []SessionAnalysis {
 						analysis.Queries = append(analysis.Queries, query)
 						analysis.TotalQueries++
 						
-						if resultCount, ok := data["result_count"].(float64); ok {
+						if resultCount, ok := fieldNumber(data, "result_count"); ok {
 							if resultCount == 0 {
 								analysis.ZeroResults = append(analysis.ZeroResults, query)
 							} else {
@@ -350,6 +588,40 @@ func (la *LogAnalyzer) AnalyzeClientBehavior() []SessionAnalysis {
 	return sessions
 }
 
+// AnalyzeClientSessions returns the latest snapshot of each MCP client session, most
+// requests first. Snapshots are cumulative, so only the newest one per client counts.
+func (la *LogAnalyzer) AnalyzeClientSessions() []ClientSessionData {
+	latest := make(map[string]ClientSessionData)
+	for _, entry := range la.entries {
+		if fieldString(entry.Data, "operation") != "client_session" {
+			continue
+		}
+		raw, err := json.Marshal(entry.Data["client_session"])
+		if err != nil {
+			continue
+		}
+		var session ClientSessionData
+		if err := json.Unmarshal(raw, &session); err != nil || session.SessionID == "" {
+			continue
+		}
+		if previous, ok := latest[session.SessionID]; !ok || !session.LastSeen.Before(previous.LastSeen) {
+			latest[session.SessionID] = session
+		}
+	}
+
+	sessions := make([]ClientSessionData, 0, len(latest))
+	for _, session := range latest {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].TotalRequests != sessions[j].TotalRequests {
+			return sessions[i].TotalRequests > sessions[j].TotalRequests
+		}
+		return sessions[i].SessionID < sessions[j].SessionID
+	})
+	return sessions
+}
+
 func (la *LogAnalyzer) findRecoveryPatterns(searchEntries []LogEntry) []QueryRecovery {
 	var recoveries []QueryRecovery
 	
@@ -359,13 +631,13 @@ func (la *LogAnalyzer) findRecoveryPatterns(searchEntries []LogEntry) []QueryRec
 		
 		// Check if current query had zero results
 		if data, ok := currentEntry.Data["search_data"].(map[string]interface{}); ok {
-			if resultCount, ok := data["result_count"].(float64); ok && resultCount == 0 {
+			if resultCount, ok := fieldNumber(data, "result_count"); ok && resultCount == 0 {
 				currentQuery, _ := data["query"].(string)
 				
 				// Check next query
 				if nextData, ok := nextEntry.Data["search_data"].(map[string]interface{}); ok {
 					nextQuery, _ := nextData["query"].(string)
-					nextResultCount, _ := nextData["result_count"].(float64)
+					nextResultCount, _ := fieldNumber(nextData, "result_count")
 					
 					if currentQuery != nextQuery {
 						recovery := QueryRecovery{
@@ -373,6 +645,7 @@ func (la *LogAnalyzer) findRecoveryPatterns(searchEntries []LogEntry) []QueryRec
 							RecoveryQuery: nextQuery,
 							TimeBetween:   nextEntry.Timestamp.Sub(currentEntry.Timestamp),
 							Successful:    nextResultCount > 0,
+							At:            nextEntry.Timestamp,
 						}
 						recoveries = append(recoveries, recovery)
 					}
@@ -384,13 +657,268 @@ func (la *LogAnalyzer) findRecoveryPatterns(searchEntries []LogEntry) []QueryRec
 	return recoveries
 }
 
+//================================================================================
+// Filter Effectiveness
+//================================================================================
+
+// AnalyzeFilterEffectiveness compares searches using each filter type against searches
+// without filters. A search with several filters counts toward each of them.
+func (la *LogAnalyzer) AnalyzeFilterEffectiveness() []FilterStats {
+	type totals struct {
+		searches, successes int
+		results             float64
+		duration            time.Duration
+	}
+	filters := []string{"none", "repo", "path", "lang"}
+	byFilter := make(map[string]*totals, len(filters))
+	for _, filter := range filters {
+		byFilter[filter] = &totals{}
+	}
+
+	for _, entry := range la.entries {
+		if entry.Tool != "searchCode" {
+			continue
+		}
+		data, ok := entry.Data["search_data"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		success := recordSucceeded(data)
+		resultCount, _ := fieldNumber(data, "result_count")
+		duration, _ := fieldNumber(data, "duration_ms") // Nanoseconds despite the field name
+
+		var used []string
+		for _, filter := range filters[1:] {
+			if value, _ := data[filter+"_filter"].(string); value != "" {
+				used = append(used, filter)
+			}
+		}
+		if len(used) == 0 {
+			used = []string{"none"}
+		}
+		for _, filter := range used {
+			t := byFilter[filter]
+			t.searches++
+			if success && resultCount > 0 {
+				t.successes++
+			}
+			t.results += resultCount
+			t.duration += time.Duration(duration)
+		}
+	}
+
+	stats := make([]FilterStats, 0, len(filters))
+	for _, filter := range filters {
+		t := byFilter[filter]
+		if t.searches == 0 {
+			continue
+		}
+		stats = append(stats, FilterStats{
+			Filter:      filter,
+			Searches:    t.searches,
+			SuccessRate: float64(t.successes) / float64(t.searches) * 100,
+			AvgResults:  t.results / float64(t.searches),
+			AvgDuration: t.duration / time.Duration(t.searches),
+		})
+	}
+	if len(stats) > 0 && stats[0].Filter == "none" {
+		for i := range stats {
+			stats[i].SuccessDelta = stats[i].SuccessRate - stats[0].SuccessRate
+		}
+	}
+	return stats
+}
+
+//================================================================================
+// Cache Savings
+//================================================================================
+
+var projectedTTLs = []struct {
+	ttl   time.Duration
+	label string
+}{
+	{time.Hour, "1h"}, {6 * time.Hour, "6h"}, {12 * time.Hour, "12h"},
+	{24 * time.Hour, "24h"}, {72 * time.Hour, "3d"}, {7 * 24 * time.Hour, "7d"},
+}
+
+// AnalyzeCacheSavings estimates avoided upstream requests and latency from cache logs. For
+// TTL projections each lookup is aged against the last miss for the same key, which is
+// when the entry was fetched and written; hits on entries written before the logs began
+// are assumed to stay hits under any TTL.
+func (la *LogAnalyzer) AnalyzeCacheSavings() CacheSavings {
+	entries := append([]LogEntry(nil), la.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	var savings CacheSavings
+	var apiCount int
+	var apiTotal time.Duration
+	var ages []time.Duration // Age of each aged lookup
+	unagedHits := 0
+	written := make(map[string]time.Time)
+
+	for _, entry := range entries {
+		operation, _ := entry.Data["operation"].(string)
+		switch {
+		case entry.Tool == "api" && operation == "api_request":
+			// Requests that failed without a response have no meaningful duration
+			if status, ok := apiRequestStatus(entry); ok && status != "error" {
+				if ms, ok := entry.Data["duration_ms"].(float64); ok {
+					apiCount++
+					apiTotal += time.Duration(ms) * time.Millisecond
+				}
+			}
+		case entry.Tool == "cache":
+			key, _ := entry.Data["cache_key"].(string)
+			hit, _ := entry.Data["hit"].(bool)
+			savings.Lookups++
+			writtenAt, known := written[key]
+			if hit {
+				savings.Hits++
+				if known {
+					ages = append(ages, entry.Timestamp.Sub(writtenAt))
+				} else {
+					unagedHits++
+				}
+				continue
+			}
+			if known {
+				ages = append(ages, entry.Timestamp.Sub(writtenAt)) // A refetch a longer TTL would have served
+			}
+			written[key] = entry.Timestamp
+		}
+	}
+
+	savings.AvoidedRequests = savings.Hits
+	if apiCount > 0 {
+		savings.AvgAPILatency = apiTotal / time.Duration(apiCount)
+		savings.LatencySaved = savings.AvgAPILatency * time.Duration(savings.Hits)
+	}
+	if savings.Lookups == 0 {
+		return savings
+	}
+
+	for _, candidate := range projectedTTLs {
+		hits := unagedHits
+		for _, age := range ages {
+			if age <= candidate.ttl {
+				hits++
+			}
+		}
+		savings.Projections = append(savings.Projections, TTLProjection{
+			TTL:           candidate.ttl,
+			Label:         candidate.label,
+			Hits:          hits,
+			HitRate:       float64(hits) / float64(savings.Lookups) * 100,
+			RequestsDelta: savings.Hits - hits,
+		})
+	}
+	return savings
+}
+
+//================================================================================
+// Session Timelines
+//================================================================================
+
+const maxTimelineEvents = 200
+
+// timelineDuration reads a duration logged by the server, which encodes time.Duration
+// as nanoseconds even in fields named duration_ms.
+func timelineDuration(data map[string]interface{}) time.Duration {
+	if v, ok := data["duration_ms"].(float64); ok {
+		return time.Duration(v)
+	}
+	return 0
+}
+
+// BuildSessionTimeline replays a session's log entries in order, producing one event per
+// completed tool call or error.
+func (la *LogAnalyzer) BuildSessionTimeline(sessionID string) SessionTimeline {
+	return la.replaySession(sessionID, maxTimelineEvents)
+}
+
+// replaySession builds a session timeline keeping at most maxEvents events, or all of
+// them when maxEvents is 0.
+func (la *LogAnalyzer) replaySession(sessionID string, maxEvents int) SessionTimeline {
+	entries := append([]LogEntry(nil), la.sessions[sessionID]...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	timeline := SessionTimeline{SessionID: sessionID}
+	if len(entries) == 0 {
+		return timeline
+	}
+	timeline.Start = entries[0].Timestamp
+	timeline.Duration = entries[len(entries)-1].Timestamp.Sub(timeline.Start)
+
+	var pending TimelineEvent // Cache and API activity awaiting the next tool event
+	for _, entry := range entries {
+		operation, _ := entry.Data["operation"].(string)
+		event := TimelineEvent{Tool: entry.Tool, Operation: operation}
+
+		switch {
+		case operation == "cache_operation":
+			if hit, _ := entry.Data["hit"].(bool); hit {
+				pending.CacheHits++
+			} else {
+				pending.CacheMisses++
+			}
+			continue
+		case operation == "api_request":
+			if _, ok := apiRequestStatus(entry); ok {
+				pending.APIRequests++
+			}
+			continue
+		case operation == "search_complete":
+			data, _ := entry.Data["search_data"].(map[string]interface{})
+			query, _ := data["query"].(string)
+			success := recordSucceeded(data)
+			resultCount, _ := fieldNumber(data, "result_count")
+			event.Summary = query
+			event.Duration = timelineDuration(data)
+			event.Results = int(resultCount)
+			event.HasResults = true
+			event.Failed = !success
+		case operation == "batch_retrieval_complete":
+			data, _ := entry.Data["batch_data"].(map[string]interface{})
+			query, _ := data["query"].(string)
+			success := recordSucceeded(data)
+			files, _ := fieldNumber(data, "files_success")
+			event.Summary = query
+			event.Duration = timelineDuration(data)
+			event.Results = int(files)
+			event.HasResults = true
+			event.Failed = !success
+		case entry.Level == LogLevelError:
+			event.Summary = entry.Message
+			event.Failed = true
+		default:
+			continue
+		}
+
+		event.Time = entry.Timestamp
+		event.Offset = entry.Timestamp.Sub(timeline.Start)
+		event.CacheHits, event.CacheMisses, event.APIRequests = pending.CacheHits, pending.CacheMisses, pending.APIRequests
+		pending = TimelineEvent{}
+
+		if maxEvents > 0 && len(timeline.Events) >= maxEvents {
+			timeline.Truncated++
+			continue
+		}
+		timeline.Events = append(timeline.Events, event)
+	}
+	return timeline
+}
+
 func (la *LogAnalyzer) GenerateReport(logFileName string) *AnalysisReport {
 	report := &AnalysisReport{
-		GeneratedAt:         time.Now(),
-		LogFileName:         logFileName,
-		TotalEntries:        len(la.entries),
-		TotalSessions:       len(la.sessions),
-		FilterEffectiveness: make(map[string]float64),
+		GeneratedAt:   time.Now(),
+		LogFileName:   logFileName,
+		TotalEntries:  len(la.entries),
+		TotalSessions: len(la.sessions),
+		ParseHealth:   la.health,
 	}
 	
 	// Analyze search patterns
@@ -410,6 +938,11 @@ func (la *LogAnalyzer) GenerateReport(logFileName string) *AnalysisReport {
 	if len(report.Sessions) > 20 {
 		report.Sessions = report.Sessions[:20]
 	}
+	report.FilterEffectiveness = la.AnalyzeFilterEffectiveness()
+	report.CacheSavings = la.AnalyzeCacheSavings()
+	for _, session := range report.Sessions {
+		report.Timelines = append(report.Timelines, la.BuildSessionTimeline(session.SessionID))
+	}
 	
 	// Calculate statistics
 	var totalSearches, zeroResults int
@@ -421,19 +954,20 @@ func (la *LogAnalyzer) GenerateReport(logFileName string) *AnalysisReport {
 			if data, ok := entry.Data["search_data"].(map[string]interface{}); ok {
 				totalSearches++
 				
-				if resultCount, ok := data["result_count"].(float64); ok && resultCount == 0 {
+				if resultCount, ok := fieldNumber(data, "result_count"); ok && resultCount == 0 {
 					zeroResults++
 				}
 				
-				if duration, ok := data["duration_ms"].(float64); ok {
-					totalDuration += time.Duration(duration) * time.Millisecond
+				// The server encodes durations as nanoseconds despite the field name
+				if duration, ok := fieldNumber(data, "duration_ms"); ok {
+					totalDuration += time.Duration(duration)
 				}
 				
-				if apiReqs, ok := data["api_requests"].(float64); ok {
+				if apiReqs, ok := fieldNumber(data, "api_requests"); ok {
 					totalAPIRequests += int(apiReqs)
 				}
 				
-				if !data["success"].(bool) {
+				if !recordSucceeded(data) {
 					errors++
 				}
 			}
@@ -463,82 +997,1169 @@ func (la *LogAnalyzer) GenerateReport(logFileName string) *AnalysisReport {
 }
 
 //================================================================================
-// HTML Report Generation
+// Recovery Knowledge Base Export
 //================================================================================
 
-func (la *LogAnalyzer) GenerateHTMLReport(report *AnalysisReport, outputPath string) error {
-	tmplPath := "templates/dashboard_template.html"
-	
-	tmpl, err := template.ParseFiles(tmplPath)
-	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+// BuildRecoveryKnowledgeBase collects successful failed→recovery transitions across all
+// sessions. Each pair is counted once per session in which it occurred.
+func (la *LogAnalyzer) BuildRecoveryKnowledgeBase() *RecoveryKnowledgeBase {
+	type pair struct{ failed, recovery string }
+	byPair := make(map[pair]*RecoverySuggestion)
+
+	for _, session := range la.AnalyzeClientBehavior() {
+		seen := make(map[pair]bool)
+		for _, recovery := range session.Recoveries {
+			if !recovery.Successful {
+				continue
+			}
+			key := pair{recovery.FailedQuery, recovery.RecoveryQuery}
+			suggestion := byPair[key]
+			if suggestion == nil {
+				suggestion = &RecoverySuggestion{FailedQuery: key.failed, RecoveryQuery: key.recovery}
+				byPair[key] = suggestion
+			}
+			if !seen[key] {
+				seen[key] = true
+				suggestion.Occurrences++
+			}
+			if recovery.At.After(suggestion.LastSeen) {
+				suggestion.LastSeen = recovery.At
+			}
+		}
 	}
-	
-	file, err := os.Create(outputPath)
+
+	kb := &RecoveryKnowledgeBase{GeneratedAt: time.Now(), Suggestions: make([]RecoverySuggestion, 0, len(byPair))}
+	for _, suggestion := range byPair {
+		kb.Suggestions = append(kb.Suggestions, *suggestion)
+	}
+	sort.Slice(kb.Suggestions, func(i, j int) bool {
+		a, b := kb.Suggestions[i], kb.Suggestions[j]
+		if a.FailedQuery != b.FailedQuery {
+			return a.FailedQuery < b.FailedQuery
+		}
+		if a.Occurrences != b.Occurrences {
+			return a.Occurrences > b.Occurrences
+		}
+		return a.RecoveryQuery < b.RecoveryQuery
+	})
+	return kb
+}
+
+// exportKnowledgeBase analyzes every log under logPath together and writes the recovery
+// knowledge base to outputPath.
+func exportKnowledgeBase(logPath, outputPath string) error {
+	analyzer := NewLogAnalyzer()
+	if err := analyzer.LoadLogs(logPath); err != nil {
+		return fmt.Errorf("failed to load logs from %s: %w", logPath, err)
+	}
+
+	kb := analyzer.BuildRecoveryKnowledgeBase()
+	data, err := json.MarshalIndent(kb, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return fmt.Errorf("failed to encode knowledge base: %w", err)
 	}
-	defer file.Close()
-	
-	return tmpl.Execute(file, report)
+	if dir := filepath.Dir(outputPath); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create knowledge base directory: %w", err)
+		}
+	}
+	// Write then rename so a running server never reads a half-written file
+	tmpPath := outputPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write knowledge base: %w", err)
+	}
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		return fmt.Errorf("failed to write knowledge base: %w", err)
+	}
+
+	log.Printf("✅ Knowledge base with %d recovery suggestions saved to: %s", len(kb.Suggestions), outputPath)
+	return nil
 }
 
 //================================================================================
-// Main Function
+// Time Window Comparison
 //================================================================================
 
-func processLogFile(logFilePath string) error {
-	analyzer := NewLogAnalyzer()
-	
-	if err := analyzer.LoadLogs(logFilePath); err != nil {
-		return fmt.Errorf("failed to load logs from %s: %w", logFilePath, err)
+// TimeWindow is a half-open [Since, Until) period; a zero bound is unbounded.
+type TimeWindow struct {
+	Label string
+	Since time.Time
+	Until time.Time
+}
+
+type QueryCount struct {
+	Query string
+	Count int
+}
+
+type WindowStats struct {
+	Window         TimeWindow
+	Searches       int
+	ZeroResults    int
+	Errors         int
+	ZeroResultRate float64
+	ErrorRate      float64
+	P50, P90, P99  time.Duration
+	TopQueries     []QueryCount
+}
+
+// parseWindowBound parses an RFC 3339 timestamp or a YYYY-MM-DD date. A date used as the
+// end of a window covers that whole day.
+func parseWindowBound(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
 	}
-	
-	// Generate report filename from log filename
-	logFileName := filepath.Base(logFilePath)
-	reportFileName := strings.TrimSuffix(logFileName, filepath.Ext(logFileName)) + ".html"
-	reportPath := filepath.Join("reports", reportFileName)
-	
-	log.Printf("Generating analysis report for: %s", logFileName)
-	report := analyzer.GenerateReport(logFileName)
-	
-	log.Printf("Analysis Summary for %s:", logFileName)
-	log.Printf("- Total entries: %d", report.TotalEntries)
-	log.Printf("- Total sessions: %d", report.TotalSessions)
-	log.Printf("- Total searches: %d", report.TotalSearches)
-	log.Printf("- Zero result rate: %.1f%%", report.ZeroResultRate)
-	log.Printf("- Cache hit rate: %.1f%%", report.CacheHitRate)
-	log.Printf("- Average duration: %v", report.AvgDuration)
-	
-	if err := os.MkdirAll("reports", 0755); err != nil {
-		return fmt.Errorf("failed to create reports directory: %w", err)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
 	}
-	
-	if err := analyzer.GenerateHTMLReport(report, reportPath); err != nil {
-		return fmt.Errorf("failed to generate HTML report for %s: %w", logFileName, err)
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use YYYY-MM-DD or RFC 3339", value)
 	}
-	
-	log.Printf("✅ Report saved to: %s", reportPath)
-	return nil
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Log Analyzer - Generate HTML reports from log files")
-		fmt.Println("")
-		fmt.Println("Usage:")
-		fmt.Println("  go run main.go <log-file>       # Analyze single log file")
-		fmt.Println("  go run main.go <log-directory>  # Analyze all .jsonl files in directory")
+// parseTimeWindow parses "since..until", where either side may be empty.
+func parseTimeWindow(value string) (TimeWindow, error) {
+	since, until, ok := strings.Cut(value, "..")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("invalid window %q: expected since..until", value)
+	}
+	window := TimeWindow{Label: value}
+	var err error
+	if window.Since, err = parseWindowBound(since, false); err != nil {
+		return TimeWindow{}, err
+	}
+	if window.Until, err = parseWindowBound(until, true); err != nil {
+		return TimeWindow{}, err
+	}
+	if !window.Since.IsZero() && !window.Until.IsZero() && !window.Since.Before(window.Until) {
+		return TimeWindow{}, fmt.Errorf("invalid window %q: since must be before until", value)
+	}
+	return window, nil
+}
+
+func (w TimeWindow) Contains(t time.Time) bool {
+	return (w.Since.IsZero() || !t.Before(w.Since)) && (w.Until.IsZero() || t.Before(w.Until))
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(float64(len(sorted))*p/100)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// AnalyzeWindow computes search statistics for completed searches inside the window.
+func (la *LogAnalyzer) AnalyzeWindow(window TimeWindow) WindowStats {
+	stats := WindowStats{Window: window}
+	var durations []time.Duration
+	counts := make(map[string]int)
+
+	for _, entry := range la.entries {
+		if entry.Tool != "searchCode" || !window.Contains(entry.Timestamp) {
+			continue
+		}
+		data, ok := entry.Data["search_data"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stats.Searches++
+		if query, _ := data["query"].(string); query != "" {
+			counts[query]++
+		}
+		if !recordSucceeded(data) {
+			stats.Errors++
+		} else if resultCount, _ := fieldNumber(data, "result_count"); resultCount == 0 {
+			stats.ZeroResults++
+		}
+		// The server encodes durations as nanoseconds despite the field name
+		if duration, ok := data["duration_ms"].(float64); ok {
+			durations = append(durations, time.Duration(duration))
+		}
+	}
+
+	if stats.Searches > 0 {
+		stats.ZeroResultRate = float64(stats.ZeroResults) / float64(stats.Searches) * 100
+		stats.ErrorRate = float64(stats.Errors) / float64(stats.Searches) * 100
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.P50, stats.P90, stats.P99 = percentile(durations, 50), percentile(durations, 90), percentile(durations, 99)
+
+	for query, count := range counts {
+		stats.TopQueries = append(stats.TopQueries, QueryCount{Query: query, Count: count})
+	}
+	sort.Slice(stats.TopQueries, func(i, j int) bool {
+		if stats.TopQueries[i].Count != stats.TopQueries[j].Count {
+			return stats.TopQueries[i].Count > stats.TopQueries[j].Count
+		}
+		return stats.TopQueries[i].Query < stats.TopQueries[j].Query
+	})
+	if len(stats.TopQueries) > 10 {
+		stats.TopQueries = stats.TopQueries[:10]
+	}
+	return stats
+}
+
+// formatComparison renders the two windows side by side with the change from A to B.
+func formatComparison(a, b WindowStats) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Comparing A = %s with B = %s\n\n", a.Window.Label, b.Window.Label)
+	fmt.Fprintf(&sb, "%-18s %12s %12s %12s\n", "Metric", "A", "B", "Delta")
+	fmt.Fprintf(&sb, "%-18s %12d %12d %+12d\n", "Searches", a.Searches, b.Searches, b.Searches-a.Searches)
+	fmt.Fprintf(&sb, "%-18s %11.1f%% %11.1f%% %+11.1fpp\n", "Zero-result rate", a.ZeroResultRate, b.ZeroResultRate, b.ZeroResultRate-a.ZeroResultRate)
+	fmt.Fprintf(&sb, "%-18s %11.1f%% %11.1f%% %+11.1fpp\n", "Error rate", a.ErrorRate, b.ErrorRate, b.ErrorRate-a.ErrorRate)
+	for _, row := range []struct {
+		name string
+		a, b time.Duration
+	}{{"Latency p50", a.P50, b.P50}, {"Latency p90", a.P90, b.P90}, {"Latency p99", a.P99, b.P99}} {
+		delta := (row.b - row.a).Round(time.Millisecond)
+		sign := "+"
+		if delta < 0 {
+			sign = ""
+		}
+		fmt.Fprintf(&sb, "%-18s %12v %12v %12s\n", row.name, row.a.Round(time.Millisecond), row.b.Round(time.Millisecond), sign+delta.String())
+	}
+
+	countsA := make(map[string]int)
+	countsB := make(map[string]int)
+	var queries []string
+	for _, q := range a.TopQueries {
+		countsA[q.Query] = q.Count
+		queries = append(queries, q.Query)
+	}
+	for _, q := range b.TopQueries {
+		countsB[q.Query] = q.Count
+		if _, ok := countsA[q.Query]; !ok {
+			queries = append(queries, q.Query)
+		}
+	}
+	fmt.Fprintf(&sb, "\nTop queries (top 10 of either window)\n")
+	if len(queries) == 0 {
+		fmt.Fprintf(&sb, "  none\n")
+	}
+	for _, q := range queries {
+		fmt.Fprintf(&sb, "  %-40s %5d %5d %+6d\n", q, countsA[q], countsB[q], countsB[q]-countsA[q])
+	}
+	return sb.String()
+}
+
+// runComparison loads the logs once and prints the comparison of the two windows.
+func runComparison(logPath, first, second string) error {
+	windowA, err := parseTimeWindow(first)
+	if err != nil {
+		return err
+	}
+	windowB, err := parseTimeWindow(second)
+	if err != nil {
+		return err
+	}
+	analyzer := NewLogAnalyzer()
+	if err := analyzer.LoadLogs(logPath); err != nil {
+		return fmt.Errorf("failed to load logs from %s: %w", logPath, err)
+	}
+	fmt.Print(formatComparison(analyzer.AnalyzeWindow(windowA), analyzer.AnalyzeWindow(windowB)))
+	return nil
+}
+
+//================================================================================
+// OpenMetrics Export
+//================================================================================
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// searchDurationBuckets are the histogram upper bounds for search durations, in seconds.
+var searchDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// escapeLabelValue escapes a label value for the OpenMetrics text format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeCounterFamily writes one counter family with a single label, sorted by label value.
+func writeCounterFamily(w io.Writer, name, help, label string, values map[string]int) {
+	fmt.Fprintf(w, "# TYPE %s counter\n# HELP %s %s\n", name, name, help)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s_total{%s=\"%s\"} %d\n", name, label, escapeLabelValue(k), values[k])
+	}
+}
+
+// WriteOpenMetrics converts aggregate log metrics into the OpenMetrics exposition format.
+// All values are derived from the loaded logs, so counters only grow as logs are appended.
+func (la *LogAnalyzer) WriteOpenMetrics(w io.Writer) error {
+	searches := map[string]int{}
+	apiRequests := map[string]int{}
+	cacheLookups := map[string]int{}
+	batches := map[string]int{}
+	batchFiles := map[string]int{}
+	levels := map[string]int{}
+	var apiBytes int64
+	var apiRetries int
+	bucketCounts := make([]int, len(searchDurationBuckets))
+	var durationSum float64
+	var durationCount int
+	var lastEntry time.Time
+
+	for _, entry := range la.entries {
+		levels[string(entry.Level)]++
+		if entry.Timestamp.After(lastEntry) {
+			lastEntry = entry.Timestamp
+		}
+		operation, _ := entry.Data["operation"].(string)
+		switch {
+		case entry.Tool == "searchCode" && operation == "search_complete":
+			data, _ := entry.Data["search_data"].(map[string]interface{})
+			success := recordSucceeded(data)
+			resultCount, _ := fieldNumber(data, "result_count")
+			switch {
+			case !success:
+				searches["error"]++
+			case resultCount == 0:
+				searches["zero_results"]++
+			default:
+				searches["success"]++
+			}
+			if duration, ok := data["duration_ms"].(float64); ok {
+				seconds := time.Duration(duration).Seconds() // Nanoseconds despite the field name
+				durationSum += seconds
+				durationCount++
+				for i, bound := range searchDurationBuckets {
+					if seconds <= bound {
+						bucketCounts[i]++
+					}
+				}
+			}
+		case entry.Tool == "batchRetrievalTool" && operation == "batch_retrieval_complete":
+			data, _ := entry.Data["batch_data"].(map[string]interface{})
+			if recordSucceeded(data) {
+				batches["success"]++
+			} else {
+				batches["error"]++
+			}
+			filesSuccess, _ := fieldNumber(data, "files_success")
+			filesError, _ := fieldNumber(data, "files_error")
+			batchFiles["success"] += int(filesSuccess)
+			batchFiles["error"] += int(filesError)
+		case entry.Tool == "api" && operation == "api_request":
+			if status, ok := apiRequestStatus(entry); ok {
+				apiRequests[status]++
+				bytes, _ := fieldNumber(entry.Data, "bytes")
+				retries, _ := fieldNumber(entry.Data, "retries")
+				apiBytes += int64(bytes)
+				apiRetries += int(retries)
+			}
+		case entry.Tool == "cache" && operation == "cache_operation":
+			if hit, _ := entry.Data["hit"].(bool); hit {
+				cacheLookups["hit"]++
+			} else {
+				cacheLookups["miss"]++
+			}
+		}
+	}
+
+	writeCounterFamily(w, "grepapp_log_searches", "Completed searchCode calls by outcome.", "outcome", searches)
+	fmt.Fprintf(w, "# TYPE grepapp_log_search_duration_seconds histogram\n# HELP grepapp_log_search_duration_seconds Duration of completed searchCode calls.\n")
+	for i, bound := range searchDurationBuckets {
+		fmt.Fprintf(w, "grepapp_log_search_duration_seconds_bucket{le=\"%g\"} %d\n", bound, bucketCounts[i])
+	}
+	fmt.Fprintf(w, "grepapp_log_search_duration_seconds_bucket{le=\"+Inf\"} %d\n", durationCount)
+	fmt.Fprintf(w, "grepapp_log_search_duration_seconds_sum %g\n", durationSum)
+	fmt.Fprintf(w, "grepapp_log_search_duration_seconds_count %d\n", durationCount)
+	writeCounterFamily(w, "grepapp_log_batch_retrievals", "Completed batchRetrievalTool calls by outcome.", "outcome", batches)
+	writeCounterFamily(w, "grepapp_log_batch_files", "Files returned by batch retrieval by result.", "result", batchFiles)
+	writeCounterFamily(w, "grepapp_log_api_requests", "Upstream API requests by HTTP status.", "status", apiRequests)
+	fmt.Fprintf(w, "# TYPE grepapp_log_api_response_bytes counter\n# UNIT grepapp_log_api_response_bytes bytes\n# HELP grepapp_log_api_response_bytes Upstream API response body bytes.\n")
+	fmt.Fprintf(w, "grepapp_log_api_response_bytes_total %d\n", apiBytes)
+	fmt.Fprintf(w, "# TYPE grepapp_log_api_retries counter\n# HELP grepapp_log_api_retries Upstream API request retries.\n")
+	fmt.Fprintf(w, "grepapp_log_api_retries_total %d\n", apiRetries)
+	writeCounterFamily(w, "grepapp_log_cache_lookups", "Search page cache lookups by result.", "result", cacheLookups)
+	writeCounterFamily(w, "grepapp_log_entries", "Log entries by level.", "level", levels)
+	fmt.Fprintf(w, "# TYPE grepapp_log_sessions gauge\n# HELP grepapp_log_sessions Distinct server sessions in the logs.\n")
+	fmt.Fprintf(w, "grepapp_log_sessions %d\n", len(la.sessions))
+	if !lastEntry.IsZero() {
+		fmt.Fprintf(w, "# TYPE grepapp_log_last_entry_timestamp_seconds gauge\n# UNIT grepapp_log_last_entry_timestamp_seconds seconds\n# HELP grepapp_log_last_entry_timestamp_seconds Time of the newest log entry.\n")
+		fmt.Fprintf(w, "grepapp_log_last_entry_timestamp_seconds %.3f\n", float64(lastEntry.UnixMilli())/1000)
+	}
+	_, err := fmt.Fprint(w, "# EOF\n")
+	return err
+}
+
+// exportOpenMetrics writes the metrics for all logs under logPath to outputPath, or to
+// stdout when outputPath is "-".
+func exportOpenMetrics(logPath, outputPath string) error {
+	analyzer := NewLogAnalyzer()
+	if err := analyzer.LoadLogs(logPath); err != nil {
+		return fmt.Errorf("failed to load logs from %s: %w", logPath, err)
+	}
+	if outputPath == "-" {
+		return analyzer.WriteOpenMetrics(os.Stdout)
+	}
+
+	// Write then rename so a textfile collector never reads a partial file
+	tmpPath := outputPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	if err := analyzer.WriteOpenMetrics(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	log.Printf("✅ OpenMetrics saved to: %s", outputPath)
+	return nil
+}
+
+// serveOpenMetrics serves /metrics on addr, re-reading the logs on every scrape.
+func serveOpenMetrics(logPath, addr string) error {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		analyzer := NewLogAnalyzer()
+		if err := analyzer.LoadLogs(logPath); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", openMetricsContentType)
+		analyzer.WriteOpenMetrics(w)
+	})
+	log.Printf("📈 Serving OpenMetrics for %s on http://%s/metrics", logPath, addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+//================================================================================
+// OpenTelemetry Export
+//================================================================================
+
+// otlpSessionsPerRequest bounds the size of each OTLP export request.
+const otlpSessionsPerRequest = 50
+
+// OTLP/HTTP JSON encoding of trace data. IDs are hex strings and times are nanoseconds
+// since the epoch encoded as strings, per the OTLP JSON mapping.
+type otlpTraceData struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 1 ok, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string        `json:"key"`
+	Value otlpAttrValue `json:"value"`
+}
+
+type otlpAttrValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAttrValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int) otlpAttribute {
+	v := fmt.Sprint(value)
+	return otlpAttribute{Key: key, Value: otlpAttrValue{IntValue: &v}}
+}
+
+func otlpBool(key string, value bool) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAttrValue{BoolValue: &value}}
+}
+
+func otlpTime(t time.Time) string {
+	return fmt.Sprint(t.UnixNano())
+}
+
+// otlpID derives a stable ID of n bytes from parts, so exporting the same logs twice
+// produces the same traces instead of duplicates.
+func otlpID(n int, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:n])
+}
+
+// BuildSessionSpans converts a session into one trace: a root span covering the session
+// and a child span per tool call. Errors logged outside a tool call become events on the
+// root span. Tool calls are logged on completion, so each span ends at its log entry.
+func (la *LogAnalyzer) BuildSessionSpans(sessionID string) []otlpSpan {
+	timeline := la.replaySession(sessionID, 0)
+	if timeline.Start.IsZero() {
+		return nil
+	}
+	traceID := otlpID(16, sessionID)
+	root := otlpSpan{
+		TraceID:    traceID,
+		SpanID:     otlpID(8, sessionID, "session"),
+		Name:       "session",
+		Kind:       otlpSpanKindInternal,
+		Attributes: []otlpAttribute{otlpString("session.id", sessionID)},
+		Status:     &otlpStatus{Code: otlpStatusOK},
+	}
+
+	start, end := timeline.Start, timeline.Start.Add(timeline.Duration)
+	spans := []otlpSpan{}
+	searches, failures := 0, 0
+	for i, event := range timeline.Events {
+		if !event.HasResults {
+			root.Events = append(root.Events, otlpEvent{
+				TimeUnixNano: otlpTime(event.Time),
+				Name:         "error",
+				Attributes:   []otlpAttribute{otlpString("tool", event.Tool), otlpString("message", event.Summary)},
+			})
+			failures++
+			continue
+		}
+
+		spanStart := event.Time.Add(-event.Duration)
+		if spanStart.Before(start) {
+			start = spanStart
+		}
+		span := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            otlpID(8, sessionID, fmt.Sprint(i)),
+			ParentSpanID:      root.SpanID,
+			Name:              event.Tool,
+			Kind:              otlpSpanKindServer,
+			StartTimeUnixNano: otlpTime(spanStart),
+			EndTimeUnixNano:   otlpTime(event.Time),
+			Attributes: []otlpAttribute{
+				otlpString("session.id", sessionID),
+				otlpString("grepapp.operation", event.Operation),
+				otlpString("grepapp.query", event.Summary),
+				otlpInt("grepapp.results", event.Results),
+				otlpInt("grepapp.cache_hits", event.CacheHits),
+				otlpInt("grepapp.cache_misses", event.CacheMisses),
+				otlpInt("grepapp.api_requests", event.APIRequests),
+			},
+			Status: &otlpStatus{Code: otlpStatusOK},
+		}
+		if event.Failed {
+			span.Status = &otlpStatus{Code: otlpStatusError, Message: "tool call failed"}
+			failures++
+		}
+		if event.Operation == "search_complete" {
+			searches++
+		}
+		spans = append(spans, span)
+	}
+
+	root.StartTimeUnixNano = otlpTime(start)
+	root.EndTimeUnixNano = otlpTime(end)
+	root.Attributes = append(root.Attributes,
+		otlpInt("grepapp.tool_calls", len(spans)),
+		otlpInt("grepapp.searches", searches),
+		otlpBool("grepapp.had_failures", failures > 0),
+	)
+	if failures > 0 {
+		root.Status = &otlpStatus{Code: otlpStatusError, Message: fmt.Sprintf("%d failed tool calls or errors", failures)}
+	}
+	return append([]otlpSpan{root}, spans...)
+}
+
+// otlpTracesURL appends the standard /v1/traces path when the endpoint has no path.
+func otlpTracesURL(endpoint string) string {
+	trimmed := strings.TrimSuffix(endpoint, "/")
+	if i := strings.Index(trimmed, "://"); i >= 0 && !strings.Contains(trimmed[i+3:], "/") {
+		return trimmed + "/v1/traces"
+	}
+	return endpoint
+}
+
+// parseOTLPHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS form key=value,key=value.
+func parseOTLPHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q (expected key=value)", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+// exportOTLP pushes every session under logPath to an OTLP/HTTP collector as traces,
+// in batches of otlpSessionsPerRequest sessions.
+func exportOTLP(logPath, endpoint, headerValue, serviceName string) error {
+	headers, err := parseOTLPHeaders(headerValue)
+	if err != nil {
+		return err
+	}
+	analyzer := NewLogAnalyzer()
+	if err := analyzer.LoadLogs(logPath); err != nil {
+		return fmt.Errorf("failed to load logs from %s: %w", logPath, err)
+	}
+
+	sessionIDs := make([]string, 0, len(analyzer.sessions))
+	for id := range analyzer.sessions {
+		sessionIDs = append(sessionIDs, id)
+	}
+	sort.Strings(sessionIDs)
+
+	url := otlpTracesURL(endpoint)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resource := otlpResource{Attributes: []otlpAttribute{
+		otlpString("service.name", serviceName),
+		otlpString("telemetry.source", "log-analyzer"),
+	}}
+	totalSpans := 0
+	for i := 0; i < len(sessionIDs); i += otlpSessionsPerRequest {
+		var spans []otlpSpan
+		for _, id := range sessionIDs[i:min(i+otlpSessionsPerRequest, len(sessionIDs))] {
+			spans = append(spans, analyzer.BuildSessionSpans(id)...)
+		}
+		if len(spans) == 0 {
+			continue
+		}
+		payload := otlpTraceData{ResourceSpans: []otlpResourceSpans{{
+			Resource:   resource,
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "grep-app-mcp/analyzer"}, Spans: spans}},
+		}}}
+		if err := postOTLP(client, url, headers, payload); err != nil {
+			return err
+		}
+		totalSpans += len(spans)
+	}
+	log.Printf("🔭 Exported %d sessions as %d spans to %s", len(sessionIDs), totalSpans, url)
+	return nil
+}
+
+// postOTLP sends one export request and fails on any non-2xx response.
+func postOTLP(client *http.Client, url string, headers map[string]string, payload otlpTraceData) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+//================================================================================
+// Terminal Subcommands
+//================================================================================
+
+// subcommand is a terminal query that prints a table instead of generating a dashboard.
+type subcommand struct {
+	summary string
+	run     func(la *LogAnalyzer, w *tabwriter.Writer, opts subcommandOptions)
+}
+
+type subcommandOptions struct {
+	limit      int
+	minQueries int
+}
+
+var subcommands = map[string]subcommand{
+	"top-queries":  {"Most frequent queries with success rates", printTopQueries},
+	"zero-results": {"Queries that returned no results", printZeroResults},
+	"sessions":     {"Sessions with query, success and recovery counts", printSessions},
+	"errors":       {"Error log entries grouped by tool and message", printErrors},
+	"clients":      {"MCP client sessions with request, search and zero-result counts", printClients},
+	"retrievals":   {"File retrievals from the server's audit log, per repository and per session", printRetrievals},
+}
+
+// parseSince parses a --since value: a relative age such as 7d or 12h, or an absolute
+// YYYY-MM-DD date or RFC 3339 timestamp.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		if _, err := fmt.Sscan(days, &n); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return parseWindowBound(value, false)
+}
+
+// filterSince drops entries logged before since.
+func (la *LogAnalyzer) filterSince(since time.Time) {
+	entries := la.entries[:0]
+	sessions := make(map[string][]LogEntry)
+	for _, entry := range la.entries {
+		if entry.Timestamp.Before(since) {
+			continue
+		}
+		entries = append(entries, entry)
+		sessions[entry.SessionID] = append(sessions[entry.SessionID], entry)
+	}
+	la.entries = entries
+	la.sessions = sessions
+}
+
+// parseInterspersed parses flags that may appear before or after positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// runSubcommand loads the logs quietly and prints the subcommand's table to stdout.
+func runSubcommand(name string, args []string) error {
+	cmd := subcommands[name]
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	since := fs.String("since", "", "Only include entries newer than this age (7d, 12h) or date (YYYY-MM-DD)")
+	limit := fs.Int("limit", 20, "Maximum rows to print; 0 prints all")
+	minQueries := fs.Int("min-queries", 0, "sessions, clients: only sessions with at least this many queries")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: analyzer %s [flags] <log-file|log-directory>\n\n%s.\n\n", name, cmd.summary)
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	log.SetOutput(io.Discard) // Per-file progress lines would clutter the table
+	analyzer := NewLogAnalyzer()
+	err = analyzer.LoadLogs(positional[0])
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		return err
+	}
+	if *since != "" {
+		cutoff, err := parseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		analyzer.filterSince(cutoff)
+	}
+	if health := analyzer.health; !health.Healthy() {
+		fmt.Fprintf(os.Stderr, "warning: %d malformed, %d oversized lines and %d incomplete records skipped or tolerated\n", health.Malformed, health.Oversized, health.IncompleteRecords)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	cmd.run(analyzer, w, subcommandOptions{limit: *limit, minQueries: *minQueries})
+	return w.Flush()
+}
+
+// truncateRows limits n rows to limit, where 0 means no limit.
+func truncateRows(n, limit int) int {
+	if limit > 0 && n > limit {
+		return limit
+	}
+	return n
+}
+
+func printTopQueries(la *LogAnalyzer, w *tabwriter.Writer, opts subcommandOptions) {
+	queries := la.AnalyzeSearchPatterns()
+	fmt.Fprintln(w, "QUERY\tCOUNT\tSUCCESS\tAVG RESULTS")
+	for _, q := range queries[:truncateRows(len(queries), opts.limit)] {
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%.1f\n", q.Query, q.Count, q.SuccessRate, q.AvgResults)
+	}
+}
+
+func printZeroResults(la *LogAnalyzer, w *tabwriter.Writer, opts subcommandOptions) {
+	queries := la.AnalyzeZeroResultQueries()
+	fmt.Fprintln(w, "QUERY\tZERO RESULTS\tCOUNT\tFAILURE")
+	for _, q := range queries[:truncateRows(len(queries), opts.limit)] {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\n", q.Query, q.ZeroResults, q.Count, q.FailureRate)
+	}
+}
+
+func printSessions(la *LogAnalyzer, w *tabwriter.Writer, opts subcommandOptions) {
+	var sessions []SessionAnalysis
+	for _, session := range la.AnalyzeClientBehavior() {
+		if session.TotalQueries >= opts.minQueries {
+			sessions = append(sessions, session)
+		}
+	}
+	fmt.Fprintln(w, "SESSION\tDURATION\tQUERIES\tSUCCESSFUL\tZERO RESULTS\tRECOVERIES")
+	for _, s := range sessions[:truncateRows(len(sessions), opts.limit)] {
+		fmt.Fprintf(w, "%s\t%v\t%d\t%d\t%d\t%d\n", shortID(s.SessionID), s.Duration.Round(time.Second), s.TotalQueries, s.SuccessQueries, len(s.ZeroResults), len(s.Recoveries))
+	}
+}
+
+func printClients(la *LogAnalyzer, w *tabwriter.Writer, opts subcommandOptions) {
+	var clients []ClientSessionData
+	for _, client := range la.AnalyzeClientSessions() {
+		if client.SuccessResults+client.ZeroResults >= opts.minQueries {
+			clients = append(clients, client)
+		}
+	}
+	fmt.Fprintln(w, "CLIENT\tFIRST SEEN\tLAST SEEN\tREQUESTS\tSEARCHES\tWITH RESULTS\tZERO RESULTS")
+	for _, c := range clients[:truncateRows(len(clients), opts.limit)] {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n", shortID(c.SessionID), c.FirstSeen.Format(time.RFC3339), c.LastSeen.Format(time.RFC3339), c.TotalRequests, c.SuccessResults+c.ZeroResults, c.SuccessResults, c.ZeroResults)
+	}
+}
+
+func printErrors(la *LogAnalyzer, w *tabwriter.Writer, opts subcommandOptions) {
+	type errorGroup struct {
+		tool, message string
+		count         int
+		lastSeen      time.Time
+	}
+	groups := make(map[[2]string]*errorGroup)
+	for _, entry := range la.entries {
+		if entry.Level != LogLevelError {
+			continue
+		}
+		key := [2]string{entry.Tool, entry.Message}
+		group := groups[key]
+		if group == nil {
+			group = &errorGroup{tool: entry.Tool, message: entry.Message}
+			groups[key] = group
+		}
+		group.count++
+		if entry.Timestamp.After(group.lastSeen) {
+			group.lastSeen = entry.Timestamp
+		}
+	}
+
+	sorted := make([]*errorGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].lastSeen.After(sorted[j].lastSeen)
+	})
+	fmt.Fprintln(w, "COUNT\tTOOL\tLAST SEEN\tMESSAGE")
+	for _, g := range sorted[:truncateRows(len(sorted), opts.limit)] {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", g.count, g.tool, g.lastSeen.Format("2006-01-02 15:04:05"), strings.ReplaceAll(g.message, "\n", " "))
+	}
+}
+
+// retrievalGroup totals the audited retrievals of one repository or session.
+type retrievalGroup struct {
+	name, tenant string
+	files        int
+	bytes        int64
+	failed       int
+	redacted     int
+	others       map[string]bool // Sessions of a repository, repositories of a session
+	last         time.Time
+}
+
+func (g *retrievalGroup) add(entry LogEntry, other string) {
+	g.files++
+	bytes, _ := fieldNumber(entry.Data, "bytes")
+	g.bytes += int64(bytes)
+	if fieldString(entry.Data, "error") != "" {
+		g.failed++
+	}
+	redacted, _ := fieldNumber(entry.Data, "redacted_secrets")
+	g.redacted += int(redacted)
+	g.others[other] = true
+	if entry.Timestamp.After(g.last) {
+		g.last = entry.Timestamp
+	}
+}
+
+// sortedRetrievalGroups orders groups by retrieved files, most first.
+func sortedRetrievalGroups(groups map[string]*retrievalGroup) []*retrievalGroup {
+	sorted := make([]*retrievalGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].files != sorted[j].files {
+			return sorted[i].files > sorted[j].files
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	return sorted
+}
+
+// printRetrievals summarizes file_retrieval audit records per repository, then per client
+// session. Records without a client session are grouped by server session.
+func printRetrievals(la *LogAnalyzer, w *tabwriter.Writer, opts subcommandOptions) {
+	repos := make(map[string]*retrievalGroup)
+	sessions := make(map[string]*retrievalGroup)
+	for _, entry := range la.entries {
+		if fieldString(entry.Data, "operation") != "file_retrieval" {
+			continue
+		}
+		repo := fieldString(entry.Data, "repo")
+		session := fieldString(entry.Data, "client_session")
+		if session == "" {
+			session = entry.SessionID
+		}
+		if repos[repo] == nil {
+			repos[repo] = &retrievalGroup{name: repo, others: make(map[string]bool)}
+		}
+		repos[repo].add(entry, session)
+		if sessions[session] == nil {
+			sessions[session] = &retrievalGroup{name: session, tenant: fieldString(entry.Data, "tenant"), others: make(map[string]bool)}
+		}
+		sessions[session].add(entry, repo)
+	}
+
+	byRepo := sortedRetrievalGroups(repos)
+	fmt.Fprintln(w, "REPO\tFILES\tBYTES\tFAILED\tREDACTED\tSESSIONS\tLAST RETRIEVED")
+	for _, g := range byRepo[:truncateRows(len(byRepo), opts.limit)] {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", g.name, g.files, g.bytes, g.failed, g.redacted, len(g.others), g.last.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintln(w)
+	bySession := sortedRetrievalGroups(sessions)
+	fmt.Fprintln(w, "SESSION\tTENANT\tFILES\tBYTES\tFAILED\tREDACTED\tREPOS\tLAST RETRIEVED")
+	for _, g := range bySession[:truncateRows(len(bySession), opts.limit)] {
+		tenant := g.tenant
+		if tenant == "" {
+			tenant = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", shortID(g.name), tenant, g.files, g.bytes, g.failed, g.redacted, len(g.others), g.last.Format("2006-01-02 15:04:05"))
+	}
+}
+
+//================================================================================
+// HTML Report Generation
+//================================================================================
+
+// shortID abbreviates a session ID for display; IDs may be empty or shorter than usual.
+func shortID(id string) string {
+	if id == "" {
+		return "(none)"
+	}
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func (la *LogAnalyzer) GenerateHTMLReport(report *AnalysisReport, outputPath string) error {
+	tmplPath := "templates/dashboard_template.html"
+	
+	tmpl, err := template.New(filepath.Base(tmplPath)).Funcs(template.FuncMap{"shortID": shortID}).ParseFiles(tmplPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+	
+	return tmpl.Execute(file, report)
+}
+
+//================================================================================
+// Main Function
+//================================================================================
+
+func processLogFile(logFilePath string) error {
+	analyzer := NewLogAnalyzer()
+	
+	if err := analyzer.LoadLogs(logFilePath); err != nil {
+		return fmt.Errorf("failed to load logs from %s: %w", logFilePath, err)
+	}
+	
+	// Generate report filename from log filename
+	logFileName := filepath.Base(logFilePath)
+	reportFileName := strings.TrimSuffix(logFileName, filepath.Ext(logFileName)) + ".html"
+	reportPath := filepath.Join("reports", reportFileName)
+	
+	log.Printf("Generating analysis report for: %s", logFileName)
+	report := analyzer.GenerateReport(logFileName)
+	
+	log.Printf("Analysis Summary for %s:", logFileName)
+	log.Printf("- Total entries: %d", report.TotalEntries)
+	log.Printf("- Total sessions: %d", report.TotalSessions)
+	log.Printf("- Client sessions: %d", len(analyzer.AnalyzeClientSessions()))
+	log.Printf("- Total searches: %d", report.TotalSearches)
+	log.Printf("- Zero result rate: %.1f%%", report.ZeroResultRate)
+	log.Printf("- Cache hit rate: %.1f%%", report.CacheHitRate)
+	log.Printf("- Average duration: %v", report.AvgDuration)
+	health := report.ParseHealth
+	log.Printf("- Parse health: %d of %d lines parsed, %d malformed, %d oversized, %d incomplete records", health.Parsed, health.Lines, health.Malformed, health.Oversized, health.IncompleteRecords)
+	log.Printf("- Cache savings: %d upstream requests avoided, ~%v latency saved", report.CacheSavings.AvoidedRequests, report.CacheSavings.LatencySaved)
+	
+	if err := os.MkdirAll("reports", 0755); err != nil {
+		return fmt.Errorf("failed to create reports directory: %w", err)
+	}
+	
+	if err := analyzer.GenerateHTMLReport(report, reportPath); err != nil {
+		return fmt.Errorf("failed to generate HTML report for %s: %w", logFileName, err)
+	}
+	
+	log.Printf("✅ Report saved to: %s", reportPath)
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if _, ok := subcommands[os.Args[1]]; ok {
+			if err := runSubcommand(os.Args[1], os.Args[2:]); err != nil {
+				log.Fatalf("%s failed: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
+	exportKB := flag.String("export-kb", "", "Also write a recovery knowledge base JSON file for the server's suggestQueries tool")
+	openMetrics := flag.String("openmetrics", "", "Write log-derived metrics in OpenMetrics format to this file (- for stdout) instead of generating reports")
+	metricsListen := flag.String("metrics-listen", "", "Serve log-derived OpenMetrics on this address (e.g. :9464) at /metrics instead of generating reports")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "Push sessions as traces to this OTLP/HTTP collector (e.g. http://localhost:4318) instead of generating reports")
+	otlpHeaders := flag.String("otlp-headers", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), "Extra headers for -otlp-endpoint as key=value,key=value")
+	otlpService := flag.String("otlp-service", "grep-app-mcp", "service.name resource attribute for exported traces")
+	compare := flag.Bool("compare", false, "Compare two time windows instead of generating reports: -compare since1..until1 since2..until2 <logs>")
+	flag.Usage = func() {
+		fmt.Println("Log Analyzer - Generate HTML reports from log files")
+		fmt.Println("")
+		fmt.Println("Usage:")
+		fmt.Println("  go run main.go <log-file>       # Analyze single log file")
+		fmt.Println("  go run main.go <log-directory>  # Analyze all .jsonl files in directory")
+		fmt.Println("  go run main.go -export-kb <kb.json> <log-file|log-directory>")
+		fmt.Println("  go run main.go --compare since1..until1 since2..until2 <log-file|log-directory>")
+		fmt.Println("  go run main.go -openmetrics <metrics.prom|-> <log-file|log-directory>")
+		fmt.Println("  go run main.go -metrics-listen :9464 <log-file|log-directory>")
+		fmt.Println("  go run main.go -otlp-endpoint http://localhost:4318 <log-file|log-directory>")
+		fmt.Println("  go run main.go <subcommand> [flags] <log-file|log-directory>")
+		fmt.Println("")
+		fmt.Println("Subcommands:")
+		names := make([]string, 0, len(subcommands))
+		for name := range subcommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %-14s %s\n", name, subcommands[name].summary)
+		}
 		fmt.Println("")
 		fmt.Println("Examples:")
 		fmt.Println("  go run main.go ../logs/mcp-server-2025-07-29.jsonl")
 		fmt.Println("  go run main.go ../logs")
+		fmt.Println("  go run main.go -export-kb ../logs/recovery-kb.json ../logs")
+		fmt.Println("  go run main.go --compare 2025-07-01..2025-07-14 2025-07-15.. ../logs")
+		fmt.Println("  go run main.go zero-results --since 7d ../logs")
 		fmt.Println("")
 		fmt.Println("Reports are generated in the 'reports/' directory.")
+	}
+	flag.Parse()
+	if *compare {
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := runComparison(flag.Arg(2), flag.Arg(0), flag.Arg(1)); err != nil {
+			log.Fatalf("Failed to compare windows: %v", err)
+		}
+		return
+	}
+	if flag.NArg() < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
+	if *metricsListen != "" {
+		if err := serveOpenMetrics(flag.Arg(0), *metricsListen); err != nil {
+			log.Fatalf("Failed to serve metrics: %v", err)
+		}
+		return
+	}
+	if *otlpEndpoint != "" {
+		if err := exportOTLP(flag.Arg(0), *otlpEndpoint, *otlpHeaders, *otlpService); err != nil {
+			log.Fatalf("Failed to export traces: %v", err)
+		}
+		return
+	}
+	if *openMetrics != "" {
+		if err := exportOpenMetrics(flag.Arg(0), *openMetrics); err != nil {
+			log.Fatalf("Failed to export metrics: %v", err)
+		}
+		return
+	}
 	
-	logPath := os.Args[1]
+	logPath := flag.Arg(0)
 	
 	// Check if it's a file or directory
 	info, err := os.Stat(logPath)
@@ -581,4 +2202,11 @@ func main() {
 			log.Fatalf("Failed to process file: %v", err)
 		}
 	}
+
+	// The knowledge base spans every session under logPath rather than one file
+	if *exportKB != "" {
+		if err := exportKnowledgeBase(logPath, *exportKB); err != nil {
+			log.Fatalf("Failed to export knowledge base: %v", err)
+		}
+	}
 }
\ No newline at end of file
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Archive Retrieval
+//================================================================================
+
+const (
+	archiveRetrievalThreshold = 30        // Files from one repository that switch retrieval to its tarball
+	maxArchiveBytes           = 256 << 20 // Compressed tarball bytes read before giving up
+	maxArchiveFileBytes       = 1 << 20   // Larger files are left to the Contents API
+)
+
+// archiveGroup is a set of requests for one repository served from a single tarball.
+type archiveGroup struct {
+	Owner   string
+	Repo    string
+	Ref     string // Empty for the default branch
+	Indexes []int  // Positions in the original request list
+	Reqs    []GitHubFileRequest
+}
+
+// planArchiveRetrieval splits requests into repositories with at least
+// archiveRetrievalThreshold files, which are fetched as archives, and the indexes of the
+// remaining requests, which are fetched one by one.
+func planArchiveRetrieval(requests []GitHubFileRequest) ([]archiveGroup, []int) {
+	counts := make(map[repoRefKey]int)
+	for _, req := range requests {
+		counts[repoRefKey{req.Owner, req.Repo, req.Ref}]++
+	}
+
+	var groups []archiveGroup
+	groupIndex := make(map[repoRefKey]int)
+	var individual []int
+	for i, req := range requests {
+		key := repoRefKey{req.Owner, req.Repo, req.Ref}
+		if counts[key] < archiveRetrievalThreshold {
+			individual = append(individual, i)
+			continue
+		}
+		g, ok := groupIndex[key]
+		if !ok {
+			g = len(groups)
+			groupIndex[key] = g
+			groups = append(groups, archiveGroup{Owner: req.Owner, Repo: req.Repo, Ref: req.Ref})
+		}
+		groups[g].Indexes = append(groups[g].Indexes, i)
+		groups[g].Reqs = append(groups[g].Reqs, req)
+	}
+	return groups, individual
+}
+
+// fetchFromArchive downloads the group's repository tarball once and extracts the requested
+// files. Paths missing from the archive, directories, oversized files and every path after
+// a failed download fall back to the Contents API.
+func fetchFromArchive(ctx context.Context, ghClient *github.Client, group archiveGroup, opts retrievalOptions) []RetrievedFile {
+	repoPath := group.Owner + "/" + group.Repo
+	log.Printf("📦 Fetching %d files from %s via its tarball", len(group.Reqs), repoPath)
+	start := time.Now()
+
+	wanted := make(map[string]bool, len(group.Reqs))
+	for _, req := range group.Reqs {
+		wanted[strings.Trim(req.Path, "/")] = true
+	}
+
+	found, err := extractArchiveFiles(ctx, ghClient, group.Owner, group.Repo, group.Ref, wanted)
+	if err != nil {
+		log.Printf("⚠️ Tarball retrieval for %s failed after %v, falling back to per-file requests: %v", repoPath, time.Since(start), err)
+	}
+
+	var results []RetrievedFile
+	fallback := 0
+	for i, req := range group.Reqs {
+		num := group.Indexes[i] + 1
+		raw, ok := found[strings.Trim(req.Path, "/")]
+		if !ok {
+			fallback++
+			results = append(results, fetchGitHubFile(ctx, ghClient, req, num, opts)...)
+			continue
+		}
+		content, encoding := normalizeEncoding(raw)
+		content, processing := postProcessContent(req.Path, content, opts)
+		results = append(results, RetrievedFile{Number: num, Repo: repoPath, Path: req.Path, Type: "file", Content: content, Encoding: encoding, Processing: processing})
+	}
+
+	log.Printf("✅ Extracted %d of %d files from the %s tarball in %v (%d fetched individually)", len(group.Reqs)-fallback, len(group.Reqs), repoPath, time.Since(start), fallback)
+	return results
+}
+
+// extractArchiveFiles streams the repository tarball and returns the content of the wanted
+// paths that are regular files within maxArchiveFileBytes. Reading stops once every wanted
+// path has been seen. Files read before an error are still returned.
+func extractArchiveFiles(ctx context.Context, ghClient *github.Client, owner, repo, ref string, wanted map[string]bool) (map[string][]byte, error) {
+	found := make(map[string][]byte)
+	link, _, err := ghClient.Repositories.GetArchiveLink(ctx, owner, repo, github.Tarball, contentsOptions(ref), 1)
+	if err != nil {
+		return found, fmt.Errorf("failed to get archive link: %w", err)
+	}
+
+	// The link is normally absolute; resolving it also handles a relative Location header
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ghClient.BaseURL.ResolveReference(link).String(), nil)
+	if err != nil {
+		return found, err
+	}
+	resp, err := ghClient.Client().Do(req)
+	if err != nil {
+		return found, fmt.Errorf("failed to download archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return found, fmt.Errorf("archive download returned %s", resp.Status)
+	}
+
+	gz, err := gzip.NewReader(io.LimitReader(resp.Body, maxArchiveBytes))
+	if err != nil {
+		return found, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gz.Close()
+
+	seen := 0
+	tr := tar.NewReader(gz)
+	for seen < len(wanted) {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return found, fmt.Errorf("failed to read archive: %w", err)
+		}
+		// Entries are prefixed with a top-level "owner-repo-sha/" directory
+		_, path, ok := strings.Cut(header.Name, "/")
+		if !ok || !wanted[path] {
+			continue
+		}
+		seen++
+		if header.Typeflag != tar.TypeReg || header.Size > maxArchiveFileBytes {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return found, fmt.Errorf("failed to read %s from archive: %w", path, err)
+		}
+		found[path] = content
+	}
+	return found, nil
+}
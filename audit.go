@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Retrieval Audit Log
+//================================================================================
+
+// RetrievalAuditRecord describes one file or directory returned to a client. Records are
+// written as log entries with operation "file_retrieval", so the analyzer reads them like
+// the operational logs.
+type RetrievalAuditRecord struct {
+	Operation       string `json:"operation"`
+	ClientSession   string `json:"client_session,omitempty"` // MCP client session, empty on transports without one
+	Tenant          string `json:"tenant,omitempty"`
+	Repo            string `json:"repo"`
+	Path            string `json:"path"`
+	Ref             string `json:"ref,omitempty"`
+	CommitSHA       string `json:"commit_sha,omitempty"`
+	Type            string `json:"type,omitempty"` // "file" or "dir"
+	Bytes           int    `json:"bytes"`
+	SHA256          string `json:"sha256,omitempty"`
+	Error           string `json:"error,omitempty"`
+	RedactedSecrets int    `json:"redacted_secrets"`             // Credentials masked by the tenant's redactSecrets policy
+	Processing      string `json:"content_processing,omitempty"` // Kind of content rewrite, such as stripped notebook outputs
+}
+
+// auditEntry is one line of the audit log, shaped like a LogEntry.
+type auditEntry struct {
+	Timestamp time.Time            `json:"timestamp"`
+	Level     LogLevel             `json:"level"`
+	Message   string               `json:"message"`
+	SessionID string               `json:"session_id"` // Server process, as in the operational logs
+	Tool      string               `json:"tool"`
+	Data      RetrievalAuditRecord `json:"data"`
+}
+
+// auditLog appends retrieval records to a file kept apart from the operational logs. Each
+// record is written and synced before the tool call returns.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// retrievalAudit is the audit log set up by -audit-log; nil disables auditing.
+var retrievalAudit *auditLog
+
+// openAuditLog opens path for appending, creating it and its directory when missing.
+func openAuditLog(path string) (*auditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &auditLog{file: file}, nil
+}
+
+// Close closes the audit log file.
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// auditRecords builds the audit records for files.
+func auditRecords(ctx context.Context, files []RetrievedFile) []RetrievalAuditRecord {
+	tenant := tenantFromContext(ctx)
+	session := clientSessionID(ctx)
+	records := make([]RetrievalAuditRecord, 0, len(files))
+	for _, file := range files {
+		record := RetrievalAuditRecord{
+			Operation:     "file_retrieval",
+			ClientSession: session,
+			Repo:          file.Repo,
+			Path:          file.Path,
+			Ref:           file.Ref,
+			CommitSHA:     file.CommitSHA,
+			Type:          file.Type,
+			Bytes:         len(file.Content),
+			SHA256:        file.SHA256,
+			Error:         file.Error,
+		}
+		if tenant != nil {
+			record.Tenant = tenant.Name
+			if tenant.RedactSecrets {
+				_, record.RedactedSecrets = redactSecrets(file.Content)
+			}
+		}
+		if file.Processing != nil {
+			record.Processing = file.Processing.Kind
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// auditRetrievals records every file returned by tool in the audit log, if one is set up.
+// A failed write is logged; it does not fail the tool call.
+func auditRetrievals(ctx context.Context, tool string, files []RetrievedFile) {
+	audit := retrievalAudit
+	if audit == nil || len(files) == 0 {
+		return
+	}
+	sessionID := ""
+	if logger := GetLogger(); logger != nil {
+		sessionID = logger.sessionID
+	}
+
+	var lines []byte
+	for _, record := range auditRecords(ctx, files) {
+		entry := auditEntry{
+			Timestamp: time.Now(),
+			Level:     LogLevelInfo,
+			Message:   fmt.Sprintf("Retrieved %s/%s", record.Repo, record.Path),
+			SessionID: sessionID,
+			Tool:      tool,
+			Data:      record,
+		}
+		if record.Error != "" {
+			entry.Message = fmt.Sprintf("Failed to retrieve %s/%s", record.Repo, record.Path)
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("⚠️ Failed to encode audit record: %v", err)
+			continue
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if _, err := audit.file.Write(lines); err != nil {
+		log.Printf("⚠️ Failed to write %d audit records: %v", len(files), err)
+		return
+	}
+	if err := audit.file.Sync(); err != nil {
+		log.Printf("⚠️ Failed to sync audit log: %v", err)
+	}
+}
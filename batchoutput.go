@@ -0,0 +1,266 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Batch Retrieval Output Formats
+//================================================================================
+
+// Output formats accepted by batchRetrievalTool's outputFormat argument.
+const (
+	batchFormatJSON     = "json"     // One JSON document with embedded contents (default)
+	batchFormatMarkdown = "markdown" // Concatenated Markdown with a header and fenced block per file
+	batchFormatBlocks   = "blocks"   // One MCP text content block per file
+	batchFormatZip      = "zip"      // Base64 zip archive embedded as a resource, for bulk export
+)
+
+var batchOutputFormats = []string{batchFormatJSON, batchFormatMarkdown, batchFormatBlocks, batchFormatZip}
+
+// parseBatchOutputFormat validates the outputFormat argument, defaulting to JSON.
+func parseBatchOutputFormat(args map[string]interface{}) (string, error) {
+	format, err := argString(args, "outputFormat")
+	if err != nil {
+		return "", err
+	}
+	if format == "" {
+		return batchFormatJSON, nil
+	}
+	format = strings.ToLower(format)
+	if !containsString(batchOutputFormats, format) {
+		return "", fmt.Errorf("unsupported outputFormat %q (expected one of %s)", format, strings.Join(batchOutputFormats, ", "))
+	}
+	return format, nil
+}
+
+// formatBatchResult renders a batch retrieval result in the requested output format.
+// Byte-identical files are shown once, except in zip archives, which hold every file.
+func formatBatchResult(result *BatchRetrievalResult, format string) (*mcp.CallToolResult, error) {
+	if format != batchFormatZip {
+		result = collapseDuplicates(result)
+	}
+	switch format {
+	case batchFormatMarkdown:
+		return mcp.NewToolResultText(formatBatchMarkdown(result)), nil
+	case batchFormatBlocks:
+		return &mcp.CallToolResult{Content: batchContentBlocks(result)}, nil
+	case batchFormatZip:
+		archive, err := buildBatchZip(result)
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{
+			mcp.NewTextContent(batchSummary(result) + fmt.Sprintf("\nZip archive attached (%d bytes).", len(archive))),
+			mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+				URI:      "grep-app://batch-retrieval.zip",
+				MIMEType: "application/zip",
+				Blob:     base64.StdEncoding.EncodeToString(archive),
+			}),
+		}}, nil
+	default:
+		result.SchemaVersion = outputSchemaVersion
+		resultBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal result: %w", err)
+		}
+		return mcp.NewToolResultText(string(resultBytes)), nil
+	}
+}
+
+// batchSummary describes how many files were retrieved and lists failures.
+func batchSummary(result *BatchRetrievalResult) string {
+	var b strings.Builder
+	success := 0
+	for _, file := range result.Files {
+		if file.Error == "" {
+			success++
+		}
+	}
+	fmt.Fprintf(&b, "Retrieved %d of %d files.\n", success, len(result.Files))
+	if len(result.Duplicates) > 0 {
+		b.WriteString(duplicateSummary(result.Duplicates) + "\n")
+	}
+	if result.RateLimit != nil {
+		b.WriteString(result.RateLimit.String() + "\n")
+	}
+	if result.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", result.Error)
+	}
+	for _, file := range result.Files {
+		if file.Error != "" {
+			fmt.Fprintf(&b, "❌ %d. %s/%s: %s\n", file.Number, file.Repo, file.Path, file.Error)
+		}
+	}
+	for _, skip := range result.Skipped {
+		fmt.Fprintf(&b, "⏭️ %d. %s/%s skipped: %s\n", skip.Number, skip.Repo, skip.Path, skip.Reason)
+	}
+	return b.String()
+}
+
+// formatBatchMarkdown concatenates all files into one Markdown document, with a header
+// before each repository's files when the result is grouped.
+func formatBatchMarkdown(result *BatchRetrievalResult) string {
+	var b strings.Builder
+	b.WriteString(batchSummary(result))
+	headers := repoHeaders(result)
+	for _, file := range result.Files {
+		if header, ok := headers[file.Repo]; ok {
+			b.WriteString("\n")
+			b.WriteString(header)
+			delete(headers, file.Repo)
+		}
+		if file.Error != "" {
+			continue
+		}
+		b.WriteString("\n")
+		writeMarkdownEntry(&b, file)
+	}
+	return b.String()
+}
+
+// batchContentBlocks returns a summary block followed by one block per retrieved file.
+// Grouped results also get a header block before each repository's files.
+func batchContentBlocks(result *BatchRetrievalResult) []mcp.Content {
+	blocks := []mcp.Content{mcp.NewTextContent(batchSummary(result))}
+	headers := repoHeaders(result)
+	for _, file := range result.Files {
+		if header, ok := headers[file.Repo]; ok {
+			blocks = append(blocks, mcp.NewTextContent(header))
+			delete(headers, file.Repo)
+		}
+		if file.Error != "" {
+			continue
+		}
+		var b strings.Builder
+		writeMarkdownEntry(&b, file)
+		blocks = append(blocks, mcp.NewTextContent(b.String()))
+	}
+	return blocks
+}
+
+// repoHeaders maps each repository in a grouped result to its Markdown header.
+func repoHeaders(result *BatchRetrievalResult) map[string]string {
+	headers := make(map[string]string, len(result.Repos))
+	for _, group := range result.Repos {
+		headers[group.Repo] = repoHeader(group)
+	}
+	return headers
+}
+
+// writeMarkdownEntry writes a retrieved file, or a bullet listing for a directory.
+func writeMarkdownEntry(b *strings.Builder, file RetrievedFile) {
+	if file.DuplicateOf != "" {
+		fmt.Fprintf(b, "## %d. %s/%s\n\nIdentical to %s (sha256 %s).\n", file.Number, file.Repo, file.Path, file.DuplicateOf, file.SHA256[:12])
+		return
+	}
+	if file.Type != "dir" {
+		writeMarkdownFile(b, file)
+		return
+	}
+	fmt.Fprintf(b, "## %d. %s/%s/\n\n", file.Number, file.Repo, file.Path)
+	for _, entry := range file.Listing {
+		if entry.Type == "dir" {
+			fmt.Fprintf(b, "- %s/\n", entry.Name)
+		} else {
+			fmt.Fprintf(b, "- %s (%d bytes)\n", entry.Name, entry.Size)
+		}
+	}
+	if file.SkippedEntries > 0 {
+		fmt.Fprintf(b, "\n_%d entries not fetched because of size or depth limits._\n", file.SkippedEntries)
+	}
+}
+
+// writeMarkdownFile writes a file header and its content as a fenced code block. The fence
+// is made longer than any backtick run in the content so it cannot be closed early.
+func writeMarkdownFile(b *strings.Builder, file RetrievedFile) {
+	fmt.Fprintf(b, "## %d. %s/%s\n\n", file.Number, file.Repo, file.Path)
+	if file.Excerpt != nil {
+		ranges := make([]string, len(file.Excerpt.Ranges))
+		for i, r := range file.Excerpt.Ranges {
+			ranges[i] = fmt.Sprintf("%d-%d", r.Start, r.End)
+		}
+		fmt.Fprintf(b, "_Lines %s of %d, around the matched lines._\n\n", strings.Join(ranges, ", "), file.Excerpt.TotalLines)
+	}
+	fence := strings.Repeat("`", max(3, longestBacktickRun(file.Content)+1))
+	b.WriteString(fence)
+	b.WriteString(strings.TrimPrefix(path.Ext(file.Path), "."))
+	b.WriteString("\n")
+	b.WriteString(file.Content)
+	if !strings.HasSuffix(file.Content, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(fence)
+	b.WriteString("\n")
+}
+
+// longestBacktickRun returns the length of the longest run of consecutive backticks.
+func longestBacktickRun(s string) int {
+	longest, current := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '`' {
+			current++
+			longest = max(longest, current)
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+// buildBatchZip packs retrieved files under repo/path along with a manifest.json that
+// records result numbers and per-file errors.
+func buildBatchZip(result *BatchRetrievalResult) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	type manifestEntry struct {
+		Number  int              `json:"number"`
+		Repo    string           `json:"repo"`
+		Path    string           `json:"path"`
+		Type    string           `json:"type,omitempty"`
+		Listing []DirectoryEntry `json:"listing,omitempty"`
+		SHA256  string           `json:"sha256,omitempty"`
+		Error   string           `json:"error,omitempty"`
+	}
+	manifest := make([]manifestEntry, 0, len(result.Files))
+
+	for _, file := range result.Files {
+		manifest = append(manifest, manifestEntry{Number: file.Number, Repo: file.Repo, Path: file.Path, Type: file.Type, Listing: file.Listing, SHA256: file.SHA256, Error: file.Error})
+		if file.Error != "" || file.Type == "dir" {
+			continue // Directory listings are recorded in the manifest only
+		}
+		w, err := zw.Create(path.Join(file.Repo, file.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s/%s to zip: %w", file.Repo, file.Path, err)
+		}
+		if _, err := w.Write([]byte(file.Content)); err != nil {
+			return nil, fmt.Errorf("failed to write %s/%s to zip: %w", file.Repo, file.Path, err)
+		}
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal zip manifest: %w", err)
+	}
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to add manifest to zip: %w", err)
+	}
+	if _, err := w.Write(manifestBytes); err != nil {
+		return nil, fmt.Errorf("failed to write manifest to zip: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize zip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Batch Retrieval Outcomes and Retry
+//================================================================================
+
+// batchFailure records a file that failed to be retrieved. It holds no content, so the
+// record reveals nothing a caller could not have requested themselves.
+type batchFailure struct {
+	Number int    `json:"number"`
+	Repo   string `json:"repo"`
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+}
+
+// batchOutcomes holds the files still failing for a query, so a later call can retry them.
+type batchOutcomes struct {
+	Failures []batchFailure `json:"failures"`
+}
+
+// batchOutcomesMu serializes the read-modify-write of recorded outcomes.
+var batchOutcomesMu sync.Mutex
+
+// batchOutcomesKey scopes the recorded failures of query to the caller's tenant.
+func batchOutcomesKey(ctx context.Context, query string) string {
+	tenant := ""
+	if profile := tenantFromContext(ctx); profile != nil {
+		tenant = profile.Name
+	}
+	return generateCacheKey(map[string]interface{}{"query": query, "batch_outcomes": true, "tenant": tenant})
+}
+
+// loadBatchOutcomes returns the recorded failures for query, or nil when none are cached.
+func loadBatchOutcomes(ctx context.Context, query string) (*batchOutcomes, error) {
+	return getCachedData[batchOutcomes](batchOutcomesKey(ctx, query), cacheTTLFor(cacheEntryFile, 0))
+}
+
+// recordBatchOutcomes updates the recorded failures for query with the files' newest
+// outcomes: failures are added or replaced, and files that succeeded are dropped. Files
+// rejected by validation are not recorded because a retry would fail again.
+func recordBatchOutcomes(ctx context.Context, query string, files []RetrievedFile) {
+	if len(files) == 0 {
+		return
+	}
+	batchOutcomesMu.Lock()
+	defer batchOutcomesMu.Unlock()
+	previous, err := loadBatchOutcomes(ctx, query)
+	if err != nil {
+		log.Printf("⚠️ Failed to read batch outcomes for '%s': %v", query, err)
+	}
+
+	type fileKey struct{ repo, path string }
+	merged := make(map[fileKey]batchFailure)
+	if previous != nil {
+		for _, failure := range previous.Failures {
+			merged[fileKey{failure.Repo, failure.Path}] = failure
+		}
+	}
+	for _, file := range files {
+		key := fileKey{file.Repo, file.Path}
+		if file.Error == "" || file.Validation != nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = batchFailure{Number: file.Number, Repo: file.Repo, Path: file.Path, Error: file.Error}
+	}
+	if previous == nil && len(merged) == 0 {
+		return
+	}
+
+	outcomes := batchOutcomes{Failures: make([]batchFailure, 0, len(merged))}
+	for _, failure := range merged {
+		outcomes.Failures = append(outcomes.Failures, failure)
+	}
+	sort.Slice(outcomes.Failures, func(i, j int) bool {
+		a, b := outcomes.Failures[i], outcomes.Failures[j]
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Path < b.Path
+	})
+	if err := cacheData(batchOutcomesKey(ctx, query), outcomes, query, cacheEntryFile); err != nil {
+		log.Printf("⚠️ Failed to record batch outcomes for '%s': %v", query, err)
+	}
+}
+
+// sortRetrievedFiles orders files by result number, then repository and path.
+func sortRetrievedFiles(files []RetrievedFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Number != files[j].Number {
+			return files[i].Number < files[j].Number
+		}
+		if files[i].Repo != files[j].Repo {
+			return files[i].Repo < files[j].Repo
+		}
+		return files[i].Path < files[j].Path
+	})
+}
+
+// retryFailedFiles re-fetches the files that failed in the caller's earlier batches for query
+// and returns the new attempts. It also returns how many files were retried and how many of
+// those now succeeded.
+func retryFailedFiles(ctx context.Context, ghClient *github.Client, query string, opts retrievalOptions) (*BatchRetrievalResult, int, int, error) {
+	previous, err := loadBatchOutcomes(ctx, query)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read previous batch outcomes: %w", err)
+	}
+	if previous == nil {
+		return &BatchRetrievalResult{Success: false, Error: "No previous batch retrieval recorded for query: " + query}, 0, 0, nil
+	}
+	if len(previous.Failures) == 0 {
+		log.Printf("✅ No failed files to retry for query '%s'", query)
+		return &BatchRetrievalResult{Success: true}, 0, 0, nil
+	}
+
+	failed := make([]NumberedHit, 0, len(previous.Failures))
+	for _, failure := range previous.Failures {
+		failed = append(failed, NumberedHit{Number: failure.Number, Repo: failure.Repo, Path: failure.Path})
+	}
+	log.Printf("🔁 Retrying %d failed files for query '%s'", len(failed), query)
+	retried := retrieveHits(ctx, ghClient, failed, opts)
+	recordBatchOutcomes(ctx, query, retried.Files)
+
+	recovered := 0
+	for _, file := range retried.Files {
+		if file.Error == "" {
+			recovered++
+		}
+	}
+	return &BatchRetrievalResult{Success: true, Files: retried.Files}, len(failed), recovered, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Upstream API Budget
+//================================================================================
+
+// errBudgetExceeded is returned instead of making an upstream request once the per-call or
+// hourly budget is used up. Cached data is still served because it never reaches the network.
+var errBudgetExceeded = errors.New("upstream API budget exceeded")
+
+// BudgetConfig limits upstream requests to grep.app and GitHub. Zero means unlimited.
+type BudgetConfig struct {
+	MaxRequestsPerCall int // Upstream requests a single tool call may make
+	MaxRequestsPerHour int // Upstream requests across all calls in a sliding hour
+}
+
+// apiStatsRegistry counts upstream requests for the whole process.
+type apiStatsRegistry struct {
+	mu     sync.Mutex
+	total  int64
+	denied int64
+	recent []time.Time // Request times within the last hour, oldest first
+}
+
+// APIStats is a snapshot of the process-wide upstream request counters.
+type APIStats struct {
+	TotalRequests    int64 `json:"total_requests"`
+	DeniedRequests   int64 `json:"denied_requests"`
+	LastHourRequests int   `json:"last_hour_requests"`
+}
+
+var apiStats = &apiStatsRegistry{}
+
+// prune drops request times older than an hour. The caller must hold r.mu.
+func (r *apiStatsRegistry) prune(now time.Time) {
+	cutoff := now.Add(-time.Hour)
+	i := 0
+	for i < len(r.recent) && !r.recent[i].After(cutoff) {
+		i++
+	}
+	r.recent = r.recent[i:]
+}
+
+// reserve records a request if the hourly limit allows it.
+func (r *apiStatsRegistry) reserve(hourlyLimit int, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(now)
+	if hourlyLimit > 0 && len(r.recent) >= hourlyLimit {
+		r.denied++
+		return false
+	}
+	r.total++
+	r.recent = append(r.recent, now)
+	return true
+}
+
+// recordDenied counts a request refused by a per-call budget.
+func (r *apiStatsRegistry) recordDenied() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.denied++
+}
+
+// snapshot returns the current counters.
+func (r *apiStatsRegistry) snapshot(now time.Time) APIStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(now)
+	return APIStats{TotalRequests: r.total, DeniedRequests: r.denied, LastHourRequests: len(r.recent)}
+}
+
+// callBudget tracks upstream requests made on behalf of one tool call. Language fan-out
+// and batch retrieval share it across goroutines.
+type callBudget struct {
+	mu     sync.Mutex
+	limit  int
+	used   int
+	denied int
+}
+
+type callBudgetKey struct{}
+
+// withCallBudget attaches a fresh per-call budget to the context.
+func withCallBudget(ctx context.Context, limit int) (context.Context, *callBudget) {
+	budget := &callBudget{limit: limit}
+	return context.WithValue(ctx, callBudgetKey{}, budget), budget
+}
+
+// reserveUpstreamRequest charges one upstream request against the call budget, the
+// tenant's hourly budget and the server-wide hourly budget. Contexts without a call budget,
+// such as background prefetches, only count against the hourly budgets.
+func reserveUpstreamRequest(ctx context.Context) error {
+	budget, _ := ctx.Value(callBudgetKey{}).(*callBudget)
+	if budget != nil {
+		budget.mu.Lock()
+		defer budget.mu.Unlock()
+	}
+	deny := func(err error) error {
+		if budget != nil {
+			budget.denied++
+		}
+		return err
+	}
+
+	if budget != nil && budget.limit > 0 && budget.used >= budget.limit {
+		apiStats.recordDenied()
+		return deny(fmt.Errorf("%w: %d requests per call", errBudgetExceeded, budget.limit))
+	}
+	now := time.Now()
+	if tenant := tenantFromContext(ctx); tenant != nil && tenant.MaxRequestsPerHour > 0 {
+		if !tenant.stats.reserve(tenant.MaxRequestsPerHour, now) {
+			apiStats.recordDenied()
+			return deny(fmt.Errorf("%w: %d requests per hour for tenant %s", errBudgetExceeded, tenant.MaxRequestsPerHour, tenant.Name))
+		}
+	}
+	hourlyLimit := GetConfig().Budget.MaxRequestsPerHour
+	if !apiStats.reserve(hourlyLimit, now) {
+		return deny(fmt.Errorf("%w: %d requests per hour", errBudgetExceeded, hourlyLimit))
+	}
+	if budget != nil {
+		budget.used++
+	}
+	return nil
+}
+
+// BudgetStatus reports budget consumption for a tool call.
+type BudgetStatus struct {
+	CallRequests   int  `json:"call_requests"`
+	CallLimit      int  `json:"call_limit"`
+	DeniedRequests int  `json:"denied_requests"`
+	HourRequests   int  `json:"hour_requests"`
+	HourLimit      int  `json:"hour_limit"`
+	Exhausted      bool `json:"exhausted"`
+}
+
+// status returns the budget consumption of this call alongside the hourly totals.
+func (b *callBudget) status() BudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BudgetStatus{
+		CallRequests:   b.used,
+		CallLimit:      b.limit,
+		DeniedRequests: b.denied,
+		HourRequests:   apiStats.snapshot(time.Now()).LastHourRequests,
+		HourLimit:      GetConfig().Budget.MaxRequestsPerHour,
+		Exhausted:      b.denied > 0,
+	}
+}
+
+// String renders the status as a short line, showing "unlimited" for unset limits.
+func (s BudgetStatus) String() string {
+	limit := func(n int) string {
+		if n <= 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("📊 API budget: %d/%s requests this call, %d/%s in the last hour, %d requests denied",
+		s.CallRequests, limit(s.CallLimit), s.HourRequests, limit(s.HourLimit), s.DeniedRequests)
+}
+
+// budgetTransport charges every outgoing request against the budget carried by its context
+// and refuses providers the caller's tenant profile does not allow.
+type budgetTransport struct {
+	base http.RoundTripper
+}
+
+// newBudgetTransport wraps base, defaulting to http.DefaultTransport.
+func newBudgetTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &budgetTransport{base: base}
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tenant := tenantFromContext(req.Context()); tenant != nil {
+		if provider := providerForHost(req.URL.Hostname()); !tenant.allowsProvider(provider) {
+			return nil, fmt.Errorf("%w: %s", errProviderNotAllowed, provider)
+		}
+	}
+	if err := reserveUpstreamRequest(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// budgetMiddleware gives each tool call its own budget, using the tenant's per-call limit
+// when set, and appends the budget status to results whose call ran into a limit.
+func budgetMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		limit := GetConfig().Budget.MaxRequestsPerCall
+		if tenant := tenantFromContext(ctx); tenant != nil && tenant.MaxRequestsPerCall > 0 {
+			limit = tenant.MaxRequestsPerCall
+		}
+		ctx, budget := withCallBudget(ctx, limit)
+		result, err := next(ctx, request)
+
+		status := budget.status()
+		if !status.Exhausted {
+			return result, err
+		}
+		if logger := LoggerFromContext(ctx); logger != nil {
+			logger.LogWarn(fmt.Sprintf("💸 API budget exhausted during %s", request.Params.Name), "budget", map[string]interface{}{
+				"tool":            request.Params.Name,
+				"call_requests":   status.CallRequests,
+				"call_limit":      status.CallLimit,
+				"denied_requests": status.DeniedRequests,
+				"hour_requests":   status.HourRequests,
+				"hour_limit":      status.HourLimit,
+			})
+		}
+		if result != nil {
+			result.Content = append(result.Content, mcp.NewTextContent(status.String()))
+		}
+		return result, err
+	}
+}
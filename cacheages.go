@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Cache Age Statistics and TTL Recommendations
+//================================================================================
+
+// cacheAgeBounds are the upper bounds of the age histogram buckets. A last, open bucket
+// holds everything older.
+var cacheAgeBounds = []time.Duration{
+	5 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 6 * time.Hour,
+	12 * time.Hour, 24 * time.Hour, 3 * 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+const (
+	minRecommendationHits = 20   // Hits of a type needed before its TTL is judged
+	coveredHitShare       = 0.95 // Share of hits a lowered TTL must still serve
+	lateHitShare          = 0.25 // Share of hits in the last quarter of the TTL that suggests raising it
+)
+
+// AgeBucket counts the entries on disk and the hits served within one age range.
+type AgeBucket struct {
+	Under   string `json:"under"` // Upper bound such as "2h", or "older" for the last bucket
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Hits    int64  `json:"hits"` // Since startup, by the entry's age when it was served
+}
+
+// TTLRecommendation suggests a different TTL for one entry type.
+type TTLRecommendation struct {
+	Type         cacheEntryType `json:"type"`
+	Flag         string         `json:"flag"`
+	CurrentTTL   string         `json:"current_ttl"`
+	SuggestedTTL string         `json:"suggested_ttl"`
+	HitShare     float64        `json:"hit_share"`             // Share of hits behind the suggestion
+	SavedBytes   int64          `json:"saved_bytes,omitempty"` // Held by entries older than the suggested TTL
+	Message      string         `json:"message"`
+}
+
+// typeHitAges is the hit-age histogram of one entry type.
+type typeHitAges struct {
+	buckets []int64
+	late    int64 // Hits on entries in the last quarter of the TTL they were looked up with
+}
+
+// hitAgeRecorder tracks how old cache entries are when they are served.
+type hitAgeRecorder struct {
+	mu     sync.Mutex
+	byType map[cacheEntryType]*typeHitAges
+}
+
+var cacheHitAges = &hitAgeRecorder{byType: make(map[cacheEntryType]*typeHitAges)}
+
+// ageBucket returns the index of the histogram bucket holding age.
+func ageBucket(age time.Duration) int {
+	for i, bound := range cacheAgeBounds {
+		if age < bound {
+			return i
+		}
+	}
+	return len(cacheAgeBounds)
+}
+
+// record counts a hit on an entry of the given age, looked up with ttl.
+func (r *hitAgeRecorder) record(entryType cacheEntryType, age, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ages := r.byType[entryType]
+	if ages == nil {
+		ages = &typeHitAges{buckets: make([]int64, len(cacheAgeBounds)+1)}
+		r.byType[entryType] = ages
+	}
+	ages.buckets[ageBucket(age)]++
+	if age > ttl*3/4 {
+		ages.late++
+	}
+}
+
+// snapshot copies the histograms recorded so far.
+func (r *hitAgeRecorder) snapshot() map[cacheEntryType]typeHitAges {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := make(map[cacheEntryType]typeHitAges, len(r.byType))
+	for entryType, ages := range r.byType {
+		copied[entryType] = typeHitAges{buckets: append([]int64(nil), ages.buckets...), late: ages.late}
+	}
+	return copied
+}
+
+// reset forgets the hits recorded so far.
+func (r *hitAgeRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byType = make(map[cacheEntryType]*typeHitAges)
+}
+
+// formatAge renders a duration as the TTL flags accept it, without the zero minutes and
+// seconds of time.Duration's String.
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// newAgeBuckets returns an empty histogram.
+func newAgeBuckets() []AgeBucket {
+	buckets := make([]AgeBucket, len(cacheAgeBounds)+1)
+	for i, bound := range cacheAgeBounds {
+		buckets[i].Under = formatAge(bound)
+	}
+	buckets[len(cacheAgeBounds)].Under = "older"
+	return buckets
+}
+
+// cacheTTLFlagFor names the flag that sets entryType's TTL.
+func cacheTTLFlagFor(entryType cacheEntryType) string {
+	switch entryType {
+	case cacheEntryComplete:
+		return "cache-ttl-complete"
+	case cacheEntryFile:
+		return "cache-ttl-file"
+	case cacheEntryRepoMeta:
+		return "cache-ttl-repo"
+	default:
+		return "cache-ttl-search"
+	}
+}
+
+// recommendTTL judges an entry type's TTL from the ages its hits were served at. A TTL is
+// lowered to the smallest bucket bound still serving 95% of hits, and raised when a quarter
+// of hits came from the last quarter of the TTL, as those entries would otherwise soon be
+// fetched again. It returns nil without enough hits or when the TTL fits.
+func recommendTTL(entryType cacheEntryType, buckets []AgeBucket, late int64, ttl time.Duration) *TTLRecommendation {
+	var total int64
+	for _, bucket := range buckets {
+		total += bucket.Hits
+	}
+	if total < minRecommendationHits || ttl <= 0 {
+		return nil
+	}
+	rec := &TTLRecommendation{Type: entryType, Flag: cacheTTLFlagFor(entryType), CurrentTTL: formatAge(ttl)}
+
+	if share := float64(late) / float64(total); share >= lateHitShare {
+		rec.SuggestedTTL = formatAge(ttl * 2)
+		rec.HitShare = share
+		rec.Message = fmt.Sprintf("%s: %.0f%% of %d hits were on entries in the last quarter of their TTL; -%s could be raised from %s to %s to avoid refetching them",
+			entryType, share*100, total, rec.Flag, rec.CurrentTTL, rec.SuggestedTTL)
+		return rec
+	}
+
+	var covered int64
+	for i, bound := range cacheAgeBounds {
+		covered += buckets[i].Hits
+		if float64(covered)/float64(total) < coveredHitShare {
+			continue
+		}
+		if bound >= ttl {
+			return nil
+		}
+		for _, older := range buckets[i+1:] {
+			rec.SavedBytes += older.Bytes
+		}
+		rec.SuggestedTTL = formatAge(bound)
+		rec.HitShare = float64(covered) / float64(total)
+		rec.Message = fmt.Sprintf("%s: %.0f%% of %d hits were on entries under %s old; -%s could be lowered from %s to %s, freeing %s held by older entries",
+			entryType, rec.HitShare*100, total, rec.SuggestedTTL, rec.Flag, rec.CurrentTTL, rec.SuggestedTTL, formatBytes(rec.SavedBytes))
+		return rec
+	}
+	return nil
+}
+
+// addAgeStatistics fills in the age histogram of each entry type from the cache files and
+// the hits recorded since startup, and the TTL recommendations that follow from them.
+func addAgeStatistics(status *CacheStatus, files []cacheFile, ttls CacheTTLConfig, now time.Time) {
+	typeStatus := func(entryType cacheEntryType) (string, CacheTypeStatus) {
+		name := string(entryType)
+		if name == "" {
+			name = "untyped" // Written before entry types were recorded
+		}
+		t := status.ByType[name]
+		if t.Ages == nil {
+			t.Ages = newAgeBuckets()
+		}
+		return name, t
+	}
+
+	for _, file := range files {
+		if file.entry == nil {
+			continue
+		}
+		name, t := typeStatus(file.entry.Type)
+		bucket := &t.Ages[ageBucket(now.Sub(file.entry.Timestamp))]
+		bucket.Entries++
+		bucket.Bytes += file.size
+		status.ByType[name] = t
+	}
+
+	hits := cacheHitAges.snapshot()
+	entryTypes := make([]cacheEntryType, 0, len(hits))
+	for entryType, ages := range hits {
+		name, t := typeStatus(entryType)
+		for i, n := range ages.buckets {
+			t.Ages[i].Hits += n
+		}
+		status.ByType[name] = t
+		entryTypes = append(entryTypes, entryType)
+	}
+	sort.Slice(entryTypes, func(i, j int) bool { return entryTypes[i] < entryTypes[j] })
+	for _, entryType := range entryTypes {
+		if entryType == "" {
+			continue // No TTL of its own to tune
+		}
+		t := status.ByType[string(entryType)]
+		if rec := recommendTTL(entryType, t.Ages, hits[entryType].late, ttls.For(entryType)); rec != nil {
+			status.Recommendations = append(status.Recommendations, *rec)
+		}
+	}
+}
+
+// formatAgeBuckets renders the non-empty buckets of a histogram on one line.
+func formatAgeBuckets(buckets []AgeBucket) string {
+	var parts []string
+	for _, bucket := range buckets {
+		if bucket.Entries == 0 && bucket.Hits == 0 {
+			continue
+		}
+		label := "<" + bucket.Under
+		if bucket.Under == "older" {
+			label = ">" + formatAge(cacheAgeBounds[len(cacheAgeBounds)-1])
+		}
+		parts = append(parts, fmt.Sprintf("%s %d/%d", label, bucket.Entries, bucket.Hits))
+	}
+	return strings.Join(parts, "  ")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Cache Debugging
+//================================================================================
+
+// CacheDebugEntry describes one cache file stored for a query.
+type CacheDebugEntry struct {
+	Key     string         `json:"key"`
+	Type    cacheEntryType `json:"type"`
+	Page    int            `json:"page,omitempty"`  // Result page for search pages of the given filters
+	Pages   int            `json:"pages,omitempty"` // Total pages grep.app reported, from page entries
+	Files   int            `json:"files,omitempty"` // Files in complete results and scans
+	Age     string         `json:"age"`
+	Expired bool           `json:"expired"`
+	Size    int64          `json:"size_bytes"`
+	Note    string         `json:"note,omitempty"`
+}
+
+// CacheDebugReport lists a query's cache entries and any inconsistencies between them.
+type CacheDebugReport struct {
+	Query    string            `json:"query"`
+	CacheDir string            `json:"cache_dir"`
+	Entries  []CacheDebugEntry `json:"entries"`
+	Issues   []string          `json:"issues,omitempty"`
+}
+
+// debugCacheEntries inspects the cache files for query. args carries the query and the
+// search filters used to work out which page each search page entry holds.
+func debugCacheEntries(args map[string]interface{}) (*CacheDebugReport, error) {
+	query, _ := args["query"].(string)
+	report := &CacheDebugReport{Query: query, CacheDir: GetConfig().CacheDir}
+
+	files, err := findCacheFiles(query)
+	if os.IsNotExist(err) {
+		report.Issues = append(report.Issues, "cache directory does not exist")
+		return report, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache files: %w", err)
+	}
+
+	completeKey := completeCacheKey(query)
+	scanKey := scanCacheKey(args)
+	pageKeys := make(map[string]int)
+	maxPages, _ := parseMaxPagesArg(args)
+	for page := 1; page <= maxPages; page++ {
+		pageKeys[searchPageCacheKey(args, page)] = page
+	}
+
+	ttlOverride, _ := parseCacheTTLArg(args) // Validated by the tool handler
+	cachedPages := make(map[int]bool)
+	totalPages := 0
+	var complete *CacheDebugEntry
+	otherPages := 0
+	for _, name := range files {
+		entry, age, err := inspectCacheFile(filepath.Join(report.CacheDir, name))
+		if err != nil {
+			report.Issues = append(report.Issues, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		key := strings.TrimSuffix(name, ".json")
+		entry.Key = key
+
+		// Entries written before types were recorded are classified by key
+		switch {
+		case key == completeKey:
+			entry.Type = cacheEntryComplete
+		case key == scanKey:
+			entry.Type = cacheEntrySearchScan
+		case pageKeys[key] > 0:
+			entry.Type = cacheEntrySearchPage
+			entry.Page = pageKeys[key]
+		case entry.Type == cacheEntrySearchPage:
+			entry.Note = "different filters"
+			otherPages++
+		}
+
+		entry.Expired = age > cacheTTLFor(entry.Type, ttlOverride)
+		if entry.Page > 0 && !entry.Expired {
+			cachedPages[entry.Page] = true
+			totalPages = max(totalPages, entry.Pages)
+		}
+		if key == completeKey {
+			complete = &entry
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+
+	sort.Slice(report.Entries, func(i, j int) bool {
+		a, b := report.Entries[i], report.Entries[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Page != b.Page {
+			return a.Page < b.Page
+		}
+		return a.Key < b.Key
+	})
+
+	switch {
+	case complete == nil && len(cachedPages) > 0:
+		report.Issues = append(report.Issues, fmt.Sprintf("%d result pages are cached but there is no complete entry, so batchRetrievalTool will report no cached results; the last search was probably cut short (quickFirstPage, timeout or API budget). Repeat the search without quickFirstPage.", len(cachedPages)))
+	case complete == nil:
+		report.Issues = append(report.Issues, "no complete entry: batchRetrievalTool needs a successful searchCode call for this exact query first")
+	case complete.Expired:
+		report.Issues = append(report.Issues, fmt.Sprintf("the complete entry is %s old and past its TTL, so batchRetrievalTool ignores it; repeat the search or pass a longer cacheTTL", complete.Age))
+	}
+	if missing := missingPages(cachedPages, min(totalPages, maxPages)); complete == nil && len(missing) > 0 {
+		report.Issues = append(report.Issues, fmt.Sprintf("pages %v are missing or expired out of %d", missing, min(totalPages, maxPages)))
+	}
+	if otherPages > 0 && len(cachedPages) == 0 {
+		report.Issues = append(report.Issues, fmt.Sprintf("%d page entries exist for this query with different filters; pass the same filters used with searchCode to match them", otherPages))
+	}
+	return report, nil
+}
+
+// inspectCacheFile reads a cache file's metadata without decoding its full payload type.
+func inspectCacheFile(path string) (CacheDebugEntry, time.Duration, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return CacheDebugEntry{}, 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CacheDebugEntry{}, 0, err
+	}
+	var raw CacheEntry[json.RawMessage]
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return CacheDebugEntry{}, 0, fmt.Errorf("unparseable cache entry: %w", err)
+	}
+
+	age := time.Since(raw.Timestamp)
+	entry := CacheDebugEntry{
+		Type: raw.Type,
+		Age:  age.Round(time.Second).String(),
+		Size: info.Size(),
+	}
+	// Search pages carry facets; complete results and scans carry a hits map
+	var page struct {
+		Facets struct {
+			Pages int `json:"pages"`
+		} `json:"facets"`
+	}
+	var results completeScan
+	if json.Unmarshal(raw.Data, &page) == nil && page.Facets.Pages > 0 {
+		entry.Pages = page.Facets.Pages
+	} else if json.Unmarshal(raw.Data, &results) == nil {
+		entry.Files = countFiles(&results.Hits)
+	}
+	return entry, age, nil
+}
+
+// missingPages lists pages 1..total not present in cached.
+func missingPages(cached map[int]bool, total int) []int {
+	var missing []int
+	for page := 1; page <= total; page++ {
+		if !cached[page] {
+			missing = append(missing, page)
+		}
+	}
+	return missing
+}
+
+// formatCacheDebugReport renders the report as a table followed by its issues.
+func formatCacheDebugReport(report *CacheDebugReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cache entries for query %q in %s: %d\n", report.Query, report.CacheDir, len(report.Entries))
+	for _, e := range report.Entries {
+		detail := ""
+		switch {
+		case e.Page > 0:
+			detail = fmt.Sprintf(" page %d/%d", e.Page, e.Pages)
+		case e.Files > 0:
+			detail = fmt.Sprintf(" %d files", e.Files)
+		}
+		status := ""
+		if e.Expired {
+			status = " EXPIRED"
+		}
+		if e.Note != "" {
+			status += " (" + e.Note + ")"
+		}
+		fmt.Fprintf(&b, "- %s %s%s, age %s, %d bytes%s\n", e.Key, e.Type, detail, e.Age, e.Size, status)
+	}
+	if len(report.Issues) == 0 {
+		b.WriteString("No inconsistencies found.\n")
+		return b.String()
+	}
+	b.WriteString("Issues:\n")
+	for _, issue := range report.Issues {
+		fmt.Fprintf(&b, "⚠️ %s\n", issue)
+	}
+	return b.String()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Cache Status and Clearing
+//================================================================================
+
+// CacheEntrySummary identifies one cache entry in a status report.
+type CacheEntrySummary struct {
+	Key      string         `json:"key"`
+	Query    string         `json:"query,omitempty"`
+	Type     cacheEntryType `json:"type,omitempty"`
+	CachedAt time.Time      `json:"cached_at"`
+}
+
+// CacheTypeStatus counts the entries of one type.
+type CacheTypeStatus struct {
+	Entries int         `json:"entries"`
+	Bytes   int64       `json:"bytes"`
+	Expired int         `json:"expired"`
+	Ages    []AgeBucket `json:"ages,omitempty"` // Entries on disk and hits since startup by age
+}
+
+// CacheStatus summarizes the disk cache and the lookups served since startup.
+type CacheStatus struct {
+	CacheDir        string                     `json:"cache_dir"`
+	Disabled        bool                       `json:"disabled,omitempty"`
+	Entries         int                        `json:"entries"`
+	Bytes           int64                      `json:"bytes"`
+	Expired         int                        `json:"expired"`    // Past their TTL; removed on the next lookup or by cacheClear
+	Unreadable      int                        `json:"unreadable"` // Files that could not be parsed as cache entries
+	ByType          map[string]CacheTypeStatus `json:"by_type"`
+	Oldest          *CacheEntrySummary         `json:"oldest,omitempty"`
+	Newest          *CacheEntrySummary         `json:"newest,omitempty"`
+	Lookups         CacheLayerStats            `json:"lookups"` // Since startup
+	HitRate         float64                    `json:"hit_rate"`
+	Recommendations []TTLRecommendation        `json:"recommendations,omitempty"`
+}
+
+// cacheFile is one file in the cache directory with its parsed entry header.
+type cacheFile struct {
+	name  string
+	size  int64
+	entry *CacheEntry[json.RawMessage] // nil when the file could not be parsed
+}
+
+// readCacheDir lists the cache entry files in dir. A missing directory holds no entries.
+func readCacheDir(dir string) ([]cacheFile, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []cacheFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		file := cacheFile{name: e.Name()}
+		if info, err := e.Info(); err == nil {
+			file.size = info.Size()
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, e.Name())); err == nil {
+			var entry CacheEntry[json.RawMessage]
+			if json.Unmarshal(data, &entry) == nil && !entry.Timestamp.IsZero() {
+				file.entry = &entry
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// cacheStatus inspects the cache directory.
+func cacheStatus() (*CacheStatus, error) {
+	cfg := GetConfig()
+	status := &CacheStatus{CacheDir: cfg.CacheDir, Disabled: cfg.NoCache, ByType: make(map[string]CacheTypeStatus), Lookups: hotCache.stats()}
+	if lookups := status.Lookups.MemoryHits + status.Lookups.DiskHits + status.Lookups.Misses; lookups > 0 {
+		status.HitRate = float64(status.Lookups.MemoryHits+status.Lookups.DiskHits) / float64(lookups)
+	}
+
+	files, err := readCacheDir(cfg.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache files: %w", err)
+	}
+	now := time.Now()
+	for _, file := range files {
+		status.Bytes += file.size
+		if file.entry == nil {
+			status.Unreadable++
+			continue
+		}
+		status.Entries++
+		typeName := string(file.entry.Type)
+		if typeName == "" {
+			typeName = "untyped" // Written before entry types were recorded
+		}
+		byType := status.ByType[typeName]
+		byType.Entries++
+		byType.Bytes += file.size
+		if now.Sub(file.entry.Timestamp) > cfg.CacheTTLs.For(file.entry.Type) {
+			byType.Expired++
+			status.Expired++
+		}
+		status.ByType[typeName] = byType
+
+		summary := &CacheEntrySummary{Key: strings.TrimSuffix(file.name, ".json"), Query: file.entry.Query, Type: file.entry.Type, CachedAt: file.entry.Timestamp}
+		if status.Oldest == nil || summary.CachedAt.Before(status.Oldest.CachedAt) {
+			status.Oldest = summary
+		}
+		if status.Newest == nil || summary.CachedAt.After(status.Newest.CachedAt) {
+			status.Newest = summary
+		}
+	}
+	addAgeStatistics(status, files, cfg.CacheTTLs, now)
+	return status, nil
+}
+
+// CacheClearResult reports what cacheClear removed.
+type CacheClearResult struct {
+	Removed int      `json:"removed"`
+	Bytes   int64    `json:"bytes"`
+	Failed  []string `json:"failed,omitempty"`
+}
+
+// clearCache removes cache entries from disk and memory. A non-empty query limits it to
+// that query's entries, and expiredOnly to entries past their TTL. Unreadable files are
+// removed along with everything else when neither limit is given.
+func clearCache(query string, expiredOnly bool) (*CacheClearResult, error) {
+	cfg := GetConfig()
+	files, err := readCacheDir(cfg.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache files: %w", err)
+	}
+	result := &CacheClearResult{}
+	now := time.Now()
+	for _, file := range files {
+		switch {
+		case file.entry == nil:
+			if query != "" || expiredOnly {
+				continue
+			}
+		case query != "" && file.entry.Query != query:
+			continue
+		case expiredOnly && now.Sub(file.entry.Timestamp) <= cfg.CacheTTLs.For(file.entry.Type):
+			continue
+		}
+		if err := os.Remove(filepath.Join(cfg.CacheDir, file.name)); err != nil {
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %v", file.name, err))
+			continue
+		}
+		hotCache.remove(strings.TrimSuffix(file.name, ".json"))
+		result.Removed++
+		result.Bytes += file.size
+	}
+	if query == "" && !expiredOnly {
+		hotCache.clear() // Memory-only entries written while the disk was degraded
+	}
+	return result, nil
+}
+
+// formatCacheStatus renders a cache status as a readable summary.
+func formatCacheStatus(s *CacheStatus) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "💾 Cache directory: %s", s.CacheDir)
+	if s.Disabled {
+		b.WriteString(" (disk caching disabled)")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "📦 %d entries, %s, %d expired", s.Entries, formatBytes(s.Bytes), s.Expired)
+	if s.Unreadable > 0 {
+		fmt.Fprintf(&b, ", %d unreadable", s.Unreadable)
+	}
+	b.WriteString("\n")
+	types := make([]string, 0, len(s.ByType))
+	for name := range s.ByType {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	for _, name := range types {
+		t := s.ByType[name]
+		fmt.Fprintf(&b, "   %-12s %5d entries %10s %5d expired\n", name, t.Entries, formatBytes(t.Bytes), t.Expired)
+	}
+	if len(types) > 0 {
+		b.WriteString("📊 Entries/hits by age:\n")
+		for _, name := range types {
+			if ages := formatAgeBuckets(s.ByType[name].Ages); ages != "" {
+				fmt.Fprintf(&b, "   %-12s %s\n", name, ages)
+			}
+		}
+	}
+	if s.Oldest != nil {
+		fmt.Fprintf(&b, "⏮️ Oldest: %s %s %q\n", s.Oldest.CachedAt.Format(time.RFC3339), s.Oldest.Type, s.Oldest.Query)
+		fmt.Fprintf(&b, "⏭️ Newest: %s %s %q\n", s.Newest.CachedAt.Format(time.RFC3339), s.Newest.Type, s.Newest.Query)
+	}
+	l := s.Lookups
+	fmt.Fprintf(&b, "🎯 Since startup: %.1f%% hit rate (%d memory hits, %d disk hits, %d misses), %d entries in memory\n",
+		s.HitRate*100, l.MemoryHits, l.DiskHits, l.Misses, l.MemoryEntries)
+	for _, rec := range s.Recommendations {
+		fmt.Fprintf(&b, "💡 %s\n", rec.Message)
+	}
+	return b.String()
+}
+
+// formatBytes renders a byte count with a binary unit.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+//================================================================================
+// Duplicate Search Coalescing
+//================================================================================
+
+// scanFlight is one in-progress scan that identical concurrent searches wait for.
+type scanFlight struct {
+	done      chan struct{}
+	scan      *searchScan // Private copy for followers; set before done is closed
+	err       error
+	followers int
+}
+
+// scanCoalescer lets concurrent identical searches share one upstream scan. Only
+// successful scans are shared: a failure may be specific to the leader's deadline or API
+// budget, so followers then run their own scan.
+type scanCoalescer struct {
+	mu      sync.Mutex
+	flights map[string]*scanFlight
+}
+
+var searchFlights = newScanCoalescer()
+
+func newScanCoalescer() *scanCoalescer {
+	return &scanCoalescer{flights: make(map[string]*scanFlight)}
+}
+
+// scanFlightKey identifies searches that produce the same scan: the normalized query and
+// filters as used for page caching, plus everything else that changes the merged result.
+// Scans are only shared within a tenant, as each tenant's provider allowlist and API budget
+// apply to the requests of its own scans.
+func scanFlightKey(ctx context.Context, args map[string]interface{}, maxPages int) string {
+	strategy, _ := parseMergeStrategy(args)
+	cacheTTL, _ := args["cacheTTL"].(string)
+	forceRefresh, _ := args["forceRefresh"].(bool)
+	collection, _ := args["collection"].(string)
+	return generateCacheKey(map[string]interface{}{
+		"scan":         searchPageCacheKey(args, 0),
+		"collection":   collectionKey(collection),
+		"maxPages":     maxPages,
+		"merge":        string(strategy),
+		"cacheTTL":     cacheTTL,
+		"forceRefresh": forceRefresh,
+		"tenant":       tenantNameFromContext(ctx),
+	})
+}
+
+// do runs scan once per key at a time. Callers arriving while it runs wait and receive a
+// copy of its result with Shared set.
+func (c *scanCoalescer) do(ctx context.Context, key string, scan func() (*searchScan, error)) (*searchScan, error) {
+	c.mu.Lock()
+	if flight, ok := c.flights[key]; ok {
+		flight.followers++
+		c.mu.Unlock()
+		select {
+		case <-flight.done:
+			if flight.err == nil {
+				shared := cloneScan(flight.scan)
+				shared.Shared = true
+				return shared, nil
+			}
+			log.Printf("🔁 Shared scan failed (%v); running this search separately", flight.err)
+			return scan()
+		case <-ctx.Done():
+			return &searchScan{Hits: &Hits{}}, ctx.Err()
+		}
+	}
+	flight := &scanFlight{done: make(chan struct{})}
+	c.flights[key] = flight
+	c.mu.Unlock()
+
+	result, err := scan()
+
+	c.mu.Lock()
+	delete(c.flights, key)
+	followers := flight.followers
+	c.mu.Unlock()
+	if followers > 0 {
+		log.Printf("🤝 Shared one scan with %d identical concurrent searches", followers)
+		flight.err = err
+		if err == nil {
+			flight.scan = cloneScan(result) // The leader may go on to modify its own copy
+		}
+	}
+	close(flight.done)
+	return result, err
+}
+
+// cloneScan copies a scan deeply enough that the copy's hits and page records can be
+// changed independently.
+func cloneScan(scan *searchScan) *searchScan {
+	copied := *scan
+	copied.Hits = &Hits{Hits: make(map[string]map[string]map[string]string, len(scan.Hits.Hits))}
+	for repo, files := range scan.Hits.Hits {
+		copiedFiles := make(map[string]map[string]string, len(files))
+		for filePath, lines := range files {
+			copiedLines := make(map[string]string, len(lines))
+			for lineNum, line := range lines {
+				copiedLines[lineNum] = line
+			}
+			copiedFiles[filePath] = copiedLines
+		}
+		copied.Hits.Hits[repo] = copiedFiles
+	}
+	copied.Hits.Context = copyLines(scan.Hits.Context)
+	copied.Pages = append([]PageFetch(nil), scan.Pages...)
+	copied.SchemaIssues = append([]string(nil), scan.SchemaIssues...)
+	copied.CollisionSamples = append([]LineCollision(nil), scan.CollisionSamples...)
+	return &copied
+}
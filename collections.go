@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Repository Collections
+//================================================================================
+
+const (
+	collectionsFileName  = "collections.json"
+	maxCollectionRepos   = 100 // Repositories in one collection; each is at least one search request
+	maxCollectionScans   = 4   // Per-repository scans of a collection search running at once
+	collectionNameFormat = "letters, digits, '-', '_' and '.'"
+)
+
+// Collection is a named set of repositories that searchCode can search as one. Collections
+// without a tenant are shared; a tenant's own collections are visible only to it and take
+// precedence over a shared collection of the same name.
+type Collection struct {
+	Name        string    `json:"name"`
+	Tenant      string    `json:"tenant,omitempty"` // Profile that saved it; empty for shared collections
+	Description string    `json:"description,omitempty"`
+	Repos       []string  `json:"repos"` // Canonical owner/name, or host/owner/name outside GitHub
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// collectionKey normalizes a collection name for lookup, so that "CNCF" finds "cncf".
+func collectionKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// storedCollectionKey keys a collection in the file by its tenant and normalized name.
+// Names cannot contain '/', so a tenant's keys never collide with shared ones.
+func storedCollectionKey(tenant, name string) string {
+	if tenant == "" {
+		return collectionKey(name)
+	}
+	return tenant + "/" + collectionKey(name)
+}
+
+// visibleCollections returns the collections tenant can use, keyed by collectionKey: the
+// shared ones, replaced by the tenant's own where the names match.
+func visibleCollections(collections map[string]Collection, tenant string) map[string]Collection {
+	visible := make(map[string]Collection)
+	for _, c := range collections {
+		if c.Tenant == "" {
+			visible[collectionKey(c.Name)] = c
+		}
+	}
+	if tenant != "" {
+		for _, c := range collections {
+			if c.Tenant == tenant {
+				visible[collectionKey(c.Name)] = c
+			}
+		}
+	}
+	return visible
+}
+
+// validate checks the name and canonicalizes the repositories, dropping duplicates.
+func (c *Collection) validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("collection name must not be empty")
+	}
+	for _, r := range c.Name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.", r)) {
+			return fmt.Errorf("invalid collection name %q: use %s", c.Name, collectionNameFormat)
+		}
+	}
+	var repos []string
+	for _, repo := range c.Repos {
+		repo = canonicalRepo(strings.TrimSpace(repo))
+		if repo == "" {
+			continue
+		}
+		if _, err := parseRepoRef(repo); err != nil {
+			return fmt.Errorf("collection %q: %w", c.Name, err)
+		}
+		if !containsString(repos, repo) {
+			repos = append(repos, repo)
+		}
+	}
+	if len(repos) == 0 {
+		return fmt.Errorf("collection %q must list at least one repository", c.Name)
+	}
+	if len(repos) > maxCollectionRepos {
+		return fmt.Errorf("collection %q lists %d repositories; at most %d are allowed", c.Name, len(repos), maxCollectionRepos)
+	}
+	c.Repos = repos
+	return nil
+}
+
+// collectionsMu serializes reads and writes of the collections file.
+var collectionsMu sync.Mutex
+
+// collectionsFile holds the collections, next to the pattern library unless configured.
+func collectionsFile() string {
+	if path := GetConfig().CollectionsFile; path != "" {
+		return path
+	}
+	return filepath.Join(patternDir(), collectionsFileName)
+}
+
+// loadCollections reads the collections keyed by storedCollectionKey. A missing file holds none.
+func loadCollections() (map[string]Collection, error) {
+	collections := make(map[string]Collection)
+	data, err := os.ReadFile(collectionsFile())
+	if os.IsNotExist(err) {
+		return collections, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Collection
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse collections file %s: %w", collectionsFile(), err)
+	}
+	for _, c := range list {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("invalid collections file %s: %w", collectionsFile(), err)
+		}
+		collections[storedCollectionKey(c.Tenant, c.Name)] = c
+	}
+	return collections, nil
+}
+
+// storeCollections replaces the collections file atomically, with collections sorted by name.
+func storeCollections(collections map[string]Collection) error {
+	encoded, err := json.MarshalIndent(sortedCollections(collections), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := collectionsFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encoded, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// sortedCollections lists the collections by name, and by tenant within a name.
+func sortedCollections(collections map[string]Collection) []Collection {
+	list := make([]Collection, 0, len(collections))
+	for _, c := range collections {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if ki, kj := collectionKey(list[i].Name), collectionKey(list[j].Name); ki != kj {
+			return ki < kj
+		}
+		return list[i].Tenant < list[j].Tenant
+	})
+	return list
+}
+
+// saveCollection validates a collection and stores it for the caller's tenant, replacing
+// the tenant's collection of the same name. Callers without a tenant save shared collections.
+func saveCollection(ctx context.Context, c Collection) (Collection, error) {
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+	c.Tenant = tenantNameFromContext(ctx)
+	c.UpdatedAt = time.Now().UTC()
+	collectionsMu.Lock()
+	defer collectionsMu.Unlock()
+	collections, err := loadCollections()
+	if err != nil {
+		return c, err
+	}
+	collections[storedCollectionKey(c.Tenant, c.Name)] = c
+	return c, storeCollections(collections)
+}
+
+// deleteCollection removes one of the caller's tenant's collections. Shared collections can
+// only be deleted by callers without a tenant.
+func deleteCollection(ctx context.Context, name string) error {
+	tenant := tenantNameFromContext(ctx)
+	collectionsMu.Lock()
+	defer collectionsMu.Unlock()
+	collections, err := loadCollections()
+	if err != nil {
+		return err
+	}
+	key := storedCollectionKey(tenant, name)
+	if _, ok := collections[key]; !ok {
+		if _, shared := collections[collectionKey(name)]; shared && tenant != "" {
+			return fmt.Errorf("collection %q is shared and cannot be deleted by tenant %s", name, tenant)
+		}
+		return fmt.Errorf("no collection named %q", name)
+	}
+	delete(collections, key)
+	return storeCollections(collections)
+}
+
+// listCollections returns the collections visible to the caller, sorted by name.
+func listCollections(ctx context.Context) ([]Collection, error) {
+	collectionsMu.Lock()
+	defer collectionsMu.Unlock()
+	collections, err := loadCollections()
+	if err != nil {
+		return nil, err
+	}
+	return sortedCollections(visibleCollections(collections, tenantNameFromContext(ctx))), nil
+}
+
+// resolveCollection returns the repositories of the named collection visible to the caller.
+func resolveCollection(ctx context.Context, name string) ([]string, error) {
+	collectionsMu.Lock()
+	stored, err := loadCollections()
+	collectionsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	collections := visibleCollections(stored, tenantNameFromContext(ctx))
+	c, ok := collections[collectionKey(name)]
+	if !ok {
+		names := make([]string, 0, len(collections))
+		for _, c := range sortedCollections(collections) {
+			names = append(names, c.Name)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown collection %q: no collections are defined; add one with saveCollection", name)
+		}
+		return nil, fmt.Errorf("unknown collection %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+	return c.Repos, nil
+}
+
+// formatCollections renders the collections as a readable list.
+func formatCollections(list []Collection) string {
+	if len(list) == 0 {
+		return "No collections are defined. Add one with saveCollection."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "📚 %d collections:\n", len(list))
+	for _, c := range list {
+		fmt.Fprintf(&b, "\n%s (%d repositories)", c.Name, len(c.Repos))
+		if c.Description != "" {
+			fmt.Fprintf(&b, ": %s", c.Description)
+		}
+		b.WriteString("\n")
+		for _, repo := range c.Repos {
+			fmt.Fprintf(&b, "  - %s\n", repo)
+		}
+	}
+	return b.String()
+}
+
+// scanGrepAppCollection searches each repository of a collection with repoFilter set to it,
+// a few at a time, and merges the hits as scanGrepAppLanguages merges languages. A langFilter
+// listing several languages is still searched per language within each repository, one
+// language at a time, so that at most maxCollectionScans requests run at once.
+func scanGrepAppCollection(ctx context.Context, client *http.Client, args map[string]interface{}, repos []string, maxPages int) (*searchScan, error) {
+	log.Printf("📚 Fanning out search across %d repositories of collection %v", len(repos), args["collection"])
+
+	resultsChan := make(chan labeledScan, len(repos))
+	slots := make(chan struct{}, maxCollectionScans)
+	var wg sync.WaitGroup
+	for _, repo := range repos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			repoArgs := copyArgs(args)
+			delete(repoArgs, "collection") // Per-repository scans share the cache of plain repoFilter searches
+			repoArgs["repoFilter"] = repo
+			scan, err := scanLanguagesConcurrently(ctx, client, repoArgs, maxPages, 1)
+			resultsChan <- labeledScan{label: "repository " + repo, scan: scan, err: err}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultsChan)
+	}()
+	return mergeScans(args, resultsChan)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sync"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Ref Resolution
+//================================================================================
+
+// commitSHAPattern matches a full commit SHA, which needs no resolving.
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// repoRefKey is one repository at one requested ref; an empty ref is the default branch.
+type repoRefKey struct {
+	owner, repo, ref string
+}
+
+// contentsOptions returns the Contents API options that read at ref, or nil for the
+// default branch.
+func contentsOptions(ref string) *github.RepositoryContentGetOptions {
+	if ref == "" {
+		return nil
+	}
+	return &github.RepositoryContentGetOptions{Ref: ref}
+}
+
+// resolveCommits resolves each distinct repository ref requested to the commit SHA it
+// points at, so all files of a repository are read from the same commit and the result
+// records which one. Requests for the default branch are not resolved, which would cost
+// a rate-limited request per repository. Refs that fail to resolve are left out; their
+// files are read at the ref as given.
+func resolveCommits(ctx context.Context, ghClient *github.Client, requests []GitHubFileRequest) map[repoRefKey]string {
+	commits := make(map[repoRefKey]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[repoRefKey]bool)
+	for _, req := range requests {
+		key := repoRefKey{req.Owner, req.Repo, req.Ref}
+		if key.ref == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if commitSHAPattern.MatchString(req.Ref) {
+			commits[key] = req.Ref
+			continue
+		}
+		wg.Add(1)
+		go func(key repoRefKey) {
+			defer wg.Done()
+			sha, _, err := ghClient.Repositories.GetCommitSHA1(ctx, key.owner, key.repo, key.ref, "")
+			if err != nil {
+				log.Printf("⚠️ Could not resolve %s/%s@%s to a commit, reading files at the ref: %v", key.owner, key.repo, key.ref, err)
+				return
+			}
+			log.Printf("📌 Resolved %s/%s@%s to commit %s", key.owner, key.repo, key.ref, sha)
+			mu.Lock()
+			commits[key] = sha
+			mu.Unlock()
+		}(key)
+	}
+	wg.Wait()
+	return commits
+}
+
+// pinRequest returns req reading at its resolved commit, when there is one.
+func pinRequest(req GitHubFileRequest, commits map[repoRefKey]string) GitHubFileRequest {
+	if sha := commits[repoRefKey{req.Owner, req.Repo, req.Ref}]; sha != "" {
+		req.Ref = sha
+	}
+	return req
+}
+
+// stampCommit records the requested ref and resolved commit on files read for req.
+func stampCommit(files []RetrievedFile, req GitHubFileRequest, commits map[repoRefKey]string) []RetrievedFile {
+	sha := commits[repoRefKey{req.Owner, req.Repo, req.Ref}]
+	for i := range files {
+		files[i].Ref = req.Ref
+		files[i].CommitSHA = sha
+	}
+	return files
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+//================================================================================
+// Cache Entry Types
+//================================================================================
+
+// cacheEntryType identifies the kind of data stored in a cache file. Each type has its
+// own staleness tolerance and therefore its own TTL.
+type cacheEntryType string
+
+const (
+	cacheEntrySearchPage cacheEntryType = "search_page" // Single grep.app API page
+	cacheEntryComplete   cacheEntryType = "complete"    // Merged multi-page result used by batch retrieval
+	cacheEntrySearchScan cacheEntryType = "search_scan" // Fully paged scan reused for subset queries
+	cacheEntryFile       cacheEntryType = "file"        // GitHub file contents
+	cacheEntryRepoMeta   cacheEntryType = "repo_meta"   // GitHub repository metadata
+)
+
+// searchPageKeyVersion is the format of search page cache keys. Version 1 keys held only
+// some of the filters; pages stored under them are never looked up again and are purged
+// at startup.
+const searchPageKeyVersion = 2
+
+// CacheTTLConfig holds the TTL for each cache entry type.
+type CacheTTLConfig struct {
+	SearchPage time.Duration
+	Complete   time.Duration
+	File       time.Duration
+	RepoMeta   time.Duration
+}
+
+// For returns the configured TTL for the given entry type.
+func (c CacheTTLConfig) For(entryType cacheEntryType) time.Duration {
+	switch entryType {
+	case cacheEntrySearchPage, cacheEntrySearchScan:
+		return c.SearchPage
+	case cacheEntryComplete:
+		return c.Complete
+	case cacheEntryFile:
+		return c.File
+	case cacheEntryRepoMeta:
+		return c.RepoMeta
+	default:
+		return c.SearchPage
+	}
+}
+
+// cacheTTLFlags names the flag that sets each entry type's TTL.
+func (c *CacheTTLConfig) cacheTTLFlags() map[string]*time.Duration {
+	return map[string]*time.Duration{
+		"cache-ttl-search":   &c.SearchPage,
+		"cache-ttl-complete": &c.Complete,
+		"cache-ttl-file":     &c.File,
+		"cache-ttl-repo":     &c.RepoMeta,
+	}
+}
+
+// setAll sets the TTL of every entry type except those whose flag was given explicitly.
+func (c *CacheTTLConfig) setAll(ttl time.Duration, explicit map[string]bool) {
+	for name, target := range c.cacheTTLFlags() {
+		if !explicit[name] {
+			*target = ttl
+		}
+	}
+}
+
+//================================================================================
+// Server Configuration
+//================================================================================
+
+// Environment variables that override configuration defaults. Command-line flags take
+// precedence over environment variables.
+const (
+	envCacheDir           = "GREPAPP_CACHE_DIR"
+	envNoCache            = "GREPAPP_NO_CACHE"
+	envLogDir             = "GREPAPP_LOG_DIR"
+	envLogFilePattern     = "GREPAPP_LOG_FILE_PATTERN"
+	envMemoryCacheEntries = "GREPAPP_MEMORY_CACHE_ENTRIES"
+	envCORSOrigins        = "GREPAPP_CORS_ORIGINS"
+	envCORSMethods        = "GREPAPP_CORS_METHODS"
+	envCORSHeaders        = "GREPAPP_CORS_HEADERS"
+	envMaxRequestsPerCall = "GREPAPP_MAX_REQUESTS_PER_CALL"
+	envMaxRequestsPerHour = "GREPAPP_MAX_REQUESTS_PER_HOUR"
+	envProfilesFile       = "GREPAPP_PROFILES_FILE"
+	envKnowledgeBaseFile  = "GREPAPP_KNOWLEDGE_BASE"
+	envPolicyFile         = "GREPAPP_POLICY_FILE"
+	envLogSync            = "GREPAPP_LOG_SYNC"
+	envLogFlushInterval   = "GREPAPP_LOG_FLUSH_INTERVAL"
+	envSkipSelfCheck      = "GREPAPP_SKIP_SELF_CHECK"
+	envUserAgent          = "GREPAPP_USER_AGENT"
+	envExtraHeaders       = "GREPAPP_EXTRA_HEADERS"
+	envStaleAfter         = "GREPAPP_STALE_AFTER"
+	envMinFreeDiskMB      = "GREPAPP_MIN_FREE_DISK_MB"
+	envLanguageOverrides  = "GREPAPP_LANGUAGE_OVERRIDES"
+	envPreload            = "GREPAPP_PRELOAD"
+	envWatchInterval      = "GREPAPP_WATCH_INTERVAL"
+	envMaxPages           = "GREPAPP_MAX_PAGES"
+	envGitHubToken        = "GITHUB_TOKEN"
+	envMaxResultMemoryMB  = "GREPAPP_MAX_RESULT_MEMORY_MB"
+	envCacheTTL           = "GREPAPP_CACHE_TTL"
+	envFallback           = "GREPAPP_FALLBACK"
+	envMaxRetries         = "GREPAPP_MAX_RETRIES"
+	envRetryBaseDelay     = "GREPAPP_RETRY_BASE_DELAY"
+	envTranslateURL       = "GREPAPP_TRANSLATE_URL"
+	envTranslateAPIKey    = "GREPAPP_TRANSLATE_API_KEY"
+	envPatternsFile       = "GREPAPP_PATTERNS_FILE"
+	envCollectionsFile    = "GREPAPP_COLLECTIONS_FILE"
+	envPatternKeyFile     = "GREPAPP_PATTERN_KEY_FILE"
+	envTrustedPatternKeys = "GREPAPP_TRUSTED_PATTERN_KEYS"
+	envEnabledTools       = "GREPAPP_ENABLED_TOOLS"
+	envDisabledTools      = "GREPAPP_DISABLED_TOOLS"
+	envAuditLog           = "GREPAPP_AUDIT_LOG"
+	envWorkspaceRoot      = "GREPAPP_WORKSPACE_ROOT"
+	envMaxFileBytes       = "GREPAPP_MAX_FILE_BYTES"
+	envMaxBatchBytes      = "GREPAPP_MAX_BATCH_BYTES"
+	envGitHubConcurrency  = "GREPAPP_GITHUB_CONCURRENCY"
+	envGitHubInterval     = "GREPAPP_GITHUB_REQUEST_INTERVAL"
+	envAllowImport        = "GREPAPP_ALLOW_SNAPSHOT_IMPORT"
+)
+
+// Config holds runtime settings for the server.
+type Config struct {
+	CacheDir              string
+	NoCache               bool
+	MemoryCacheEntries    int // Capacity of the in-memory layer in front of the disk cache
+	LogDir                string
+	LogFilePattern        string
+	LogWrite              LogWriteConfig
+	CacheTTLs             CacheTTLConfig
+	CORS                  CORSConfig
+	Budget                BudgetConfig
+	ProfilesFile          string // JSON tenant profiles for the http transport; empty leaves it unauthenticated
+	KnowledgeBaseFile     string // Recovery knowledge base exported by the analyzer; empty uses the log directory
+	PolicyFile            string // JSON tool call policy applied before every tool call
+	SkipSelfCheck         bool   // Skip the readiness probes run at startup
+	RequestHeaders        RequestHeaderConfig
+	StaleAfter            time.Duration     // Cache age that triggers a staleness warning; 0 disables it
+	MinFreeDiskMB         int               // Free space below which cache and log writes stop; 0 disables the check
+	LanguageOverrides     map[string]string // Lowercase extension or file name to language, checked before the built-in mapping
+	PreloadPaths          []string          // Snapshot archives or directories of them imported into the cache at startup
+	WatchInterval         time.Duration     // How often subscribed queries are searched again; 0 disables result watching
+	MaxPages              int               // Result pages a search fetches unless the call sets maxPages
+	GitHubToken           string            // Authenticates GitHub requests; tenant profiles may use their own
+	MaxResultMemoryMB     int               // Unmerged search hits held in memory before spilling to disk; 0 disables spilling
+	Fallback              []string          // Providers searched in order when grep.app fails; empty disables fallback
+	Retry                 RetryConfig
+	TranslateURL          string        // LibreTranslate-compatible endpoint for translateComments; empty disables translation
+	TranslateAPIKey       string        // Sent as api_key to the translation endpoint when set
+	PatternsFile          string        // Saved pattern library; empty uses patterns/patterns.json in the cache directory
+	CollectionsFile       string        // Named repository sets searchCode's collection argument searches; empty uses collections.json next to the pattern library
+	PatternKeyFile        string        // Ed25519 seed that signs exported pattern bundles; created on first export
+	TrustedPatternKeys    []string      // Base64 public keys whose pattern bundles import without allowUntrusted
+	EnabledTools          []string      // Tools and tool groups offered to clients; empty offers all of them
+	DisabledTools         []string      // Tools and tool groups hidden from clients, applied after EnabledTools
+	AuditLogFile          string        // Append-only log of every file retrieval; empty disables auditing
+	WorkspaceRoot         string        // Directory compareLocal may read local files from; empty allows only passed content
+	MaxFileBytes          int           // Content returned per retrieved file before head/tail truncation; 0 disables the limit
+	MaxBatchBytes         int           // Content returned across a batch retrieval; 0 disables the limit
+	GitHubConcurrency     int           // Files or archives a retrieval fetches from GitHub at once
+	GitHubRequestInterval time.Duration // Minimum spacing between the starts of GitHub fetches; 0 disables pacing
+	AllowSnapshotImport   bool          // Let HTTP callers without a tenant profile import snapshots
+}
+
+// defaultConfig returns the configuration used when no flags are given.
+func defaultConfig() *Config {
+	return &Config{
+		CacheDir:           defaultCacheDirPath(),
+		LogDir:             defaultLogDirPath(),
+		LogFilePattern:     defaultLogFilePattern,
+		LogWrite:           LogWriteConfig{FlushInterval: defaultLogFlushInterval},
+		MemoryCacheEntries: 256,
+		CacheTTLs: CacheTTLConfig{
+			SearchPage: 12 * time.Hour,
+			Complete:   24 * time.Hour, // Batch retrieval depends on complete results, so keep them longest among search data
+			File:       6 * time.Hour,
+			RepoMeta:   7 * 24 * time.Hour,
+		},
+		CORS:                  defaultCORSConfig(),
+		StaleAfter:            defaultStaleAfter,
+		MinFreeDiskMB:         defaultMinFreeDiskMB,
+		WatchInterval:         defaultWatchInterval,
+		MaxPages:              maxSearchPages,
+		MaxResultMemoryMB:     defaultMaxResultMemoryMB,
+		Retry:                 defaultRetryConfig(),
+		MaxFileBytes:          defaultMaxFileBytes,
+		MaxBatchBytes:         defaultMaxBatchBytes,
+		GitHubConcurrency:     defaultGitHubConcurrency,
+		GitHubRequestInterval: defaultGitHubRequestInterval,
+	}
+}
+
+var appConfig = defaultConfig()
+
+// applyEnv overrides configuration defaults from environment variables.
+func (c *Config) applyEnv() error {
+	if v := os.Getenv(envCacheDir); v != "" {
+		c.CacheDir = v
+	}
+	if v := os.Getenv(envLogDir); v != "" {
+		c.LogDir = v
+	}
+	if v := os.Getenv(envLogFilePattern); v != "" {
+		c.LogFilePattern = v
+	}
+	if v := os.Getenv(envKnowledgeBaseFile); v != "" {
+		c.KnowledgeBaseFile = v
+	}
+	if v := os.Getenv(envPolicyFile); v != "" {
+		c.PolicyFile = v
+	}
+	if v := os.Getenv(envProfilesFile); v != "" {
+		c.ProfilesFile = v
+	}
+	if v := os.Getenv(envCORSOrigins); v != "" {
+		c.CORS.AllowedOrigins = splitCommaList(v)
+	}
+	if v := os.Getenv(envCORSMethods); v != "" {
+		c.CORS.AllowedMethods = splitCommaList(v)
+	}
+	if v := os.Getenv(envCORSHeaders); v != "" {
+		c.CORS.AllowedHeaders = splitCommaList(v)
+	}
+	if v := os.Getenv(envMemoryCacheEntries); v != "" {
+		entries, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMemoryCacheEntries, v, err)
+		}
+		c.MemoryCacheEntries = entries
+	}
+	if v := os.Getenv(envMaxRequestsPerCall); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMaxRequestsPerCall, v, err)
+		}
+		c.Budget.MaxRequestsPerCall = limit
+	}
+	if v := os.Getenv(envMaxRequestsPerHour); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMaxRequestsPerHour, v, err)
+		}
+		c.Budget.MaxRequestsPerHour = limit
+	}
+	if v := os.Getenv(envLogSync); v != "" {
+		logSync, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envLogSync, v, err)
+		}
+		c.LogWrite.Sync = logSync
+	}
+	if v := os.Getenv(envLogFlushInterval); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envLogFlushInterval, v, err)
+		}
+		c.LogWrite.FlushInterval = interval
+	}
+	if v := os.Getenv(envUserAgent); v != "" {
+		c.RequestHeaders.UserAgent = v
+	}
+	if v := os.Getenv(envExtraHeaders); v != "" {
+		headers, err := parseHeaderList(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value: %w", envExtraHeaders, err)
+		}
+		c.RequestHeaders.Extra = headers
+	}
+	if v := os.Getenv(envStaleAfter); v != "" {
+		staleAfter, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envStaleAfter, v, err)
+		}
+		c.StaleAfter = staleAfter
+	}
+	if v := os.Getenv(envCacheTTL); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid %s value %q: must be a positive duration", envCacheTTL, v)
+		}
+		c.CacheTTLs.setAll(ttl, nil)
+	}
+	if v := os.Getenv(envLanguageOverrides); v != "" {
+		overrides, err := parseLanguageOverrides(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value: %w", envLanguageOverrides, err)
+		}
+		c.LanguageOverrides = overrides
+	}
+	if v := os.Getenv(envWatchInterval); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envWatchInterval, v, err)
+		}
+		c.WatchInterval = interval
+	}
+	if v := os.Getenv(envMaxPages); v != "" {
+		maxPages, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMaxPages, v, err)
+		}
+		c.MaxPages = maxPages
+	}
+	if v := os.Getenv(envMaxResultMemoryMB); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMaxResultMemoryMB, v, err)
+		}
+		c.MaxResultMemoryMB = limit
+	}
+	if v := os.Getenv(envGitHubToken); v != "" {
+		c.GitHubToken = v
+	}
+	if v := os.Getenv(envPreload); v != "" {
+		c.PreloadPaths = splitCommaList(v)
+	}
+	if v := os.Getenv(envMaxRetries); v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMaxRetries, v, err)
+		}
+		c.Retry.MaxRetries = retries
+	}
+	if v := os.Getenv(envRetryBaseDelay); v != "" {
+		delay, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envRetryBaseDelay, v, err)
+		}
+		c.Retry.BaseDelay = delay
+	}
+	if v := os.Getenv(envFallback); v != "" {
+		c.Fallback = splitCommaList(v)
+	}
+	if v := os.Getenv(envTranslateURL); v != "" {
+		c.TranslateURL = v
+	}
+	if v := os.Getenv(envTranslateAPIKey); v != "" {
+		c.TranslateAPIKey = v
+	}
+	if v := os.Getenv(envPatternsFile); v != "" {
+		c.PatternsFile = v
+	}
+	if v := os.Getenv(envCollectionsFile); v != "" {
+		c.CollectionsFile = v
+	}
+	if v := os.Getenv(envPatternKeyFile); v != "" {
+		c.PatternKeyFile = v
+	}
+	if v := os.Getenv(envTrustedPatternKeys); v != "" {
+		c.TrustedPatternKeys = splitCommaList(v)
+	}
+	if v := os.Getenv(envEnabledTools); v != "" {
+		c.EnabledTools = splitCommaList(v)
+	}
+	if v := os.Getenv(envDisabledTools); v != "" {
+		c.DisabledTools = splitCommaList(v)
+	}
+	if v := os.Getenv(envAuditLog); v != "" {
+		c.AuditLogFile = v
+	}
+	if v := os.Getenv(envWorkspaceRoot); v != "" {
+		c.WorkspaceRoot = v
+	}
+	if v := os.Getenv(envMaxFileBytes); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMaxFileBytes, v, err)
+		}
+		c.MaxFileBytes = limit
+	}
+	if v := os.Getenv(envMaxBatchBytes); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMaxBatchBytes, v, err)
+		}
+		c.MaxBatchBytes = limit
+	}
+	if v := os.Getenv(envGitHubConcurrency); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envGitHubConcurrency, v, err)
+		}
+		c.GitHubConcurrency = workers
+	}
+	if v := os.Getenv(envGitHubInterval); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envGitHubInterval, v, err)
+		}
+		c.GitHubRequestInterval = interval
+	}
+	if v := os.Getenv(envMinFreeDiskMB); v != "" {
+		minFree, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envMinFreeDiskMB, v, err)
+		}
+		c.MinFreeDiskMB = minFree
+	}
+	if v := os.Getenv(envSkipSelfCheck); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envSkipSelfCheck, v, err)
+		}
+		c.SkipSelfCheck = skip
+	}
+	if v := os.Getenv(envAllowImport); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envAllowImport, v, err)
+		}
+		c.AllowSnapshotImport = allow
+	}
+	if v := os.Getenv(envNoCache); v != "" {
+		noCache, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", envNoCache, v, err)
+		}
+		c.NoCache = noCache
+	}
+	return nil
+}
+
+// appDirName is the per-application subdirectory used inside OS-standard locations.
+const appDirName = "grep-app-mcp"
+
+// defaultCacheDirPath returns the OS cache directory for the server
+// ($XDG_CACHE_HOME or ~/.cache on Linux, ~/Library/Caches on macOS, %LocalAppData% on Windows),
+// falling back to ./cache when it cannot be determined.
+func defaultCacheDirPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return fallbackCacheDir
+	}
+	return filepath.Join(dir, appDirName)
+}
+
+// defaultLogDirPath returns the OS location for persistent logs
+// ($XDG_STATE_HOME or ~/.local/state on Linux, ~/Library/Logs on macOS, %LocalAppData% on Windows),
+// falling back to ./logs when it cannot be determined.
+func defaultLogDirPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, appDirName, "logs")
+		}
+	case "darwin", "ios":
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, "Library", "Logs", appDirName)
+		}
+	default:
+		if dir := os.Getenv("XDG_STATE_HOME"); dir != "" && filepath.IsAbs(dir) {
+			return filepath.Join(dir, appDirName, "logs")
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "state", appDirName, "logs")
+		}
+	}
+	return fallbackLogDir
+}
+
+// GetConfig returns the active server configuration.
+func GetConfig() *Config {
+	return appConfig
+}
+
+//================================================================================
+// Command-Line Flags
+//================================================================================
+
+// parseFlags defines the configuration flags on fs and parses args. Each flag defaults
+// to the current value, so flags given on the command line override the environment
+// applied before. -cache-ttl sets every entry type the -cache-ttl-* flags leave unset.
+func (c *Config) parseFlags(fs *flag.FlagSet, args []string) error {
+	var cacheTTL time.Duration
+	fs.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "Directory for cached search results (env "+envCacheDir+")")
+	fs.BoolVar(&c.NoCache, "no-cache", c.NoCache, "Disable disk caching; batch retrieval then has no results to work from (env "+envNoCache+")")
+	fs.StringVar(&c.LogDir, "log-dir", c.LogDir, "Directory for structured JSONL logs (env "+envLogDir+")")
+	fs.StringVar(&c.LogFilePattern, "log-file-pattern", c.LogFilePattern, "Log file name pattern; supports %date, %hostname and %pid (env "+envLogFilePattern+")")
+	fs.BoolVar(&c.LogWrite.Sync, "log-sync", c.LogWrite.Sync, "Write and fsync every log entry before continuing instead of buffering entries (env "+envLogSync+")")
+	fs.DurationVar(&c.LogWrite.FlushInterval, "log-flush-interval", c.LogWrite.FlushInterval, "How often buffered log entries are written to disk; errors are always written at once (env "+envLogFlushInterval+")")
+	fs.DurationVar(&cacheTTL, "cache-ttl", 0, "Cache TTL for every entry type; the -cache-ttl-* flags override it per type (env "+envCacheTTL+")")
+	fs.DurationVar(&c.CacheTTLs.SearchPage, "cache-ttl-search", c.CacheTTLs.SearchPage, "Cache TTL for individual grep.app search pages")
+	fs.DurationVar(&c.CacheTTLs.Complete, "cache-ttl-complete", c.CacheTTLs.Complete, "Cache TTL for complete search results used by batch retrieval")
+	fs.DurationVar(&c.CacheTTLs.File, "cache-ttl-file", c.CacheTTLs.File, "Cache TTL for GitHub file contents")
+	fs.IntVar(&c.MemoryCacheEntries, "memory-cache-entries", c.MemoryCacheEntries, "Number of cache entries kept in memory in front of the disk cache; 0 disables the memory layer (env "+envMemoryCacheEntries+")")
+	fs.DurationVar(&c.CacheTTLs.RepoMeta, "cache-ttl-repo", c.CacheTTLs.RepoMeta, "Cache TTL for GitHub repository metadata")
+	fs.Var(commaListFlag{&c.CORS.AllowedOrigins}, "cors-origins", "Comma-separated origins allowed to call the http transport, or * for any; empty disables CORS (env "+envCORSOrigins+")")
+	fs.Var(commaListFlag{&c.CORS.AllowedMethods}, "cors-methods", "Comma-separated HTTP methods allowed in CORS requests (env "+envCORSMethods+")")
+	fs.Var(commaListFlag{&c.CORS.AllowedHeaders}, "cors-headers", "Comma-separated request headers allowed in CORS requests (env "+envCORSHeaders+")")
+	fs.IntVar(&c.Budget.MaxRequestsPerCall, "max-requests-per-call", c.Budget.MaxRequestsPerCall, "Maximum upstream API requests per tool call; 0 means unlimited (env "+envMaxRequestsPerCall+")")
+	fs.IntVar(&c.Budget.MaxRequestsPerHour, "max-requests-per-hour", c.Budget.MaxRequestsPerHour, "Maximum upstream API requests per hour across all calls; 0 means unlimited (env "+envMaxRequestsPerHour+")")
+	fs.StringVar(&c.KnowledgeBaseFile, "knowledge-base", c.KnowledgeBaseFile, "Recovery knowledge base exported by the analyzer for suggestQueries (default <log-dir>/"+knowledgeBaseFileName+", env "+envKnowledgeBaseFile+")")
+	fs.StringVar(&c.ProfilesFile, "profiles", c.ProfilesFile, "JSON file mapping API keys to tenant profiles for the http transport (env "+envProfilesFile+")")
+	fs.StringVar(&c.RequestHeaders.UserAgent, "user-agent", c.RequestHeaders.UserAgent, "User-Agent sent to grep.app and GitHub (default "+defaultUserAgent()+", env "+envUserAgent+")")
+	fs.Var(languageOverridesFlag{&c.LanguageOverrides}, "language-overrides", "Comma-separated extension=Language or filename=Language overrides for inferred file languages, e.g. .h=C++ (env "+envLanguageOverrides+")")
+	fs.Var(headerFlag{&c.RequestHeaders.Extra}, "header", "Extra \"Name: value\" header sent to grep.app and GitHub; repeatable (env "+envExtraHeaders+", separated by ;)")
+	fs.DurationVar(&c.StaleAfter, "stale-after", c.StaleAfter, "Warn when served search results were cached longer ago than this; 0 disables the warning (env "+envStaleAfter+")")
+	fs.IntVar(&c.MaxPages, "max-pages", c.MaxPages, fmt.Sprintf("Result pages a search fetches unless the call sets maxPages, 1-%d (env %s)", maxPagesLimit, envMaxPages))
+	fs.DurationVar(&c.WatchInterval, "watch-interval", c.WatchInterval, "How often queries with subscribed grepapp://results resources are searched again; 0 disables result watching (env "+envWatchInterval+")")
+	fs.IntVar(&c.MaxResultMemoryMB, "max-result-memory-mb", c.MaxResultMemoryMB, "Memory for unmerged search hits, in MB, after which a multi-language search spills them to temporary files; 0 disables spilling (env "+envMaxResultMemoryMB+")")
+	fs.IntVar(&c.MinFreeDiskMB, "min-free-disk-mb", c.MinFreeDiskMB, "Stop writing cache and log files while less than this many MB are free; 0 disables the check (env "+envMinFreeDiskMB+")")
+	fs.StringVar(&c.GitHubToken, "github-token", c.GitHubToken, "GitHub token for file retrieval, directory listings and repository metadata; raises the rate limit from 60 to 5,000 requests per hour (env "+envGitHubToken+")")
+	fs.BoolVar(&c.AllowSnapshotImport, "allow-snapshot-import", c.AllowSnapshotImport, "Let HTTP callers without a tenant profile import snapshots, which replace the complete results every caller shares; tenants need allowSnapshotImport in their profile (env "+envAllowImport+")")
+	fs.BoolVar(&c.SkipSelfCheck, "skip-self-check", c.SkipSelfCheck, "Skip the startup probe of grep.app, GitHub and the cache and log directories (env "+envSkipSelfCheck+")")
+	fs.Var(commaListFlag{&c.PreloadPaths}, "preload", "Comma-separated snapshot archives from exportSnapshot, or directories of them, imported into the cache at startup (env "+envPreload+")")
+	fs.IntVar(&c.Retry.MaxRetries, "max-retries", c.Retry.MaxRetries, "Retries of a grep.app request that failed with a network error, 429 or 5xx; 0 disables retrying (env "+envMaxRetries+")")
+	fs.DurationVar(&c.Retry.BaseDelay, "retry-base-delay", c.Retry.BaseDelay, "Delay before the first retry, doubled for each later one with jitter, up to "+c.Retry.MaxDelay.String()+" (env "+envRetryBaseDelay+")")
+	fs.Var(commaListFlag{&c.Fallback}, "fallback", "Comma-separated providers searchCode falls back to, in order, when grep.app fails or times out; \"github\" uses GitHub code search, which needs a GitHub token (env "+envFallback+")")
+	fs.StringVar(&c.TranslateURL, "translate-url", c.TranslateURL, "LibreTranslate-compatible endpoint, e.g. https://libretranslate.example/translate, used to translate non-English comments when a call sets translateComments (env "+envTranslateURL+")")
+	fs.StringVar(&c.TranslateAPIKey, "translate-api-key", c.TranslateAPIKey, "API key for the translation endpoint (env "+envTranslateAPIKey+")")
+	fs.StringVar(&c.PatternsFile, "patterns-file", c.PatternsFile, "Saved search pattern library (default patterns/patterns.json in the cache directory, env "+envPatternsFile+")")
+	fs.StringVar(&c.PatternKeyFile, "pattern-key-file", c.PatternKeyFile, "Ed25519 key that signs exported pattern bundles, created on first export (default signing.key next to the pattern library, env "+envPatternKeyFile+")")
+	fs.Var(commaListFlag{&c.TrustedPatternKeys}, "trusted-pattern-keys", "Comma-separated base64 public keys whose pattern bundles importPatterns accepts without allowUntrusted (env "+envTrustedPatternKeys+")")
+	fs.StringVar(&c.CollectionsFile, "collections-file", c.CollectionsFile, "JSON list of named repository collections, [{\"name\": ..., \"repos\": [...]}], that searchCode's collection argument searches; also written by saveCollection (default collections.json next to the pattern library, env "+envCollectionsFile+")")
+	fs.Var(commaListFlag{&c.EnabledTools}, "enable-tools", "Comma-separated tools or tool groups (search, github, cache, patterns, collections, admin, write) offered to clients; empty offers all (env "+envEnabledTools+")")
+	fs.Var(commaListFlag{&c.DisabledTools}, "disable-tools", "Comma-separated tools or tool groups hidden from clients, e.g. github,write for read-only search (env "+envDisabledTools+")")
+	fs.StringVar(&c.AuditLogFile, "audit-log", c.AuditLogFile, "Append-only JSON lines audit log of every file retrieval, kept apart from the operational logs; empty disables it (env "+envAuditLog+")")
+	fs.IntVar(&c.MaxFileBytes, "max-file-bytes", c.MaxFileBytes, "Content returned per retrieved file; larger files keep their head and tail around a truncation marker. 0 disables the limit (env "+envMaxFileBytes+")")
+	fs.IntVar(&c.MaxBatchBytes, "max-batch-bytes", c.MaxBatchBytes, "Content returned across all files of a batch retrieval; files past the budget are truncated or omitted. 0 disables the limit (env "+envMaxBatchBytes+")")
+	fs.IntVar(&c.GitHubConcurrency, "github-concurrency", c.GitHubConcurrency, "Files or repository archives a retrieval fetches from GitHub at once (env "+envGitHubConcurrency+")")
+	fs.DurationVar(&c.GitHubRequestInterval, "github-request-interval", c.GitHubRequestInterval, "Minimum spacing between the starts of GitHub fetches across all calls, to stay under GitHub's secondary rate limits; 0 disables pacing (env "+envGitHubInterval+")")
+	fs.StringVar(&c.WorkspaceRoot, "workspace-root", c.WorkspaceRoot, "Directory whose files compareLocal may read through localPath; empty allows only localContent (env "+envWorkspaceRoot+")")
+	fs.StringVar(&c.PolicyFile, "policy", c.PolicyFile, "JSON tool call policy that can deny calls or rewrite their arguments (env "+envPolicyFile+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if cacheTTL < 0 {
+		return fmt.Errorf("-cache-ttl must be positive, got %s", cacheTTL)
+	}
+	if cacheTTL > 0 {
+		explicit := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		c.CacheTTLs.setAll(cacheTTL, explicit)
+	}
+	return nil
+}
+
+// cacheTTLFor returns the TTL for an entry type, preferring a positive per-call override.
+func cacheTTLFor(entryType cacheEntryType, override time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+	return GetConfig().CacheTTLs.For(entryType)
+}
+
+// parseCacheTTLArg reads the optional per-call cacheTTL argument. It accepts a Go duration
+// string such as "30m" or a number of seconds. A zero result means no override. forceRefresh
+// overrides it with a TTL every cached entry exceeds.
+func parseCacheTTLArg(args map[string]interface{}) (time.Duration, error) {
+	refresh, err := argBool(args, "forceRefresh")
+	if err != nil {
+		return 0, err
+	}
+	if refresh {
+		return time.Nanosecond, nil
+	}
+	raw, ok := args["cacheTTL"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	switch v := raw.(type) {
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cacheTTL %q: %w", v, err)
+		}
+		if ttl < 0 {
+			return 0, fmt.Errorf("cacheTTL must not be negative: %s", v)
+		}
+		return ttl, nil
+	case float64:
+		if v < 0 {
+			return 0, fmt.Errorf("cacheTTL must not be negative: %v", v)
+		}
+		return time.Duration(v * float64(time.Second)), nil
+	default:
+		return 0, fmt.Errorf("cacheTTL must be a duration string or number of seconds, got %T", raw)
+	}
+}
+
+// parseMaxPagesArg reads the optional per-call maxPages argument, defaulting to the
+// configured page limit.
+func parseMaxPagesArg(args map[string]interface{}) (int, error) {
+	v, ok, err := argNumber(args, "maxPages")
+	if !ok && err == nil {
+		return GetConfig().MaxPages, nil
+	}
+	if err != nil || v != float64(int(v)) || v < 1 || v > maxPagesLimit {
+		return 0, fmt.Errorf("maxPages must be a whole number between 1 and %d, got %v", maxPagesLimit, args["maxPages"])
+	}
+	return int(v), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//================================================================================
+// CORS
+//================================================================================
+
+const corsMaxAgeSeconds = 600 // How long browsers may cache a preflight response
+
+// CORSConfig controls which browser origins may call the HTTP transport. CORS headers
+// are only sent when at least one origin is allowed.
+type CORSConfig struct {
+	AllowedOrigins []string // Exact origins such as "https://app.example.com", or "*"
+	AllowedMethods []string
+	AllowedHeaders []string
+}
+
+// defaultCORSConfig allows the methods and headers used by the streamable HTTP transport
+// but no origins, so CORS stays disabled until configured.
+func defaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "Accept", "Last-Event-ID", "Mcp-Session-Id", "Mcp-Protocol-Version"},
+	}
+}
+
+// Enabled reports whether any origin is allowed.
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" if it is not allowed.
+func (c CORSConfig) allowOrigin(origin string) string {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// corsMiddleware adds CORS headers for allowed origins and answers preflight requests.
+// Requests from other origins pass through without CORS headers, so browsers block them.
+func corsMiddleware(cfg CORSConfig, next http.Handler) http.Handler {
+	if !cfg.Enabled() {
+		return next
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := cfg.allowOrigin(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if allowed == "" {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		w.Header().Set("Access-Control-Expose-Headers", mcpSessionHeader)
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAgeSeconds))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitCommaList splits a comma-separated setting, dropping empty entries.
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// commaListFlag is a flag.Value that parses a comma-separated list into a string slice.
+type commaListFlag struct {
+	target *[]string
+}
+
+func (f commaListFlag) String() string {
+	if f.target == nil {
+		return ""
+	}
+	return strings.Join(*f.target, ",")
+}
+
+func (f commaListFlag) Set(value string) error {
+	*f.target = splitCommaList(value)
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Per-Call Cost Accounting
+//================================================================================
+
+// ProviderCost is the upstream traffic of one tool call to one provider.
+type ProviderCost struct {
+	Requests int   `json:"requests"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// CallCost summarizes what a tool call cost upstream and what the cache saved it. Bytes are
+// response bodies as read, after any transfer compression was undone.
+type CallCost struct {
+	Requests        int                     `json:"requests"`
+	Bytes           int64                   `json:"bytes"`
+	ByProvider      map[string]ProviderCost `json:"by_provider,omitempty"`
+	CacheHits       int                     `json:"cache_hits"`        // Search pages served from the cache instead of grep.app
+	CacheBytesSaved int64                   `json:"cache_bytes_saved"` // Estimated size of those pages
+}
+
+// costRecorder accumulates the cost of one tool call across its concurrent requests.
+type costRecorder struct {
+	mu   sync.Mutex
+	cost CallCost
+}
+
+type costRecorderKey struct{}
+
+// withCostRecorder attaches a fresh cost recorder to the context.
+func withCostRecorder(ctx context.Context) (context.Context, *costRecorder) {
+	recorder := &costRecorder{cost: CallCost{ByProvider: make(map[string]ProviderCost)}}
+	return context.WithValue(ctx, costRecorderKey{}, recorder), recorder
+}
+
+// observeResponseCost counts req against its call and wraps the response body so the bytes
+// are counted as they are read.
+func observeResponseCost(req *http.Request, resp *http.Response) {
+	recorder, ok := req.Context().Value(costRecorderKey{}).(*costRecorder)
+	if !ok {
+		return
+	}
+	provider := providerForHost(req.URL.Hostname())
+	recorder.add(provider, 1, 0)
+	if resp != nil && resp.Body != nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, recorder: recorder, provider: provider}
+	}
+}
+
+// recordCacheSaving counts a search page served from the cache, estimating the bytes the
+// request would have downloaded from the cached value's encoded size.
+func recordCacheSaving(ctx context.Context, cached any) {
+	recorder, ok := ctx.Value(costRecorderKey{}).(*costRecorder)
+	if !ok {
+		return
+	}
+	encoded, _ := json.Marshal(cached)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.cost.CacheHits++
+	recorder.cost.CacheBytesSaved += int64(len(encoded))
+}
+
+func (r *costRecorder) add(provider string, requests int, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cost.Requests += requests
+	r.cost.Bytes += bytes
+	p := r.cost.ByProvider[provider]
+	p.Requests += requests
+	p.Bytes += bytes
+	r.cost.ByProvider[provider] = p
+}
+
+// snapshot returns a copy of the cost recorded so far.
+func (r *costRecorder) snapshot() CallCost {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cost := r.cost
+	cost.ByProvider = make(map[string]ProviderCost, len(r.cost.ByProvider))
+	for provider, p := range r.cost.ByProvider {
+		cost.ByProvider[provider] = p
+	}
+	return cost
+}
+
+// countingBody adds the bytes read from a response body to the call's cost.
+type countingBody struct {
+	io.ReadCloser
+	recorder *costRecorder
+	provider string
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.recorder.add(b.provider, 0, int64(n))
+	}
+	return n, err
+}
+
+// String renders the cost as a short line.
+func (c CallCost) String() string {
+	providers := make([]string, 0, len(c.ByProvider))
+	for provider, p := range c.ByProvider {
+		providers = append(providers, fmt.Sprintf("%s %d/%s", provider, p.Requests, formatBytes(p.Bytes)))
+	}
+	sort.Strings(providers)
+	line := fmt.Sprintf("💰 Cost: %d upstream requests, %s downloaded", c.Requests, formatBytes(c.Bytes))
+	if len(providers) > 0 {
+		line += " (" + strings.Join(providers, ", ") + ")"
+	}
+	return line + fmt.Sprintf(", %d cached pages saved ~%s", c.CacheHits, formatBytes(c.CacheBytesSaved))
+}
+
+// costMiddleware records the upstream cost of each tool call, adds it to the result's
+// _meta as "cost" and logs it for calls that touched the network or the page cache.
+func costMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, recorder := withCostRecorder(ctx)
+		result, err := next(ctx, request)
+
+		cost := recorder.snapshot()
+		if result != nil {
+			if result.Meta == nil {
+				result.Meta = make(map[string]any)
+			}
+			result.Meta["cost"] = cost
+		}
+		if cost.Requests == 0 && cost.CacheHits == 0 {
+			return result, err
+		}
+		if logger := LoggerFromContext(ctx); logger != nil {
+			fields := map[string]interface{}{
+				"tool":              request.Params.Name,
+				"requests":          cost.Requests,
+				"bytes":             cost.Bytes,
+				"cache_hits":        cost.CacheHits,
+				"cache_bytes_saved": cost.CacheBytesSaved,
+			}
+			for provider, p := range cost.ByProvider {
+				fields[provider+"_requests"] = p.Requests
+				fields[provider+"_bytes"] = p.Bytes
+			}
+			logger.LogInfo(fmt.Sprintf("%s for %s", cost, request.Params.Name), "cost", fields)
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Count-Only Search
+//================================================================================
+
+const maxFacetBuckets = 10 // Facet values shown per breakdown
+
+// CountSummary is the result of a count-only reconnaissance search.
+type CountSummary struct {
+	Query        string        `json:"query"`
+	TotalMatches int           `json:"total_matches"`
+	TotalPages   int           `json:"total_pages"`
+	ScanPages    int           `json:"full_search_pages"` // Pages a full search would fetch given maxPages
+	Languages    []FacetBucket `json:"languages,omitempty"`
+	Repositories []FacetBucket `json:"repositories,omitempty"`
+	Paths        []FacetBucket `json:"paths,omitempty"`
+	APIRequests  int           `json:"api_requests"`
+	CachedAt     string        `json:"cached_at,omitempty"` // When the oldest cached page was stored
+
+	cachedAt time.Time
+}
+
+// countGrepApp fetches only the first page for each requested language and reports the
+// totals and facet breakdowns without parsing any snippets.
+func countGrepApp(ctx context.Context, client *http.Client, args map[string]interface{}) (*CountSummary, error) {
+	opts, err := parseSearchOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	summary := &CountSummary{Query: opts.Query}
+
+	langs := splitLangFilter(opts.LangFilter)
+	if len(langs) == 0 {
+		langs = []string{""}
+	}
+
+	langCounts := make(map[string]int)
+	repoCounts := make(map[string]int)
+	pathCounts := make(map[string]int)
+
+	for _, lang := range langs {
+		langOpts := opts
+		langOpts.LangFilter = lang
+		results, err := fetchGrepAppPage(ctx, client, langOpts, 1)
+		summary.APIRequests++
+		if err != nil {
+			return summary, err
+		}
+
+		if results.FromCache && (summary.cachedAt.IsZero() || results.CachedAt.Before(summary.cachedAt)) {
+			summary.cachedAt = results.CachedAt
+			summary.CachedAt = results.CachedAt.UTC().Format(time.RFC3339)
+		}
+		summary.TotalMatches += results.Facets.Count
+		summary.TotalPages += results.Facets.Pages
+		summary.ScanPages += min(results.Facets.Pages, opts.MaxPages)
+		addFacetCounts(langCounts, results.Facets.Lang)
+		addFacetCounts(repoCounts, results.Facets.Repo)
+		addFacetCounts(pathCounts, results.Facets.Path)
+	}
+
+	summary.Languages = topFacetBuckets(langCounts, maxFacetBuckets)
+	summary.Repositories = topFacetBuckets(repoCounts, maxFacetBuckets)
+	summary.Paths = topFacetBuckets(pathCounts, maxFacetBuckets)
+	return summary, nil
+}
+
+// addFacetCounts accumulates bucket counts, so per-language requests can be combined.
+func addFacetCounts(counts map[string]int, facet FacetBuckets) {
+	for _, bucket := range facet.Buckets {
+		counts[bucket.Val] += bucket.Count
+	}
+}
+
+// topFacetBuckets returns up to limit buckets ordered by descending count.
+func topFacetBuckets(counts map[string]int, limit int) []FacetBucket {
+	buckets := make([]FacetBucket, 0, len(counts))
+	for val, count := range counts {
+		buckets = append(buckets, FacetBucket{Val: val, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].Val < buckets[j].Val
+	})
+	if len(buckets) > limit {
+		buckets = buckets[:limit]
+	}
+	return buckets
+}
+
+// formatCountSummary renders a count summary as readable text.
+func formatCountSummary(summary *CountSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Count for %q:\n", summary.Query)
+	fmt.Fprintf(&b, "  Total matches: %d (%d pages available, %d scanned by a full search)\n",
+		summary.TotalMatches, summary.TotalPages, summary.ScanPages)
+
+	sections := []struct {
+		title   string
+		buckets []FacetBucket
+	}{
+		{"Top languages", summary.Languages},
+		{"Top repositories", summary.Repositories},
+		{"Top paths", summary.Paths},
+	}
+	for _, section := range sections {
+		if len(section.buckets) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s:\n", section.title)
+		for _, bucket := range section.buckets {
+			fmt.Fprintf(&b, "    %-40s %d\n", bucket.Val, bucket.Count)
+		}
+	}
+	b.WriteString("Note: counts come from grep.app and do not reflect client-side filters such as regex or minMatchesPerFile.\n")
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+//================================================================================
+// Content Deduplication
+//================================================================================
+
+// FileLocation is one place a retrieved file was found.
+type FileLocation struct {
+	Number int    `json:"number"`
+	Repo   string `json:"repo"`
+	Path   string `json:"path"`
+}
+
+// DuplicateContent lists the locations of byte-identical retrieved files, which are
+// common across forks and vendored copies. The first location holds the content.
+type DuplicateContent struct {
+	SHA256    string         `json:"sha256"`
+	Bytes     int            `json:"bytes"`
+	Locations []FileLocation `json:"locations"`
+}
+
+// hashFiles records the SHA-256 of every retrieved file's content.
+func hashFiles(files []RetrievedFile) {
+	for i := range files {
+		if files[i].Error != "" || files[i].Type == "dir" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(files[i].Content))
+		files[i].SHA256 = hex.EncodeToString(sum[:])
+	}
+}
+
+// collapseDuplicates returns a copy of result in which files with the same SHA-256 as an
+// earlier file carry no content, only a reference to the file that does, and lists each
+// set of identical files in Duplicates. result itself is left unchanged.
+func collapseDuplicates(result *BatchRetrievalResult) *BatchRetrievalResult {
+	first := make(map[string]int) // SHA-256 to the index of its first file
+	groups := make(map[string]*DuplicateContent)
+	var order []string
+	files := make([]RetrievedFile, len(result.Files))
+	copy(files, result.Files)
+
+	for i, file := range files {
+		if file.SHA256 == "" {
+			continue
+		}
+		location := FileLocation{Number: file.Number, Repo: file.Repo, Path: file.Path}
+		original, seen := first[file.SHA256]
+		if !seen {
+			first[file.SHA256] = i
+			continue
+		}
+		group, ok := groups[file.SHA256]
+		if !ok {
+			kept := files[original]
+			group = &DuplicateContent{SHA256: file.SHA256, Bytes: len(kept.Content), Locations: []FileLocation{{Number: kept.Number, Repo: kept.Repo, Path: kept.Path}}}
+			groups[file.SHA256] = group
+			order = append(order, file.SHA256)
+		}
+		group.Locations = append(group.Locations, location)
+		files[i].Content = ""
+		files[i].DuplicateOf = files[original].Repo + "/" + files[original].Path
+	}
+	if len(order) == 0 {
+		return result
+	}
+
+	collapsed := *result
+	collapsed.Files = files
+	collapsed.Duplicates = make([]DuplicateContent, 0, len(order))
+	for _, sha := range order {
+		collapsed.Duplicates = append(collapsed.Duplicates, *groups[sha])
+	}
+	return &collapsed
+}
+
+// duplicateSummary describes how much content deduplication saved.
+func duplicateSummary(duplicates []DuplicateContent) string {
+	copies, saved := 0, 0
+	for _, group := range duplicates {
+		copies += len(group.Locations) - 1
+		saved += (len(group.Locations) - 1) * group.Bytes
+	}
+	return fmt.Sprintf("%d files are byte-identical copies of others and are shown once (%d bytes saved).", copies, saved)
+}
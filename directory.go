@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Directory Retrieval
+//================================================================================
+
+const (
+	defaultDirectoryBytes = 512 << 10 // Default total size of files fetched per directory
+	maxDirectoryBytes     = 8 << 20
+	maxDirectoryFileBytes = 64 << 10 // Larger files are listed but never fetched recursively
+	maxDirectoryDepth     = 5
+	maxDirectoryListings  = 50 // Subdirectory listing requests per recursive retrieval
+)
+
+// DirectoryEntry is one item in a directory listing.
+type DirectoryEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type string `json:"type"` // "file", "dir", "symlink" or "submodule"
+	Size int    `json:"size"`
+}
+
+// parseExplicitPath splits an "owner/repo/path" argument into a retrieval hit. A leading
+// https://github.com/ or github.com/ and a .git suffix on the repository are accepted.
+// Explicit paths are not part of the numbered listing, so they carry number 0.
+func parseExplicitPath(fullPath string) NumberedHit {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(fullPath), "https://"), "http://")
+	trimmed = strings.TrimPrefix(strings.Trim(trimmed, "/"), githubHost+"/")
+	parts := strings.SplitN(trimmed, "/", 3)
+	if len(parts) < 3 {
+		return NumberedHit{Repo: canonicalRepo(strings.Join(parts, "/"))}
+	}
+	return NumberedHit{Repo: canonicalRepo(parts[0] + "/" + parts[1]), Path: parts[2]}
+}
+
+// directoryListing converts GitHub directory contents into sorted listing entries.
+func directoryListing(contents []*github.RepositoryContent) []DirectoryEntry {
+	listing := make([]DirectoryEntry, 0, len(contents))
+	for _, item := range contents {
+		listing = append(listing, DirectoryEntry{
+			Name: item.GetName(),
+			Path: item.GetPath(),
+			Type: item.GetType(),
+			Size: item.GetSize(),
+		})
+	}
+	sort.Slice(listing, func(i, j int) bool { return listing[i].Path < listing[j].Path })
+	return listing
+}
+
+// fetchDirectoryFiles walks a directory breadth-first and fetches files no larger than
+// maxDirectoryFileBytes until the byte budget is spent. The walk stops once the budget is
+// gone, and lists at most maxDirectoryListings subdirectories. Entries that are not
+// fetched are reported in the returned skip count.
+func fetchDirectoryFiles(ctx context.Context, ghClient *github.Client, req GitHubFileRequest, num int, listing []DirectoryEntry, opts retrievalOptions) ([]RetrievedFile, int) {
+	repoPath := req.Owner + "/" + req.Repo
+	type pendingDir struct {
+		entries []DirectoryEntry
+		depth   int
+	}
+	queue := []pendingDir{{entries: listing, depth: 1}}
+	var files []RetrievedFile
+	budget := opts.MaxDirectoryBytes
+	skipped := 0
+	listings := 0
+
+	for len(queue) > 0 && ctx.Err() == nil {
+		current := queue[0]
+		queue = queue[1:]
+		for i, entry := range current.entries {
+			if ctx.Err() != nil {
+				break
+			}
+			if budget <= 0 {
+				skipped += len(current.entries) - i
+				for _, pending := range queue {
+					skipped += len(pending.entries)
+				}
+				queue = nil
+				break
+			}
+			switch entry.Type {
+			case "dir":
+				if current.depth >= maxDirectoryDepth || listings >= maxDirectoryListings {
+					skipped++
+					continue
+				}
+				listings++
+				_, contents, _, err := ghClient.Repositories.GetContents(ctx, req.Owner, req.Repo, entry.Path, contentsOptions(req.Ref))
+				if err != nil {
+					files = append(files, RetrievedFile{Number: num, Repo: repoPath, Path: entry.Path, Type: "dir", Error: err.Error()})
+					continue
+				}
+				queue = append(queue, pendingDir{entries: directoryListing(contents), depth: current.depth + 1})
+			case "file":
+				if entry.Size > maxDirectoryFileBytes || entry.Size > budget {
+					skipped++
+					continue
+				}
+				fileContent, _, _, err := ghClient.Repositories.GetContents(ctx, req.Owner, req.Repo, entry.Path, contentsOptions(req.Ref))
+				if err != nil {
+					files = append(files, RetrievedFile{Number: num, Repo: repoPath, Path: entry.Path, Type: "file", Error: err.Error()})
+					continue
+				}
+				raw, err := fileContent.GetContent()
+				if err != nil {
+					files = append(files, RetrievedFile{Number: num, Repo: repoPath, Path: entry.Path, Type: "file", Error: fmt.Sprintf("failed to get file content: %v", err)})
+					continue
+				}
+				budget -= entry.Size
+				content, encoding := normalizeEncoding([]byte(raw))
+				content, processing := postProcessContent(entry.Path, content, opts)
+				files = append(files, RetrievedFile{Number: num, Repo: repoPath, Path: entry.Path, Type: "file", Content: content, Encoding: encoding, Processing: processing})
+			}
+		}
+	}
+
+	log.Printf("📂 Recursively fetched %d files from %s/%s (%d skipped, %d bytes of budget left)", len(files), repoPath, req.Path, skipped, budget)
+	return files, skipped
+}
+
+//================================================================================
+// Directory Trees
+//================================================================================
+
+const (
+	contentsAPIMaxEntries = 1000 // The Contents API silently cuts directory listings at this size
+	defaultListLimit      = 1000
+	maxListLimit          = 5000
+)
+
+// DirectoryTreeListing is one page of a directory listing read through the Git Trees API.
+type DirectoryTreeListing struct {
+	Repo       string           `json:"repo"`
+	Path       string           `json:"path"`
+	Ref        string           `json:"ref"`
+	Recursive  bool             `json:"recursive"`
+	Total      int              `json:"total"` // Entries GitHub returned, before paging
+	Offset     int              `json:"offset"`
+	NextOffset int              `json:"next_offset,omitempty"` // Set when more entries follow this page
+	Entries    []DirectoryEntry `json:"entries"`
+
+	Truncated     bool     `json:"truncated"`                // GitHub cut the recursive tree short
+	ContinuePaths []string `json:"continue_paths,omitempty"` // Subdirectories to list separately when truncated
+}
+
+// listDirectoryTree lists dirPath at ref through the Git Trees API, which unlike the
+// Contents API does not stop at 1000 entries. The tree of dirPath is found by walking
+// down from the root one segment at a time.
+func listDirectoryTree(ctx context.Context, ghClient *github.Client, owner, repo, dirPath, ref string, recursive bool) (*DirectoryTreeListing, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	treeSHA := ref
+	if dirPath != "" {
+		for _, segment := range strings.Split(dirPath, "/") {
+			tree, _, err := ghClient.Git.GetTree(ctx, owner, repo, treeSHA, false)
+			if err != nil {
+				return nil, err
+			}
+			next := ""
+			for _, entry := range tree.Entries {
+				if entry.GetPath() == segment && entry.GetType() == "tree" {
+					next = entry.GetSHA()
+					break
+				}
+			}
+			if next == "" {
+				return nil, fmt.Errorf("directory %q not found at %s", dirPath, ref)
+			}
+			treeSHA = next
+		}
+	}
+
+	tree, _, err := ghClient.Git.GetTree(ctx, owner, repo, treeSHA, recursive)
+	if err != nil {
+		return nil, err
+	}
+	listing := &DirectoryTreeListing{
+		Repo:      owner + "/" + repo,
+		Path:      dirPath,
+		Ref:       ref,
+		Recursive: recursive,
+		Truncated: tree.GetTruncated(),
+	}
+	for _, entry := range tree.Entries {
+		fullPath := entry.GetPath()
+		if dirPath != "" {
+			fullPath = dirPath + "/" + fullPath
+		}
+		listing.Entries = append(listing.Entries, DirectoryEntry{
+			Name: path.Base(fullPath),
+			Path: fullPath,
+			Type: treeEntryType(entry),
+			Size: entry.GetSize(),
+		})
+	}
+	sort.Slice(listing.Entries, func(i, j int) bool { return listing.Entries[i].Path < listing.Entries[j].Path })
+
+	if listing.Truncated {
+		// The truncated tree may miss whole subdirectories, so read them from the top level
+		top, _, err := ghClient.Git.GetTree(ctx, owner, repo, treeSHA, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range top.Entries {
+			if entry.GetType() == "tree" {
+				listing.ContinuePaths = append(listing.ContinuePaths, strings.TrimPrefix(dirPath+"/"+entry.GetPath(), "/"))
+			}
+		}
+		sort.Strings(listing.ContinuePaths)
+	}
+	listing.Total = len(listing.Entries)
+	return listing, nil
+}
+
+// treeEntryType maps a Git tree entry to the Contents API type names used in listings.
+func treeEntryType(entry *github.TreeEntry) string {
+	switch {
+	case entry.GetType() == "tree":
+		return "dir"
+	case entry.GetType() == "commit":
+		return "submodule"
+	case entry.GetMode() == "120000":
+		return "symlink"
+	default:
+		return "file"
+	}
+}
+
+// page keeps limit entries starting at offset and records where the next page starts.
+func (l *DirectoryTreeListing) page(offset, limit int) {
+	l.Offset = min(offset, len(l.Entries))
+	end := min(l.Offset+limit, len(l.Entries))
+	if end < len(l.Entries) {
+		l.NextOffset = end
+	}
+	l.Entries = l.Entries[l.Offset:end]
+}
+
+// formatDirectoryTree renders a listing page with its continuation options.
+func formatDirectoryTree(l *DirectoryTreeListing) string {
+	var b strings.Builder
+	location := l.Repo
+	if l.Path != "" {
+		location += "/" + l.Path
+	}
+	if len(l.Entries) == 0 {
+		fmt.Fprintf(&b, "📂 %s@%s: no entries at offset %d of %d\n", location, l.Ref, l.Offset, l.Total)
+	} else {
+		fmt.Fprintf(&b, "📂 %s@%s: entries %d-%d of %d\n", location, l.Ref, l.Offset+1, l.Offset+len(l.Entries), l.Total)
+	}
+	for _, entry := range l.Entries {
+		switch entry.Type {
+		case "dir":
+			fmt.Fprintf(&b, "%s/\n", entry.Path)
+		case "file":
+			fmt.Fprintf(&b, "%s (%d bytes)\n", entry.Path, entry.Size)
+		default:
+			fmt.Fprintf(&b, "%s [%s]\n", entry.Path, entry.Type)
+		}
+	}
+	if l.NextOffset > 0 {
+		fmt.Fprintf(&b, "\n➡️ %d more entries: call listDirectory again with offset=%d.\n", l.Total-l.NextOffset, l.NextOffset)
+	}
+	if l.Truncated {
+		b.WriteString("\n⚠️ GitHub truncated this recursive listing because the tree is too large.")
+		if len(l.ContinuePaths) > 0 {
+			fmt.Fprintf(&b, " List these subdirectories separately: %s\n", strings.Join(l.ContinuePaths, ", "))
+		} else {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
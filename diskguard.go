@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Disk Write Health
+//================================================================================
+
+const (
+	defaultMinFreeDiskMB = 100              // Free space below which cache and log writes stop
+	diskCheckInterval    = 30 * time.Second // How often free space is checked and degraded stores retried
+)
+
+// errDiskSpaceUnsupported is returned by freeDiskBytes on platforms without a free space query.
+var errDiskSpaceUnsupported = errors.New("free disk space is not available on this platform")
+
+// DiskWriteStats reports the write health of the cache or log directory.
+type DiskWriteStats struct {
+	Store         string `json:"store"` // "cache" or "log"
+	Degraded      bool   `json:"degraded"`
+	Reason        string `json:"reason,omitempty"`
+	DegradedSince string `json:"degraded_since,omitempty"`
+	WriteFailures int64  `json:"write_failures"`
+	SkippedWrites int64  `json:"skipped_writes"` // Writes dropped while degraded
+	FreeBytes     uint64 `json:"free_bytes,omitempty"`
+}
+
+// diskGuard tracks write failures and free space for one store. After a failed write or
+// when free space drops below the configured minimum the store is degraded: writes are
+// skipped until a later check finds enough space, at which point writing is retried.
+type diskGuard struct {
+	store string
+	dir   func() string
+
+	mu        sync.Mutex
+	degraded  bool
+	reason    string
+	since     time.Time
+	failures  int64
+	skipped   int64
+	freeBytes uint64
+	lastCheck time.Time
+}
+
+var (
+	cacheDiskGuard = newDiskGuard("cache", func() string { return GetConfig().CacheDir })
+	logDiskGuard   = newDiskGuard("log", func() string { return GetConfig().LogDir })
+)
+
+func newDiskGuard(store string, dir func() string) *diskGuard {
+	return &diskGuard{store: store, dir: dir}
+}
+
+// allow reports whether a write should be attempted, counting it as skipped otherwise.
+func (g *diskGuard) allow() bool {
+	g.mu.Lock()
+	now := time.Now()
+	var notice string
+	if now.Sub(g.lastCheck) >= diskCheckInterval {
+		g.lastCheck = now
+		notice = g.checkSpaceLocked(now)
+	}
+	allowed := !g.degraded
+	if !allowed {
+		g.skipped++
+	}
+	g.mu.Unlock()
+
+	g.report(notice)
+	return allowed
+}
+
+// recordFailure degrades the store after a failed write.
+func (g *diskGuard) recordFailure(err error) {
+	g.mu.Lock()
+	g.failures++
+	notice := g.degradeLocked(err.Error(), time.Now())
+	g.mu.Unlock()
+
+	g.report(notice)
+}
+
+// checkSpaceLocked compares free space with the configured minimum, degrading or
+// recovering the store. It returns a message when the state changed.
+func (g *diskGuard) checkSpaceLocked(now time.Time) string {
+	free, err := freeDiskBytes(existingDir(g.dir()))
+	if err != nil {
+		// Without a free space figure, retry writes and let them report their own failures
+		return g.recoverLocked()
+	}
+	g.freeBytes = free
+	minFree := uint64(GetConfig().MinFreeDiskMB) << 20
+	if minFree > 0 && free < minFree {
+		return g.degradeLocked(fmt.Sprintf("only %d MB free, below the %d MB minimum", free>>20, GetConfig().MinFreeDiskMB), now)
+	}
+	return g.recoverLocked()
+}
+
+func (g *diskGuard) degradeLocked(reason string, now time.Time) string {
+	g.reason = reason
+	if g.degraded {
+		return ""
+	}
+	g.degraded = true
+	g.since = now
+	g.lastCheck = now // Wait a full interval before retrying
+	return fmt.Sprintf("⚠️ Disabling %s writes to %s: %s", g.store, g.dir(), reason)
+}
+
+func (g *diskGuard) recoverLocked() string {
+	if !g.degraded {
+		return ""
+	}
+	g.degraded = false
+	g.reason = ""
+	return fmt.Sprintf("✅ Re-enabling %s writes to %s after %s degraded", g.store, g.dir(), time.Since(g.since).Round(time.Second))
+}
+
+// report logs a state change. Log store changes go to the console only, since the log
+// file is what failed.
+func (g *diskGuard) report(notice string) {
+	if notice == "" {
+		return
+	}
+	if logger := GetLogger(); logger != nil && g.store != "log" {
+		logger.LogWarn(notice, "disk", map[string]interface{}{"disk_writes": g.stats()})
+		return
+	}
+	log.Printf("%s", notice)
+}
+
+// stats returns a snapshot of the store's write health.
+func (g *diskGuard) stats() DiskWriteStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := DiskWriteStats{
+		Store:         g.store,
+		Degraded:      g.degraded,
+		Reason:        g.reason,
+		WriteFailures: g.failures,
+		SkippedWrites: g.skipped,
+		FreeBytes:     g.freeBytes,
+	}
+	if g.degraded {
+		stats.DegradedSince = g.since.UTC().Format(time.RFC3339)
+	}
+	return stats
+}
+
+// existingDir returns dir or its nearest existing parent, so free space can be checked
+// before the directory is created.
+func existingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// diskWriteStats returns the write health of the cache and log directories.
+func diskWriteStats() []DiskWriteStats {
+	return []DiskWriteStats{cacheDiskGuard.stats(), logDiskGuard.stats()}
+}
+
+// degradedDiskWarning describes degraded stores for tool results, or returns "".
+func degradedDiskWarning() string {
+	var parts []string
+	for _, stats := range diskWriteStats() {
+		if !stats.Degraded {
+			continue
+		}
+		switch stats.Store {
+		case "cache":
+			parts = append(parts, "results are not being cached to disk ("+stats.Reason+")")
+		case "log":
+			parts = append(parts, "logs are not being written to file ("+stats.Reason+")")
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "⚠️ Degraded mode: " + strings.Join(parts, "; ") + ". Free up disk space; writes resume automatically."
+}
+
+// diskHealthMiddleware appends the degraded mode warning to tool results.
+func diskHealthMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if result != nil {
+			if warning := degradedDiskWarning(); warning != "" {
+				result.Content = append(result.Content, mcp.NewTextContent(warning))
+				addWarning(ctx, warnDiskDegraded, warning)
+			}
+		}
+		return result, err
+	}
+}
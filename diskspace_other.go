@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// freeDiskBytes is not implemented here; stores are only degraded by failed writes.
+func freeDiskBytes(dir string) (uint64, error) {
+	return 0, errDiskSpaceUnsupported
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Client Requests
+//================================================================================
+
+const methodElicitationCreate = "elicitation/create"
+
+// clientRequester sends JSON-RPC requests to the stdio client and routes its responses
+// back. mcp-go only sends notifications, so requests such as elicitation go through here.
+type clientRequester struct {
+	out io.Writer
+
+	mu          sync.Mutex
+	nextID      int
+	pending     map[string]chan clientResponse
+	elicitation bool // The client declared the elicitation capability
+}
+
+// clientResponse is the client's answer to a server request.
+type clientResponse struct {
+	Result json.RawMessage
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+}
+
+// stdioClient is set while the stdio transport runs; it is nil for the http transport.
+var stdioClient *clientRequester
+
+func newClientRequester(out io.Writer) *clientRequester {
+	return &clientRequester{out: out, pending: make(map[string]chan clientResponse)}
+}
+
+// observe inspects a message from the client. It records the capabilities declared in
+// initialize and reports true for responses to server requests, which it consumes.
+func (c *clientRequester) observe(line []byte) bool {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Capabilities map[string]json.RawMessage `json:"capabilities"`
+		} `json:"params"`
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return false
+	}
+	if msg.Method == string(mcp.MethodInitialize) {
+		_, ok := msg.Params.Capabilities["elicitation"]
+		c.mu.Lock()
+		c.elicitation = ok
+		c.mu.Unlock()
+		return false
+	}
+	if msg.Method != "" || len(msg.ID) == 0 {
+		return false
+	}
+	var id string
+	if err := json.Unmarshal(msg.ID, &id); err != nil {
+		return false
+	}
+	c.mu.Lock()
+	ch, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	ch <- clientResponse{Result: msg.Result, Error: msg.Error}
+	return true
+}
+
+// supportsElicitation reports whether the client can answer elicitation requests.
+func (c *clientRequester) supportsElicitation() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.elicitation
+}
+
+// request sends method to the client and waits for its result.
+func (c *clientRequester) request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	c.mu.Lock()
+	c.nextID++
+	id := fmt.Sprintf("grepapp-%d", c.nextID)
+	ch := make(chan clientResponse, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	encoded, err := json.Marshal(map[string]interface{}{"jsonrpc": mcp.JSONRPC_VERSION, "id": id, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(c.out, "%s\n", encoded); err != nil {
+		return nil, err
+	}
+	select {
+	case response := <-ch:
+		if response.Error != nil {
+			return nil, fmt.Errorf("client error %d: %s", response.Error.Code, response.Error.Message)
+		}
+		return response.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+//================================================================================
+// Interactive Query Refinement
+//================================================================================
+
+const (
+	ambiguousResultThreshold = 500             // Total matches at which a search counts as a flood
+	elicitationTimeout       = 2 * time.Minute // How long to wait for the user's answer
+)
+
+// searchOutcome is filled in by searchCode so the interactive wrapper can judge the result.
+type searchOutcome struct {
+	recorded   bool
+	totalCount int
+	files      int
+}
+
+type searchOutcomeKey struct{}
+
+// recordSearchOutcome notes the total matches and returned files of a finished search.
+func recordSearchOutcome(ctx context.Context, totalCount, files int) {
+	if outcome, ok := ctx.Value(searchOutcomeKey{}).(*searchOutcome); ok {
+		*outcome = searchOutcome{recorded: true, totalCount: totalCount, files: files}
+	}
+}
+
+// elicitationResult is the client's answer to an elicitation request.
+type elicitationResult struct {
+	Action  string                 `json:"action"` // "accept", "decline" or "cancel"
+	Content map[string]interface{} `json:"content"`
+}
+
+// refinementQuestion builds the clarifying question for a search outcome, or returns an
+// empty message when the outcome needs none.
+func refinementQuestion(query string, args map[string]interface{}, outcome searchOutcome) (string, map[string]interface{}) {
+	switch {
+	case outcome.files == 0:
+		properties := map[string]interface{}{
+			"query": map[string]interface{}{"type": "string", "title": "Reworded query", "description": "A different query to search for instead; leave empty to keep the current one"},
+		}
+		if hasNarrowingFilters(args) {
+			properties["dropFilters"] = map[string]interface{}{"type": "boolean", "title": "Drop filters", "description": "Search again without the repository, path and language filters"}
+		}
+		if useRegex, _ := args["useRegex"].(bool); useRegex {
+			properties["literal"] = map[string]interface{}{"type": "boolean", "title": "Search literally", "description": "Treat the query as plain text instead of a regular expression"}
+		}
+		return fmt.Sprintf("No results for %q. Would you like to broaden the search?", query), map[string]interface{}{"type": "object", "properties": properties}
+	case outcome.totalCount >= ambiguousResultThreshold:
+		properties := map[string]interface{}{
+			"langFilter": map[string]interface{}{"type": "string", "title": "Language", "description": "Only search files in these comma-separated languages, e.g. Go"},
+			"repoFilter": map[string]interface{}{"type": "string", "title": "Repository", "description": "Only search this repository, e.g. owner/name"},
+			"pathFilter": map[string]interface{}{"type": "string", "title": "Path", "description": "Only search paths containing this text, e.g. src/"},
+		}
+		return fmt.Sprintf("%q matched %d results, more than can be shown. Would you like to narrow the search?", query, outcome.totalCount), map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return "", nil
+}
+
+func hasNarrowingFilters(args map[string]interface{}) bool {
+	for _, filter := range []string{"repoFilter", "pathFilter", "langFilter"} {
+		if v, _ := args[filter].(string); strings.TrimSpace(v) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRefinement returns a copy of args changed by the user's answer and a description
+// of the changes, or nil when the answer changes nothing.
+func applyRefinement(args map[string]interface{}, content map[string]interface{}) (map[string]interface{}, []string) {
+	refined := copyArgs(args)
+	var changes []string
+	if v, _ := content["query"].(string); strings.TrimSpace(v) != "" && v != args["query"] {
+		refined["query"] = strings.TrimSpace(v)
+		changes = append(changes, fmt.Sprintf("query %q", refined["query"]))
+	}
+	if drop, _ := content["dropFilters"].(bool); drop {
+		for _, filter := range []string{"repoFilter", "pathFilter", "langFilter"} {
+			delete(refined, filter)
+		}
+		changes = append(changes, "dropped repository, path and language filters")
+	}
+	if literal, _ := content["literal"].(bool); literal {
+		refined["useRegex"] = false
+		changes = append(changes, "literal search")
+	}
+	for _, filter := range []string{"langFilter", "repoFilter", "pathFilter"} {
+		if v, _ := content[filter].(string); strings.TrimSpace(v) != "" {
+			refined[filter] = strings.TrimSpace(v)
+			changes = append(changes, fmt.Sprintf("%s=%q", filter, refined[filter]))
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return refined, changes
+}
+
+// interactiveSearch wraps the searchCode handler. With interactive set, a search that finds
+// nothing or floods asks the user a clarifying question through MCP elicitation and, if
+// answered, searches again with the refined arguments. Without a client that supports
+// elicitation the original result is returned with a note.
+func interactiveSearch(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		if interactive, _ := args["interactive"].(bool); !interactive {
+			return next(ctx, request)
+		}
+		outcome := &searchOutcome{}
+		result, err := next(context.WithValue(ctx, searchOutcomeKey{}, outcome), request)
+		if err != nil || result == nil || result.IsError || !outcome.recorded {
+			return result, err
+		}
+		query, _ := args["query"].(string)
+		message, schema := refinementQuestion(query, args, *outcome)
+		if message == "" {
+			return result, nil
+		}
+
+		client := stdioClient
+		if client == nil || clientSessionID(ctx) != stdioSessionID || !client.supportsElicitation() {
+			result.Content = append(result.Content, mcp.NewTextContent("ℹ️ interactive was set, but this client does not support elicitation, so no clarifying question was asked."))
+			return result, nil
+		}
+
+		log.Printf("🙋 Asking the client to refine query '%s'", query)
+		askCtx, cancel := context.WithTimeout(ctx, elicitationTimeout)
+		defer cancel()
+		raw, err := client.request(askCtx, methodElicitationCreate, map[string]interface{}{"message": message, "requestedSchema": schema})
+		if err != nil {
+			log.Printf("⚠️ Elicitation failed for query '%s': %v", query, err)
+			return result, nil
+		}
+		var answer elicitationResult
+		if err := json.Unmarshal(raw, &answer); err != nil || answer.Action != "accept" {
+			log.Printf("🙅 Refinement of query '%s' declined", query)
+			return result, nil
+		}
+		refined, changes := applyRefinement(args, answer.Content)
+		if refined == nil {
+			return result, nil
+		}
+		refined["interactive"] = false // Ask at most once per call
+		request.Params.Arguments = refined
+		log.Printf("🔁 Searching again with %s", strings.Join(changes, ", "))
+		refinedResult, err := next(ctx, request)
+		if err != nil || refinedResult == nil {
+			return refinedResult, err
+		}
+		refinedResult.Content = append([]mcp.Content{mcp.NewTextContent("🙋 Refined after your answer: " + strings.Join(changes, ", ") + ".")}, refinedResult.Content...)
+		return refinedResult, nil
+	}
+}
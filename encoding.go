@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//================================================================================
+// Content Encoding Normalization
+//================================================================================
+
+// Source encodings reported in RetrievedFile.Encoding.
+const (
+	encodingUTF8        = "utf-8"
+	encodingUTF8BOM     = "utf-8-bom"
+	encodingUTF16LE     = "utf-16le"
+	encodingUTF16BE     = "utf-16be"
+	encodingWindows1252 = "windows-1252" // Superset of Latin-1 used for any other non-UTF-8 text
+	encodingBinary      = "binary"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// normalizeEncoding detects the encoding of raw file content and converts it to UTF-8
+// without a byte order mark. Content that looks binary is returned unchanged.
+func normalizeEncoding(raw []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(raw, bomUTF8):
+		return string(raw[len(bomUTF8):]), encodingUTF8BOM
+	case bytes.HasPrefix(raw, bomUTF16LE):
+		return decodeUTF16(raw[len(bomUTF16LE):], binary.LittleEndian), encodingUTF16LE
+	case bytes.HasPrefix(raw, bomUTF16BE):
+		return decodeUTF16(raw[len(bomUTF16BE):], binary.BigEndian), encodingUTF16BE
+	}
+
+	if utf8.Valid(raw) && bytes.IndexByte(raw, 0) < 0 {
+		return string(raw), encodingUTF8
+	}
+	if order, ok := detectUTF16WithoutBOM(raw); ok {
+		encoding := encodingUTF16LE
+		if order == binary.BigEndian {
+			encoding = encodingUTF16BE
+		}
+		return decodeUTF16(raw, order), encoding
+	}
+	if bytes.IndexByte(raw, 0) >= 0 {
+		return string(raw), encodingBinary
+	}
+	return decodeWindows1252(raw), encodingWindows1252
+}
+
+// detectUTF16WithoutBOM recognizes mostly-ASCII UTF-16 text by its NUL byte pattern:
+// the high byte of nearly every code unit is zero and sits at a consistent offset.
+func detectUTF16WithoutBOM(raw []byte) (binary.ByteOrder, bool) {
+	if len(raw) < 4 || len(raw)%2 != 0 {
+		return nil, false
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i+1 < len(raw); i += 2 {
+		if raw[i] == 0 {
+			evenZeros++
+		}
+		if raw[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	units := len(raw) / 2
+	switch {
+	case oddZeros*10 >= units*9 && evenZeros*10 < units:
+		return binary.LittleEndian, true
+	case evenZeros*10 >= units*9 && oddZeros*10 < units:
+		return binary.BigEndian, true
+	}
+	return nil, false
+}
+
+// decodeUTF16 converts UTF-16 code units to a UTF-8 string. A trailing odd byte is dropped.
+func decodeUTF16(raw []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = order.Uint16(raw[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// windows1252High maps bytes 0x80-0x9F to their Unicode code points; the remaining
+// high bytes are identical to Latin-1. Undefined positions map to U+FFFD.
+var windows1252High = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// decodeWindows1252 converts Windows-1252 (and therefore Latin-1) bytes to UTF-8.
+func decodeWindows1252(raw []byte) string {
+	var b strings.Builder
+	b.Grow(len(raw) + len(raw)/8)
+	for _, c := range raw {
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c < 0xA0:
+			b.WriteRune(windows1252High[c-0x80])
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
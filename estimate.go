@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Search Cost Estimates
+//================================================================================
+
+// typicalPageLatency is assumed for each upstream page when the probe was served from the
+// cache and so could not be timed.
+const typicalPageLatency = time.Second
+
+// Recommendations made by an estimate.
+const (
+	recommendFullSearch = "full_search" // Run the search as is
+	recommendSample     = "sample"      // Fetch fewer pages, e.g. with quickFirstPage or a lower maxPages
+	recommendRefine     = "refine"      // Narrow the query, since a full search cannot see every result
+)
+
+// SearchEstimate is the expected cost of a search, worked out from its first page only.
+type SearchEstimate struct {
+	Query              string  `json:"query"`
+	TotalMatches       int     `json:"total_matches"`
+	AvailablePages     int     `json:"available_pages"`
+	EstimatedPages     int     `json:"estimated_pages"` // Pages a full search would fetch given maxPages
+	CachedPages        int     `json:"cached_pages"`    // Of those, pages that are already cached
+	CacheCoverage      float64 `json:"cache_coverage"`  // Fraction of estimated pages that are cached
+	ScanCached         bool    `json:"scan_cached"`     // Cached complete scans answer the search without any page
+	UpstreamRequests   int     `json:"upstream_requests"`
+	EstimatedLatencyMs int64   `json:"estimated_latency_ms"`
+	ProbeRequests      int     `json:"probe_requests"`             // Upstream requests the estimate itself made
+	BudgetRemaining    *int    `json:"budget_remaining,omitempty"` // Upstream requests a search may still make; absent when unlimited
+	Recommendation     string  `json:"recommendation"`
+	Reason             string  `json:"reason"`
+}
+
+// estimateSearch probes page 1 of each requested language and estimates the pages,
+// upstream requests and latency of running the search in full. The probe pages are cached,
+// so a search that follows does not fetch them again.
+func estimateSearch(ctx context.Context, client *http.Client, args map[string]interface{}) (*SearchEstimate, error) {
+	opts, err := parseSearchOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	estimate := &SearchEstimate{Query: opts.Query, ScanCached: true}
+	maxPages, ttlOverride := opts.MaxPages, opts.CacheTTL
+
+	langs := splitLangFilter(opts.LangFilter)
+	if len(langs) == 0 {
+		langs = []string{""}
+	}
+
+	var probeTime time.Duration
+	uncachedPerLang := make([]int, 0, len(langs))
+	for _, lang := range langs {
+		langArgs, langOpts := args, opts
+		if lang != "" {
+			langArgs = copyArgs(args)
+			langArgs["langFilter"] = lang
+			langOpts.LangFilter = lang
+		}
+		start := time.Now()
+		results, err := fetchGrepAppPage(ctx, client, langOpts, 1)
+		if err != nil {
+			return estimate, err
+		}
+		if !results.FromCache {
+			estimate.ProbeRequests++
+			probeTime += time.Since(start)
+		}
+
+		pages := min(results.Facets.Pages, maxPages)
+		estimate.TotalMatches += results.Facets.Count
+		estimate.AvailablePages += results.Facets.Pages
+		estimate.EstimatedPages += pages
+
+		// Languages with a cached complete scan need no pages at all
+		if scanCached(langArgs, ttlOverride) {
+			estimate.CachedPages += pages
+			uncachedPerLang = append(uncachedPerLang, 0)
+			continue
+		}
+		estimate.ScanCached = false
+		uncached := 0
+		for page := 1; page <= pages; page++ {
+			if cacheEntryFresh(langOpts.pageCacheKey(page), cacheTTLFor(cacheEntrySearchPage, ttlOverride)) {
+				estimate.CachedPages++
+			} else {
+				uncached++
+			}
+		}
+		uncachedPerLang = append(uncachedPerLang, uncached)
+	}
+
+	// Languages are scanned concurrently and pages one after another
+	pageLatency := typicalPageLatency
+	if estimate.ProbeRequests > 0 {
+		pageLatency = probeTime / time.Duration(estimate.ProbeRequests)
+	}
+	slowest := 0
+	for _, uncached := range uncachedPerLang {
+		estimate.UpstreamRequests += uncached
+		slowest = max(slowest, uncached)
+	}
+	estimate.EstimatedLatencyMs = (time.Duration(slowest) * pageLatency).Milliseconds()
+	if estimate.EstimatedPages > 0 {
+		estimate.CacheCoverage = float64(estimate.CachedPages) / float64(estimate.EstimatedPages)
+	} else {
+		estimate.ScanCached = false
+	}
+
+	remaining := remainingBudget(ctx)
+	if remaining >= 0 {
+		estimate.BudgetRemaining = &remaining
+	}
+	switch {
+	case estimate.UpstreamRequests == 0:
+		estimate.Recommendation = recommendFullSearch
+		estimate.Reason = "every page a search needs is cached"
+	case estimate.AvailablePages > estimate.EstimatedPages:
+		estimate.Recommendation = recommendRefine
+		estimate.Reason = fmt.Sprintf("%d pages match but a search fetches at most %d per language; add repoFilter, pathFilter or langFilter, or raise maxPages", estimate.AvailablePages, maxPages)
+	case remaining >= 0 && estimate.UpstreamRequests > remaining:
+		estimate.Recommendation = recommendSample
+		estimate.Reason = fmt.Sprintf("the search needs %d upstream requests but only %d remain in the API budget; use quickFirstPage or a lower maxPages", estimate.UpstreamRequests, remaining)
+	default:
+		estimate.Recommendation = recommendFullSearch
+		estimate.Reason = "a search sees every result within the page limit and the API budget"
+	}
+	return estimate, nil
+}
+
+// scanCached reports whether a cached complete scan of args or one of its supersets would
+// answer the search.
+func scanCached(args map[string]interface{}, ttlOverride time.Duration) bool {
+	ttl := cacheTTLFor(cacheEntrySearchScan, ttlOverride)
+	for _, candidate := range supersetCandidates(args) {
+		if cacheEntryFresh(scanCacheKey(candidate), ttl) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheEntryFresh reports whether a cache entry younger than ttl exists without reading it
+// into the memory cache or counting a lookup.
+func cacheEntryFresh(cacheKey string, ttl time.Duration) bool {
+	if GetConfig().NoCache {
+		return false
+	}
+	if _, _, ok := hotCache.getEntry(cacheKey, ttl); ok {
+		return true
+	}
+	data, err := os.ReadFile(cacheFilePath(cacheKey))
+	if err != nil {
+		return false
+	}
+	var entry CacheEntry[json.RawMessage]
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return false
+	}
+	return time.Since(entry.Timestamp) <= ttl
+}
+
+// remainingBudget returns how many upstream requests a new tool call may make under the
+// per-call, tenant and server-wide budgets, or -1 when none of them is limited.
+func remainingBudget(ctx context.Context) int {
+	now := time.Now()
+	remaining := -1
+	limit := func(n int) {
+		if remaining < 0 || n < remaining {
+			remaining = max(n, 0)
+		}
+	}
+	budget := GetConfig().Budget
+	if budget.MaxRequestsPerCall > 0 {
+		limit(budget.MaxRequestsPerCall)
+	}
+	if budget.MaxRequestsPerHour > 0 {
+		limit(budget.MaxRequestsPerHour - apiStats.snapshot(now).LastHourRequests)
+	}
+	if tenant := tenantFromContext(ctx); tenant != nil && tenant.MaxRequestsPerHour > 0 {
+		limit(tenant.MaxRequestsPerHour - tenant.stats.snapshot(now).LastHourRequests)
+	}
+	return remaining
+}
+
+// formatSearchEstimate renders an estimate as readable text.
+func formatSearchEstimate(e *SearchEstimate) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Estimate for %q:\n", e.Query)
+	fmt.Fprintf(&b, "  Matches: %d across %d pages\n", e.TotalMatches, e.AvailablePages)
+	fmt.Fprintf(&b, "  A full search fetches %d pages, %d already cached (%.0f%% coverage)", e.EstimatedPages, e.CachedPages, e.CacheCoverage*100)
+	if e.ScanCached {
+		b.WriteString(", answered by a cached scan")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "  Upstream requests: %d, roughly %s\n", e.UpstreamRequests, (time.Duration(e.EstimatedLatencyMs) * time.Millisecond).Round(100*time.Millisecond))
+	if e.BudgetRemaining != nil {
+		fmt.Fprintf(&b, "  API budget remaining: %d requests\n", *e.BudgetRemaining)
+	}
+	fmt.Fprintf(&b, "  Probe cost: %d upstream requests\n", e.ProbeRequests)
+	fmt.Fprintf(&b, "💡 Recommendation: %s (%s)\n", e.Recommendation, e.Reason)
+	return b.String()
+}
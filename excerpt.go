@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Matched Line Excerpts
+//================================================================================
+
+const maxContextLines = 500 // Upper bound for batchRetrievalTool's contextLines
+
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// LineExcerpt describes a file whose content was cut down to its matched lines and the
+// lines around them.
+type LineExcerpt struct {
+	ContextLines int         `json:"context_lines"`
+	TotalLines   int         `json:"total_lines"`
+	Ranges       []LineRange `json:"ranges"` // Lines kept, in order; everything else is elided
+}
+
+// excerptRanges returns the line ranges covering each matched line and contextLines lines
+// on either side, merged where they touch and clipped to the file's total lines. Matched
+// lines beyond the end of the file, as happens when it changed since grep.app indexed it,
+// are ignored.
+func excerptRanges(matched []int, contextLines, total int) []LineRange {
+	sorted := append([]int(nil), matched...)
+	sort.Ints(sorted)
+	var ranges []LineRange
+	for _, line := range sorted {
+		if line < 1 || line > total {
+			continue
+		}
+		start, end := max(1, line-contextLines), min(total, line+contextLines)
+		if n := len(ranges); n > 0 && start <= ranges[n-1].End+1 {
+			ranges[n-1].End = max(ranges[n-1].End, end)
+			continue
+		}
+		ranges = append(ranges, LineRange{Start: start, End: end})
+	}
+	return ranges
+}
+
+// elisionMarker is the line standing in for omitted lines first through last.
+func elisionMarker(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("⋯ line %d omitted ⋯", first)
+	}
+	return fmt.Sprintf("⋯ lines %d-%d omitted ⋯", first, last)
+}
+
+// excerptContent keeps the matched lines of content with contextLines lines around each and
+// replaces every omitted stretch with an elision marker. It returns nil when no matched line
+// falls inside the content or nothing would be omitted, in which case content is kept whole.
+func excerptContent(content string, matched []int, contextLines int) (string, *LineExcerpt) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	ranges := excerptRanges(matched, contextLines, len(lines))
+	if len(ranges) == 0 || (len(ranges) == 1 && ranges[0].Start == 1 && ranges[0].End == len(lines)) {
+		return content, nil
+	}
+
+	var b strings.Builder
+	next := 1
+	for _, r := range ranges {
+		if r.Start > next {
+			b.WriteString(elisionMarker(next, r.Start-1))
+			b.WriteString("\n")
+		}
+		for _, line := range lines[r.Start-1 : r.End] {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		next = r.End + 1
+	}
+	if next <= len(lines) {
+		b.WriteString(elisionMarker(next, len(lines)))
+		b.WriteString("\n")
+	}
+	return b.String(), &LineExcerpt{ContextLines: contextLines, TotalLines: len(lines), Ranges: ranges}
+}
+
+// matchedLineNumbers returns the numeric line numbers of a file's matched lines.
+func matchedLineNumbers(lines map[string]string) []int {
+	numbers := make([]int, 0, len(lines))
+	for key := range lines {
+		if num, err := strconv.Atoi(key); err == nil {
+			numbers = append(numbers, num)
+		}
+	}
+	return numbers
+}
+
+// excerptMatchedLines cuts each retrieved file down to its matched lines in the cached
+// results of query, with contextLines lines around each. Files without matched lines in the
+// cache, such as explicitly requested paths, and directories are left whole. It returns the
+// number of files excerpted.
+func excerptMatchedLines(files []RetrievedFile, query string, cacheTTL time.Duration, contextLines int) int {
+	hits, err := getQueryResults(query, cacheTTLFor(cacheEntryComplete, cacheTTL))
+	if err != nil || hits == nil {
+		log.Printf("⚠️ No cached matched lines for query '%s'; returning whole files", query)
+		return 0
+	}
+	excerpted := 0
+	for i, file := range files {
+		if file.Error != "" || file.Type == "dir" || file.DuplicateOf != "" {
+			continue
+		}
+		matched := matchedLineNumbers(hits.Hits[file.Repo][file.Path])
+		if len(matched) == 0 {
+			continue
+		}
+		content, excerpt := excerptContent(file.Content, matched, contextLines)
+		if excerpt == nil {
+			continue
+		}
+		files[i].Content = content
+		files[i].Excerpt = excerpt
+		excerpted++
+	}
+	log.Printf("✂️ Cut %d of %d files down to matched lines with %d lines of context", excerpted, len(files), contextLines)
+	return excerpted
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//================================================================================
+// Repository Expansion
+//================================================================================
+
+// ExpandedFile is one file of an expanded repository with all its matched lines.
+type ExpandedFile struct {
+	Number int               `json:"number,omitempty"` // Result number for batchRetrievalTool; absent for files only the repo-scoped search found
+	Path   string            `json:"path"`
+	Lines  map[string]string `json:"lines"`
+}
+
+// RepoExpansion lists every known hit of a search in one repository.
+type RepoExpansion struct {
+	Query        string         `json:"query"`
+	Repo         string         `json:"repo"`
+	Files        []ExpandedFile `json:"files"`
+	CachedFiles  int            `json:"cached_files"`            // Files in the cached search results
+	FetchedFiles int            `json:"fetched_files,omitempty"` // Files found only by the repo-scoped search
+	PagesFetched int            `json:"pages_fetched,omitempty"`
+	Complete     bool           `json:"complete"` // The repo-scoped search fetched every page
+}
+
+// expandRepo collects the cached hits of query in repo. With fetchMore it also searches
+// grep.app with repoFilter set to repo, which finds hits beyond the page limit of the
+// original search. Files found that way have no result number, because the numbering of
+// the cached results must stay stable for batch retrieval.
+func expandRepo(ctx context.Context, client *http.Client, args map[string]interface{}) (*RepoExpansion, error) {
+	query, _ := args["query"].(string)
+	repoArg, _ := args["repo"].(string)
+	repo := canonicalRepo(repoArg)
+	fetchMore, _ := args["fetchMore"].(bool)
+	expansion := &RepoExpansion{Query: query, Repo: repo}
+
+	ttlOverride, _ := parseCacheTTLArg(args) // Validated by the tool handler
+	cached, err := getQueryResults(query, cacheTTLFor(cacheEntryComplete, ttlOverride))
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil && !fetchMore {
+		return nil, fmt.Errorf("no cached results for query %q; run searchCode first or set fetchMore", query)
+	}
+
+	files := make(map[string]map[string]string)
+	numbers := make(map[string]int) // Path to result number
+	if cached != nil {
+		cachedNumbers := numberHits(cached)
+		for cachedRepo, paths := range cached.Hits {
+			if canonicalRepo(cachedRepo) != repo {
+				continue
+			}
+			for path, lines := range paths {
+				files[path] = maps.Clone(lines) // Cached maps may be shared with the memory cache
+				numbers[path] = cachedNumbers[cachedRepo][path]
+			}
+		}
+	}
+	expansion.CachedFiles = len(files)
+
+	if fetchMore {
+		scanArgs := copyArgs(args)
+		scanArgs["repoFilter"] = repo
+		maxPages, _ := parseMaxPagesArg(args) // Validated by the tool handler
+		scan, err := scanGrepAppLanguages(ctx, client, scanArgs, maxPages)
+		if err != nil && countFiles(scan.Hits) == 0 {
+			return nil, err
+		}
+		if err != nil {
+			log.Printf("⚠️ Repo-scoped search for %s stopped early: %v", repo, err)
+		}
+		useRegex, _ := args["useRegex"].(bool)
+		wholeWords, _ := args["wholeWords"].(bool)
+		caseSensitive, _ := args["caseSensitive"].(bool)
+		hits := scan.Hits
+		if filter := buildLineFilter(query, useRegex, wholeWords, caseSensitive); filter != nil {
+			if hits, err = applyRegexFilter(ctx, hits, filter); err != nil {
+				return nil, err
+			}
+		}
+		for scannedRepo, paths := range hits.Hits {
+			if canonicalRepo(scannedRepo) != repo {
+				continue
+			}
+			for path, lines := range paths {
+				if _, ok := files[path]; !ok {
+					files[path] = make(map[string]string)
+					expansion.FetchedFiles++
+				}
+				for line, text := range lines {
+					files[path][line] = text
+				}
+			}
+		}
+		expansion.PagesFetched = scan.PagesScanned
+		expansion.Complete = err == nil && scan.Complete
+	}
+
+	for path, lines := range files {
+		expansion.Files = append(expansion.Files, ExpandedFile{Number: numbers[path], Path: path, Lines: lines})
+	}
+	// Numbered files first, in result order, then the newly found ones by path
+	sort.Slice(expansion.Files, func(i, j int) bool {
+		a, b := expansion.Files[i], expansion.Files[j]
+		if (a.Number == 0) != (b.Number == 0) {
+			return a.Number != 0
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return a.Path < b.Path
+	})
+	return expansion, nil
+}
+
+// formatRepoExpansion renders an expansion as a numbered list. Files without a number are
+// marked with + and can be retrieved through the paths argument of batchRetrievalTool.
+func formatRepoExpansion(e *RepoExpansion) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📂 %s: %d files for %q (%d cached", e.Repo, len(e.Files), e.Query, e.CachedFiles)
+	if e.PagesFetched > 0 {
+		fmt.Fprintf(&b, ", %d more from %d repo-scoped pages", e.FetchedFiles, e.PagesFetched)
+		if !e.Complete {
+			b.WriteString(", more pages remain")
+		}
+	}
+	b.WriteString(")\n")
+	for _, file := range e.Files {
+		marker := "+"
+		if file.Number > 0 {
+			marker = fmt.Sprintf("%d.", file.Number)
+		}
+		fmt.Fprintf(&b, "%s %s\n", marker, file.Path)
+		lines := sortedKeys(file.Lines)
+		slices.SortStableFunc(lines, func(x, y string) int {
+			a, _ := strconv.Atoi(x)
+			c, _ := strconv.Atoi(y)
+			return a - c
+		})
+		for _, line := range lines {
+			fmt.Fprintf(&b, "   L%s: %s\n", line, file.Lines[line])
+		}
+	}
+	if e.FetchedFiles > 0 {
+		fmt.Fprintf(&b, "Files marked + are not in the numbered results; retrieve them with batchRetrievalTool paths such as '%s/<path>'.\n", e.Repo)
+	}
+	return b.String()
+}
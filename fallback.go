@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Provider Fallback
+//================================================================================
+
+const (
+	githubCodeSearchPerPage = 100     // Most results GitHub code search returns per request
+	maxFallbackLinesPerFile = 10      // Matched lines kept per file found by a fallback provider
+	maxFallbackFileFetches  = 4       // Files downloaded concurrently to locate matched lines
+	maxFallbackFileBytes    = 1 << 20 // Larger files are searched for matched lines only this far
+)
+
+// githubRawBaseURL serves file contents by commit without using the GitHub API rate limit.
+var githubRawBaseURL = "https://raw.githubusercontent.com"
+
+// fallbackProviders are the providers a fallback policy may name.
+var fallbackProviders = []string{providerGitHub}
+
+// validateFallbackPolicy checks that every provider in the policy can serve searches.
+func validateFallbackPolicy(policy []string) error {
+	for _, provider := range policy {
+		if !containsString(fallbackProviders, provider) {
+			return fmt.Errorf("unknown fallback provider %q (expected one of %s)", provider, strings.Join(fallbackProviders, ", "))
+		}
+	}
+	return nil
+}
+
+// shouldFallBack reports whether a failed grep.app search may be retried with another
+// provider. Exhausted budgets and expired call deadlines would fail there too.
+func shouldFallBack(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil && !errors.Is(err, errBudgetExceeded)
+}
+
+// searchFallbackProviders runs the search with each provider of the fallback policy in
+// turn after grep.app failed with primaryErr, returning the first that succeeds. The scan
+// records which provider served it and why.
+func searchFallbackProviders(ctx context.Context, client *http.Client, ghClient *github.Client, args map[string]interface{}, maxPages int, primaryErr error) (*searchScan, error) {
+	opts, err := parseSearchOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	var failures []string
+	for _, provider := range GetConfig().Fallback {
+		if tenant := tenantFromContext(ctx); tenant != nil && !tenant.allowsProvider(provider) {
+			failures = append(failures, fmt.Sprintf("%s: %v", provider, errProviderNotAllowed))
+			continue
+		}
+		log.Printf("🔁 grep.app failed (%v); falling back to %s", primaryErr, provider)
+		var scan *searchScan
+		switch provider {
+		case providerGitHub:
+			scan, err = searchGitHubCode(ctx, client, ghClient, opts, maxPages*grepAppResultsPerPage)
+		}
+		if err == nil {
+			scan.Provider = provider
+			scan.FallbackReason = primaryErr.Error()
+			return scan, nil
+		}
+		log.Printf("❌ Fallback to %s failed: %v", provider, err)
+		failures = append(failures, fmt.Sprintf("%s: %v", provider, err))
+	}
+	if len(failures) == 0 {
+		return nil, fmt.Errorf("no fallback providers configured")
+	}
+	return nil, errors.New(strings.Join(failures, "; "))
+}
+
+// searchGitHubCode searches with the GitHub code search API, one request per language, and
+// downloads each matched file to find the matched lines and their numbers, which the API
+// does not report. Regex searches are not supported by the API.
+func searchGitHubCode(ctx context.Context, client *http.Client, ghClient *github.Client, opts SearchOptions, maxResults int) (*searchScan, error) {
+	if opts.UseRegex {
+		return nil, fmt.Errorf("GitHub code search does not support regex queries")
+	}
+	langs := splitLangFilter(opts.LangFilter)
+	if len(langs) == 0 {
+		langs = []string{""}
+	}
+	perPage := min(maxResults, githubCodeSearchPerPage)
+
+	scan := &searchScan{Hits: &Hits{Hits: make(map[string]map[string]map[string]string)}, Complete: true}
+	var files []*github.CodeResult
+	for _, lang := range langs {
+		start := time.Now()
+		result, _, err := ghClient.Search.Code(ctx, githubCodeQuery(opts, lang), &github.SearchOptions{ListOptions: github.ListOptions{PerPage: perPage}})
+		scan.APIRequests++
+		if err != nil {
+			return scan, fmt.Errorf("GitHub code search failed: %w", err)
+		}
+		scan.PagesScanned++
+		scan.AvailablePages += (result.GetTotal() + perPage - 1) / perPage
+		scan.TotalCount += result.GetTotal()
+		scan.Complete = scan.Complete && !result.GetIncompleteResults() && result.GetTotal() <= len(result.CodeResults)
+		scan.Pages = append(scan.Pages, PageFetch{Language: lang, Page: 1, Hits: len(result.CodeResults), ElapsedMs: time.Since(start).Milliseconds()})
+		files = append(files, result.CodeResults...)
+	}
+
+	matches := fallbackLineMatcher(opts)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxFallbackFileFetches)
+	for _, file := range files {
+		repo := file.GetRepository().GetFullName()
+		path := file.GetPath()
+		if repo == "" || path == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(file *github.CodeResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			lines, err := fetchMatchedLines(ctx, client, file, matches)
+			mu.Lock()
+			defer mu.Unlock()
+			scan.APIRequests++
+			if err != nil || len(lines) == 0 {
+				log.Printf("⚠️ Left out %s/%s, no matched lines found: %v", repo, path, err)
+				return
+			}
+			if scan.Hits.Hits[repo] == nil {
+				scan.Hits.Hits[repo] = make(map[string]map[string]string)
+			}
+			scan.Hits.Hits[repo][path] = lines
+		}(file)
+	}
+	wg.Wait()
+	return scan, nil
+}
+
+// githubCodeQuery translates the search options into GitHub code search syntax.
+func githubCodeQuery(opts SearchOptions, lang string) string {
+	quote := func(s string) string {
+		if strings.ContainsAny(s, " \t\"") {
+			return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+		}
+		return s
+	}
+	terms := []string{quote(opts.Query)}
+	if opts.RepoFilter != "" {
+		terms = append(terms, "repo:"+opts.RepoFilter)
+	}
+	if opts.PathFilter != "" {
+		terms = append(terms, "path:"+quote(opts.PathFilter))
+	}
+	if lang != "" {
+		terms = append(terms, "language:"+quote(lang))
+	}
+	return strings.Join(terms, " ")
+}
+
+// fallbackLineMatcher matches lines containing the query, or failing that any of its
+// words, since GitHub code search matches terms anywhere in a file.
+func fallbackLineMatcher(opts SearchOptions) func(lines []string) []int {
+	normalize := strings.ToLower
+	if opts.CaseSensitive {
+		normalize = func(s string) string { return s }
+	}
+	query := normalize(opts.Query)
+	find := func(lines []string, terms []string) []int {
+		var found []int
+		for i, line := range lines {
+			text := normalize(line)
+			for _, term := range terms {
+				if strings.Contains(text, term) {
+					found = append(found, i)
+					break
+				}
+			}
+			if len(found) == maxFallbackLinesPerFile {
+				break
+			}
+		}
+		return found
+	}
+	return func(lines []string) []int {
+		if found := find(lines, []string{query}); len(found) > 0 {
+			return found
+		}
+		return find(lines, strings.Fields(query))
+	}
+}
+
+// fetchMatchedLines downloads a code search result's file at the commit the search saw and
+// returns its matched lines keyed by line number.
+func fetchMatchedLines(ctx context.Context, client *http.Client, file *github.CodeResult, matches func([]string) []int) (map[string]string, error) {
+	ref, ok := commitFromHTMLURL(file.GetHTMLURL())
+	if !ok {
+		return nil, fmt.Errorf("no commit in %q", file.GetHTMLURL())
+	}
+	segments := strings.Split(file.GetPath(), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	rawURL := fmt.Sprintf("%s/%s/%s/%s", githubRawBaseURL, file.GetRepository().GetFullName(), ref, strings.Join(segments, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFallbackFileBytes))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(body), "\n")
+	matched := make(map[string]string)
+	for _, i := range matches(lines) {
+		matched[strconv.Itoa(i+1)] = strings.TrimRight(lines[i], "\r")
+	}
+	return matched, nil
+}
+
+// commitFromHTMLURL extracts the ref from a github.com/owner/repo/blob/<ref>/path URL.
+func commitFromHTMLURL(htmlURL string) (string, bool) {
+	_, rest, ok := strings.Cut(htmlURL, "/blob/")
+	if !ok {
+		return "", false
+	}
+	ref, _, ok := strings.Cut(rest, "/")
+	return ref, ok && ref != ""
+}
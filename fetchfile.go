@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Single File Retrieval
+//================================================================================
+
+// fetchFileCacheKey identifies a file at a ref together with the options that change its
+// post-processed content and the GitHub credentials it was read with, so that a private file
+// fetched with one tenant's token is never served to another tenant.
+func fetchFileCacheKey(ctx context.Context, req GitHubFileRequest, opts retrievalOptions) string {
+	return generateCacheKey(map[string]interface{}{
+		"fetch_file":            req.Owner + "/" + req.Repo + "/" + req.Path,
+		"ref":                   req.Ref,
+		"keep_notebook_outputs": opts.KeepNotebookOutputs,
+		"credentials":           githubCredentialID(ctx),
+	})
+}
+
+// githubCredentialID identifies the tenant token GitHub requests under ctx are made with,
+// or is empty when they use the server's own client.
+func githubCredentialID(ctx context.Context) string {
+	tenant := tenantFromContext(ctx)
+	if tenant == nil || tenant.GitHubToken == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(tenant.GitHubToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// fetchSingleFile retrieves one file or directory listing, serving it from the file cache or
+// a preloaded snapshot when possible. Successful fetches are cached; cacheTTL overrides the
+// file TTL when positive. The second result reports whether GitHub was not called.
+func fetchSingleFile(ctx context.Context, ghClient *github.Client, req GitHubFileRequest, cacheTTL time.Duration, opts retrievalOptions) (RetrievedFile, bool) {
+	repoPath := req.Owner + "/" + req.Repo
+	// Cached and preloaded files came from GitHub too, so they are refused along with it
+	if tenant := tenantFromContext(ctx); tenant != nil && !tenant.allowsProvider(providerGitHub) {
+		return RetrievedFile{Number: 1, Repo: repoPath, Path: req.Path, Ref: req.Ref, Error: fmt.Sprintf("%v: %s", errProviderNotAllowed, providerGitHub)}, true
+	}
+	cacheKey := fetchFileCacheKey(ctx, req, opts)
+	cached, err := getCachedData[RetrievedFile](cacheKey, cacheTTLFor(cacheEntryFile, cacheTTL))
+	if err != nil {
+		log.Printf("⚠️ Failed to read cached file %s/%s: %v", repoPath, req.Path, err)
+	}
+	if cached != nil {
+		log.Printf("💾 Serving %s/%s from cache", repoPath, req.Path)
+		return *cached, true
+	}
+	if req.Ref == "" {
+		if content, ok := preloadedFile(repoPath, req.Path); ok {
+			log.Printf("📦 Serving %s/%s from preloaded snapshots", repoPath, req.Path)
+			return RetrievedFile{Number: 1, Repo: repoPath, Path: req.Path, Content: content, Type: "file"}, true
+		}
+	}
+
+	file := fetchGitHubFiles(ctx, ghClient, []GitHubFileRequest{req}, opts)[0]
+	if file.Error == "" {
+		if err := cacheData(cacheKey, file, repoPath+"/"+req.Path, cacheEntryFile); err != nil {
+			log.Printf("⚠️ Failed to cache file %s/%s: %v", repoPath, req.Path, err)
+		}
+	}
+	return file, false
+}
+
+// formatFetchedFile renders a fetched file as markdown, or its listing for a directory.
+func formatFetchedFile(file RetrievedFile, cached bool) string {
+	var b strings.Builder
+	writeMarkdownEntry(&b, file)
+	var notes []string
+	if file.Ref != "" {
+		notes = append(notes, "ref "+file.Ref)
+	}
+	if file.CommitSHA != "" {
+		notes = append(notes, "commit "+file.CommitSHA[:min(12, len(file.CommitSHA))])
+	}
+	if file.Language != "" {
+		notes = append(notes, file.Language)
+	}
+	if file.Truncated {
+		notes = append(notes, fmt.Sprintf("truncated from %d bytes", file.OriginalBytes))
+	} else if file.Type == "file" {
+		notes = append(notes, fmt.Sprintf("%d bytes", len(file.Content)))
+	}
+	if cached {
+		notes = append(notes, "cached")
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(&b, "\n_%s_\n", strings.Join(notes, ", "))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
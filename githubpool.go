@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// GitHub Fetch Worker Pool
+//================================================================================
+
+const (
+	defaultGitHubConcurrency     = 5                     // Files or archives fetched from GitHub at once per retrieval
+	defaultGitHubRequestInterval = 50 * time.Millisecond // Minimum spacing between the starts of GitHub fetches
+)
+
+// requestPacer spaces out the starts of requests shared by every caller, so that concurrent
+// retrievals together stay under GitHub's secondary rate limits.
+type requestPacer struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+var githubPacer = &requestPacer{}
+
+// wait blocks until interval has passed since the previous start, or ctx is done.
+func (p *requestPacer) wait(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	start := time.Now()
+	if p.next.After(start) {
+		start = p.next
+	}
+	p.next = start.Add(interval)
+	p.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// githubFetchJob fetches the files of one request, or of one repository's archive.
+type githubFetchJob func() []RetrievedFile
+
+// runGitHubJobs runs jobs on at most concurrency workers, paced by githubPacer, and returns
+// their files in job order. A job whose wait is cut short by ctx still runs, so that it
+// reports the cancellation for its files.
+func runGitHubJobs(ctx context.Context, jobs []githubFetchJob, concurrency int, interval time.Duration) []RetrievedFile {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([][]RetrievedFile, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				githubPacer.wait(ctx, interval)
+				results[i] = jobs[i]()
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var files []RetrievedFile
+	for _, jobFiles := range results {
+		files = append(files, jobFiles...)
+	}
+	return files
+}
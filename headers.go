@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+//================================================================================
+// Outgoing Request Headers
+//================================================================================
+
+// RequestHeaderConfig sets the User-Agent and extra headers sent to grep.app and GitHub.
+type RequestHeaderConfig struct {
+	UserAgent string      // Empty uses defaultUserAgent
+	Extra     http.Header // Added to every upstream request, e.g. proxy credentials
+}
+
+// defaultUserAgent identifies the server and its version to upstream services.
+func defaultUserAgent() string {
+	return fmt.Sprintf("grep-app-mcp/%s (+https://github.com/ai-tools-all/grep_app_mcp_golang)", Version)
+}
+
+// parseHeaderLine parses a "Name: value" header.
+func parseHeaderLine(line string) (string, string, error) {
+	name, value, ok := strings.Cut(line, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("invalid header %q: expected \"Name: value\"", name)
+	}
+	return textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value), nil
+}
+
+// parseHeaderList parses semicolon-separated "Name: value" headers, as used by the
+// environment variable.
+func parseHeaderList(list string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, line := range strings.Split(list, ";") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, value, err := parseHeaderLine(line)
+		if err != nil {
+			return nil, err
+		}
+		headers.Add(name, value)
+	}
+	return headers, nil
+}
+
+// headerFlag is a repeatable flag.Value that adds one "Name: value" header per use.
+type headerFlag struct {
+	target *http.Header
+}
+
+func (f headerFlag) String() string {
+	if f.target == nil {
+		return ""
+	}
+	names := make([]string, 0, len(*f.target))
+	for name := range *f.target {
+		names = append(names, name) // Values may hold credentials, so only names are shown
+	}
+	return strings.Join(names, ",")
+}
+
+func (f headerFlag) Set(value string) error {
+	name, v, err := parseHeaderLine(value)
+	if err != nil {
+		return err
+	}
+	if *f.target == nil {
+		*f.target = make(http.Header)
+	}
+	f.target.Add(name, v)
+	return nil
+}
+
+// headerTransport sets the configured User-Agent and extra headers on every request.
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+func newHeaderTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &headerTransport{base: base}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cfg := GetConfig().RequestHeaders
+	req = req.Clone(req.Context()) // RoundTrippers must not modify the caller's request
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for name, values := range cfg.Extra {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Recent Searches
+//================================================================================
+
+const (
+	defaultRecentSearches = 20
+	maxRecentSearches     = 200
+	maxLogLineBytes       = 4 << 20 // Search records embed arguments, so allow long lines
+)
+
+// RecentSearch summarizes the latest execution of a distinct query across all sessions.
+type RecentSearch struct {
+	Query       string            `json:"query"`
+	LastRun     time.Time         `json:"last_run"`
+	SessionID   string            `json:"session_id"`
+	ResultCount int               `json:"result_count"`
+	FileCount   int               `json:"file_count"`
+	Runs        int               `json:"runs"`
+	Success     bool              `json:"success"`
+	Filters     map[string]string `json:"filters,omitempty"`
+	Cached      bool              `json:"cached"` // Complete results are still available to batchRetrievalTool
+}
+
+// searchCompleteRecord is the subset of a log line needed to reconstruct search history.
+type searchCompleteRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	SessionID string    `json:"session_id"`
+	Tool      string    `json:"tool"`
+	Data      struct {
+		Operation  string         `json:"operation"`
+		SearchData *SearchLogData `json:"search_data"`
+	} `json:"data"`
+}
+
+// listRecentSearches scans every JSONL log file in dir and returns the most recent
+// distinct queries, newest first.
+func listRecentSearches(dir string, limit int) ([]RecentSearch, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log files: %w", err)
+	}
+
+	byQuery := make(map[string]*RecentSearch)
+	for _, file := range files {
+		if err := collectSearchRecords(file, byQuery); err != nil {
+			return nil, err
+		}
+	}
+
+	searches := make([]RecentSearch, 0, len(byQuery))
+	for _, search := range byQuery {
+		search.Cached = hasCompleteResults(search.Query)
+		searches = append(searches, *search)
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		return searches[i].LastRun.After(searches[j].LastRun)
+	})
+
+	if limit > 0 && len(searches) > limit {
+		searches = searches[:limit]
+	}
+	return searches, nil
+}
+
+// collectSearchRecords folds the search_complete records of one log file into byQuery.
+func collectSearchRecords(file string, byQuery map[string]*RecentSearch) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineBytes)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		// Cheap pre-filter before decoding the full entry
+		if !strings.Contains(string(line), `"search_complete"`) {
+			continue
+		}
+		var record searchCompleteRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue // Skip malformed lines
+		}
+		if record.Data.Operation != "search_complete" || record.Data.SearchData == nil {
+			continue
+		}
+		data := record.Data.SearchData
+		if data.Query == "" {
+			continue
+		}
+
+		search, ok := byQuery[data.Query]
+		if !ok {
+			search = &RecentSearch{Query: data.Query}
+			byQuery[data.Query] = search
+		}
+		search.Runs++
+		if record.Timestamp.After(search.LastRun) {
+			search.LastRun = record.Timestamp
+			search.SessionID = record.SessionID
+			search.ResultCount = data.ResultCount
+			search.FileCount = data.FileCount
+			search.Success = data.Success
+			search.Filters = data.Filters
+		}
+	}
+	return scanner.Err()
+}
+
+// hasCompleteResults reports whether a complete result set for the query exists in the cache.
+func hasCompleteResults(query string) bool {
+	cacheKey := completeCacheKey(query)
+	_, err := os.Stat(cacheFilePath(cacheKey))
+	return err == nil
+}
+
+// formatRecentSearches renders recent searches as a readable list.
+func formatRecentSearches(searches []RecentSearch) string {
+	if len(searches) == 0 {
+		return "No searches found in the logs."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Recent searches (%d):\n", len(searches))
+	for i, search := range searches {
+		status := fmt.Sprintf("%d repos, %d files", search.ResultCount, search.FileCount)
+		if !search.Success {
+			status = "failed"
+		}
+		cached := ""
+		if search.Cached {
+			cached = ", cached for batch retrieval"
+		}
+		fmt.Fprintf(&b, "%d. %q — %s (%s, runs: %d, session: %s%s)\n",
+			i+1, search.Query, search.LastRun.Format("2006-01-02 15:04:05"), status, search.Runs, search.SessionID, cached)
+	}
+	return b.String()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Tool Call Hooks
+//================================================================================
+
+// ToolCallInfo describes a tool call to the hooks that run before it.
+type ToolCallInfo struct {
+	Tool      string
+	SessionID string                 // MCP client session, empty when the transport has none
+	Tenant    string                 // Tenant profile name, empty without profiles
+	Arguments map[string]interface{} // A private copy; changes are passed on to the tool
+}
+
+// ToolCallHook runs before every tool call. Returning an error denies the call with the
+// error's message; changes to info.Arguments replace the call's arguments.
+type ToolCallHook interface {
+	BeforeToolCall(ctx context.Context, info *ToolCallInfo) error
+}
+
+// ToolCallHookFunc adapts a function into a ToolCallHook.
+type ToolCallHookFunc func(ctx context.Context, info *ToolCallInfo) error
+
+func (f ToolCallHookFunc) BeforeToolCall(ctx context.Context, info *ToolCallInfo) error {
+	return f(ctx, info)
+}
+
+// RepoPolicyHook is implemented by hooks that also vet the repositories a tool searches when
+// they are not named by its arguments, such as the repositories of a collection. It returns
+// the repositories the call may search, or an error to deny it.
+type RepoPolicyHook interface {
+	FilterRepos(ctx context.Context, info *ToolCallInfo, repos []string) ([]string, error)
+}
+
+type namedHook struct {
+	name string
+	hook ToolCallHook
+}
+
+// toolCallHooks run in registration order; the first denial stops the call.
+var toolCallHooks struct {
+	sync.RWMutex
+	hooks []namedHook
+}
+
+// RegisterToolCallHook adds a hook that runs before every tool call. Embedders can use it
+// to enforce their own policy without changing the tool handlers.
+func RegisterToolCallHook(name string, hook ToolCallHook) {
+	toolCallHooks.Lock()
+	defer toolCallHooks.Unlock()
+	toolCallHooks.hooks = append(toolCallHooks.hooks, namedHook{name: name, hook: hook})
+}
+
+// toolCallHookMiddleware runs the registered hooks and applies their decisions.
+func toolCallHookMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		toolCallHooks.RLock()
+		hooks := toolCallHooks.hooks
+		toolCallHooks.RUnlock()
+		if len(hooks) == 0 {
+			return next(ctx, request)
+		}
+
+		info := &ToolCallInfo{Tool: request.Params.Name, Arguments: copyArgs(request.GetArguments())}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			info.SessionID = session.SessionID()
+		}
+		if tenant := tenantFromContext(ctx); tenant != nil {
+			info.Tenant = tenant.Name
+		}
+
+		for _, h := range hooks {
+			if err := h.hook.BeforeToolCall(ctx, info); err != nil {
+				if logger := LoggerFromContext(ctx); logger != nil {
+					logger.LogWarn(fmt.Sprintf("🚫 Tool call %s denied by hook %s: %v", info.Tool, h.name, err), "policy", map[string]interface{}{
+						"tool":   info.Tool,
+						"hook":   h.name,
+						"tenant": info.Tenant,
+					})
+				}
+				return mcp.NewToolResultError(fmt.Sprintf("tool call denied: %v", err)), nil
+			}
+		}
+		request.Params.Arguments = info.Arguments
+		return next(ctx, request)
+	}
+}
+
+// filterReposByHooks passes the repositories a tool is about to search through every
+// registered RepoPolicyHook, in registration order.
+func filterReposByHooks(ctx context.Context, tool string, repos []string) ([]string, error) {
+	toolCallHooks.RLock()
+	hooks := toolCallHooks.hooks
+	toolCallHooks.RUnlock()
+
+	info := &ToolCallInfo{Tool: tool, Arguments: map[string]interface{}{}}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		info.SessionID = session.SessionID()
+	}
+	if tenant := tenantFromContext(ctx); tenant != nil {
+		info.Tenant = tenant.Name
+	}
+	for _, h := range hooks {
+		repoHook, ok := h.hook.(RepoPolicyHook)
+		if !ok {
+			continue
+		}
+		var err error
+		if repos, err = repoHook.FilterRepos(ctx, info, repos); err != nil {
+			return nil, err
+		}
+	}
+	return repos, nil
+}
+
+//================================================================================
+// Policy File Hook
+//================================================================================
+
+// PolicyRule applies to calls matching its tools and tenants; empty lists match all.
+type PolicyRule struct {
+	Tools                []string               `json:"tools,omitempty"`
+	Tenants              []string               `json:"tenants,omitempty"`
+	Deny                 bool                   `json:"deny,omitempty"`
+	Message              string                 `json:"message,omitempty"`              // Reason shown when the rule denies a call
+	RepoAllowlist        []string               `json:"repoAllowlist,omitempty"`        // path.Match patterns such as "myorg/*"
+	DenyOutsideAllowlist bool                   `json:"denyOutsideAllowlist,omitempty"` // Deny instead of dropping a disallowed repoFilter
+	StripArguments       []string               `json:"stripArguments,omitempty"`
+	SetArguments         map[string]interface{} `json:"setArguments,omitempty"`
+}
+
+// Policy is the built-in hook configured with -policy. Every matching rule applies in order.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// loadPolicy reads and validates a policy file of the form {"rules": [...]}.
+func loadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	for i, rule := range policy.Rules {
+		for _, pattern := range rule.RepoAllowlist {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid repoAllowlist pattern %q: %w", i+1, pattern, err)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+func (r PolicyRule) matches(info *ToolCallInfo) bool {
+	return (len(r.Tools) == 0 || containsString(r.Tools, info.Tool)) &&
+		(len(r.Tenants) == 0 || containsString(r.Tenants, info.Tenant))
+}
+
+// repoAllowed reports whether repo matches one of the allowlist patterns.
+func (r PolicyRule) repoAllowed(repo string) bool {
+	for _, pattern := range r.RepoAllowlist {
+		if ok, _ := path.Match(pattern, repo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BeforeToolCall applies every matching rule to the call.
+func (p *Policy) BeforeToolCall(ctx context.Context, info *ToolCallInfo) error {
+	for _, rule := range p.Rules {
+		if !rule.matches(info) {
+			continue
+		}
+		if rule.Deny {
+			if rule.Message != "" {
+				return errors.New(rule.Message)
+			}
+			return fmt.Errorf("%s is not allowed by policy", info.Tool)
+		}
+		if repo, _ := info.Arguments["repoFilter"].(string); repo != "" && len(rule.RepoAllowlist) > 0 && !rule.repoAllowed(repo) {
+			if rule.DenyOutsideAllowlist {
+				return fmt.Errorf("repoFilter %q is outside the allowed repositories", repo)
+			}
+			delete(info.Arguments, "repoFilter")
+			if logger := LoggerFromContext(ctx); logger != nil {
+				logger.LogInfo(fmt.Sprintf("🧹 Policy dropped repoFilter %q from %s", repo, info.Tool), "policy", map[string]interface{}{"tool": info.Tool, "tenant": info.Tenant})
+			}
+		}
+		for _, name := range rule.StripArguments {
+			delete(info.Arguments, name)
+		}
+		for name, value := range rule.SetArguments {
+			info.Arguments[name] = value
+		}
+	}
+	return nil
+}
+
+// FilterRepos applies the allowlists of the matching rules to repositories searched on the
+// caller's behalf, such as those of a collection. Repositories outside an allowlist are
+// dropped, or the call is denied with denyOutsideAllowlist.
+func (p *Policy) FilterRepos(ctx context.Context, info *ToolCallInfo, repos []string) ([]string, error) {
+	for _, rule := range p.Rules {
+		if !rule.matches(info) || len(rule.RepoAllowlist) == 0 {
+			continue
+		}
+		var allowed, dropped []string
+		for _, repo := range repos {
+			if rule.repoAllowed(repo) {
+				allowed = append(allowed, repo)
+			} else {
+				dropped = append(dropped, repo)
+			}
+		}
+		if len(dropped) == 0 {
+			continue
+		}
+		if rule.DenyOutsideAllowlist {
+			return nil, fmt.Errorf("repository %q is outside the allowed repositories", dropped[0])
+		}
+		if logger := LoggerFromContext(ctx); logger != nil {
+			logger.LogInfo(fmt.Sprintf("🧹 Policy dropped %d repositories outside the allowlist from %s", len(dropped), info.Tool), "policy", map[string]interface{}{"tool": info.Tool, "tenant": info.Tenant, "repos": dropped})
+		}
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("none of the %d repositories are allowed by policy", len(repos))
+		}
+		repos = allowed
+	}
+	return repos, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Recovery Knowledge Base
+//================================================================================
+
+const (
+	knowledgeBaseFileName = "recovery-kb.json" // Looked up in the log directory when no path is configured
+	defaultSuggestions    = 5
+	maxSuggestions        = 50
+)
+
+// RecoverySuggestion maps a query that returned nothing to a follow-up query that worked.
+// The analyzer's -export-kb option writes these; suggestQueries reads them.
+type RecoverySuggestion struct {
+	FailedQuery   string    `json:"failed_query"`
+	RecoveryQuery string    `json:"recovery_query"`
+	Occurrences   int       `json:"occurrences"` // Sessions in which the recovery was observed
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// RecoveryKnowledgeBase is the file exchanged between the analyzer and the server.
+type RecoveryKnowledgeBase struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	Suggestions []RecoverySuggestion `json:"suggestions"`
+}
+
+// QuerySuggestion is a ranked suggestion returned by suggestQueries.
+type QuerySuggestion struct {
+	Query       string  `json:"query"`
+	BasedOn     string  `json:"based_on"` // Failed query the suggestion was learned from
+	Score       float64 `json:"score"`    // 1 for an exact match, token overlap otherwise
+	Occurrences int     `json:"occurrences"`
+}
+
+// knowledgeBaseFile returns the configured knowledge base path.
+func knowledgeBaseFile() string {
+	if path := GetConfig().KnowledgeBaseFile; path != "" {
+		return path
+	}
+	return filepath.Join(GetConfig().LogDir, knowledgeBaseFileName)
+}
+
+// knowledgeBaseCache holds the last loaded file and reloads it when it changes on disk,
+// so a fresh analyzer export takes effect without a restart.
+var knowledgeBaseCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	kb      *RecoveryKnowledgeBase
+}
+
+// loadKnowledgeBase reads the knowledge base at path, reusing the cached copy when unchanged.
+func loadKnowledgeBase(path string) (*RecoveryKnowledgeBase, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	knowledgeBaseCache.Lock()
+	defer knowledgeBaseCache.Unlock()
+	if knowledgeBaseCache.kb != nil && knowledgeBaseCache.path == path && knowledgeBaseCache.modTime.Equal(info.ModTime()) {
+		return knowledgeBaseCache.kb, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read knowledge base: %w", err)
+	}
+	var kb RecoveryKnowledgeBase
+	if err := json.Unmarshal(data, &kb); err != nil {
+		return nil, fmt.Errorf("failed to parse knowledge base %s: %w", path, err)
+	}
+	knowledgeBaseCache.path = path
+	knowledgeBaseCache.modTime = info.ModTime()
+	knowledgeBaseCache.kb = &kb
+	return &kb, nil
+}
+
+// queryTokens splits a query into lower-case word tokens for fuzzy matching.
+func queryTokens(query string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, token := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !(r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		tokens[token] = true
+	}
+	return tokens
+}
+
+// tokenOverlap returns the Jaccard similarity of two token sets.
+func tokenOverlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for token := range a {
+		if b[token] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// suggest ranks recovery queries for query: exact matches on the failed query first, then
+// failed queries sharing words with it. Each recovery query appears once.
+func (kb *RecoveryKnowledgeBase) suggest(query string, limit int) []QuerySuggestion {
+	normalized := strings.ToLower(strings.TrimSpace(query))
+	tokens := queryTokens(query)
+
+	best := make(map[string]QuerySuggestion)
+	for _, s := range kb.Suggestions {
+		score := 1.0
+		if strings.ToLower(strings.TrimSpace(s.FailedQuery)) != normalized {
+			score = tokenOverlap(tokens, queryTokens(s.FailedQuery))
+		}
+		if score == 0 || strings.EqualFold(s.RecoveryQuery, query) {
+			continue
+		}
+		current, ok := best[s.RecoveryQuery]
+		if !ok || score > current.Score || score == current.Score && s.Occurrences > current.Occurrences {
+			best[s.RecoveryQuery] = QuerySuggestion{Query: s.RecoveryQuery, BasedOn: s.FailedQuery, Score: score, Occurrences: s.Occurrences}
+		}
+	}
+
+	suggestions := make([]QuerySuggestion, 0, len(best))
+	for _, s := range best {
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		if suggestions[i].Occurrences != suggestions[j].Occurrences {
+			return suggestions[i].Occurrences > suggestions[j].Occurrences
+		}
+		return suggestions[i].Query < suggestions[j].Query
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// formatQuerySuggestions renders suggestions as a numbered list.
+func formatQuerySuggestions(query string, suggestions []QuerySuggestion) string {
+	if len(suggestions) == 0 {
+		return fmt.Sprintf("No recovery suggestions known for %q.", query)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Suggested queries for %q:\n", query)
+	for i, s := range suggestions {
+		if s.Score == 1 {
+			fmt.Fprintf(&b, "%d. %s (worked after this query in %d sessions)\n", i+1, s.Query, s.Occurrences)
+		} else {
+			fmt.Fprintf(&b, "%d. %s (worked after similar query %q in %d sessions)\n", i+1, s.Query, s.BasedOn, s.Occurrences)
+		}
+	}
+	return b.String()
+}
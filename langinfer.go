@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+//================================================================================
+// Language Inference
+//================================================================================
+
+// extensionLanguages maps lowercase file extensions to grep.app language names.
+var extensionLanguages = map[string]string{
+	".go":    "Go",
+	".js":    "JavaScript",
+	".mjs":   "JavaScript",
+	".cjs":   "JavaScript",
+	".jsx":   "JSX",
+	".ts":    "TypeScript",
+	".mts":   "TypeScript",
+	".tsx":   "TSX",
+	".py":    "Python",
+	".pyi":   "Python",
+	".rb":    "Ruby",
+	".rs":    "Rust",
+	".java":  "Java",
+	".kt":    "Kotlin",
+	".kts":   "Kotlin",
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".cxx":   "C++",
+	".hpp":   "C++",
+	".hh":    "C++",
+	".cs":    "C#",
+	".php":   "PHP",
+	".swift": "Swift",
+	".scala": "Scala",
+	".sh":    "Shell",
+	".bash":  "Shell",
+	".zsh":   "Shell",
+	".yml":   "YAML",
+	".yaml":  "YAML",
+	".md":    "Markdown",
+	".html":  "HTML",
+	".htm":   "HTML",
+	".css":   "CSS",
+	".scss":  "SCSS",
+	".sql":   "SQL",
+	".lua":   "Lua",
+	".dart":  "Dart",
+	".ex":    "Elixir",
+	".exs":   "Elixir",
+	".hs":    "Haskell",
+	".json":  "JSON",
+	".toml":  "TOML",
+	".xml":   "XML",
+	".proto": "Protocol Buffer",
+	".tf":    "HCL",
+	".vue":   "Vue",
+	".ipynb": "Jupyter Notebook",
+}
+
+// fileNameLanguages maps lowercase file names without a telling extension.
+var fileNameLanguages = map[string]string{
+	"dockerfile":     "Dockerfile",
+	"makefile":       "Makefile",
+	"gnumakefile":    "Makefile",
+	"cmakelists.txt": "CMake",
+	"gemfile":        "Ruby",
+	"rakefile":       "Ruby",
+	"build":          "Starlark",
+	"build.bazel":    "Starlark",
+}
+
+// inferLanguage guesses a file's language from its name, consulting the configured
+// overrides first. It returns "" when the file is not recognized.
+func inferLanguage(filePath string) string {
+	name := strings.ToLower(path.Base(filePath))
+	ext := path.Ext(name)
+	overrides := GetConfig().LanguageOverrides
+	if lang, ok := overrides[name]; ok {
+		return lang
+	}
+	if lang, ok := overrides[ext]; ok && ext != "" {
+		return lang
+	}
+	if lang, ok := fileNameLanguages[name]; ok {
+		return lang
+	}
+	if strings.HasPrefix(name, "dockerfile.") || strings.HasSuffix(name, ".dockerfile") {
+		return "Dockerfile"
+	}
+	return extensionLanguages[ext]
+}
+
+// parseLanguageOverrides parses comma-separated "pattern=Language" overrides, where the
+// pattern is an extension such as ".h" or a file name such as "BUILD".
+func parseLanguageOverrides(list string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, item := range splitCommaList(list) {
+		pattern, lang, ok := strings.Cut(item, "=")
+		pattern, lang = strings.ToLower(strings.TrimSpace(pattern)), strings.TrimSpace(lang)
+		if !ok || pattern == "" || lang == "" {
+			return nil, fmt.Errorf("invalid language override %q: expected \"extension=Language\"", item)
+		}
+		overrides[pattern] = canonicalLanguage(lang)
+	}
+	return overrides, nil
+}
+
+// languageOverridesFlag is a flag.Value that parses comma-separated language overrides.
+type languageOverridesFlag struct {
+	target *map[string]string
+}
+
+func (f languageOverridesFlag) String() string {
+	if f.target == nil {
+		return ""
+	}
+	var items []string
+	for pattern, lang := range *f.target {
+		items = append(items, pattern+"="+lang)
+	}
+	return strings.Join(items, ",")
+}
+
+func (f languageOverridesFlag) Set(value string) error {
+	overrides, err := parseLanguageOverrides(value)
+	if err != nil {
+		return err
+	}
+	*f.target = overrides
+	return nil
+}
+
+// inferHitLanguages returns the inferred language of every recognized file in hits, keyed
+// by repository and path like the hits themselves.
+func inferHitLanguages(hits *Hits) map[string]map[string]string {
+	languages := make(map[string]map[string]string)
+	for repo, files := range hits.Hits {
+		for filePath := range files {
+			lang := inferLanguage(filePath)
+			if lang == "" {
+				continue
+			}
+			if languages[repo] == nil {
+				languages[repo] = make(map[string]string)
+			}
+			languages[repo][filePath] = lang
+		}
+	}
+	return languages
+}
+
+// addFileLanguages sets the inferred language of every retrieved file.
+func addFileLanguages(files []RetrievedFile) {
+	for i := range files {
+		if files[i].Type != "dir" {
+			files[i].Language = inferLanguage(files[i].Path)
+		}
+	}
+}
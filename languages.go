@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Language Aliases
+//================================================================================
+
+// languageAliases maps common lowercase shorthands to the language names grep.app expects.
+// An unrecognized lang value silently returns zero results, so aliases are resolved before
+// building the request.
+var languageAliases = map[string]string{
+	"golang":     "Go",
+	"go":         "Go",
+	"js":         "JavaScript",
+	"javascript": "JavaScript",
+	"node":       "JavaScript",
+	"jsx":        "JSX",
+	"ts":         "TypeScript",
+	"typescript": "TypeScript",
+	"tsx":        "TSX",
+	"py":         "Python",
+	"python":     "Python",
+	"python3":    "Python",
+	"rb":         "Ruby",
+	"ruby":       "Ruby",
+	"rs":         "Rust",
+	"rust":       "Rust",
+	"java":       "Java",
+	"kt":         "Kotlin",
+	"kotlin":     "Kotlin",
+	"c":          "C",
+	"cpp":        "C++",
+	"c++":        "C++",
+	"cxx":        "C++",
+	"cs":         "C#",
+	"csharp":     "C#",
+	"c#":         "C#",
+	"php":        "PHP",
+	"swift":      "Swift",
+	"scala":      "Scala",
+	"sh":         "Shell",
+	"bash":       "Shell",
+	"shell":      "Shell",
+	"yml":        "YAML",
+	"yaml":       "YAML",
+	"md":         "Markdown",
+	"markdown":   "Markdown",
+	"html":       "HTML",
+	"css":        "CSS",
+	"sql":        "SQL",
+	"lua":        "Lua",
+	"dart":       "Dart",
+	"elixir":     "Elixir",
+	"ex":         "Elixir",
+	"haskell":    "Haskell",
+	"hs":         "Haskell",
+	"dockerfile": "Dockerfile",
+}
+
+// canonicalLanguage resolves a language alias to its grep.app name, leaving unknown values untouched.
+func canonicalLanguage(lang string) string {
+	if canonical, ok := languageAliases[strings.ToLower(strings.TrimSpace(lang))]; ok {
+		return canonical
+	}
+	return strings.TrimSpace(lang)
+}
+
+// canonicalizeLangFilter rewrites every language in a comma-separated langFilter to its
+// canonical name and reports which inputs were rewritten.
+func canonicalizeLangFilter(langFilter string) (string, map[string]string) {
+	langs := splitLangFilter(langFilter)
+	rewritten := make(map[string]string)
+	canonical := make([]string, 0, len(langs))
+	seen := make(map[string]struct{})
+	for _, lang := range langs {
+		resolved := canonicalLanguage(lang)
+		if resolved != lang {
+			rewritten[lang] = resolved
+		}
+		if _, ok := seen[resolved]; ok {
+			continue
+		}
+		seen[resolved] = struct{}{}
+		canonical = append(canonical, resolved)
+	}
+	return strings.Join(canonical, ","), rewritten
+}
+
+//================================================================================
+// Explain Output
+//================================================================================
+
+// formatSearchExplain describes the effective search parameters after normalization.
+func formatSearchExplain(args map[string]interface{}, langRewrites map[string]string) string {
+	var b strings.Builder
+	b.WriteString("Search plan:\n")
+
+	query, _ := args["query"].(string)
+	fmt.Fprintf(&b, "  query: %q\n", query)
+
+	for _, flagName := range []string{"caseSensitive", "useRegex", "wholeWords"} {
+		if v, ok := args[flagName].(bool); ok && v {
+			fmt.Fprintf(&b, "  %s: true\n", flagName)
+		}
+	}
+	for _, filterName := range []string{"repoFilter", "collection", "pathFilter"} {
+		if v, ok := args[filterName].(string); ok && v != "" {
+			fmt.Fprintf(&b, "  %s: %s\n", filterName, v)
+		}
+	}
+
+	if langFilter, ok := args["langFilter"].(string); ok && langFilter != "" {
+		langs := splitLangFilter(langFilter)
+		fmt.Fprintf(&b, "  langFilter: %s\n", strings.Join(langs, ", "))
+		if len(langs) > 1 {
+			fmt.Fprintf(&b, "    (searched as %d concurrent per-language requests)\n", len(langs))
+		}
+		var aliases []string
+		for from := range langRewrites {
+			aliases = append(aliases, from)
+		}
+		sort.Strings(aliases)
+		for _, from := range aliases {
+			fmt.Fprintf(&b, "    alias %q → %q\n", from, langRewrites[from])
+		}
+	}
+
+	maxPages, _ := parseMaxPagesArg(args)
+	fmt.Fprintf(&b, "  maxPages: %d\n", maxPages)
+	return b.String()
+}
+
+// withExplain prepends the explain text as its own content block so that
+// structured outputs such as JSON remain parseable.
+func withExplain(result *mcp.CallToolResult, explain string) *mcp.CallToolResult {
+	if explain == "" || result == nil {
+		return result
+	}
+	result.Content = append([]mcp.Content{mcp.NewTextContent(explain)}, result.Content...)
+	return result
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//================================================================================
+// Line Merge Strategies
+//================================================================================
+
+// lineMergeStrategy decides which text to keep when the same repo, path and line number
+// arrive from more than one page or language scan with different content.
+type lineMergeStrategy string
+
+const (
+	mergeKeepLast    lineMergeStrategy = "keep-last" // Later sources overwrite earlier ones
+	mergeKeepFirst   lineMergeStrategy = "keep-first"
+	mergeKeepLongest lineMergeStrategy = "keep-longest"
+	mergeKeepAll     lineMergeStrategy = "keep-all" // Every variant, tagged with its source
+)
+
+// lineMergeStrategies lists the values accepted by searchCode's mergeStrategy argument.
+var lineMergeStrategies = []string{string(mergeKeepLast), string(mergeKeepFirst), string(mergeKeepLongest), string(mergeKeepAll)}
+
+// maxRecordedCollisions caps the collision samples kept for diagnostics.
+const maxRecordedCollisions = 20
+
+// parseMergeStrategy reads the optional mergeStrategy argument, defaulting to keep-last.
+func parseMergeStrategy(args map[string]interface{}) (lineMergeStrategy, error) {
+	v, err := argString(args, "mergeStrategy")
+	if err != nil {
+		return "", err
+	}
+	if v == "" {
+		return mergeKeepLast, nil
+	}
+	if !containsString(lineMergeStrategies, v) {
+		return "", fmt.Errorf("invalid mergeStrategy %q: must be one of %s", v, strings.Join(lineMergeStrategies, ", "))
+	}
+	return lineMergeStrategy(v), nil
+}
+
+// LineCollision records one line that arrived with different content from two sources.
+type LineCollision struct {
+	Repo     string `json:"repo"`
+	Path     string `json:"path"`
+	Line     string `json:"line"`
+	Sources  string `json:"sources"` // Sources of the existing and incoming text, e.g. "page 1, page 3"
+	Existing string `json:"existing"`
+	Incoming string `json:"incoming"`
+}
+
+// lineMerger merges hits from several sources with one strategy and counts collisions.
+type lineMerger struct {
+	strategy    lineMergeStrategy
+	fileSources map[mergeFileKey]string // Source that first added each file
+	lineSources map[mergeLineKey]string // Lines whose kept text came from another source
+	combined    map[mergeLineKey]bool   // Lines already holding tagged variants under keep-all
+	Collisions  int
+	Samples     []LineCollision // The first maxRecordedCollisions collisions
+}
+
+type mergeFileKey struct{ repo, path string }
+
+type mergeLineKey struct {
+	mergeFileKey
+	line string
+}
+
+func newLineMerger(strategy lineMergeStrategy) *lineMerger {
+	return &lineMerger{
+		strategy:    strategy,
+		fileSources: make(map[mergeFileKey]string),
+		lineSources: make(map[mergeLineKey]string),
+		combined:    make(map[mergeLineKey]bool),
+	}
+}
+
+// merge adds source's lines to target, resolving collisions with the merger's strategy.
+// tag names the source, such as "page 2" or "language Go".
+func (m *lineMerger) merge(target, source *Hits, tag string) {
+	mergeContext(target, source)
+	if target.Hits == nil {
+		target.Hits = make(map[string]map[string]map[string]string, len(source.Hits))
+	}
+	for repo, pathData := range source.Hits {
+		targetRepo, ok := target.Hits[repo]
+		if !ok {
+			targetRepo = make(map[string]map[string]string, len(pathData))
+			target.Hits[repo] = targetRepo
+		}
+		for path, lines := range pathData {
+			targetLines, ok := targetRepo[path]
+			if !ok {
+				targetLines = make(map[string]string, len(lines))
+				targetRepo[path] = targetLines
+			}
+			// Sources are tracked per file, and per line only where they differ, to keep
+			// merging large scans cheap
+			fileKey := mergeFileKey{repo, path}
+			fileTag, ok := m.fileSources[fileKey]
+			if !ok {
+				fileTag = tag
+				m.fileSources[fileKey] = tag
+			}
+			for lineNum, line := range lines {
+				existing, exists := targetLines[lineNum]
+				if !exists {
+					targetLines[lineNum] = line
+					if tag != fileTag {
+						m.lineSources[mergeLineKey{fileKey, lineNum}] = tag
+					}
+					continue
+				}
+				if existing == line {
+					continue
+				}
+				key := mergeLineKey{fileKey, lineNum}
+				existingTag, ok := m.lineSources[key]
+				if !ok {
+					existingTag = fileTag
+				}
+				m.recordCollision(repo, path, lineNum, existingTag, tag, existing, line)
+				targetLines[lineNum] = m.resolve(key, existingTag, existing, line, tag)
+			}
+		}
+	}
+}
+
+// resolve returns the text to keep for a colliding line.
+func (m *lineMerger) resolve(key mergeLineKey, existingTag, existing, incoming, tag string) string {
+	switch m.strategy {
+	case mergeKeepFirst:
+		return existing
+	case mergeKeepLongest:
+		if len(incoming) > len(existing) {
+			m.lineSources[key] = tag
+			return incoming
+		}
+		return existing
+	case mergeKeepAll:
+		if !m.combined[key] {
+			existing = fmt.Sprintf("[%s] %s", existingTag, existing)
+			m.combined[key] = true
+		}
+		return fmt.Sprintf("%s | [%s] %s", existing, tag, incoming)
+	default:
+		m.lineSources[key] = tag
+		return incoming
+	}
+}
+
+func (m *lineMerger) recordCollision(repo, path, line, existingTag, incomingTag, existing, incoming string) {
+	m.Collisions++
+	if len(m.Samples) >= maxRecordedCollisions {
+		return
+	}
+	m.Samples = append(m.Samples, LineCollision{
+		Repo:     repo,
+		Path:     path,
+		Line:     line,
+		Sources:  existingTag + ", " + incomingTag,
+		Existing: existing,
+		Incoming: incoming,
+	})
+}
+
+// addTo adds the merger's collision counts to scan, keeping at most maxRecordedCollisions samples.
+func (m *lineMerger) addTo(scan *searchScan) {
+	scan.LineCollisions += m.Collisions
+	for _, sample := range m.Samples {
+		if len(scan.CollisionSamples) >= maxRecordedCollisions {
+			break
+		}
+		scan.CollisionSamples = append(scan.CollisionSamples, sample)
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//================================================================================
+// Local Workspace Comparison
+//================================================================================
+
+const (
+	maxCompareFiles    = 20        // Upstream files compared when no result numbers are given
+	maxLocalFiles      = 2000      // Files read from a local directory
+	maxLocalFileBytes  = 256 << 10 // Larger local files are skipped
+	maxDiffCells       = 4_000_000 // Line pairs the diff may compare; larger pairs get no diff
+	maxDiffOutputLines = 400       // Diff lines shown before truncating
+	maxReportedLines   = 20        // Lines listed per divergence section
+	diffContextLines   = 3         // Unchanged lines around each diff hunk
+)
+
+// localFile is a file read from the workspace or passed as content.
+type localFile struct {
+	Path    string
+	Content string
+}
+
+// UpstreamSimilarity is how closely one upstream file matches a local file. Similarity is
+// the share of distinct significant lines the two files have in common.
+type UpstreamSimilarity struct {
+	FileLocation
+	Similarity    float64 `json:"similarity"`
+	SharedLines   int     `json:"shared_lines"`
+	UpstreamLines int     `json:"upstream_lines"` // Distinct significant lines in the upstream file
+}
+
+// CommonLine is a line found in several upstream files.
+type CommonLine struct {
+	Line  string `json:"line"`
+	Files int    `json:"files"` // Upstream files containing it
+}
+
+// LocalComparison compares one local file with its upstream counterparts.
+type LocalComparison struct {
+	LocalPath     string               `json:"local_path"`
+	LocalLines    int                  `json:"local_lines"` // Distinct significant lines in the local file
+	Upstream      []UpstreamSimilarity `json:"upstream"`    // Most similar first
+	CommonMinimum int                  `json:"common_minimum,omitempty"`
+	MissingCommon []CommonLine         `json:"missing_common,omitempty"` // Lines in at least CommonMinimum upstream files but not the local one
+	LocalOnly     []string             `json:"local_only,omitempty"`     // Local lines in no upstream file
+	Diff          string               `json:"diff,omitempty"`           // Unified diff from the closest upstream file to the local one
+	DiffNote      string               `json:"diff_note,omitempty"`
+}
+
+// LocalComparisonReport is the result of compareLocal.
+type LocalComparisonReport struct {
+	Query       string            `json:"query"`
+	Comparisons []LocalComparison `json:"comparisons"`
+	Unpaired    []FileLocation    `json:"unpaired,omitempty"` // Upstream files with no local file of the same name
+	Failed      []RetrievedFile   `json:"failed,omitempty"`
+}
+
+// resolveWorkspacePath resolves p, absolute or relative to root, and rejects paths that lead
+// outside root, including through symbolic links.
+func resolveWorkspacePath(root, p string) (string, error) {
+	if root == "" {
+		return "", fmt.Errorf("localPath needs a workspace directory set with -workspace-root; pass localContent instead")
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("workspace root is not accessible: %w", err)
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	realPath, err := filepath.EvalSymlinks(filepath.Clean(p))
+	if err != nil {
+		return "", &ValidationError{Field: "localPath", Value: p, Reason: "does not exist"}
+	}
+	rel, err := filepath.Rel(realRoot, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &ValidationError{Field: "localPath", Value: p, Reason: "is outside the workspace root"}
+	}
+	return realPath, nil
+}
+
+// readLocalFile reads a text file, reporting false for binary or oversized files.
+func readLocalFile(p string) (string, bool, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", false, err
+	}
+	if info.Size() > maxLocalFileBytes {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", false, err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", false, nil
+	}
+	return string(data), true, nil
+}
+
+// loadLocalFiles reads the file at p, or the text files beneath it when it is a directory.
+// Hidden directories, binary files and files over maxLocalFileBytes are skipped. Paths are
+// reported relative to root.
+func loadLocalFiles(root, p string) ([]localFile, error) {
+	resolved, err := resolveWorkspacePath(root, p)
+	if err != nil {
+		return nil, err
+	}
+	realRoot, _ := filepath.EvalSymlinks(root) // Resolved by resolveWorkspacePath
+	relative := func(p string) string {
+		rel, err := filepath.Rel(realRoot, p)
+		if err != nil {
+			return p
+		}
+		return filepath.ToSlash(rel)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		content, ok, err := readLocalFile(resolved)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &ValidationError{Field: "localPath", Value: p, Reason: fmt.Sprintf("is binary or larger than %d bytes", maxLocalFileBytes)}
+		}
+		return []localFile{{Path: relative(resolved), Content: content}}, nil
+	}
+
+	var files []localFile
+	err = filepath.WalkDir(resolved, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != resolved && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(files) == maxLocalFiles {
+			return fs.SkipAll
+		}
+		content, ok, err := readLocalFile(p)
+		if err != nil || !ok {
+			return nil
+		}
+		files = append(files, localFile{Path: relative(p), Content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	if len(files) == 0 {
+		return nil, &ValidationError{Field: "localPath", Value: p, Reason: "contains no readable text files"}
+	}
+	return files, nil
+}
+
+// pairUpstreamFiles assigns each upstream file to the local file with the same base name,
+// preferring the one sharing the longest path suffix. With a single local file, every
+// upstream file is compared with it. Upstream files without a counterpart are returned
+// separately.
+func pairUpstreamFiles(local []localFile, upstream []RetrievedFile) (map[int][]RetrievedFile, []RetrievedFile) {
+	pairs := make(map[int][]RetrievedFile)
+	var unpaired []RetrievedFile
+	for _, file := range upstream {
+		if len(local) == 1 {
+			pairs[0] = append(pairs[0], file)
+			continue
+		}
+		best, bestScore := -1, -1
+		for i, lf := range local {
+			if path.Base(lf.Path) != path.Base(file.Path) {
+				continue
+			}
+			if score := sharedSuffixSegments(lf.Path, file.Path); score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			unpaired = append(unpaired, file)
+			continue
+		}
+		pairs[best] = append(pairs[best], file)
+	}
+	return pairs, unpaired
+}
+
+// sharedSuffixSegments counts the trailing path segments a and b have in common.
+func sharedSuffixSegments(a, b string) int {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[len(as)-1-n] == bs[len(bs)-1-n] {
+		n++
+	}
+	return n
+}
+
+// normalizeLine collapses whitespace so that indentation and spacing changes do not count
+// as divergence. Lines without a letter or digit, such as lone braces, are insignificant
+// and normalize to "".
+func normalizeLine(line string) string {
+	if strings.IndexFunc(line, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+		return ""
+	}
+	return strings.Join(strings.Fields(line), " ")
+}
+
+// significantLines returns the distinct normalized lines of content in order of appearance.
+func significantLines(content string) ([]string, map[string]bool) {
+	var ordered []string
+	set := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		if normalized := normalizeLine(line); normalized != "" && !set[normalized] {
+			set[normalized] = true
+			ordered = append(ordered, normalized)
+		}
+	}
+	return ordered, set
+}
+
+// compareLocalFile compares a local file with its upstream counterparts: how similar each
+// is, which lines most upstream files share but the local file lacks, which local lines no
+// upstream file has, and a diff against the closest upstream file.
+func compareLocalFile(local localFile, upstream []RetrievedFile) LocalComparison {
+	localOrdered, localSet := significantLines(local.Content)
+	comparison := LocalComparison{LocalPath: local.Path, LocalLines: len(localSet)}
+
+	seenUpstream := make(map[string]bool)
+	counts := make(map[string]int)
+	var order []string
+	for _, file := range upstream {
+		ordered, set := significantLines(file.Content)
+		shared := 0
+		for line := range set {
+			if localSet[line] {
+				shared++
+			}
+		}
+		similarity := 0.0
+		if union := len(set) + len(localSet) - shared; union > 0 {
+			similarity = float64(shared) / float64(union)
+		}
+		comparison.Upstream = append(comparison.Upstream, UpstreamSimilarity{
+			FileLocation:  FileLocation{Number: file.Number, Repo: file.Repo, Path: file.Path},
+			Similarity:    similarity,
+			SharedLines:   shared,
+			UpstreamLines: len(set),
+		})
+		for _, line := range ordered {
+			if !seenUpstream[line] {
+				seenUpstream[line] = true
+				order = append(order, line)
+			}
+			counts[line]++
+		}
+	}
+	closest := 0
+	for i, u := range comparison.Upstream {
+		if u.Similarity > comparison.Upstream[closest].Similarity {
+			closest = i
+		}
+	}
+	closestFile := upstream[closest]
+	sort.SliceStable(comparison.Upstream, func(i, j int) bool {
+		return comparison.Upstream[i].Similarity > comparison.Upstream[j].Similarity
+	})
+
+	if len(upstream) >= 2 {
+		comparison.CommonMinimum = max(2, (len(upstream)+1)/2)
+		for _, line := range order {
+			if counts[line] >= comparison.CommonMinimum && !localSet[line] {
+				comparison.MissingCommon = append(comparison.MissingCommon, CommonLine{Line: line, Files: counts[line]})
+			}
+		}
+		sort.SliceStable(comparison.MissingCommon, func(i, j int) bool {
+			return comparison.MissingCommon[i].Files > comparison.MissingCommon[j].Files
+		})
+		if len(comparison.MissingCommon) > maxReportedLines {
+			comparison.MissingCommon = comparison.MissingCommon[:maxReportedLines]
+		}
+	}
+	for _, line := range localOrdered {
+		if !seenUpstream[line] {
+			comparison.LocalOnly = append(comparison.LocalOnly, line)
+			if len(comparison.LocalOnly) == maxReportedLines {
+				break
+			}
+		}
+	}
+
+	upstreamName := closestFile.Repo + "/" + closestFile.Path
+	diff, ok := unifiedDiff(upstreamName, local.Path, splitLines(closestFile.Content), splitLines(local.Content))
+	switch {
+	case !ok:
+		comparison.DiffNote = fmt.Sprintf("The files are too large to diff against %s.", upstreamName)
+	case diff == "":
+		comparison.DiffNote = fmt.Sprintf("The local file is identical to %s.", upstreamName)
+	default:
+		comparison.Diff = diff
+	}
+	return comparison
+}
+
+// splitLines splits content into lines without their line endings.
+func splitLines(content string) []string {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// diffOp is one line of a line diff: ' ' kept, '-' only in a, '+' only in b.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines computes a minimal line diff from a to b by longest common subsequence. It
+// reports false when the files are too large to compare.
+func diffLines(a, b []string) ([]diffOp, bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(midA), len(midB)
+	if (n+1)*(m+1) > maxDiffCells {
+		return nil, false
+	}
+
+	// lcs[i*(m+1)+j] is the length of the longest common subsequence of midA[i:] and midB[j:]
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+m)
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && midA[i] == midB[j]:
+			ops = append(ops, diffOp{' ', midA[i]})
+			i++
+			j++
+		case i < n && (j == m || lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]):
+			ops = append(ops, diffOp{'-', midA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', midB[j]})
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops, true
+}
+
+// unifiedDiff renders the diff from a to b in unified format with diffContextLines lines
+// of context, truncated after maxDiffOutputLines lines. It returns "" for identical input
+// and false when the files are too large to compare.
+func unifiedDiff(aName, bName string, a, b []string) (string, bool) {
+	ops, ok := diffLines(a, b)
+	if !ok {
+		return "", false
+	}
+	// Mark the ops within diffContextLines of a change
+	show := make([]bool, len(ops))
+	changed := false
+	for k, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		changed = true
+		for c := max(0, k-diffContextLines); c <= min(len(ops)-1, k+diffContextLines); c++ {
+			show[c] = true
+		}
+	}
+	if !changed {
+		return "", true
+	}
+
+	var out []string
+	out = append(out, "--- "+aName, "+++ "+bName)
+	aLine, bLine := 1, 1
+	for k := 0; k < len(ops); {
+		if !show[k] {
+			if ops[k].kind != '+' {
+				aLine++
+			}
+			if ops[k].kind != '-' {
+				bLine++
+			}
+			k++
+			continue
+		}
+		end := k
+		for end < len(ops) && show[end] {
+			end++
+		}
+		aCount, bCount := 0, 0
+		var body []string
+		for _, op := range ops[k:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+			body = append(body, string(op.kind)+op.line)
+		}
+		out = append(out, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine, aCount, bLine, bCount))
+		out = append(out, body...)
+		aLine += aCount
+		bLine += bCount
+		k = end
+	}
+	if len(out) > maxDiffOutputLines {
+		omitted := len(out) - maxDiffOutputLines
+		out = append(out[:maxDiffOutputLines], fmt.Sprintf("... %d more diff lines not shown", omitted))
+	}
+	return strings.Join(out, "\n") + "\n", true
+}
+
+// buildLocalComparison compares the local files with the retrieved upstream files.
+func buildLocalComparison(query string, local []localFile, files []RetrievedFile) LocalComparisonReport {
+	report := LocalComparisonReport{Query: query}
+	var upstream []RetrievedFile
+	for _, file := range files {
+		switch {
+		case file.Error != "":
+			report.Failed = append(report.Failed, file)
+		case file.Type != "dir":
+			upstream = append(upstream, file)
+		}
+	}
+	pairs, unpaired := pairUpstreamFiles(local, upstream)
+	for i, lf := range local {
+		if len(pairs[i]) > 0 {
+			report.Comparisons = append(report.Comparisons, compareLocalFile(lf, pairs[i]))
+		}
+	}
+	for _, file := range unpaired {
+		report.Unpaired = append(report.Unpaired, FileLocation{Number: file.Number, Repo: file.Repo, Path: file.Path})
+	}
+	return report
+}
+
+// formatLocalComparison renders a comparison report as Markdown.
+func formatLocalComparison(report LocalComparisonReport) string {
+	var b strings.Builder
+	for _, c := range report.Comparisons {
+		fmt.Fprintf(&b, "## %s\n\n", c.LocalPath)
+		closest := c.Upstream[0]
+		fmt.Fprintf(&b, "Compared with %d upstream files; the closest is %d. %s/%s (%.0f%% similar).\n\n", len(c.Upstream), closest.Number, closest.Repo, closest.Path, closest.Similarity*100)
+		b.WriteString("| # | Upstream file | Similarity | Shared lines |\n|---|---|---|---|\n")
+		for _, u := range c.Upstream {
+			fmt.Fprintf(&b, "| %d | %s/%s | %.0f%% | %d of %d |\n", u.Number, u.Repo, u.Path, u.Similarity*100, u.SharedLines, u.UpstreamLines)
+		}
+		if len(c.MissingCommon) > 0 {
+			fmt.Fprintf(&b, "\n### Common upstream lines missing locally\n\nLines found in at least %d of %d upstream files:\n\n", c.CommonMinimum, len(c.Upstream))
+			for _, line := range c.MissingCommon {
+				fmt.Fprintf(&b, "- `%s` (%d files)\n", line.Line, line.Files)
+			}
+		}
+		if len(c.LocalOnly) > 0 {
+			b.WriteString("\n### Local lines found in no upstream file\n\n")
+			for _, line := range c.LocalOnly {
+				fmt.Fprintf(&b, "- `%s`\n", line)
+			}
+		}
+		if c.Diff != "" {
+			fmt.Fprintf(&b, "\n### Diff from %d. %s/%s\n\n```diff\n%s```\n", closest.Number, closest.Repo, closest.Path, c.Diff)
+		} else if c.DiffNote != "" {
+			fmt.Fprintf(&b, "\n_%s_\n", c.DiffNote)
+		}
+		b.WriteString("\n")
+	}
+	if len(report.Unpaired) > 0 {
+		b.WriteString("Upstream files with no local file of the same name:\n")
+		for _, u := range report.Unpaired {
+			fmt.Fprintf(&b, "- %d. %s/%s\n", u.Number, u.Repo, u.Path)
+		}
+		b.WriteString("\n")
+	}
+	for _, file := range report.Failed {
+		fmt.Fprintf(&b, "❌ %d. %s/%s: %s\n", file.Number, file.Repo, file.Path, file.Error)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
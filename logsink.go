@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Log File Writer
+//================================================================================
+
+const (
+	defaultLogFlushInterval = time.Second
+	defaultLogBufferSize    = 64 << 10
+)
+
+// LogWriteConfig controls how log entries reach the log file.
+type LogWriteConfig struct {
+	Sync          bool          // Write and fsync every entry before returning
+	FlushInterval time.Duration // How often buffered entries are written and synced; 0 uses the default
+	BufferSize    int           // Buffered bytes that trigger a write before the interval; 0 uses the default
+}
+
+// logSink serializes writes to the log file so concurrent entries never interleave. Unless
+// configured as synchronous it buffers entries in memory and a background goroutine
+// writes and syncs them every flush interval.
+type logSink struct {
+	mu     sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer // nil when synchronous
+	closed bool
+	failed bool // A write failed; entries are dropped until logDiskGuard allows a retry
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newLogSink(file *os.File, cfg LogWriteConfig) *logSink {
+	s := &logSink{file: file}
+	if cfg.Sync {
+		return s
+	}
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = defaultLogFlushInterval
+	}
+	size := cfg.BufferSize
+	if size <= 0 {
+		size = defaultLogBufferSize
+	}
+	s.buf = bufio.NewWriterSize(file, size)
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.flushLoop(interval)
+	return s
+}
+
+// flushLoop flushes the buffer every interval until the sink is closed.
+func (s *logSink) flushLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// write appends one line to the log. Synchronous sinks, and buffered ones when urgent is
+// set, write and sync it before returning. While the log directory is degraded the line is
+// dropped without an error, so the entry still reaches the console.
+func (s *logSink) write(line []byte, urgent bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("log file is closed")
+	}
+	if !logDiskGuard.allow() {
+		return nil
+	}
+	if s.failed {
+		if s.buf != nil {
+			s.buf.Reset(s.file) // bufio keeps the first error; entries it held are lost
+		}
+		s.failed = false
+	}
+	if s.buf == nil {
+		if _, err := s.file.Write(line); err != nil {
+			return s.failLocked(fmt.Errorf("failed to write log entry: %w", err))
+		}
+		return s.syncLocked()
+	}
+	// bufio writes through to the file whenever the buffer fills
+	if _, err := s.buf.Write(line); err != nil {
+		return s.failLocked(fmt.Errorf("failed to write log entry: %w", err))
+	}
+	if urgent {
+		return s.flushLocked()
+	}
+	return nil
+}
+
+// flush writes any buffered entries and syncs the file.
+func (s *logSink) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.failed {
+		return nil
+	}
+	return s.flushLocked()
+}
+
+func (s *logSink) flushLocked() error {
+	if s.buf != nil {
+		if s.buf.Buffered() == 0 {
+			return nil
+		}
+		if err := s.buf.Flush(); err != nil {
+			return s.failLocked(fmt.Errorf("failed to flush log entries: %w", err))
+		}
+	}
+	return s.syncLocked()
+}
+
+func (s *logSink) syncLocked() error {
+	if err := s.file.Sync(); err != nil {
+		return s.failLocked(fmt.Errorf("failed to sync log file: %w", err))
+	}
+	return nil
+}
+
+// failLocked marks the sink failed and degrades the log directory.
+func (s *logSink) failLocked(err error) error {
+	s.failed = true
+	logDiskGuard.recordFailure(err)
+	return err
+}
+
+// close stops the background flusher, flushes what is left and closes the file.
+func (s *logSink) close() error {
+	if s.stop != nil {
+		s.stopOnce.Do(func() { close(s.stop) })
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil || s.closed {
+		return nil
+	}
+	var flushErr error
+	if !s.failed {
+		flushErr = s.flushLocked()
+	}
+	s.closed = true
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -14,13 +15,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/google/go-github/v58/github"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -43,9 +46,13 @@ var (
 
 const (
 	grepAppAPIBaseURL = "https://grep.app/api/search"
-	cacheDir          = "./cache"
-	cacheTTL          = 24 * time.Hour
-	maxSearchPages    = 5 // To prevent excessive API calls, matching the TS implementation
+	fallbackCacheDir  = "./cache" // Used when the OS cache directory cannot be determined
+	maxSearchPages    = 5         // Default pages per search, matching the TS implementation; see -max-pages
+	maxPagesLimit     = 20        // Upper bound for -max-pages and the maxPages argument
+	maxLanguageScans  = 4         // Per-language scans of one search running at once
+
+	jsonIndentThreshold = 1 << 20  // Estimated output size above which JSON is emitted without indentation
+	maxJSONOutputBytes  = 16 << 20 // Hard cap on the size of a single JSON tool response
 )
 
 //================================================================================
@@ -68,22 +75,45 @@ type GrepAppResponse struct {
 		} `json:"hits"`
 	} `json:"hits"`
 	Facets struct {
-		Count int `json:"count"`
-		Pages int `json:"pages"`
+		Count int          `json:"count"`
+		Pages int          `json:"pages"`
+		Lang  FacetBuckets `json:"lang"`
+		Repo  FacetBuckets `json:"repo"`
+		Path  FacetBuckets `json:"path"`
 	} `json:"facets"`
+
+	// SchemaIssues lists unexpected payload shapes detected when the response was fetched.
+	SchemaIssues []string `json:"-"`
+	// FromCache is set when the page was served from the cache rather than grep.app.
+	FromCache bool      `json:"-"`
+	CachedAt  time.Time `json:"-"` // When the cached page was stored
+}
+
+// FacetBuckets holds grep.app's per-value match counts for a facet such as language or repository.
+type FacetBuckets struct {
+	Buckets []FacetBucket `json:"buckets"`
+}
+
+// FacetBucket is a single facet value with its match count.
+type FacetBucket struct {
+	Val   string `json:"val"`
+	Count int    `json:"count"`
 }
 
 // Hits stores the structured search results.
 // It maps repository -> file path -> line number -> line content.
 type Hits struct {
-	Hits map[string]map[string]map[string]string `json:"hits"`
+	Hits    map[string]map[string]map[string]string `json:"hits"`
+	Context map[string]map[string]map[string]string `json:"context,omitempty"` // Unmarked snippet rows around the matches; never counted as hits
 }
 
 // CacheEntry wraps data stored in the cache with a timestamp.
 type CacheEntry[T any] struct {
-	Data      T         `json:"data"`
-	Timestamp time.Time `json:"timestamp"`
-	Query     string    `json:"query"`
+	Data       T              `json:"data"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Query      string         `json:"query"`
+	Type       cacheEntryType `json:"type,omitempty"`
+	KeyVersion int            `json:"key_version,omitempty"` // Format of the key search pages were stored under
 }
 
 // NumberedHit is used for flattening search results for batch retrieval.
@@ -98,22 +128,88 @@ type GitHubFileRequest struct {
 	Owner string `json:"owner"`
 	Repo  string `json:"repo"`
 	Path  string `json:"path"`
+	Ref   string `json:"ref,omitempty"` // Branch, tag or commit; empty uses the default branch
+}
+
+// retrievalOptions controls how batch retrieval handles directories and post-processes content.
+type retrievalOptions struct {
+	Recursive           bool   // Fetch small files under a directory, not just its listing
+	MaxDirectoryBytes   int    // Total size cap for recursively fetched files per directory
+	KeepNotebookOutputs bool   // Keep Jupyter cell outputs instead of stripping them
+	Ref                 string // Branch, tag or commit to read files at; empty uses the default branch
+}
+
+// parseRetrievalOptions reads the ref, recursive, maxDirectoryBytes and keepNotebookOutputs arguments.
+func parseRetrievalOptions(args map[string]interface{}) (retrievalOptions, error) {
+	opts := retrievalOptions{MaxDirectoryBytes: defaultDirectoryBytes}
+	var err error
+	if opts.Ref, err = argString(args, "ref"); err != nil {
+		return opts, err
+	}
+	opts.Ref = strings.TrimSpace(opts.Ref)
+	if err := validateRef(opts.Ref); err != nil {
+		return opts, err
+	}
+	if opts.Recursive, err = argBool(args, "recursive"); err != nil {
+		return opts, err
+	}
+	if opts.KeepNotebookOutputs, err = argBool(args, "keepNotebookOutputs"); err != nil {
+		return opts, err
+	}
+	v, ok, err := argNumber(args, "maxDirectoryBytes")
+	if err != nil {
+		return opts, err
+	}
+	if ok {
+		if v <= 0 || v > maxDirectoryBytes {
+			return opts, fmt.Errorf("maxDirectoryBytes must be between 1 and %d", maxDirectoryBytes)
+		}
+		opts.MaxDirectoryBytes = int(v)
+	}
+	return opts, nil
 }
 
 // RetrievedFile holds the content or an error for a file fetched from GitHub.
 type RetrievedFile struct {
-	Number  int    `json:"number"`
-	Repo    string `json:"repo"`
-	Path    string `json:"path"`
-	Content string `json:"content"`
-	Error   string `json:"error,omitempty"`
+	Number   int    `json:"number"`
+	Repo     string `json:"repo"`
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Type     string `json:"type,omitempty"`     // "file" or "dir"
+	Language string `json:"language,omitempty"` // Inferred from the file name
+	Encoding string `json:"encoding,omitempty"` // Source encoding before conversion to UTF-8
+	Error    string `json:"error,omitempty"`
+
+	Ref       string `json:"ref,omitempty"`        // Requested branch, tag or commit; empty for the default branch
+	CommitSHA string `json:"commit_sha,omitempty"` // Commit the file was read from, when the ref could be resolved
+
+	SHA256      string `json:"sha256,omitempty"`       // Of Content, for retrieved files
+	DuplicateOf string `json:"duplicate_of,omitempty"` // repo/path of an identical file holding the content
+
+	Listing        []DirectoryEntry `json:"listing,omitempty"`         // Directory contents when Type is "dir"
+	SkippedEntries int              `json:"skipped_entries,omitempty"` // Directory files left out by the recursive size caps
+
+	Processing *ContentProcessing `json:"processing,omitempty"` // Set when notebook or SVG content was rewritten
+	Excerpt    *LineExcerpt       `json:"excerpt,omitempty"`    // Set when Content was cut down to the matched lines
+
+	Truncated     bool `json:"truncated,omitempty"`      // Content was cut by the file size or batch byte limits
+	OriginalBytes int  `json:"original_bytes,omitempty"` // Size of the content before truncation
+
+	Validation *ValidationError `json:"validation_error,omitempty"` // Set when the request was rejected before reaching GitHub
 }
 
 // BatchRetrievalResult encapsulates the outcome of a batch file retrieval operation.
 type BatchRetrievalResult struct {
+	SchemaVersion string `json:"schemaVersion"` // Set when the result is returned as JSON
+
 	Success bool            `json:"success"`
 	Files   []RetrievedFile `json:"files"`
+	Skipped []SkippedHit    `json:"skipped,omitempty"` // Results on hosts retrieval does not support
+	Repos   []RepoGroup     `json:"repos,omitempty"`   // Per-repository summary, in the order files are listed
 	Error   string          `json:"error,omitempty"`
+
+	Duplicates []DuplicateContent `json:"duplicates,omitempty"` // Sets of byte-identical files
+	RateLimit  *GitHubRateLimit   `json:"rate_limit,omitempty"` // GitHub quota left after the retrieval
 }
 
 //================================================================================
@@ -127,51 +223,104 @@ func generateCacheKey(keyObj map[string]interface{}) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// getCachedData retrieves and unmarshals data from a cache file if it exists and is not expired.
-func getCachedData[T any](cacheKey string) (*T, error) {
-	filePath := filepath.Join(cacheDir, cacheKey+".json")
+// cacheFilePath returns the on-disk location of a cache entry.
+func cacheFilePath(cacheKey string) string {
+	return filepath.Join(GetConfig().CacheDir, cacheKey+".json")
+}
+
+// getCachedData retrieves and unmarshals data from a cache file if it exists and is younger than ttl.
+// When caching is disabled every lookup is a miss.
+func getCachedData[T any](cacheKey string, ttl time.Duration) (*T, error) {
+	data, _, err := getCachedEntry[T](cacheKey, ttl)
+	return data, err
+}
+
+// getCachedEntry is getCachedData that also returns when the entry was cached.
+func getCachedEntry[T any](cacheKey string, ttl time.Duration) (*T, time.Time, error) {
+	if GetConfig().NoCache {
+		return nil, time.Time{}, nil
+	}
+	if value, cachedAt, entryType, ok := hotCache.getTypedEntry(cacheKey, ttl); ok {
+		if data, ok := value.(T); ok {
+			hotCache.record("memory")
+			serverStats.recordCacheLookup(true)
+			cacheHitAges.record(entryType, time.Since(cachedAt), ttl)
+			if logger := GetLogger(); logger != nil {
+				logger.LogDebug(fmt.Sprintf("Cache hit for key: %s", cacheKey), "cache", map[string]interface{}{"key": cacheKey, "layer": "memory"})
+			}
+			return &data, cachedAt, nil
+		}
+	}
+
+	filePath := cacheFilePath(cacheKey)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil, nil // Cache miss
+		hotCache.record("miss")
+		serverStats.recordCacheLookup(false)
+		return nil, time.Time{}, nil // Cache miss
 	}
 
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read cache file: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to read cache file: %w", err)
 	}
 
 	var entry CacheEntry[T]
 	if err := json.Unmarshal(data, &entry); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal cache entry: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to unmarshal cache entry: %w", err)
 	}
 
-	if time.Since(entry.Timestamp) > cacheTTL {
+	if time.Since(entry.Timestamp) > ttl {
 		if logger := GetLogger(); logger != nil {
 			logger.LogDebug(fmt.Sprintf("Cache expired for key: %s", cacheKey), "cache", map[string]interface{}{"key": cacheKey})
 		} else {
 			log.Printf("Cache expired for key: %s", cacheKey)
 		}
 		os.Remove(filePath) // Delete expired cache file
-		return nil, nil     // Cache miss
+		hotCache.record("miss")
+		serverStats.recordCacheLookup(false)
+		return nil, time.Time{}, nil // Cache miss
 	}
 
+	hotCache.record("disk")
+	serverStats.recordCacheLookup(true)
+	cacheHitAges.record(entry.Type, time.Since(entry.Timestamp), ttl)
+	hotCache.putTyped(cacheKey, entry.Data, entry.Timestamp, entry.Type, GetConfig().MemoryCacheEntries)
 	if logger := GetLogger(); logger != nil {
-		logger.LogDebug(fmt.Sprintf("Cache hit for key: %s", cacheKey), "cache", map[string]interface{}{"key": cacheKey})
+		logger.LogDebug(fmt.Sprintf("Cache hit for key: %s", cacheKey), "cache", map[string]interface{}{"key": cacheKey, "layer": "disk"})
 	} else {
 		log.Printf("Cache hit for key: %s", cacheKey)
 	}
-	return &entry.Data, nil
+	return &entry.Data, entry.Timestamp, nil
 }
 
-// cacheData marshals and writes data to a cache file.
-func cacheData[T any](cacheKey string, data T, query string) error {
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
-	}
+// cacheData marshals and writes data to a cache file. It is a no-op when caching is disabled.
+// While the cache directory is degraded only the memory layer is updated.
+func cacheData[T any](cacheKey string, data T, query string, entryType cacheEntryType) error {
+	return cacheDataAt(cacheKey, data, query, entryType, time.Now())
+}
 
+// cacheDataAt stores data as cacheData does, stamped with the time it was fetched, such as
+// the original fetch time of imported results.
+func cacheDataAt[T any](cacheKey string, data T, query string, entryType cacheEntryType, fetchedAt time.Time) error {
+	if GetConfig().NoCache {
+		return nil
+	}
 	entry := CacheEntry[T]{
 		Data:      data,
-		Timestamp: time.Now(),
+		Timestamp: fetchedAt,
 		Query:     query,
+		Type:      entryType,
+	}
+	if entryType == cacheEntrySearchPage {
+		entry.KeyVersion = searchPageKeyVersion
+	}
+	if !cacheDiskGuard.allow() {
+		hotCache.putTyped(cacheKey, data, entry.Timestamp, entryType, GetConfig().MemoryCacheEntries)
+		return nil
+	}
+	if err := os.MkdirAll(GetConfig().CacheDir, 0755); err != nil {
+		cacheDiskGuard.recordFailure(err)
+		return fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
 	entryBytes, err := json.Marshal(entry)
@@ -179,13 +328,18 @@ func cacheData[T any](cacheKey string, data T, query string) error {
 		return fmt.Errorf("failed to marshal cache entry: %w", err)
 	}
 
-	filePath := filepath.Join(cacheDir, cacheKey+".json")
-	return os.WriteFile(filePath, entryBytes, 0644)
+	if err := os.WriteFile(cacheFilePath(cacheKey), entryBytes, 0644); err != nil {
+		hotCache.remove(cacheKey)
+		cacheDiskGuard.recordFailure(err)
+		return err
+	}
+	hotCache.putTyped(cacheKey, data, entry.Timestamp, entryType, GetConfig().MemoryCacheEntries)
+	return nil
 }
 
 // findCacheFiles searches the cache directory for files matching a specific query.
 func findCacheFiles(query string) ([]string, error) {
-	files, err := os.ReadDir(cacheDir)
+	files, err := os.ReadDir(GetConfig().CacheDir)
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +348,7 @@ func findCacheFiles(query string) ([]string, error) {
 		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
 			continue
 		}
-		filePath := filepath.Join(cacheDir, file.Name())
+		filePath := filepath.Join(GetConfig().CacheDir, file.Name())
 		content, err := os.ReadFile(filePath)
 		if err != nil {
 			continue // Skip unreadable files
@@ -210,15 +364,53 @@ func findCacheFiles(query string) ([]string, error) {
 	return matchingFiles, nil
 }
 
+// purgeOldSearchPages deletes search pages stored under an older key format from dir and
+// returns how many were removed.
+func purgeOldSearchPages(dir string) (int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		filePath := filepath.Join(dir, file.Name())
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+		var entry CacheEntry[json.RawMessage]
+		if err := json.Unmarshal(content, &entry); err != nil {
+			continue
+		}
+		if entry.Type != cacheEntrySearchPage || entry.KeyVersion >= searchPageKeyVersion {
+			continue
+		}
+		if err := os.Remove(filePath); err == nil {
+			hotCache.remove(strings.TrimSuffix(file.Name(), ".json"))
+			removed++
+		}
+	}
+	return removed, nil
+}
+
 // getQueryResults loads the most recent, complete cached search result for a query.
 type fullSearchResult struct {
 	Hits  Hits `json:"hits"`
 	Count int  `json:"count"`
 }
 
-func getQueryResults(query string) (*Hits, error) {
-	cacheKey := generateCacheKey(map[string]interface{}{"query": query, "complete": true})
-	cached, err := getCachedData[fullSearchResult](cacheKey)
+// completeCacheKey identifies the complete result of query that batch retrieval numbers
+// files by. Every reader and writer of complete results must use it.
+func completeCacheKey(query string) string {
+	return generateCacheKey(map[string]interface{}{"query": query, "complete": true})
+}
+
+func getQueryResults(query string, ttl time.Duration) (*Hits, error) {
+	cacheKey := completeCacheKey(query)
+	cached, err := getCachedData[fullSearchResult](cacheKey, ttl)
 	if err != nil {
 		log.Printf("Error reading cache for complete query results: %v", err)
 		return nil, err
@@ -268,111 +460,208 @@ func validateRegexPattern(pattern string) *RegexValidationResult {
 	}
 }
 
-// applyRegexFilter applies regex filtering to search results
-func applyRegexFilter(hits *Hits, regexResult *RegexValidationResult) *Hits {
+// parallelFilterMinLines is the line count from which applyRegexFilter spreads the work
+// across goroutines; below it the coordination costs more than it saves.
+const parallelFilterMinLines = 5000
+
+// filterFile is one file's lines queued for regex filtering.
+type filterFile struct {
+	repo, path string
+	lines      map[string]string
+}
+
+// applyRegexFilter applies regex filtering to search results. Large result sets are split
+// across a worker pool sized to GOMAXPROCS.
+func applyRegexFilter(ctx context.Context, hits *Hits, regexResult *RegexValidationResult) (*Hits, error) {
 	if !regexResult.IsValid || regexResult.CompiledRe == nil {
-		return hits
+		return hits, nil
 	}
 
-	filteredHits := &Hits{Hits: make(map[string]map[string]map[string]string)}
-	
+	var files []filterFile
+	totalLines := 0
 	for repo, pathData := range hits.Hits {
 		for path, lines := range pathData {
-			filteredLines := make(map[string]string)
-			
-			for lineNum, line := range lines {
-				if regexResult.CompiledRe.MatchString(line) {
-					filteredLines[lineNum] = line
-				}
-			}
-			
-			if len(filteredLines) > 0 {
-				if filteredHits.Hits[repo] == nil {
-					filteredHits.Hits[repo] = make(map[string]map[string]string)
-				}
-				filteredHits.Hits[repo][path] = filteredLines
-			}
+			files = append(files, filterFile{repo: repo, path: path, lines: lines})
+			totalLines += len(lines)
 		}
 	}
-	
-	return filteredHits
+	workers := 1
+	if totalLines >= parallelFilterMinLines {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	filtered, err := filterFiles(ctx, files, regexResult.CompiledRe, workers)
+	filtered.Context = hits.Context
+	return filtered, err
 }
 
+// filterFiles keeps the lines matching re. Each worker takes every workers-th file and
+// writes only its own result slots, so the output does not depend on scheduling. Workers
+// stop between files once ctx is done, and the context's error is returned.
+func filterFiles(ctx context.Context, files []filterFile, re *regexp.Regexp, workers int) (*Hits, error) {
+	workers = max(1, min(workers, len(files)))
+	filtered := make([]map[string]string, len(files))
 
-//================================================================================
-// Core Logic (grep.app, GitHub, Batch)
-//================================================================================
-
-// parseSnippet extracts line numbers and code from the HTML snippet returned by grep.app.
-func parseSnippet(snippet string) (map[string]string, error) {
-	matches := make(map[string]string)
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(snippet))
-	if err != nil {
-		return nil, err
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(files) && ctx.Err() == nil; i += workers {
+				kept := make(map[string]string)
+				for lineNum, line := range files[i].lines {
+					if re.MatchString(line) {
+						kept[lineNum] = line
+					}
+				}
+				filtered[i] = kept
+			}
+		}(w)
 	}
+	wg.Wait()
 
-	doc.Find("tr").Each(func(i int, tr *goquery.Selection) {
-		lineNum := tr.Find("div.lineno").Text()
-		linePre := tr.Find("pre")
-		if lineNum != "" && linePre.Find("mark").Length() > 0 {
-			matches[strings.TrimSpace(lineNum)] = strings.TrimSpace(linePre.Text())
+	filteredHits := &Hits{Hits: make(map[string]map[string]map[string]string)}
+	for i, file := range files {
+		if len(filtered[i]) == 0 {
+			continue
 		}
-	})
-	return matches, nil
+		if filteredHits.Hits[file.repo] == nil {
+			filteredHits.Hits[file.repo] = make(map[string]map[string]string)
+		}
+		filteredHits.Hits[file.repo][file.path] = filtered[i]
+	}
+	return filteredHits, ctx.Err()
 }
 
-// mergeHits combines search results from a source Hits object into a target.
-func mergeHits(target, source *Hits) {
-	if target.Hits == nil {
-		target.Hits = make(map[string]map[string]map[string]string)
+// buildLineFilter returns the client-side filter that re-checks matched lines the way
+// grep.app matched them, or nil when no filtering is needed. Regex queries are used as
+// given and literal queries are escaped; with wholeWords the pattern is bounded by \b at
+// each end that starts or finishes with a word character, since grep.app does not require
+// a boundary next to punctuation. Matching is case-insensitive unless caseSensitive is set.
+func buildLineFilter(query string, useRegex, wholeWords, caseSensitive bool) *RegexValidationResult {
+	if !useRegex && !wholeWords {
+		return nil
+	}
+	pattern := query
+	if !useRegex {
+		pattern = regexp.QuoteMeta(query)
 	}
-	for repo, pathData := range source.Hits {
-		if _, ok := target.Hits[repo]; !ok {
-			target.Hits[repo] = make(map[string]map[string]string)
+	if wholeWords {
+		prefix, suffix := `\b`, `\b`
+		if !useRegex {
+			first, _ := utf8.DecodeRuneInString(query)
+			last, _ := utf8.DecodeLastRuneInString(query)
+			if !isWordRune(first) {
+				prefix = ""
+			}
+			if !isWordRune(last) {
+				suffix = ""
+			}
 		}
+		pattern = prefix + "(?:" + pattern + ")" + suffix
+	}
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return validateRegexPattern(pattern)
+}
+
+// isWordRune reports whether r is a word character as matched by \w.
+func isWordRune(r rune) bool {
+	return r == '_' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
+
+// applyMinMatchesFilter keeps only files with at least minMatches matched lines.
+func applyMinMatchesFilter(hits *Hits, minMatches int) *Hits {
+	filteredHits := &Hits{Hits: make(map[string]map[string]map[string]string), Context: hits.Context}
+	for repo, pathData := range hits.Hits {
 		for path, lines := range pathData {
-			if _, ok := target.Hits[repo][path]; !ok {
-				target.Hits[repo][path] = make(map[string]string)
+			if len(lines) < minMatches {
+				continue
 			}
-			for lineNum, line := range lines {
-				target.Hits[repo][path][lineNum] = line
+			if filteredHits.Hits[repo] == nil {
+				filteredHits.Hits[repo] = make(map[string]map[string]string)
 			}
+			filteredHits.Hits[repo][path] = lines
 		}
 	}
+	return filteredHits
 }
 
-// fetchGrepAppPage fetches a single page of results from the grep.app API, using cache if available.
-func fetchGrepAppPage(ctx context.Context, client *http.Client, args map[string]interface{}, page int) (*GrepAppResponse, error) {
-	query, _ := args["query"].(string)
-	// Include all relevant parameters in cache key to avoid conflicts
-	cacheKeyObj := map[string]interface{}{
-		"query": query, 
-		"page": page,
+// countFiles returns the number of files across all repositories.
+func countFiles(hits *Hits) int {
+	total := 0
+	for _, pathData := range hits.Hits {
+		total += len(pathData)
 	}
-	if repoFilter, ok := args["repoFilter"].(string); ok && repoFilter != "" {
-		cacheKeyObj["repoFilter"] = repoFilter
+	return total
+}
+
+//================================================================================
+// Core Logic (grep.app, GitHub, Batch)
+//================================================================================
+
+// parseSnippet extracts the matched line numbers and code from the HTML snippet returned by grep.app.
+func parseSnippet(snippet string) (map[string]string, error) {
+	matches, _, err := parseSnippetLines(snippet)
+	return matches, err
+}
+
+// mergeHits combines search results from a source Hits object into a target.
+// Colliding lines take the source's text.
+func mergeHits(target, source *Hits) {
+	newLineMerger(mergeKeepLast).merge(target, source, "")
+}
+
+// searchPageCacheKey returns the cache key of one grep.app result page for args.
+func searchPageCacheKey(args map[string]interface{}, page int) string {
+	opts, _ := parseSearchOptions(args) // Validated by the tool handler
+	return opts.pageCacheKey(page)
+}
+
+// pageCacheKey returns the cache key of one grep.app result page. The key is derived from
+// the exact grep.app request parameters, so every filter sent upstream is part of it.
+func (o SearchOptions) pageCacheKey(page int) string {
+	return generateCacheKey(map[string]interface{}{
+		"v":      searchPageKeyVersion,
+		"params": grepAppPageParams(o, page).Encode(),
+	})
+}
+
+// grepAppPageParams returns the grep.app query parameters for one result page.
+func grepAppPageParams(opts SearchOptions, page int) url.Values {
+	q := url.Values{}
+	q.Set("q", opts.Query)
+	q.Set("page", strconv.Itoa(page))
+	if opts.CaseSensitive {
+		q.Set("case", "1")
 	}
-	if caseSensitive, ok := args["caseSensitive"].(bool); ok && caseSensitive {
-		cacheKeyObj["caseSensitive"] = caseSensitive
+	if opts.UseRegex {
+		q.Set("regexp", "1")
 	}
-	if useRegex, ok := args["useRegex"].(bool); ok && useRegex {
-		cacheKeyObj["useRegex"] = useRegex
+	if opts.WholeWords {
+		q.Set("words", "1")
 	}
-	if wholeWords, ok := args["wholeWords"].(bool); ok && wholeWords {
-		cacheKeyObj["wholeWords"] = wholeWords
+	if opts.RepoFilter != "" {
+		q.Set("f.repo", opts.RepoFilter)
 	}
-	if pathFilter, ok := args["pathFilter"].(string); ok && pathFilter != "" {
-		cacheKeyObj["pathFilter"] = pathFilter
+	if opts.PathFilter != "" {
+		q.Set("path", opts.PathFilter)
 	}
-	if langFilter, ok := args["langFilter"].(string); ok && langFilter != "" {
-		cacheKeyObj["langFilter"] = langFilter
+	if opts.LangFilter != "" {
+		q.Set("lang", opts.LangFilter)
 	}
-	cacheKey := generateCacheKey(cacheKeyObj)
+	return q
+}
+
+// fetchGrepAppPage fetches a single page of results from the grep.app API, using cache if available.
+func fetchGrepAppPage(ctx context.Context, client *http.Client, opts SearchOptions, page int) (*GrepAppResponse, error) {
+	query := opts.Query
+	cacheKey := opts.pageCacheKey(page)
 
 	log.Printf("Fetching page %d for query: %s", page, query)
 
 	// Check cache
-	cached, err := getCachedData[GrepAppResponse](cacheKey)
+	cached, cachedAt, err := getCachedEntry[GrepAppResponse](cacheKey, cacheTTLFor(cacheEntrySearchPage, opts.CacheTTL))
 	if err != nil {
 		log.Printf("Cache read error for key %s: %v", cacheKey, err)
 	}
@@ -384,6 +673,9 @@ func fetchGrepAppPage(ctx context.Context, client *http.Client, args map[string]
 			logger.LogCacheOperation(cacheKey, true, query)
 		}
 		
+		recordCacheSaving(ctx, cached)
+		cached.FromCache = true
+		cached.CachedAt = cachedAt
 		return cached, nil
 	}
 
@@ -396,75 +688,45 @@ func fetchGrepAppPage(ctx context.Context, client *http.Client, args map[string]
 
 	// Fetch from API
 	reqURL, _ := url.Parse(grepAppAPIBaseURL)
-	q := reqURL.Query()
-	q.Set("q", query)
-	q.Set("page", strconv.Itoa(page))
-	if v, ok := args["caseSensitive"].(bool); ok && v {
-		q.Set("case", "1")
-	}
-	if v, ok := args["useRegex"].(bool); ok && v {
-		q.Set("regexp", "1")
-	}
-	if v, ok := args["wholeWords"].(bool); ok && v {
-		q.Set("words", "1")
-	}
-	if v, ok := args["repoFilter"].(string); ok && v != "" {
-		q.Set("f.repo", v)
-	}
-	if v, ok := args["pathFilter"].(string); ok && v != "" {
-		q.Set("path", v)
-	}
-	if v, ok := args["langFilter"].(string); ok && v != "" {
-		q.Set("lang", v)
-	}
-	reqURL.RawQuery = q.Encode()
+	reqURL.RawQuery = grepAppPageParams(opts, page).Encode()
 
 	log.Printf("Making HTTP request to: %s", reqURL.String())
 
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL.String(), nil)
-	if err != nil {
-		log.Printf("Failed to create HTTP request: %v", err)
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	start := time.Now()
-	resp, err := client.Do(req)
-	duration := time.Since(start)
-
-	// Log API request
-	if logger := GetLogger(); logger != nil {
-		logger.LogAPIRequest(reqURL.String(), duration, 0, err)
-	}
-
-	if err != nil {
-		log.Printf("HTTP request failed after %v: %v", duration, err)
+	// Transient failures are retried with backoff before the page counts as failed
+	status, body, err := getWithRetry(ctx, client, reqURL.String())
+	if err != nil && status == 0 {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	log.Printf("HTTP request completed in %v, status: %d", duration, resp.StatusCode)
-	
-	// Update API request log with status code
-	if logger := GetLogger(); logger != nil {
-		logger.LogAPIRequest(reqURL.String(), duration, resp.StatusCode, nil)
+	if status != http.StatusOK {
+		log.Printf("API request failed with status %d, body: %s", status, string(body))
+		return nil, fmt.Errorf("API request failed with status %d: %s", status, string(body))
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("API request failed with status %d, body: %s", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	if err != nil {
+		log.Printf("Failed to read API response: %v", err)
+		return nil, fmt.Errorf("failed to read API response: %w", err)
 	}
 
 	var apiResponse GrepAppResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
 		log.Printf("Failed to decode API response: %v", err)
+		logSchemaMismatch(reqURL.String(), []string{fmt.Sprintf("failed to decode response: %v", err)}, string(body))
 		return nil, fmt.Errorf("failed to decode API response: %w", err)
 	}
 
 	log.Printf("Successfully parsed API response: %d hits, %d total results", len(apiResponse.Hits.Hits), apiResponse.Facets.Count)
 
+	// Validate the payload shape so upstream changes are reported instead of silently yielding empty hits
+	if issues := validateGrepAppPayload(body); len(issues) > 0 {
+		logSchemaMismatch(reqURL.String(), issues, string(body))
+		apiResponse.SchemaIssues = issues
+		log.Printf("Skipping cache write for query '%s', page %d due to schema mismatch", query, page)
+		return &apiResponse, nil
+	}
+
 	// Save to cache
-	if err := cacheData(cacheKey, apiResponse, query); err != nil {
+	if err := cacheData(cacheKey, apiResponse, query, cacheEntrySearchPage); err != nil {
 		log.Printf("Cache write error for key %s: %v", cacheKey, err)
 	} else {
 		log.Printf("Successfully cached response for query '%s', page %d", query, page)
@@ -473,124 +735,558 @@ func fetchGrepAppPage(ctx context.Context, client *http.Client, args map[string]
 	return &apiResponse, nil
 }
 
-// flattenHits converts the nested Hits map into a simple numbered list.
-func flattenHits(hits *Hits) []NumberedHit {
-	var flattened []NumberedHit
-	i := 1
-	// Sort repos and paths for deterministic numbering
-	var repos []string
-	for repo := range hits.Hits {
-		repos = append(repos, repo)
-	}
-	sort.Strings(repos)
+// searchScan holds the merged hits and request accounting for a multi-page grep.app scan.
+type searchScan struct {
+	Hits         *Hits
+	TotalCount   int
+	APIRequests  int
+	PagesScanned int
+	SchemaIssues []string
+	Complete     bool // Every result page was fetched, not cut off by the page limit
+	FromSuperset bool // Served from a cached broader scan without calling grep.app
 
-	for _, repo := range repos {
-		pathData := hits.Hits[repo]
-		var paths []string
-		for path := range pathData {
-			paths = append(paths, path)
-		}
-		sort.Strings(paths)
+	AvailablePages int         // Result pages grep.app reports for the query
+	Pages          []PageFetch // One record per fetched page, in fetch order
 
-		for _, path := range paths {
-			flattened = append(flattened, NumberedHit{
-				Number: i,
-				Repo:   repo,
-				Path:   path,
-			})
-			i++
-		}
-	}
-	return flattened
-}
+	LineCollisions   int             // Lines that arrived with different text from several pages or languages
+	CollisionSamples []LineCollision // The first few collisions
 
-// parseGitHubRepo extracts owner and repo from a GitHub repository string.
-var githubRepoRegex = regexp.MustCompile(`^(?:https?:\/\/github\.com\/)?([\w.-]+)\/([\w.-]+)(?:\.git)?$`)
+	CachedAt time.Time // When the oldest cached data in the scan was stored; zero when all was fetched fresh
+	Shared   bool      // Copied from an identical concurrent search's scan
 
-func parseGitHubRepo(repoString string) (owner, repo string, err error) {
-	matches := githubRepoRegex.FindStringSubmatch(repoString)
-	if len(matches) != 3 {
-		return "", "", fmt.Errorf("invalid GitHub repo format: %s", repoString)
-	}
-	return matches[1], matches[2], nil
-}
+	SnippetErrors     int // Result snippets that could not be parsed and were left out
+	SnippetsRecovered int // Unparseable snippets whose lines were recovered by re-requesting the page or from GitHub
 
-// fetchGitHubFiles retrieves multiple files from GitHub concurrently.
-func fetchGitHubFiles(ctx context.Context, ghClient *github.Client, requests []GitHubFileRequest) []RetrievedFile {
-	log.Printf("🔗 Starting GitHub file retrieval for %d files", len(requests))
-	start := time.Now()
+	SpilledSegments int // Language results written to disk because they exceeded the memory cap
 
-	var wg sync.WaitGroup
-	resultsChan := make(chan RetrievedFile, len(requests))
+	Provider       string // Fallback provider that served the hits; empty for grep.app
+	FallbackReason string // Why grep.app could not serve them
 
-	for i, req := range requests {
-		wg.Add(1)
-		go func(req GitHubFileRequest, num int) {
-			defer wg.Done()
+	PageError string // Why a page failed after earlier pages arrived; those pages are returned as partial results
+}
 
-			repoPath := fmt.Sprintf("%s/%s", req.Owner, req.Repo)
-			log.Printf("📁 Fetching file %d: %s/%s", num, repoPath, req.Path)
+// parsePageHits converts the raw hits of a single API page into the structured Hits map.
+// It also counts non-empty snippets whose markup no longer matches what parseSnippet expects.
+func parsePageHits(results *GrepAppResponse) (*Hits, int, int) {
+	pageHits := &Hits{Hits: make(map[string]map[string]map[string]string), Context: make(map[string]map[string]map[string]string)}
+	snippetErrors := 0
+	unparseable := 0
 
-			fileStart := time.Now()
-			fileContent, _, _, err := ghClient.Repositories.GetContents(ctx, req.Owner, req.Repo, req.Path, nil)
-			fileDuration := time.Since(fileStart)
+	for _, hit := range results.Hits.Hits {
+		if snippetLooksUnparseable(hit.Content.Snippet) {
+			unparseable++
+		}
+		parsed, context, err := parseSnippetLines(hit.Content.Snippet)
+		if err != nil {
+			snippetErrors++
+			log.Printf("⚠️ Failed to parse snippet for repo %s/%s: %v", hit.Repo.Raw, hit.Path.Raw, err)
+			continue
+		}
+		repo := canonicalRepo(hit.Repo.Raw)
+		if pageHits.Hits[repo] == nil {
+			pageHits.Hits[repo] = make(map[string]map[string]string)
+		}
+		if pageHits.Hits[repo][hit.Path.Raw] == nil {
+			pageHits.Hits[repo][hit.Path.Raw] = make(map[string]string)
+		}
+		for lineNum, line := range parsed {
+			pageHits.Hits[repo][hit.Path.Raw][lineNum] = line
+		}
+		if len(context) > 0 {
+			addLines(pageHits.Context, repo, hit.Path.Raw, context)
+		}
+	}
+	return pageHits, snippetErrors, unparseable
+}
 
-			if err != nil {
-				log.Printf("❌ Failed to fetch file %d (%s/%s) after %v: %v", num, repoPath, req.Path, fileDuration, err)
-				resultsChan <- RetrievedFile{Number: num, Repo: repoPath, Path: req.Path, Error: err.Error()}
-				return
-			}
-			if fileContent == nil {
-				log.Printf("❌ File %d (%s/%s) returned nil content after %v", num, repoPath, req.Path, fileDuration)
-				resultsChan <- RetrievedFile{Number: num, Repo: repoPath, Path: req.Path, Error: "file content is nil"}
-				return
-			}
-			content, err := fileContent.GetContent()
-			if err != nil {
-				log.Printf("❌ Failed to decode file %d (%s/%s) after %v: %v", num, repoPath, req.Path, fileDuration, err)
-				resultsChan <- RetrievedFile{Number: num, Repo: repoPath, Path: req.Path, Error: fmt.Sprintf("failed to get file content: %v", err)}
-				return
+// scanGrepApp fetches up to maxPages pages for a single argument set and merges the results.
+// The returned scan is never nil, so callers can report partial accounting on error.
+func scanGrepApp(ctx context.Context, client *http.Client, args map[string]interface{}, maxPages int) (*searchScan, error) {
+	if cached, ok := lookupSupersetScan(args); ok {
+		return cached, nil
+	}
+	scan := &searchScan{Hits: &Hits{}}
+	opts, err := parseSearchOptions(args)
+	if err != nil {
+		return scan, err
+	}
+	merger := newLineMerger(opts.MergeStrategy)
+	defer merger.addTo(scan)
+
+	for page := 1; ; page++ {
+		// Cached pages make no request, so a cancelled call is caught here too
+		if err := ctx.Err(); err != nil {
+			log.Printf("🚫 Page scan stopped before page %d: %v", page, err)
+			return scan, fmt.Errorf("page %d: %w", page, err)
+		}
+		if logger := GetLogger(); logger != nil {
+			logger.LogDebug(fmt.Sprintf("📖 Processing page %d", page), "searchCode", map[string]interface{}{"page": page})
+		}
+		pageStart := time.Now()
+		results, err := fetchGrepAppPage(ctx, client, opts, page)
+		scan.APIRequests++
+		if err != nil {
+			return scan, fmt.Errorf("page %d: %w", page, err)
+		}
+		scan.PagesScanned = page
+		scan.AvailablePages = results.Facets.Pages
+		scan.Pages = append(scan.Pages, PageFetch{
+			Language:  opts.LangFilter,
+			Page:      page,
+			Hits:      len(results.Hits.Hits),
+			CacheHit:  results.FromCache,
+			ElapsedMs: time.Since(pageStart).Milliseconds(),
+		})
+
+		pageHits, snippetErrors, unparseable := parsePageHits(results)
+		if failed := failedSnippets(results, pageHits); len(failed) > 0 {
+			remaining, requests := recoverSnippets(ctx, client, opts, page, pageHits, failed)
+			scan.APIRequests += requests
+			scan.SnippetsRecovered += len(failed) - len(remaining)
+			snippetErrors = len(remaining)
+		}
+		if snippetErrors > 0 {
+			log.Printf("⚠️ Page %d had %d snippet parsing errors", page, snippetErrors)
+			scan.SnippetErrors += snippetErrors
+		}
+		scan.SchemaIssues = appendUnique(scan.SchemaIssues, results.SchemaIssues...)
+		if unparseable > 0 {
+			issue := "snippet HTML no longer contains the expected line-number table markup"
+			if !containsString(scan.SchemaIssues, issue) {
+				for _, hit := range results.Hits.Hits {
+					if snippetLooksUnparseable(hit.Content.Snippet) {
+						logSchemaMismatch(fmt.Sprintf("snippet (page %d)", page), []string{issue}, hit.Content.Snippet)
+						break
+					}
+				}
 			}
+			scan.SchemaIssues = appendUnique(scan.SchemaIssues, issue)
+		}
 
-			log.Printf("✅ Successfully fetched file %d (%s/%s) in %v (%d bytes)", num, repoPath, req.Path, fileDuration, len(content))
-			resultsChan <- RetrievedFile{Number: num, Repo: repoPath, Path: req.Path, Content: content}
-		}(req, i+1) // Use index for temporary numbering before matching with original
-	}
+		log.Printf("✅ Page %d processed: %d repositories found", page, len(pageHits.Hits))
 
-	wg.Wait()
-	close(resultsChan)
+		merger.merge(scan.Hits, pageHits, fmt.Sprintf("page %d", page))
+		scan.TotalCount = results.Facets.Count
+		if results.FromCache {
+			scan.noteCachedAt(results.CachedAt)
+		}
 
-	var results []RetrievedFile
-	successCount := 0
-	errorCount := 0
+		log.Printf("📊 Total progress: %d repos collected, %d total results available", len(scan.Hits.Hits), scan.TotalCount)
+		reportPageProgress(ctx, opts.LangFilter, page, min(results.Facets.Pages, maxPages), countFiles(scan.Hits))
 
-	for res := range resultsChan {
-		results = append(results, res)
-		if res.Error == "" {
-			successCount++
-		} else {
-			errorCount++
+		if page >= results.Facets.Pages || page >= maxPages {
+			log.Printf("🏁 Search complete: reached page limit (page %d, max pages: %d, search limit: %d)", page, results.Facets.Pages, maxPages)
+			scan.Complete = page >= results.Facets.Pages
+			break
 		}
 	}
+	cacheCompleteScan(args, scan)
+	return scan, nil
+}
 
-	duration := time.Since(start)
-	log.Printf("🎯 GitHub file retrieval completed in %v: %d successful, %d errors", duration, successCount, errorCount)
-
-	return results
+// splitLangFilter splits a comma-separated langFilter into trimmed, de-duplicated language names.
+func splitLangFilter(langFilter string) []string {
+	var langs []string
+	seen := make(map[string]struct{})
+	for _, lang := range strings.Split(langFilter, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			continue
+		}
+		if _, ok := seen[lang]; ok {
+			continue
+		}
+		seen[lang] = struct{}{}
+		langs = append(langs, lang)
+	}
+	return langs
 }
 
-// batchRetrieveFiles orchestrates the batch retrieval process.
-func batchRetrieveFiles(ctx context.Context, ghClient *github.Client, query string, resultNumbers []int) (*BatchRetrievalResult, error) {
-	log.Printf("🔄 Starting batch file retrieval process for query: '%s'", query)
+// scanGrepAppLanguages runs one scan per language when langFilter lists several languages,
+// since grep.app does not reliably combine multiple lang values in a single request.
+// At most maxLanguageScans per-language scans run at once, and their hits are merged.
+func scanGrepAppLanguages(ctx context.Context, client *http.Client, args map[string]interface{}, maxPages int) (*searchScan, error) {
+	return scanLanguagesConcurrently(ctx, client, args, maxPages, maxLanguageScans)
+}
 
-	cachedHits, err := getQueryResults(query)
-	if err != nil {
-		log.Printf("❌ Failed to get cached query results: %v", err)
-		return nil, fmt.Errorf("failed to get cached query results: %w", err)
+// scanLanguagesConcurrently is scanGrepAppLanguages with at most concurrency per-language
+// scans running at once.
+func scanLanguagesConcurrently(ctx context.Context, client *http.Client, args map[string]interface{}, maxPages, concurrency int) (*searchScan, error) {
+	langFilter, _ := args["langFilter"].(string)
+	langs := splitLangFilter(langFilter)
+	if len(langs) <= 1 {
+		if len(langs) == 1 && langs[0] != langFilter {
+			args = copyArgs(args)
+			args["langFilter"] = langs[0]
+		}
+		return scanGrepApp(ctx, client, args, maxPages)
 	}
-	if cachedHits == nil {
-		log.Printf("⚠️ No cached results found for query: '%s'", query)
-		return &BatchRetrievalResult{Success: false, Error: "No cached results found for query: " + query}, nil
+
+	log.Printf("🌐 Fanning out search across %d languages: %v", len(langs), langs)
+
+	var wg sync.WaitGroup
+	resultsChan := make(chan labeledScan, len(langs))
+	slots := make(chan struct{}, concurrency)
+	for _, lang := range langs {
+		wg.Add(1)
+		go func(lang string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			langArgs := copyArgs(args)
+			langArgs["langFilter"] = lang
+			scan, err := scanGrepApp(ctx, client, langArgs, maxPages)
+			resultsChan <- labeledScan{label: "language " + lang, scan: scan, err: err}
+		}(lang)
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultsChan)
+	}()
+	return mergeScans(args, resultsChan)
+}
+
+// labeledScan is one scan of a search fanned out over languages or repositories.
+type labeledScan struct {
+	label string // e.g. "language Go"
+	scan  *searchScan
+	err   error
+}
+
+// mergeScans merges the scans of a fanned-out search as they arrive, until results is
+// closed. Hits of failed scans are kept so that a timed-out call can return partial results,
+// and the first failure is returned.
+func mergeScans(args map[string]interface{}, results <-chan labeledScan) (*searchScan, error) {
+	merged := &searchScan{Hits: &Hits{}, Complete: true}
+	strategy, _ := parseMergeStrategy(args) // Validated by the tool handler
+	merger := newLineMerger(strategy)
+	// Scan results are held, or spilled to disk past the memory cap, until all arrive
+	spool := newHitSpool(GetConfig().MaxResultMemoryMB << 20)
+	var firstErr error
+	for res := range results {
+		merged.LineCollisions += res.scan.LineCollisions
+		merged.CollisionSamples = append(merged.CollisionSamples, res.scan.CollisionSamples...)
+		merged.Complete = merged.Complete && res.err == nil && res.scan.Complete
+		merged.APIRequests += res.scan.APIRequests
+		merged.SnippetErrors += res.scan.SnippetErrors
+		merged.SnippetsRecovered += res.scan.SnippetsRecovered
+		merged.PagesScanned += res.scan.PagesScanned
+		merged.AvailablePages += res.scan.AvailablePages
+		merged.Pages = append(merged.Pages, res.scan.Pages...)
+		merged.SchemaIssues = appendUnique(merged.SchemaIssues, res.scan.SchemaIssues...)
+		merged.noteCachedAt(res.scan.CachedAt)
+		if res.err != nil {
+			log.Printf("❌ Scan failed for %s: %v", res.label, res.err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", res.label, res.err)
+			}
+			// Keep pages fetched before the failure so a timed-out call can return partial results
+			spool.add(res.label, res.scan.Hits)
+			continue
+		}
+		log.Printf("✅ Scanned %s: %d repositories, %d total results", res.label, len(res.scan.Hits.Hits), res.scan.TotalCount)
+		spool.add(res.label, res.scan.Hits)
+		merged.TotalCount += res.scan.TotalCount
+	}
+	spilled, err := spool.drain(merger, merged.Hits)
+	merged.SpilledSegments = spilled
+	if spilled > 0 {
+		log.Printf("💽 Merged %d scan results back from disk", spilled)
+	}
+	if err != nil {
+		log.Printf("❌ %v", err)
+		merged.Complete = false
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(merged.CollisionSamples) > maxRecordedCollisions {
+		merged.CollisionSamples = merged.CollisionSamples[:maxRecordedCollisions]
+	}
+	merger.addTo(merged)
+	return merged, firstErr
+}
+
+// appendUnique appends values that are not already present in the slice.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !containsString(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// containsString reports whether the slice contains the value.
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// copyArgs returns a shallow copy of tool arguments so they can be modified per request.
+func copyArgs(args map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		copied[k] = v
+	}
+	return copied
+}
+
+// flattenHits converts the nested Hits map into a simple numbered list.
+func flattenHits(hits *Hits) []NumberedHit {
+	repos := sortedKeys(hits.Hits)
+	total := 0
+	for _, pathData := range hits.Hits {
+		total += len(pathData)
+	}
+
+	// Sort repos and paths for deterministic numbering
+	flattened := make([]NumberedHit, 0, total)
+	for _, repo := range repos {
+		for _, path := range sortedKeys(hits.Hits[repo]) {
+			flattened = append(flattened, NumberedHit{
+				Number: len(flattened) + 1,
+				Repo:   repo,
+				Path:   path,
+			})
+		}
+	}
+	return flattened
+}
+
+// resultNumbering maps repo → path → result number in the unfiltered listing.
+type resultNumbering map[string]map[string]int
+
+// numberHits records the result number of every file, matching flattenHits. Numbering the
+// unfiltered set keeps numbers stable when client-side filters drop files.
+func numberHits(hits *Hits) resultNumbering {
+	numbers := make(resultNumbering, len(hits.Hits))
+	for _, hit := range flattenHits(hits) {
+		if numbers[hit.Repo] == nil {
+			numbers[hit.Repo] = make(map[string]int)
+		}
+		numbers[hit.Repo][hit.Path] = hit.Number
+	}
+	return numbers
+}
+
+// formatNumberMapping lists which original result number each displayed file carries,
+// so callers can see the gaps left by filtering.
+func formatNumberMapping(hits *Hits, numbers resultNumbering, originalFiles int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔢 Result numbers refer to the unfiltered listing of %d files; %d remain after filtering. Pass them to batchRetrievalTool unchanged.\n", originalFiles, countFiles(hits))
+	b.WriteString("Position → result number:\n")
+	position := 0
+	for _, repo := range sortHits(hits) {
+		for _, file := range repo.Files {
+			position++
+			fmt.Fprintf(&b, "  %d → %d (%s/%s)\n", position, numbers[repo.Repo][file.Path], repo.Repo, file.Path)
+		}
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of a map in lexical order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lineHit is a matched line with its line number parsed once.
+type lineHit struct {
+	Num     int
+	Key     string
+	Text    string
+	Context bool // An unmarked snippet row shown around the matches
+}
+
+// fileHits holds the numerically sorted matched lines of one file.
+type fileHits struct {
+	Path  string
+	Lines []lineHit
+}
+
+// repoHits holds the sorted files of one repository.
+type repoHits struct {
+	Repo  string
+	Files []fileHits
+}
+
+// sortHits builds a fully sorted view of the hits in a single pass, so formatters do not
+// each re-sort repositories, paths and line numbers or repeat string conversions.
+func sortHits(hits *Hits) []repoHits {
+	repos := sortedKeys(hits.Hits)
+	sorted := make([]repoHits, len(repos))
+	for i, repo := range repos {
+		pathData := hits.Hits[repo]
+		paths := sortedKeys(pathData)
+		files := make([]fileHits, len(paths))
+		for j, path := range paths {
+			lines := pathData[path]
+			lineHits := make([]lineHit, 0, len(lines))
+			for key, text := range lines {
+				num, _ := strconv.Atoi(key)
+				lineHits = append(lineHits, lineHit{Num: num, Key: key, Text: text})
+			}
+			sortLineHits(lineHits)
+			files[j] = fileHits{Path: path, Lines: lineHits}
+		}
+		sorted[i] = repoHits{Repo: repo, Files: files}
+	}
+	return sorted
+}
+
+// sortLineHits sorts lines by number, then by key for numbers that did not parse.
+func sortLineHits(lines []lineHit) {
+	slices.SortFunc(lines, func(a, b lineHit) int {
+		if a.Num != b.Num {
+			return a.Num - b.Num
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+}
+
+// parseGitHubRepo extracts owner and repo from a GitHub repository string in any form
+// parseRepoRef accepts.
+func parseGitHubRepo(repoString string) (owner, repo string, err error) {
+	ref, err := parseRepoRef(repoString)
+	if err != nil || ref.Provider != githubHost {
+		return "", "", fmt.Errorf("invalid GitHub repo format: %s", repoString)
+	}
+	return ref.Owner, ref.Name, nil
+}
+
+// fetchGitHubFiles retrieves multiple files from GitHub on a bounded, paced worker pool and
+// returns them in request order, archive groups at the position of their first file.
+// Directories return their listing, plus small files beneath them when opts.Recursive is set.
+// Each repository's ref is resolved to a commit first, which the files are read from.
+func fetchGitHubFiles(ctx context.Context, ghClient *github.Client, requests []GitHubFileRequest, opts retrievalOptions) []RetrievedFile {
+	log.Printf("🔗 Starting GitHub file retrieval for %d files", len(requests))
+	start := time.Now()
+
+	commits := resolveCommits(ctx, ghClient, requests)
+	pinned := make([]GitHubFileRequest, len(requests))
+	for i, req := range requests {
+		pinned[i] = pinRequest(req, commits)
+	}
+
+	// Repositories with many requested files are downloaded once as an archive
+	byArchive, individual := planArchiveRetrieval(pinned)
+	jobs := make([]githubFetchJob, len(requests))
+	for _, group := range byArchive {
+		jobs[group.Indexes[0]] = func() []RetrievedFile {
+			return stampCommit(fetchFromArchive(ctx, ghClient, group, opts), requests[group.Indexes[0]], commits)
+		}
+	}
+	for _, i := range individual {
+		jobs[i] = func() []RetrievedFile {
+			// Use index for temporary numbering before matching with original
+			return stampCommit(fetchGitHubFile(ctx, ghClient, pinned[i], i+1, opts), requests[i], commits)
+		}
+	}
+	jobs = slices.DeleteFunc(jobs, func(job githubFetchJob) bool { return job == nil })
+
+	cfg := GetConfig()
+	results := runGitHubJobs(ctx, jobs, cfg.GitHubConcurrency, cfg.GitHubRequestInterval)
+	successCount := 0
+	errorCount := 0
+	for _, res := range results {
+		if res.Error == "" {
+			successCount++
+		} else {
+			errorCount++
+		}
+	}
+
+	duration := time.Since(start)
+	if err := ctx.Err(); err != nil {
+		log.Printf("🚫 GitHub file retrieval stopped after %v (%v): %d successful, %d errors", duration, err, successCount, errorCount)
+		return results
+	}
+	log.Printf("🎯 GitHub file retrieval completed in %v: %d successful, %d errors", duration, successCount, errorCount)
+
+	return results
+}
+
+// fetchGitHubFile retrieves one file or directory through the Contents API.
+func fetchGitHubFile(ctx context.Context, ghClient *github.Client, req GitHubFileRequest, num int, opts retrievalOptions) []RetrievedFile {
+	repoPath := fmt.Sprintf("%s/%s", req.Owner, req.Repo)
+	if err := ctx.Err(); err != nil {
+		return []RetrievedFile{{Number: num, Repo: repoPath, Path: req.Path, Error: fmt.Sprintf("not fetched: %v", err)}}
+	}
+	log.Printf("📁 Fetching file %d: %s/%s", num, repoPath, req.Path)
+
+	fileStart := time.Now()
+	fileContent, dirContents, _, err := ghClient.Repositories.GetContents(ctx, req.Owner, req.Repo, req.Path, contentsOptions(req.Ref))
+	fileDuration := time.Since(fileStart)
+
+	if err != nil {
+		log.Printf("❌ Failed to fetch file %d (%s/%s) after %v: %v", num, repoPath, req.Path, fileDuration, err)
+		return []RetrievedFile{{Number: num, Repo: repoPath, Path: req.Path, Error: err.Error()}}
+	}
+	if fileContent == nil && dirContents != nil {
+		listing := directoryListing(dirContents)
+		if len(dirContents) >= contentsAPIMaxEntries {
+			// The Contents API cut the listing short; the Trees API returns all of it
+			if tree, err := listDirectoryTree(ctx, ghClient, req.Owner, req.Repo, req.Path, req.Ref, false); err == nil {
+				listing = tree.Entries
+			} else {
+				log.Printf("⚠️ Directory %s/%s may be truncated at %d entries: %v", repoPath, req.Path, len(dirContents), err)
+			}
+		}
+		log.Printf("📂 Path %d (%s/%s) is a directory with %d entries", num, repoPath, req.Path, len(listing))
+		dir := RetrievedFile{Number: num, Repo: repoPath, Path: req.Path, Type: "dir", Listing: listing}
+		if !opts.Recursive {
+			return []RetrievedFile{dir}
+		}
+		files, skipped := fetchDirectoryFiles(ctx, ghClient, req, num, listing, opts)
+		dir.SkippedEntries = skipped
+		return append([]RetrievedFile{dir}, files...)
+	}
+	if fileContent == nil {
+		log.Printf("❌ File %d (%s/%s) returned nil content after %v", num, repoPath, req.Path, fileDuration)
+		return []RetrievedFile{{Number: num, Repo: repoPath, Path: req.Path, Error: "file content is nil"}}
+	}
+	content, err := fileContent.GetContent()
+	if err != nil {
+		log.Printf("❌ Failed to decode file %d (%s/%s) after %v: %v", num, repoPath, req.Path, fileDuration, err)
+		return []RetrievedFile{{Number: num, Repo: repoPath, Path: req.Path, Error: fmt.Sprintf("failed to get file content: %v", err)}}
+	}
+
+	content, encoding := normalizeEncoding([]byte(content))
+	if encoding != encodingUTF8 {
+		log.Printf("🔤 Normalized file %d (%s/%s) from %s", num, repoPath, req.Path, encoding)
+	}
+	content, processing := postProcessContent(req.Path, content, opts)
+	if processing != nil {
+		log.Printf("🧹 Post-processed %s file %d (%s/%s): %d → %d bytes", processing.Kind, num, repoPath, req.Path, processing.OriginalBytes, len(content))
+	}
+
+	log.Printf("✅ Successfully fetched file %d (%s/%s) in %v (%d bytes)", num, repoPath, req.Path, fileDuration, len(content))
+	return []RetrievedFile{{Number: num, Repo: repoPath, Path: req.Path, Type: "file", Content: content, Encoding: encoding, Processing: processing}}
+}
+
+// selectNumberedHits loads the cached complete result for query and returns the hits for
+// resultNumbers, or all hits when no numbers are given. A non-nil result reports a
+// missing cache entry to the caller.
+func selectNumberedHits(query string, resultNumbers []int, cacheTTL time.Duration) ([]NumberedHit, *BatchRetrievalResult, error) {
+	cachedHits, err := getQueryResults(query, cacheTTLFor(cacheEntryComplete, cacheTTL))
+	if err != nil {
+		log.Printf("❌ Failed to get cached query results: %v", err)
+		return nil, nil, fmt.Errorf("failed to get cached query results: %w", err)
+	}
+	if cachedHits == nil {
+		log.Printf("⚠️ No cached results found for query: '%s'", query)
+		return nil, &BatchRetrievalResult{Success: false, Error: "No cached results found for query: " + query}, nil
 	}
 
 	log.Printf("✅ Found cached results for query: '%s'", query)
@@ -616,50 +1312,98 @@ func batchRetrieveFiles(ctx context.Context, ghClient *github.Client, query stri
 		log.Printf("📊 Processing all %d available results", len(allNumberedHits))
 	}
 
+	return hitsToProcess, nil, nil
+}
+
+// batchRetrieveFiles orchestrates the batch retrieval process.
+// cacheTTL overrides the TTL of the cached complete result when positive. Explicit
+// "owner/repo/path" entries in paths are retrieved in addition to numbered results; when
+// only paths are given, the cached results are not needed.
+func batchRetrieveFiles(ctx context.Context, ghClient *github.Client, query string, resultNumbers []int, paths []string, cacheTTL time.Duration, opts retrievalOptions) (*BatchRetrievalResult, error) {
+	log.Printf("🔄 Starting batch file retrieval process for query: '%s'", query)
+
+	var hitsToProcess []NumberedHit
+	if len(paths) == 0 || len(resultNumbers) > 0 {
+		numbered, result, err := selectNumberedHits(query, resultNumbers, cacheTTL)
+		if err != nil || result != nil {
+			return result, err
+		}
+		hitsToProcess = numbered
+	}
+	for _, p := range paths {
+		hitsToProcess = append(hitsToProcess, parseExplicitPath(p))
+	}
+
 	if len(hitsToProcess) == 0 {
 		log.Printf("❌ No results found for the given result numbers")
 		return &BatchRetrievalResult{Success: false, Error: "No results found for the given result numbers."}, nil
 	}
+	return retrieveHits(ctx, ghClient, hitsToProcess, opts), nil
+}
 
+// retrieveHits validates and fetches the files for hits, keeping their result numbers.
+func retrieveHits(ctx context.Context, ghClient *github.Client, hitsToProcess []NumberedHit, opts retrievalOptions) *BatchRetrievalResult {
 	var fileRequests []GitHubFileRequest
+	var rejected []RetrievedFile
+	var skipped []SkippedHit
+	var preloaded []RetrievedFile
 	requestNumberMap := make(map[int]int)
-	skipCount := 0
 
 	log.Printf("🔍 Preparing GitHub file requests for %d hits", len(hitsToProcess))
 
-	for i, hit := range hitsToProcess {
-		owner, repo, err := parseGitHubRepo(hit.Repo)
+	for _, hit := range hitsToProcess {
+		if skip, ok := skipUnsupportedHost(hit); ok {
+			log.Printf("⏭️ Skipping %s/%s: %s", hit.Repo, hit.Path, skip.Reason)
+			skipped = append(skipped, skip)
+			continue
+		}
+		if content, ok := preloadedFile(hit.Repo, hit.Path); ok && opts.Ref == "" {
+			preloaded = append(preloaded, RetrievedFile{Number: hit.Number, Repo: hit.Repo, Path: hit.Path, Content: content, Type: "file"})
+			continue
+		}
+		fileRequest, err := sanitizeFileRequest(hit.Repo, hit.Path)
 		if err != nil {
-			log.Printf("⚠️ Skipping invalid repo format: %s (error: %v)", hit.Repo, err)
-			skipCount++
+			log.Printf("⚠️ Skipping invalid retrieval request %s/%s: %v", hit.Repo, hit.Path, err)
+			var validationErr *ValidationError
+			errors.As(err, &validationErr)
+			rejected = append(rejected, RetrievedFile{Number: hit.Number, Repo: hit.Repo, Path: hit.Path, Error: err.Error(), Validation: validationErr})
 			continue
 		}
-		fileRequests = append(fileRequests, GitHubFileRequest{Owner: owner, Repo: repo, Path: hit.Path})
-		requestNumberMap[i+1-skipCount] = hit.Number
+		fileRequest.Ref = opts.Ref
+		fileRequests = append(fileRequests, fileRequest)
+		requestNumberMap[len(fileRequests)] = hit.Number
 	}
 
-	if skipCount > 0 {
-		log.Printf("⚠️ Skipped %d invalid repositories", skipCount)
+	if len(rejected) > 0 {
+		log.Printf("⚠️ Skipped %d invalid retrieval requests", len(rejected))
 	}
 
+	if len(preloaded) > 0 {
+		log.Printf("📦 Serving %d files from preloaded snapshots", len(preloaded))
+	}
 	log.Printf("📋 Created %d GitHub file requests", len(fileRequests))
 
-	ghResults := fetchGitHubFiles(ctx, ghClient, fileRequests)
+	ghResults := fetchGitHubFiles(ctx, ghClient, fileRequests, opts)
 
 	log.Printf("🔄 Mapping results back to original numbering")
-	finalFiles := make([]RetrievedFile, len(ghResults))
+	finalFiles := make([]RetrievedFile, len(ghResults), len(ghResults)+len(rejected)+len(preloaded))
 	for i, file := range ghResults {
 		finalFiles[i] = file
 		finalFiles[i].Number = requestNumberMap[file.Number]
 	}
+	finalFiles = append(finalFiles, rejected...)
+	finalFiles = append(finalFiles, preloaded...)
 
-	sort.Slice(finalFiles, func(i, j int) bool {
-		return finalFiles[i].Number < finalFiles[j].Number
+	sort.SliceStable(finalFiles, func(i, j int) bool {
+		if finalFiles[i].Number != finalFiles[j].Number {
+			return finalFiles[i].Number < finalFiles[j].Number
+		}
+		return finalFiles[i].Path < finalFiles[j].Path
 	})
 
-	log.Printf("✅ Batch retrieval process completed: %d files processed", len(finalFiles))
+	log.Printf("✅ Batch retrieval process completed: %d files processed, %d skipped", len(finalFiles), len(skipped))
 
-	return &BatchRetrievalResult{Success: true, Files: finalFiles}, nil
+	return &BatchRetrievalResult{Success: true, Files: finalFiles, Skipped: skipped}
 }
 
 //================================================================================
@@ -669,44 +1413,39 @@ func batchRetrieveFiles(ctx context.Context, ghClient *github.Client, query stri
 // formatResultsAsText creates a human-readable summary of search results.
 func formatResultsAsText(hits *Hits) string {
 	var b strings.Builder
+	b.Grow(estimateHitsSize(hits))
 	separator := strings.Repeat("─", 80) + "\n"
 	repoCt, fileCt, lineCt := 0, 0, 0
 
-	// Sort for deterministic output
-	var repos []string
-	for repo := range hits.Hits {
-		repos = append(repos, repo)
-	}
-	sort.Strings(repos)
-
-	for _, repo := range repos {
+	for _, repo := range sortHits(hits) {
 		repoCt++
 		b.WriteString(separator)
-		fmt.Fprintf(&b, "Repository: %s\n", repo)
-
-		pathData := hits.Hits[repo]
-		var paths []string
-		for path := range pathData {
-			paths = append(paths, path)
-		}
-		sort.Strings(paths)
+		b.WriteString("Repository: ")
+		b.WriteString(repo.Repo)
+		b.WriteString("\n")
 
-		for _, path := range paths {
+		for _, file := range repo.Files {
 			fileCt++
-			fmt.Fprintf(&b, "  /%s\n", path)
-
-			lines := pathData[path]
-			var lineNums []int
-			for lineNumStr := range lines {
-				num, _ := strconv.Atoi(lineNumStr)
-				lineNums = append(lineNums, num)
-			}
-			sort.Ints(lineNums)
-
-			for _, lineNum := range lineNums {
-				lineCt++
-				lineNumStr := strconv.Itoa(lineNum)
-				fmt.Fprintf(&b, "    %5s: %s\n", lineNumStr, lines[lineNumStr])
+			b.WriteString("  /")
+			b.WriteString(file.Path)
+			b.WriteString("\n")
+
+			for _, line := range fileLinesWithContext(hits, repo.Repo, file) {
+				// Equivalent to fmt's "    %5s: %s\n" without per-line formatting allocations;
+				// context lines are set off grep-style with "-" in place of ":"
+				separator := "- "
+				if !line.Context {
+					lineCt++
+					separator = ": "
+				}
+				b.WriteString("    ")
+				for pad := len(line.Key); pad < 5; pad++ {
+					b.WriteByte(' ')
+				}
+				b.WriteString(line.Key)
+				b.WriteString(separator)
+				b.WriteString(line.Text)
+				b.WriteString("\n")
 			}
 		}
 	}
@@ -715,121 +1454,615 @@ func formatResultsAsText(hits *Hits) string {
 	return b.String()
 }
 
-// formatResultsAsNumberedList creates a numbered list of files with their matches.
-func formatResultsAsNumberedList(hits *Hits) string {
-	var b strings.Builder
-	numberedHits := flattenHits(hits)
+// treeNode is a directory or file in the per-repository result tree.
+type treeNode struct {
+	name     string
+	isFile   bool
+	matches  int
+	children map[string]*treeNode
+}
+
+// insertPath adds a file with its match count, creating intermediate directories.
+func (n *treeNode) insertPath(parts []string, matches int) {
+	n.matches += matches
+	if len(parts) == 0 {
+		return
+	}
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	child, ok := n.children[parts[0]]
+	if !ok {
+		child = &treeNode{name: parts[0], isFile: len(parts) == 1}
+		n.children[parts[0]] = child
+	}
+	child.insertPath(parts[1:], matches)
+}
 
-	for _, hit := range numberedHits {
-		pathData := hits.Hits[hit.Repo][hit.Path]
-		var lineNums []int
-		for lineNumStr := range pathData {
-			num, _ := strconv.Atoi(lineNumStr)
-			lineNums = append(lineNums, num)
+// sortedChildren returns directories before files, each group in lexical order.
+func (n *treeNode) sortedChildren() []*treeNode {
+	children := make([]*treeNode, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].isFile != children[j].isFile {
+			return !children[i].isFile
 		}
-		sort.Ints(lineNums)
+		return children[i].name < children[j].name
+	})
+	return children
+}
 
-		if len(lineNums) > 0 {
-			firstLineNumStr := strconv.Itoa(lineNums[0])
-			fmt.Fprintf(&b, "%d. [%s/%s:%s] %s\n", hit.Number, hit.Repo, hit.Path, firstLineNumStr, pathData[firstLineNumStr])
+// writeTree renders children with box-drawing connectors. Directory chains with a single
+// subdirectory are collapsed into one node, e.g. "src/main/java/".
+func (n *treeNode) writeTree(b *strings.Builder, prefix string) {
+	children := n.sortedChildren()
+	for i, child := range children {
+		connector, childPrefix := "├── ", "│   "
+		if i == len(children)-1 {
+			connector, childPrefix = "└── ", "    "
+		}
 
-			for i := 1; i < len(lineNums); i++ {
-				lineNumStr := strconv.Itoa(lineNums[i])
-				fmt.Fprintf(&b, "   L%s: %s\n", lineNumStr, pathData[lineNumStr])
+		name := child.name
+		for !child.isFile && len(child.children) == 1 {
+			only := child.sortedChildren()[0]
+			if only.isFile {
+				break
 			}
+			name += "/" + only.name
+			child = only
+		}
+		if !child.isFile {
+			name += "/"
+		}
+
+		fmt.Fprintf(b, "%s%s%s (%d)\n", prefix, connector, name, child.matches)
+		if !child.isFile {
+			child.writeTree(b, prefix+childPrefix)
 		}
 	}
-	return b.String()
 }
 
-//================================================================================
-// Main Server Logic
-//================================================================================
+// formatResultsAsTree renders hits as a collapsed directory tree per repository with
+// matched-line counts at every node.
+func formatResultsAsTree(hits *Hits) string {
+	var b strings.Builder
+	repoCt, fileCt, lineCt := 0, 0, 0
 
-func main() {
-	var transport string
-	var port int
-	var showVersion bool
-	
-	// Custom usage function to show version info
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "GrepApp MCP Server %s (commit: %s)\n\n", Version, GitCommit)
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nBuild Information:\n")
-		fmt.Fprintf(os.Stderr, "  Version: %s\n", Version)
-		fmt.Fprintf(os.Stderr, "  Git Commit: %s\n", GitCommit)
-		fmt.Fprintf(os.Stderr, "  Build Date: %s\n", BuildDate)
-		fmt.Fprintf(os.Stderr, "  Built By: %s\n", BuildBy)
+	for _, repo := range sortedKeys(hits.Hits) {
+		repoCt++
+		root := &treeNode{name: repo}
+		for path, lines := range hits.Hits[repo] {
+			fileCt++
+			lineCt += len(lines)
+			root.insertPath(strings.Split(strings.Trim(path, "/"), "/"), len(lines))
+		}
+		fmt.Fprintf(&b, "%s (%d matches)\n", repo, root.matches)
+		root.writeTree(&b, "")
+		b.WriteString("\n")
 	}
-	
-	flag.StringVar(&transport, "transport", "stdio", "Transport type (stdio or http)")
-	flag.IntVar(&port, "port", 8603, "Port for http transport")
-	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
-	flag.Parse()
+	fmt.Fprintf(&b, "Summary: Found %d matched lines in %d files across %d repositories.\n", lineCt, fileCt, repoCt)
+	return b.String()
+}
 
-	// Handle version flag
-	if showVersion {
-		fmt.Printf("GrepApp MCP Server %s\n", Version)
-		fmt.Printf("Git Commit: %s\n", GitCommit)
-		fmt.Printf("Build Date: %s\n", BuildDate)
-		fmt.Printf("Built By: %s\n", BuildBy)
-		os.Exit(0)
+// errJSONOutputTooLarge is returned when encoded JSON output would exceed its size cap.
+var errJSONOutputTooLarge = fmt.Errorf("JSON output exceeds %d bytes; narrow the query or use numberedOutput", maxJSONOutputBytes)
+
+// cappedWriter is a strings.Builder that refuses writes beyond a fixed size.
+type cappedWriter struct {
+	b     strings.Builder
+	limit int
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	if w.b.Len()+len(p) > w.limit {
+		return 0, errJSONOutputTooLarge
 	}
+	return w.b.Write(p)
+}
 
-	log.Printf("🚀 Initializing GrepApp MCP Server %s", Version)
-	log.Printf("🔧 Configuration: transport=%s, port=%d", transport, port)
-	log.Printf("📦 Build info: commit=%s, date=%s, by=%s", GitCommit, BuildDate, BuildBy)
+// estimateHitsSize approximates the encoded JSON size of the hits without encoding them.
+func estimateHitsSize(hits *Hits) int {
+	size := 2
+	for repo, pathData := range hits.Hits {
+		size += len(repo) + 8
+		for path, lines := range pathData {
+			size += len(path) + 8
+			for lineNum, line := range lines {
+				size += len(lineNum) + len(line) + 8
+			}
+		}
+	}
+	return size
+}
 
-	// Initialize observability logging
-	log.Printf("📊 Initializing observability logging")
-	if err := InitGlobalLogger(logDir); err != nil {
-		log.Fatalf("💥 Failed to initialize logger: %v", err)
+// encodeHitsJSON encodes the hits map one repository at a time so that the full document is
+// never held twice in memory. Indentation is dropped for large results, and encoding stops
+// with errJSONOutputTooLarge once limit bytes have been written.
+func encodeHitsJSON(hits *Hits, limit int) (string, error) {
+	w := &cappedWriter{limit: limit}
+	if err := writeHitsJSON(w, hits, estimateHitsSize(hits) <= jsonIndentThreshold); err != nil {
+		return "", err
 	}
-	defer CloseGlobalLogger()
+	return w.b.String(), nil
+}
 
-	logger := GetLogger()
+// writeHitsJSON streams the hits map as a JSON object with repositories in sorted order.
+// With indent set, the output matches json.MarshalIndent(hits.Hits, "", "  ").
+func writeHitsJSON(w io.Writer, hits *Hits, indent bool) error {
+	var repos []string
+	for repo := range hits.Hits {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
 
-	// Initialize HTTP and GitHub clients
-	logger.LogInfo("🌐 Initializing HTTP client with 30s timeout", "server", nil)
-	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if len(repos) == 0 {
+		_, err := io.WriteString(w, "{}")
+		return err
+	}
 
-	logger.LogInfo("🐙 Initializing GitHub client", "server", nil)
-	ghClient := github.NewClient(nil)
+	open, sep, closing, colon := "{", ",", "}", ":"
+	if indent {
+		open, sep, closing, colon = "{\n  ", ",\n  ", "\n}", ": "
+	}
 
-	logger.LogInfo("⚙️ Creating MCP server with tool capabilities and recovery", "server", nil)
-	s := server.NewMCPServer(
-		"GrepApp Search Server",
-		Version,
+	if _, err := io.WriteString(w, open); err != nil {
+		return err
+	}
+	for i, repo := range repos {
+		if i > 0 {
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+		}
+		key, err := json.Marshal(repo)
+		if err != nil {
+			return err
+		}
+		var value []byte
+		if indent {
+			value, err = json.MarshalIndent(hits.Hits[repo], "  ", "  ")
+		} else {
+			value, err = json.Marshal(hits.Hits[repo])
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(key); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, colon); err != nil {
+			return err
+		}
+		if _, err := w.Write(value); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, closing)
+	return err
+}
+
+// formatResultsAsNumberedList creates a numbered list of files with their matches.
+// Numbering matches flattenHits, including files without matched lines.
+func formatResultsAsNumberedList(hits *Hits) string {
+	return formatNumberedList(hits, nil)
+}
+
+// formatNumberedList renders a numbered list using the given numbering, or sequential
+// numbers when numbers is nil.
+func formatNumberedList(hits *Hits, numbers resultNumbering) string {
+	var b strings.Builder
+	b.Grow(estimateHitsSize(hits))
+	number := 0
+
+	for _, repo := range sortHits(hits) {
+		for _, file := range repo.Files {
+			number++
+			if numbers != nil {
+				number = numbers[repo.Repo][file.Path]
+			}
+			if len(file.Lines) == 0 {
+				continue
+			}
+			first := file.Lines[0]
+			fmt.Fprintf(&b, "%d. [%s/%s:%s] %s\n", number, repo.Repo, file.Path, first.Key, first.Text)
+
+			for _, line := range fileLinesWithContext(hits, repo.Repo, file) {
+				if line.Key == first.Key && !line.Context {
+					continue
+				}
+				separator := ": "
+				if line.Context {
+					separator = "- "
+				}
+				b.WriteString("   L")
+				b.WriteString(line.Key)
+				b.WriteString(separator)
+				b.WriteString(line.Text)
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+//================================================================================
+// Search Logging Helpers
+//================================================================================
+
+// newSearchLogData fills the request-derived fields of a search completion record.
+// Result counts default to zero and are set by the caller on success.
+func newSearchLogData(args map[string]interface{}, scan *searchScan, duration time.Duration) SearchLogData {
+	query, _ := args["query"].(string)
+	useRegex, _ := args["useRegex"].(bool)
+	caseSensitive, _ := args["caseSensitive"].(bool)
+	wholeWords, _ := args["wholeWords"].(bool)
+
+	filters := make(map[string]string)
+	if v, ok := args["repoFilter"].(string); ok && v != "" {
+		filters["repo"] = v
+	}
+	if v, ok := args["collection"].(string); ok && v != "" {
+		filters["collection"] = v
+	}
+	if v, ok := args["pathFilter"].(string); ok && v != "" {
+		filters["path"] = v
+	}
+	if v, ok := args["langFilter"].(string); ok && v != "" {
+		filters["lang"] = v
+	}
+	if v, ok := args["minMatchesPerFile"].(float64); ok && v > 1 {
+		filters["minMatches"] = strconv.Itoa(int(v))
+	}
+	if v, ok := args["maxPathDepth"].(float64); ok && v >= 1 {
+		filters["maxPathDepth"] = strconv.Itoa(int(v))
+	}
+	if v, ok := args["filenameRegex"].(string); ok && v != "" {
+		filters["filenameRegex"] = v
+	}
+	if v, ok := args["extensionFilter"].(string); ok && v != "" {
+		filters["extensions"] = v
+	}
+	if v, ok := args["topicFilter"].(string); ok && v != "" {
+		filters["topics"] = v
+	}
+
+	return SearchLogData{
+		Query:         query,
+		UseRegex:      useRegex,
+		CaseSensitive: caseSensitive,
+		WholeWords:    wholeWords,
+		RepoFilter:    filters["repo"],
+		PathFilter:    filters["path"],
+		LangFilter:    filters["lang"],
+		Filters:       filters,
+		CacheLayers:   hotCache.stats(),
+		Duration:      duration,
+		Success:       true,
+		APIRequests:   scan.APIRequests,
+		PagesScanned:  scan.PagesScanned,
+		PageError:     scan.PageError,
+	}
+}
+
+//================================================================================
+// Main Server Logic
+//================================================================================
+
+func main() {
+	var transport string
+	var port int
+	var listen string
+	var showVersion bool
+	
+	// Custom usage function to show version info
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "GrepApp MCP Server %s (commit: %s)\n\n", Version, GitCommit)
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nBuild Information:\n")
+		fmt.Fprintf(os.Stderr, "  Version: %s\n", Version)
+		fmt.Fprintf(os.Stderr, "  Git Commit: %s\n", GitCommit)
+		fmt.Fprintf(os.Stderr, "  Build Date: %s\n", BuildDate)
+		fmt.Fprintf(os.Stderr, "  Built By: %s\n", BuildBy)
+	}
+	
+	flag.StringVar(&transport, "transport", "stdio", "Transport type (stdio or http)")
+	flag.IntVar(&port, "port", 8603, "Port for http transport")
+	flag.StringVar(&listen, "listen", "", "Listen address for http transport: host:port or unix:/path/to/socket (overrides -port)")
+	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
+
+	cfg := GetConfig()
+	if err := cfg.applyEnv(); err != nil {
+		log.Fatalf("💥 Invalid environment configuration: %v", err)
+	}
+	if err := cfg.parseFlags(flag.CommandLine, os.Args[1:]); err != nil {
+		log.Fatalf("💥 %v", err)
+	}
+
+	// Handle version flag
+	if showVersion {
+		fmt.Printf("GrepApp MCP Server %s\n", Version)
+		fmt.Printf("Git Commit: %s\n", GitCommit)
+		fmt.Printf("Build Date: %s\n", BuildDate)
+		fmt.Printf("Built By: %s\n", BuildBy)
+		os.Exit(0)
+	}
+
+	log.Printf("🚀 Initializing GrepApp MCP Server %s", Version)
+	if cfg.MaxPages < 1 || cfg.MaxPages > maxPagesLimit {
+		log.Fatalf("💥 -max-pages must be between 1 and %d, got %d", maxPagesLimit, cfg.MaxPages)
+	}
+	if cfg.MaxFileBytes < 0 || cfg.MaxBatchBytes < 0 {
+		log.Fatalf("💥 -max-file-bytes and -max-batch-bytes must not be negative, got %d and %d", cfg.MaxFileBytes, cfg.MaxBatchBytes)
+	}
+	if cfg.GitHubConcurrency < 1 || cfg.GitHubRequestInterval < 0 {
+		log.Fatalf("💥 -github-concurrency must be at least 1 and -github-request-interval must not be negative, got %d and %s", cfg.GitHubConcurrency, cfg.GitHubRequestInterval)
+	}
+	if cfg.Retry.MaxRetries < 0 || cfg.Retry.BaseDelay <= 0 {
+		log.Fatalf("💥 -max-retries must not be negative and -retry-base-delay must be positive, got %d and %s", cfg.Retry.MaxRetries, cfg.Retry.BaseDelay)
+	}
+	if err := validateFallbackPolicy(cfg.Fallback); err != nil {
+		log.Fatalf("💥 Invalid -fallback: %v", err)
+	}
+	if len(cfg.Fallback) > 0 {
+		log.Printf("🔁 Search fallback: grep.app → %s", strings.Join(cfg.Fallback, " → "))
+	}
+	disabledTools, err := resolveDisabledTools(cfg.EnabledTools, cfg.DisabledTools)
+	if err != nil {
+		log.Fatalf("💥 Invalid tool selection: %v", err)
+	}
+	log.Printf("🔧 Configuration: transport=%s, port=%d", transport, port)
+	if cfg.NoCache {
+		log.Printf("💾 Disk cache disabled")
+	} else {
+		log.Printf("💾 Cache directory: %s", cfg.CacheDir)
+		if removed, err := purgeOldSearchPages(cfg.CacheDir); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Failed to purge old-format search pages: %v", err)
+		} else if removed > 0 {
+			log.Printf("🧹 Removed %d search pages cached under an old key format", removed)
+		}
+	}
+	if cfg.Budget.MaxRequestsPerCall > 0 || cfg.Budget.MaxRequestsPerHour > 0 {
+		log.Printf("💸 API budget: %d requests per call, %d per hour (0 = unlimited)", cfg.Budget.MaxRequestsPerCall, cfg.Budget.MaxRequestsPerHour)
+	}
+	if len(cfg.RequestHeaders.Extra) > 0 {
+		log.Printf("🪪 Extra upstream request headers: %s", headerFlag{&cfg.RequestHeaders.Extra})
+	}
+	log.Printf("📦 Build info: commit=%s, date=%s, by=%s", GitCommit, BuildDate, BuildBy)
+
+	// Initialize observability logging
+	log.Printf("📊 Initializing observability logging")
+	log.Printf("📁 Log directory: %s", cfg.LogDir)
+	if err := InitGlobalLogger(cfg.LogDir, cfg.LogFilePattern, cfg.LogWrite); err != nil {
+		log.Fatalf("💥 Failed to initialize logger: %v", err)
+	}
+	defer CloseGlobalLogger()
+
+	logger := GetLogger()
+	stopSessionPersistence := startSessionPersistence(logger, sessionPersistInterval)
+	defer stopSessionPersistence()
+	stopStatsPersistence := startStatsPersistence(cfg.LogDir, statsCheckpointInterval)
+	defer stopStatsPersistence()
+
+	if cfg.AuditLogFile != "" {
+		audit, err := openAuditLog(cfg.AuditLogFile)
+		if err != nil {
+			logger.LogErrorMsg("💥 Failed to open retrieval audit log", "server", err, map[string]interface{}{"file": cfg.AuditLogFile})
+			fatalf("💥 Failed to open retrieval audit log: %v", err)
+		}
+		retrievalAudit = audit
+		defer audit.Close()
+		logger.LogInfo(fmt.Sprintf("🧾 Auditing file retrievals to %s", cfg.AuditLogFile), "server", map[string]interface{}{"file": cfg.AuditLogFile})
+	}
+
+	if cfg.PolicyFile != "" {
+		policy, err := loadPolicy(cfg.PolicyFile)
+		if err != nil {
+			logger.LogErrorMsg("💥 Failed to load tool call policy", "server", err, map[string]interface{}{"file": cfg.PolicyFile})
+			fatalf("💥 Failed to load tool call policy: %v", err)
+		}
+		RegisterToolCallHook("policy", policy)
+		logger.LogInfo(fmt.Sprintf("🛡️ Loaded tool call policy with %d rules", len(policy.Rules)), "server", map[string]interface{}{"file": cfg.PolicyFile})
+	}
+
+	if len(cfg.PreloadPaths) > 0 {
+		summary, err := preloadSnapshots(cfg.PreloadPaths)
+		if err != nil {
+			logger.LogErrorMsg("💥 Failed to preload cache snapshots", "server", err, map[string]interface{}{"paths": cfg.PreloadPaths})
+			fatalf("💥 Failed to preload cache snapshots: %v", err)
+		}
+		logger.LogInfo(fmt.Sprintf("📦 Preloaded %d snapshots: %d queries, %d files", summary.Archives, len(summary.Queries), summary.Files), "server", map[string]interface{}{"queries": summary.Queries})
+		if len(summary.Expired) > 0 {
+			logger.LogWarn(fmt.Sprintf("⚠️ %d preloaded queries are older than the complete-result TTL and will not be served; raise -cache-ttl-complete to use them", len(summary.Expired)), "server", map[string]interface{}{"queries": summary.Expired})
+		}
+	}
+
+	// Initialize HTTP and GitHub clients
+	logger.LogInfo("🌐 Initializing HTTP client with 30s timeout", "server", nil)
+	httpClient := &http.Client{Timeout: 30 * time.Second, Transport: newBudgetTransport(newHeaderTransport(newStatsTransport(nil)))}
+
+	logger.LogInfo("🐙 Initializing GitHub client", "server", nil)
+	ghClient := github.NewClient(&http.Client{Transport: newBudgetTransport(newHeaderTransport(newStatsTransport(nil)))})
+	if cfg.GitHubToken != "" {
+		ghClient = ghClient.WithAuthToken(cfg.GitHubToken)
+		logger.LogInfo("🔑 GitHub requests are authenticated with a token", "server", nil)
+	} else {
+		logger.LogInfo("⚠️ No GitHub token set; file retrieval is limited to 60 requests per hour", "server", nil)
+	}
+
+	logger.LogInfo("⚙️ Creating MCP server with tool capabilities and recovery", "server", nil)
+	s := server.NewMCPServer(
+		"GrepApp Search Server",
+		Version,
 		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(cfg.WatchInterval > 0, false),
 		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(requestLoggerMiddleware),
+		server.WithToolHandlerMiddleware(sessionStatsMiddleware),
+		server.WithToolHandlerMiddleware(warningsMiddleware),
+		server.WithToolHandlerMiddleware(diskHealthMiddleware),
+		server.WithToolHandlerMiddleware(budgetMiddleware),
+		server.WithToolHandlerMiddleware(costMiddleware),
+		server.WithToolHandlerMiddleware(tenantMiddleware),
+		server.WithToolHandlerMiddleware(toolCallHookMiddleware),
 	)
 
+	// --- Output Schemas ---
+	logger.LogInfo("🔧 Registering output schema resources", "server", nil)
+	registerOutputSchemas(s)
+
+	// --- Result Watching ---
+	if cfg.WatchInterval > 0 {
+		logger.LogInfo(fmt.Sprintf("🔧 Registering results resources; subscribed queries refresh every %s", cfg.WatchInterval), "server", nil)
+		startResultWatching(s, httpClient, cfg.WatchInterval)
+	}
+
 	// --- searchCode Tool ---
 	logger.LogInfo("🔧 Registering searchCode tool", "server", nil)
 	searchCodeTool := mcp.NewTool("searchCode",
 		mcp.WithDescription("Searches public code on GitHub using the grep.app API with enhanced regex support."),
 		mcp.WithString("query", mcp.Description("The search query string. If useRegex is true, this should be a valid Go regex pattern."), mcp.Required()),
 		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return results as a JSON object.")),
+		mcp.WithBoolean("includeMetadata", mcp.Description("If true with jsonOutput, wrap results as {\"schemaVersion\": ..., \"hits\": ..., \"languages\": ..., \"metadata\": ...} where languages gives each file's language inferred from its name and metadata reports pages fetched versus available, per-page hit counts and cache hits, total available versus returned results, and an elapsed time breakdown."+outputSchemaNote(outputSchemaResults))),
 		mcp.WithBoolean("numberedOutput", mcp.Description("If true, return results as a numbered list for model selection.")),
+		mcp.WithBoolean("treeOutput", mcp.Description("If true, return results as a directory tree per repository with match counts at each node.")),
+		mcp.WithBoolean("includeContext", mcp.Description("If true, text and numbered output also show the unmarked lines grep.app returns around matches, marked with \"-\" after the line number instead of \":\". They are not counted as matches and do not affect JSON output.")),
 		mcp.WithBoolean("caseSensitive", mcp.Description("Perform a case-sensitive search.")),
 		mcp.WithBoolean("useRegex", mcp.Description("Treat the query as a regular expression. Supports Go regex syntax with client-side validation and filtering.")),
-		mcp.WithBoolean("wholeWords", mcp.Description("Search for whole words only.")),
+		mcp.WithBoolean("autoEscape", mcp.Description("With useRegex, escape the query's metacharacters and search for it literally if it is not a valid regex, instead of failing.")),
+		mcp.WithBoolean("wholeWords", mcp.Description("Search for whole words only. Matched lines are re-checked client-side with word boundaries, together with useRegex and caseSensitive.")),
 		mcp.WithString("repoFilter", mcp.Description("Filter by repository name pattern.")),
+		mcp.WithString("collection", mcp.Description("Search only the repositories of this named collection, e.g. 'cncf', with one repoFilter search per repository merged into one result. Collections come from -collections-file or saveCollection; listCollections shows them. Cannot be combined with repoFilter or countOnly.")),
 		mcp.WithString("pathFilter", mcp.Description("Filter by file path pattern.")),
-		mcp.WithString("langFilter", mcp.Description("Filter by language, comma-separated.")),
+		mcp.WithString("langFilter", mcp.Description("Filter by language, comma-separated. Multiple languages are searched concurrently and merged. Common aliases such as golang, js, ts and py are accepted.")),
+		mcp.WithBoolean("countOnly", mcp.Description("If true, fetch only the first page and return total match and page counts with language, repository and path breakdowns. A cheap way to size a search before running it.")),
+		mcp.WithNumber("maxPages", mcp.Description(fmt.Sprintf("Maximum result pages to fetch, 1-%d (default %d, set with -max-pages). Raise it for long-tail queries whose results are cut off; each page is one upstream request.", maxPagesLimit, GetConfig().MaxPages))),
+		mcp.WithBoolean("quickFirstPage", mcp.Description("If true, return first-page results immediately and fetch the remaining pages in the background. Repeat the search to get the complete results and final numbering before using batchRetrievalTool.")),
+		mcp.WithBoolean("explain", mcp.Description("If true, prepend a description of the effective search parameters, including canonicalized language names.")),
+		mcp.WithString("cacheTTL", mcp.Description("Override the maximum age of cached search pages for this call, e.g. '30m' or '2h'.")),
+		mcp.WithBoolean("forceRefresh", mcp.Description("If true, ignore cached results and fetch every page from grep.app again. Use it when the output warns that cached results are stale.")),
+		mcp.WithBoolean("interactive", mcp.Description("If true and the search finds nothing or more than "+strconv.Itoa(ambiguousResultThreshold)+" matches, ask the user a clarifying question through MCP elicitation, such as a language to narrow by or a filter to drop, and search again with the answer. Needs a stdio client that supports elicitation.")),
+		mcp.WithNumber("minMatchesPerFile", mcp.Description("Only return files with at least this many matched lines.")),
+		mcp.WithNumber("maxPathDepth", mcp.Description("Only return files at most this many path segments deep; 1 keeps top-level files only.")),
+		mcp.WithString("filenameRegex", mcp.Description("Only return files whose name (without directories) matches this Go regex, e.g. '^Dockerfile$'.")),
+		mcp.WithString("extensionFilter", mcp.Description("Only return files with one of these comma-separated extensions, e.g. 'yml,yaml'. Case-insensitive.")),
+		mcp.WithString("topicFilter", mcp.Description("Only return files from GitHub repositories tagged with at least one of these comma-separated topics, e.g. 'kubernetes,machine-learning'. Looks up each repository's metadata, which is cached for a week.")),
+		mcp.WithString("mergeStrategy",
+			mcp.Description("How to resolve a line that arrives with different text from several pages or languages: 'keep-last' (default), 'keep-first', 'keep-longest', or 'keep-all' to keep every variant tagged with its source. Collisions are reported in the metadata."),
+			mcp.Enum(lineMergeStrategies...),
+		),
+		mcp.WithBoolean("translateComments", mcp.Description("If true, append English translations of non-English comments found in the matched lines, to help judge hits from international codebases. Needs a translation endpoint set with -translate-url.")),
+		timeoutSecondsOption(),
 	)
 
-	s.AddTool(searchCodeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	s.AddTool(searchCodeTool, interactiveSearch(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		args := request.GetArguments()
-		query, _ := args["query"].(string)
-		useRegex, _ := args["useRegex"].(bool)
-		
-		logger.LogInfo(fmt.Sprintf("🔍 Starting searchCode tool execution for query: '%s', useRegex: %t", query, useRegex), "searchCode", map[string]interface{}{"query": query, "useRegex": useRegex})
+		// Clients that send a progress token are notified after each fetched page
+		ctx = withProgressReporter(ctx, s, request)
+		ctx = withSnippetRecovery(ctx, githubClientFor(ctx, ghClient))
 		logger.LogDebug(fmt.Sprintf("📋 Tool arguments: %+v", args), "searchCode", nil)
 
+		// Arguments are validated once; the rest of the call reads them in canonical types
+		opts, err := parseSearchOptions(args)
+		if err != nil {
+			logger.LogErrorMsg(fmt.Sprintf("❌ Invalid arguments: %v", err), "searchCode", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		args = opts.apply(args)
+		query, useRegex, maxPages := opts.Query, opts.UseRegex, opts.MaxPages
+
+		logger.LogInfo(fmt.Sprintf("🔍 Starting searchCode tool execution for query: '%s', useRegex: %t", query, useRegex), "searchCode", map[string]interface{}{"query": query, "useRegex": useRegex})
+
+		ctx, cancel, timeout, err := withCallTimeout(ctx, args)
+		defer cancel()
+		if err != nil {
+			logger.LogErrorMsg(fmt.Sprintf("❌ Invalid timeoutSeconds: %v", err), "searchCode", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		minMatches := 0
+		if v, ok, err := argNumber(args, "minMatchesPerFile"); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		} else if ok {
+			if v < 0 {
+				return mcp.NewToolResultError("minMatchesPerFile must not be negative"), nil
+			}
+			minMatches = int(v)
+		}
+
+		pathPost, err := parsePathPostFilter(args)
+		if err != nil {
+			logger.LogErrorMsg(fmt.Sprintf("❌ Invalid path filter: %v", err), "searchCode", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		// Warn about regex syntax in literal queries and escape invalid regexes on request
+		autoEscape, _ := args["autoEscape"].(bool)
+		// Complete results stay keyed by the caller's query, which batchRetrievalTool is passed
+		completeQuery := query
+		preparedQuery, queryNotes := prepareQuery(query, useRegex, autoEscape)
+		if preparedQuery != query {
+			logger.LogInfo(fmt.Sprintf("🔡 Escaped invalid regex query: '%s' → '%s'", query, preparedQuery), "searchCode", map[string]interface{}{"query": query, "escaped": preparedQuery})
+			args = copyArgs(args)
+			args["query"] = preparedQuery
+			query = preparedQuery
+		}
+
+		// Repository URLs and .git suffixes are reduced to the form grep.app reports
+		if repoFilter, _ := request.GetArguments()["repoFilter"].(string); repoFilter != opts.RepoFilter {
+			logger.LogInfo(fmt.Sprintf("🏷️ Canonicalized repoFilter: '%s' → '%s'", repoFilter, opts.RepoFilter), "searchCode", nil)
+		}
+
+		// A collection fans the search out over its repositories
+		collection, err := argString(args, "collection")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		var collectionRepos []string
+		if collection != "" {
+			if opts.RepoFilter != "" {
+				return mcp.NewToolResultError("collection and repoFilter cannot be combined; add the repository to the collection or search it separately"), nil
+			}
+			if countOnly, _ := args["countOnly"].(bool); countOnly {
+				return mcp.NewToolResultError("countOnly does not support collection; search one repository of it with repoFilter to size the search"), nil
+			}
+			if collectionRepos, err = resolveCollection(ctx, collection); err != nil {
+				logger.LogErrorMsg(fmt.Sprintf("❌ Invalid collection: %v", err), "searchCode", err, nil)
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			// The repoFilter allowlist of -policy applies to each repository of the collection
+			if collectionRepos, err = filterReposByHooks(ctx, request.Params.Name, collectionRepos); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("tool call denied: %v", err)), nil
+			}
+			logger.LogInfo(fmt.Sprintf("📚 Searching collection '%s' of %d repositories", collection, len(collectionRepos)), "searchCode", map[string]interface{}{
+				"collection": collection,
+				"repos":      len(collectionRepos),
+			})
+		}
+
+		// Resolve language aliases before any request is built
+		var langRewrites map[string]string
+		if langFilter, ok := args["langFilter"].(string); ok && langFilter != "" {
+			args = copyArgs(args)
+			args["langFilter"], langRewrites = canonicalizeLangFilter(langFilter)
+			if len(langRewrites) > 0 {
+				logger.LogInfo(fmt.Sprintf("🔤 Canonicalized langFilter: '%s' → '%s'", langFilter, args["langFilter"]), "searchCode", map[string]interface{}{"aliases": langRewrites})
+			}
+		}
+
+		explain := ""
+		if v, _ := args["explain"].(bool); v {
+			explain = formatSearchExplain(args, langRewrites)
+		}
+		translate, _ := args["translateComments"].(bool)
+		if err := checkTranslationArg(translate); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
 		// Log search start
-		if logger := GetLogger(); logger != nil {
+		if logger := LoggerFromContext(ctx); logger != nil {
 			logger.LogSearchStart(query, args)
 		}
 
@@ -840,176 +2073,324 @@ func main() {
 			regexResult = validateRegexPattern(query)
 			if !regexResult.IsValid {
 				logger.LogErrorMsg(fmt.Sprintf("❌ Invalid regex pattern: %v", regexResult.Error), "searchCode", regexResult.Error, map[string]interface{}{"pattern": query})
-				return mcp.NewToolResultError(fmt.Sprintf("Invalid regex pattern: %v", regexResult.Error)), nil
+				return mcp.NewToolResultError(fmt.Sprintf("Invalid regex pattern: %v. Set autoEscape to true to search for it literally, or set useRegex to false.", regexResult.Error)), nil
 			}
 			logger.LogInfo("✅ Regex pattern validated successfully", "searchCode", map[string]interface{}{"pattern": query})
 		}
+		// Lines are re-checked client-side for regex and whole-word searches
+		wholeWords, _ := args["wholeWords"].(bool)
+		caseSensitive, _ := args["caseSensitive"].(bool)
+		lineFilter := buildLineFilter(query, useRegex, wholeWords, caseSensitive)
+		if lineFilter != nil && !lineFilter.IsValid {
+			logger.LogErrorMsg(fmt.Sprintf("❌ Invalid client-side filter: %v", lineFilter.Error), "searchCode", lineFilter.Error, map[string]interface{}{"pattern": lineFilter.Pattern})
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid regex pattern: %v", lineFilter.Error)), nil
+		}
 
-		start := time.Now()
-		page := 1
-		allHits := &Hits{}
-		totalCount := 0
-		apiRequests := 0
-
-		logger.LogInfo(fmt.Sprintf("📄 Beginning page-by-page search (max %d pages)", maxSearchPages), "searchCode", map[string]interface{}{"maxPages": maxSearchPages})
-
-		for {
-			logger.LogDebug(fmt.Sprintf("📖 Processing page %d", page), "searchCode", map[string]interface{}{"page": page})
-			results, err := fetchGrepAppPage(ctx, httpClient, args, page)
-			apiRequests++
+		if countOnly, _ := args["countOnly"].(bool); countOnly {
+			logger.LogInfo(fmt.Sprintf("🔢 Running count-only search for query: '%s'", query), "searchCode", map[string]interface{}{"query": query})
+			summary, err := countGrepApp(ctx, httpClient, args)
 			if err != nil {
-				logger.LogErrorMsg(fmt.Sprintf("❌ searchCode tool failed on page %d: %v", page, err), "searchCode", err, map[string]interface{}{"page": page})
-				
-				// Log search failure
-				if logger := GetLogger(); logger != nil {
-					searchData := SearchLogData{
-						Query:        query,
-						UseRegex:     useRegex,
-						Success:      false,
-						Error:        err.Error(),
-						Duration:     time.Since(start),
-						APIRequests:  apiRequests,
-						PagesScanned: page,
-					}
-					logger.LogSearchComplete(searchData)
+				logger.LogErrorMsg(fmt.Sprintf("❌ Count-only search failed: %v", err), "searchCode", err, nil)
+				if isCallTimeout(ctx, err) {
+					return mcp.NewToolResultError(fmt.Sprintf("count-only search timed out after %s", timeout)), nil
 				}
-				
 				return mcp.NewToolResultError(fmt.Sprintf("API fetch failed: %v", err)), nil
 			}
-
-			pageHits := &Hits{Hits: make(map[string]map[string]map[string]string)}
-			snippetErrors := 0
-
-			for _, hit := range results.Hits.Hits {
-				parsed, err := parseSnippet(hit.Content.Snippet)
+			logger.LogInfo(fmt.Sprintf("🔢 Count-only search found %d matches across %d pages", summary.TotalMatches, summary.TotalPages), "searchCode", map[string]interface{}{
+				"query":        query,
+				"count_only":   true,
+				"total":        summary.TotalMatches,
+				"pages":        summary.TotalPages,
+				"api_requests": summary.APIRequests,
+			})
+			if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+				resultBytes, err := json.MarshalIndent(summary, "", "  ")
 				if err != nil {
-					snippetErrors++
-					log.Printf("⚠️ Failed to parse snippet for repo %s/%s: %v", hit.Repo.Raw, hit.Path.Raw, err)
-					continue
-				}
-				if pageHits.Hits[hit.Repo.Raw] == nil {
-					pageHits.Hits[hit.Repo.Raw] = make(map[string]map[string]string)
-				}
-				if pageHits.Hits[hit.Repo.Raw][hit.Path.Raw] == nil {
-					pageHits.Hits[hit.Repo.Raw][hit.Path.Raw] = make(map[string]string)
-				}
-				for lineNum, line := range parsed {
-					pageHits.Hits[hit.Repo.Raw][hit.Path.Raw][lineNum] = line
+					return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
 				}
+				return withCacheFreshness(withQueryNotes(withExplain(mcp.NewToolResultText(string(resultBytes)), explain), queryNotes), summary.cachedAt), nil
 			}
+			return withCacheFreshness(withQueryNotes(withExplain(mcp.NewToolResultText(formatCountSummary(summary)), explain), queryNotes), summary.cachedAt), nil
+		}
 
-			if snippetErrors > 0 {
-				log.Printf("⚠️ Page %d had %d snippet parsing errors", page, snippetErrors)
-			}
+		start := time.Now()
+
+		pageLimit := maxPages
+		quickFirstPage, _ := args["quickFirstPage"].(bool)
+		if quickFirstPage {
+			pageLimit = 1
+		}
+		logger.LogInfo(fmt.Sprintf("📄 Beginning page-by-page search (max %d pages)", pageLimit), "searchCode", map[string]interface{}{"maxPages": pageLimit})
 
-			log.Printf("✅ Page %d processed: %d repositories found", page, len(pageHits.Hits))
+		scan, err := searchFlights.do(ctx, scanFlightKey(ctx, args, pageLimit), func() (*searchScan, error) {
+			if collectionRepos != nil {
+				return scanGrepAppCollection(ctx, httpClient, args, collectionRepos, pageLimit)
+			}
+			return scanGrepAppLanguages(ctx, httpClient, args, pageLimit)
+		})
+		if scan.Shared {
+			logger.LogInfo("🤝 Reused the scan of an identical concurrent search", "searchCode", map[string]interface{}{"query": query, "shared_scan": true})
+		}
+		// A failed grep.app search is retried with the configured fallback providers, which
+		// know nothing of collections
+		if len(GetConfig().Fallback) > 0 && collectionRepos == nil && countFiles(scan.Hits) == 0 && shouldFallBack(ctx, err) {
+			fallbackScan, fallbackErr := searchFallbackProviders(ctx, httpClient, githubClientFor(ctx, ghClient), args, pageLimit, err)
+			if fallbackErr != nil {
+				err = fmt.Errorf("%w; fallback failed: %v", err, fallbackErr)
+			} else {
+				logger.LogWarn(fmt.Sprintf("🔁 grep.app failed; results served by %s", fallbackScan.Provider), "searchCode", map[string]interface{}{
+					"query":    query,
+					"provider": fallbackScan.Provider,
+					"reason":   fallbackScan.FallbackReason,
+				})
+				scan, err = fallbackScan, nil
+			}
+		}
+		allHits := scan.Hits
+		totalCount := scan.TotalCount
+		apiRequests := scan.APIRequests
+		if skipped := scan.AvailablePages - scan.PagesScanned; skipped > 0 && err == nil {
+			logger.LogInfo(fmt.Sprintf("⏭️ Skipped %d of %d available pages beyond the %d-page limit", skipped, scan.AvailablePages, pageLimit), "searchCode", map[string]interface{}{
+				"query":           query,
+				"pages_fetched":   scan.PagesScanned,
+				"pages_available": scan.AvailablePages,
+				"pages_skipped":   skipped,
+				"max_pages":       pageLimit,
+			})
+		}
+		if scan.LineCollisions > 0 {
+			strategy, _ := parseMergeStrategy(args)
+			logger.LogInfo(fmt.Sprintf("🔀 %d lines arrived with different text from several pages or languages; resolved with %s", scan.LineCollisions, strategy), "searchCode", map[string]interface{}{
+				"line_collisions": scan.LineCollisions,
+				"merge_strategy":  string(strategy),
+			})
+		}
 
-			mergeHits(allHits, pageHits)
-			totalCount = results.Facets.Count
+		// A per-call deadline that expires after some pages arrived yields partial results
+		partial := false
+		if isCallTimeout(ctx, err) {
+			if len(allHits.Hits) > 0 {
+				logger.LogWarn(fmt.Sprintf("⏱️ Search timed out after %s; returning partial results from %d pages", timeout, scan.PagesScanned), "searchCode", map[string]interface{}{
+					"timeout_seconds": timeout.Seconds(),
+					"pages":           scan.PagesScanned,
+				})
+				partial = true
+				err = nil
+			} else {
+				err = fmt.Errorf("timed out after %s before any results were returned: %w", timeout, err)
+			}
+		}
+		// An exhausted API budget after some pages arrived also degrades to fewer pages
+		budgetLimited := false
+		if errors.Is(err, errBudgetExceeded) && len(allHits.Hits) > 0 {
+			logger.LogWarn(fmt.Sprintf("💸 API budget exhausted; returning results from %d pages", scan.PagesScanned), "searchCode", map[string]interface{}{
+				"pages": scan.PagesScanned,
+			})
+			budgetLimited = true
+			err = nil
+		}
+		// Any other failed page keeps the pages fetched before it rather than discarding them
+		if err != nil && len(allHits.Hits) > 0 && ctx.Err() == nil {
+			logger.LogWarn(fmt.Sprintf("⚠️ A result page failed after %d pages; returning partial results: %v", scan.PagesScanned, err), "searchCode", map[string]interface{}{
+				"pages": scan.PagesScanned,
+				"error": err.Error(),
+			})
+			scan.PageError = err.Error()
+			err = nil
+		}
+		pageFailed := scan.PageError != ""
+		cancelled := isCancelled(ctx, err)
+		if cancelled {
+			logger.LogWarn(fmt.Sprintf("🚫 searchCode cancelled by the client after %d pages", scan.PagesScanned), "searchCode", map[string]interface{}{
+				"query":     query,
+				"pages":     scan.PagesScanned,
+				"cancelled": true,
+			})
+		} else if err != nil {
+			logger.LogErrorMsg(fmt.Sprintf("❌ searchCode tool failed: %v", err), "searchCode", err, map[string]interface{}{"pages": scan.PagesScanned})
+		}
+		if err != nil {
 
-			log.Printf("📊 Total progress: %d repos collected, %d total results available", len(allHits.Hits), totalCount)
+			// Log search failure
+			if logger := LoggerFromContext(ctx); logger != nil {
+				searchData := SearchLogData{
+					Query:        query,
+					UseRegex:     useRegex,
+					Success:      false,
+					Error:        err.Error(),
+					Duration:     time.Since(start),
+					APIRequests:  apiRequests,
+					PagesScanned: scan.PagesScanned,
+					Cancelled:    cancelled,
+				}
+				logger.LogSearchComplete(searchData)
+			}
 
-			if page >= results.Facets.Pages || page >= maxSearchPages {
-				log.Printf("🏁 Search complete: reached page limit (page %d, max pages: %d, search limit: %d)", page, results.Facets.Pages, maxSearchPages)
-				break
+			if cancelled {
+				return mcp.NewToolResultError("search cancelled by the client"), nil
 			}
-			page++
+			return mcp.NewToolResultError(fmt.Sprintf("API fetch failed: %v", err)), nil
 		}
 
 		duration := time.Since(start)
 
+		// With quickFirstPage, an unfinished scan continues in the background and fills the complete cache
+		prefetching := false
+		if quickFirstPage && !scan.Complete && !partial && !pageFailed {
+			prefetching = startCompletePrefetch(httpClient, args, completeQuery)
+			if !prefetching {
+				log.Printf("⏳ Complete results for '%s' are already being fetched", query)
+			}
+		}
+		incomplete := quickFirstPage && !scan.Complete
+
+		var topicNote string // Set when topicFilter could not check some repositories
+
+		// decorate attaches the explain block and any upstream schema and timeout warnings to a result
+		decorate := func(result *mcp.CallToolResult) *mcp.CallToolResult {
+			recordSearchOutcome(ctx, totalCount, countFiles(allHits))
+			addScanWarnings(ctx, scan)
+			if partial {
+				addWarning(ctx, warnTimeout, fmt.Sprintf("timeoutSeconds (%s) expired after %d pages; results are partial", timeout, scan.PagesScanned))
+			} else if budgetLimited {
+				addWarning(ctx, warnBudgetExhausted, fmt.Sprintf("the API budget ran out after %d pages; results are partial", scan.PagesScanned))
+			} else if incomplete {
+				addWarning(ctx, warnFirstPageOnly, fmt.Sprintf("only the first page of %d matches was returned; the rest is being fetched in the background", totalCount))
+			}
+			result = withSchemaWarning(withQueryNotes(withExplain(result, explain), queryNotes), scan.SchemaIssues)
+			result = withCacheFreshness(result, scan.CachedAt)
+			if partial {
+				result = withTimeoutWarning(result, timeout, fmt.Sprintf("%d pages scanned before the deadline", scan.PagesScanned))
+			}
+			if pageFailed {
+				result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("⚠️ Fetching results failed after %d pages (%s); showing the results fetched before the failure.", scan.PagesScanned, scan.PageError)))
+			}
+			if budgetLimited {
+				result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("💸 The API budget ran out after %d pages; results are incomplete. Cached queries do not use the budget.", scan.PagesScanned)))
+			}
+			if topicNote != "" {
+				result.Content = append(result.Content, mcp.NewTextContent(topicNote))
+			}
+			if translate {
+				result = withCommentTranslations(ctx, httpClient, result, collectHitComments(allHits, maxTranslatedComments))
+			}
+			if incomplete {
+				result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("⏳ Showing the first page of %d matches; remaining pages are being fetched in the background. Repeat this search for complete results and final numbering before using batchRetrievalTool.", totalCount)))
+			}
+			return result
+		}
+
 		if len(allHits.Hits) == 0 {
 			log.Printf("📭 No results found for query '%s' after %v", query, duration)
 			
 			// Log zero results
-			if logger := GetLogger(); logger != nil {
-				filters := make(map[string]string)
-				if v, ok := args["repoFilter"].(string); ok && v != "" {
-					filters["repo"] = v
-				}
-				if v, ok := args["pathFilter"].(string); ok && v != "" {
-					filters["path"] = v
-				}
-				if v, ok := args["langFilter"].(string); ok && v != "" {
-					filters["lang"] = v
-				}
-				
-				caseSensitive, _ := args["caseSensitive"].(bool)
-				wholeWords, _ := args["wholeWords"].(bool)
-				
-				searchData := SearchLogData{
-					Query:         query,
-					UseRegex:      useRegex,
-					CaseSensitive: caseSensitive,
-					WholeWords:    wholeWords,
-					Filters:       filters,
-					ResultCount:   0,
-					FileCount:     0,
-					LineCount:     0,
-					Duration:      duration,
-					Success:       true,
-					APIRequests:   apiRequests,
-					PagesScanned:  page - 1,
-				}
-				logger.LogSearchComplete(searchData)
+			if logger := LoggerFromContext(ctx); logger != nil {
+				logger.LogSearchComplete(newSearchLogData(args, scan, duration))
 			}
+			clientSessions.recordSearch(clientSessionID(ctx), query, 0, time.Now())
 			
-			return mcp.NewToolResultText("No results found for your query."), nil
+			return decorate(mcp.NewToolResultText("No results found for your query.")), nil
 		}
 
-		// Apply regex filtering if enabled
-		if useRegex && regexResult != nil && regexResult.IsValid {
-			log.Printf("🔍 Applying client-side regex filtering")
+		// Client-side filters shrink allHits; the unfiltered set keeps defining result numbers
+		unfilteredHits := allHits
+
+		// Apply regex and whole-word filtering if enabled
+		if lineFilter != nil {
+			log.Printf("🔍 Applying client-side line filtering: %s", lineFilter.Pattern)
 			originalHits := len(allHits.Hits)
-			allHits = applyRegexFilter(allHits, regexResult)
-			log.Printf("🎯 Regex filtering complete: %d repos after filtering (was %d)", len(allHits.Hits), originalHits)
+			allHits, err = applyRegexFilter(ctx, allHits, lineFilter)
+			if err != nil {
+				logger.LogWarn(fmt.Sprintf("🚫 searchCode stopped during line filtering: %v", err), "searchCode", map[string]interface{}{"query": query, "cancelled": true})
+				if logger := LoggerFromContext(ctx); logger != nil {
+					searchData := newSearchLogData(args, scan, time.Since(start))
+					searchData.Success, searchData.Cancelled, searchData.Error = false, true, err.Error()
+					logger.LogSearchComplete(searchData)
+				}
+				return mcp.NewToolResultError(fmt.Sprintf("search stopped during line filtering: %v", err)), nil
+			}
+			log.Printf("🎯 Line filtering complete: %d repos after filtering (was %d)", len(allHits.Hits), originalHits)
 			
 			if len(allHits.Hits) == 0 {
-				log.Printf("📭 No results matched regex pattern after filtering")
+				log.Printf("📭 No results matched the line filter")
 				
 				// Log regex filtered zero results
-				if logger := GetLogger(); logger != nil {
-					filters := make(map[string]string)
-					if v, ok := args["repoFilter"].(string); ok && v != "" {
-						filters["repo"] = v
-					}
-					if v, ok := args["pathFilter"].(string); ok && v != "" {
-						filters["path"] = v
-					}
-					if v, ok := args["langFilter"].(string); ok && v != "" {
-						filters["lang"] = v
-					}
-					
-					caseSensitive, _ := args["caseSensitive"].(bool)
-					wholeWords, _ := args["wholeWords"].(bool)
-					
-					searchData := SearchLogData{
-						Query:         query,
-						UseRegex:      useRegex,
-						CaseSensitive: caseSensitive,
-						WholeWords:    wholeWords,
-						Filters:       filters,
-						ResultCount:   0,
-						FileCount:     0,
-						LineCount:     0,
-						Duration:      duration,
-						Success:       true,
-						APIRequests:   apiRequests,
-						PagesScanned:  page - 1,
-						RegexFiltered: true,
-					}
+				if logger := LoggerFromContext(ctx); logger != nil {
+					searchData := newSearchLogData(args, scan, duration)
+					searchData.RegexFiltered = true
 					logger.LogSearchComplete(searchData)
 				}
+				clientSessions.recordSearch(clientSessionID(ctx), query, 0, time.Now())
 				
-				return mcp.NewToolResultText("No results matched the regex pattern."), nil
+				if !useRegex {
+					return decorate(mcp.NewToolResultText("No results matched the query as a whole word.")), nil
+				}
+				return decorate(mcp.NewToolResultText("No results matched the regex pattern.")), nil
 			}
 		}
 
-	
+		// Drop files with too few matched lines if requested
+		if minMatches > 1 {
+			originalFiles := countFiles(allHits)
+			allHits = applyMinMatchesFilter(allHits, minMatches)
+			log.Printf("🎯 minMatchesPerFile=%d kept %d of %d files", minMatches, countFiles(allHits), originalFiles)
+
+			if len(allHits.Hits) == 0 {
+				if logger := LoggerFromContext(ctx); logger != nil {
+					searchData := newSearchLogData(args, scan, duration)
+					searchData.RegexFiltered = lineFilter != nil
+					logger.LogSearchComplete(searchData)
+				}
+				clientSessions.recordSearch(clientSessionID(ctx), query, 0, time.Now())
+				return decorate(mcp.NewToolResultText(fmt.Sprintf("No files had at least %d matched lines.", minMatches))), nil
+			}
+		}
+
+		// Drop files by path depth, file name or extension if requested
+		if pathPost != nil {
+			originalFiles := countFiles(allHits)
+			allHits = applyPathPostFilter(allHits, pathPost)
+			log.Printf("🎯 %s kept %d of %d files", pathPost.describe(), countFiles(allHits), originalFiles)
+
+			if len(allHits.Hits) == 0 {
+				if logger := LoggerFromContext(ctx); logger != nil {
+					searchData := newSearchLogData(args, scan, duration)
+					searchData.RegexFiltered = lineFilter != nil
+					logger.LogSearchComplete(searchData)
+				}
+				clientSessions.recordSearch(clientSessionID(ctx), query, 0, time.Now())
+				return decorate(mcp.NewToolResultText(fmt.Sprintf("No files matched the path filters (%s).", pathPost.describe()))), nil
+			}
+		}
+
+		// Drop repositories without the requested GitHub topics
+		if topics := parseTopicFilter(args); len(topics) > 0 {
+			originalRepos := len(allHits.Hits)
+			var unchecked []string
+			allHits, unchecked = applyTopicFilter(ctx, githubClientFor(ctx, ghClient), allHits, topics)
+			topicNote = topicFilterNote(unchecked)
+			if len(unchecked) > 0 {
+				addWarning(ctx, warnReposSkipped, fmt.Sprintf("topicFilter left out %d repositories whose topics could not be checked", len(unchecked)))
+			}
+			log.Printf("🏷️ topicFilter=%s kept %d of %d repositories (%d unchecked)", strings.Join(topics, ","), len(allHits.Hits), originalRepos, len(unchecked))
+
+			if len(allHits.Hits) == 0 {
+				if logger := LoggerFromContext(ctx); logger != nil {
+					searchData := newSearchLogData(args, scan, duration)
+					searchData.RegexFiltered = lineFilter != nil
+					logger.LogSearchComplete(searchData)
+				}
+				clientSessions.recordSearch(clientSessionID(ctx), query, 0, time.Now())
+				return decorate(mcp.NewToolResultText(fmt.Sprintf("No repositories were tagged with any of the topics: %s.", strings.Join(topics, ", ")))), nil
+			}
+		}
 
 		// Count final results
 		totalFiles := 0
 		totalLines := 0
+		if includeContext, _ := args["includeContext"].(bool); !includeContext {
+			allHits = allHits.withoutContext()
+		}
 		for _, repoData := range allHits.Hits {
 			for _, fileData := range repoData {
 				totalFiles++
@@ -1036,73 +2417,87 @@ func main() {
 		log.Printf("🎯 Search completed successfully in %v: %d repos, %d files, %d matched lines", duration, len(allHits.Hits), totalFiles, totalLines)
 
 		// Log successful search completion
-		if logger := GetLogger(); logger != nil {
-			filters := make(map[string]string)
-			if v, ok := args["repoFilter"].(string); ok && v != "" {
-				filters["repo"] = v
-			}
-			if v, ok := args["pathFilter"].(string); ok && v != "" {
-				filters["path"] = v
-			}
-			if v, ok := args["langFilter"].(string); ok && v != "" {
-				filters["lang"] = v
-			}
-			
-			caseSensitive, _ := args["caseSensitive"].(bool)
-			wholeWords, _ := args["wholeWords"].(bool)
-			
-			searchData := SearchLogData{
-				Query:         query,
-				UseRegex:      useRegex,
-				CaseSensitive: caseSensitive,
-				WholeWords:    wholeWords,
-				Filters:       filters,
-				ResultCount:   len(allHits.Hits),
-				FileCount:     totalFiles,
-				LineCount:     totalLines,
-				Duration:      duration,
-				Success:       true,
-				APIRequests:   apiRequests,
-				PagesScanned:  page - 1,
-				RegexFiltered: useRegex && regexResult != nil && regexResult.IsValid,
-			}
+		if logger := LoggerFromContext(ctx); logger != nil {
+			searchData := newSearchLogData(args, scan, duration)
+			searchData.ResultCount = len(allHits.Hits)
+			searchData.FileCount = totalFiles
+			searchData.LineCount = totalLines
+			searchData.RegexFiltered = lineFilter != nil
 			logger.LogSearchComplete(searchData)
 		}
+		clientSessions.recordSearch(clientSessionID(ctx), query, len(allHits.Hits), time.Now())
 
-		// Cache the complete result for batch retrieval
-		completeCacheKey := generateCacheKey(map[string]interface{}{"query": query, "complete": true})
-		fullRes := fullSearchResult{Hits: *allHits, Count: totalCount}
-		if err := cacheData(completeCacheKey, fullRes, query); err != nil {
-			log.Printf("⚠️ Failed to cache complete results: %v", err)
+		// Cache the complete result for batch retrieval; partial results would shift result numbers
+		if partial || budgetLimited || pageFailed {
+			log.Printf("⏭️ Skipping complete result cache for partial results")
+		} else if incomplete {
+			log.Printf("⏭️ Skipping complete result cache for first-page results (background prefetch: %t)", prefetching)
 		} else {
-			log.Printf("💾 Successfully cached complete results for future batch retrieval")
+			fullRes := fullSearchResult{Hits: *unfilteredHits, Count: totalCount}
+			if err := cacheData(completeCacheKey(completeQuery), fullRes, completeQuery, cacheEntryComplete); err != nil {
+				log.Printf("⚠️ Failed to cache complete results: %v", err)
+			} else {
+				log.Printf("💾 Successfully cached complete results for future batch retrieval")
+			}
 		}
 
 		// Format output
 		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
 			log.Printf("📤 Returning JSON output format")
-			jsonBytes, err := json.MarshalIndent(allHits.Hits, "", "  ")
+			var jsonText string
+			if includeMetadata, _ := args["includeMetadata"].(bool); includeMetadata {
+				meta := newSearchMetadata(scan, unfilteredHits, allHits, duration, time.Since(start))
+				jsonText, err = encodeHitsWithMetadata(allHits, meta, maxJSONOutputBytes)
+			} else {
+				keepJSONUnchanged(ctx) // Top-level keys are repositories
+				jsonText, err = encodeHitsJSON(allHits, maxJSONOutputBytes)
+			}
 			if err != nil {
-				log.Printf("❌ JSON marshaling failed: %v", err)
-				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal JSON: %v", err)), nil
+				log.Printf("❌ JSON encoding failed: %v", err)
+				return mcp.NewToolResultError(fmt.Sprintf("failed to encode JSON: %v", err)), nil
 			}
-			return mcp.NewToolResultText(string(jsonBytes)), nil
+			return decorate(mcp.NewToolResultText(jsonText)), nil
+		}
+		if treeOutput, _ := args["treeOutput"].(bool); treeOutput {
+			log.Printf("📤 Returning tree output format")
+			return decorate(mcp.NewToolResultText(formatResultsAsTree(allHits))), nil
 		}
 		if numberedOutput, _ := args["numberedOutput"].(bool); numberedOutput {
 			log.Printf("📤 Returning numbered list output format")
-			return mcp.NewToolResultText(formatResultsAsNumberedList(allHits)), nil
+			originalFiles := countFiles(unfilteredHits)
+			if originalFiles == totalFiles {
+				return decorate(mcp.NewToolResultText(formatResultsAsNumberedList(allHits))), nil
+			}
+			numbers := numberHits(unfilteredHits)
+			result := mcp.NewToolResultText(formatNumberedList(allHits, numbers))
+			result.Content = append(result.Content, mcp.NewTextContent(formatNumberMapping(allHits, numbers, originalFiles)))
+			return decorate(result), nil
 		}
 
 		log.Printf("📤 Returning formatted text output")
-		return mcp.NewToolResultText(formatResultsAsText(allHits)), nil
-	})
+		return decorate(mcp.NewToolResultText(formatResultsAsText(allHits))), nil
+	}))
 
 	// --- batchRetrievalTool ---
 	logger.LogInfo("🔧 Registering batchRetrievalTool", "server", nil)
 	batchRetrievalTool := mcp.NewTool("batchRetrievalTool",
-		mcp.WithDescription("Retrieve file contents for specified search results from a cached query."),
+		mcp.WithDescription("Retrieve file contents for specified search results from a cached query. Files are grouped by repository, with a per-repository summary of stars, ref and fetch counts. Each file carries its SHA-256; byte-identical files, common across forks, are shown once with the other locations listed under duplicates."),
 		mcp.WithString("query", mcp.Description("The original search query."), mcp.Required()),
 		mcp.WithArray("resultNumbers", mcp.Description("List of result numbers to retrieve.")),
+		mcp.WithArray("paths", mcp.Description("Additional files or directories to retrieve as 'owner/repo/path'. When given without resultNumbers, only these paths are retrieved.")),
+		mcp.WithString("ref", mcp.Description("Branch, tag or commit SHA to read every file at (default: the default branch, which may have changed since grep.app indexed it). Each file records the commit it was read from.")),
+		mcp.WithBoolean("recursive", mcp.Description("For directories, also fetch files beneath them (up to 64KB each) instead of only the listing.")),
+		mcp.WithBoolean("keepNotebookOutputs", mcp.Description("Keep Jupyter notebook cell outputs. By default outputs are stripped; kept outputs still have images and other binary data summarized.")),
+		mcp.WithNumber("maxDirectoryBytes", mcp.Description(fmt.Sprintf("Total size cap for files fetched recursively per directory (default %d).", defaultDirectoryBytes))),
+		mcp.WithString("cacheTTL", mcp.Description("Override the maximum age of the cached search results for this call, e.g. '1h'.")),
+		mcp.WithString("outputFormat",
+			mcp.Description("Output format: 'json' (default) for one JSON document, 'markdown' for concatenated files with headers, 'blocks' for one content block per file, or 'zip' for a base64 zip archive."+outputSchemaNote(outputSchemaBatch)),
+			mcp.Enum(batchOutputFormats...),
+		),
+		mcp.WithBoolean("retryFailedOnly", mcp.Description("Re-fetch only the files that failed in previous batch retrievals for this query, such as rate-limited requests, and return the new attempts. resultNumbers and paths are ignored.")),
+		mcp.WithBoolean("translateComments", mcp.Description("If true, append English translations of non-English comments found in the retrieved files. Needs a translation endpoint set with -translate-url.")),
+		mcp.WithNumber("contextLines", mcp.Description(fmt.Sprintf("If set, return only each file's matched lines from the cached search results plus this many lines around each, 0-%d. Omitted stretches are replaced by '⋯ lines X-Y omitted ⋯' markers and the kept ranges are listed under excerpt. Files without cached matches are returned whole.", maxContextLines))),
+		timeoutSecondsOption(),
 	)
 
 	s.AddTool(batchRetrievalTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -1112,42 +2507,59 @@ func main() {
 
 		start := time.Now()
 
-		query, ok := args["query"].(string)
-		if !ok || query == "" {
-			log.Printf("❌ batchRetrievalTool failed: missing query parameter")
-			return mcp.NewToolResultError("query parameter is required"), nil
+		batchOpts, err := parseBatchOptions(args)
+		if err != nil {
+			log.Printf("❌ batchRetrievalTool failed: %v", err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		query, resultNumbers, paths, cacheTTL, outputFormat, opts := batchOpts.Query, batchOpts.ResultNumbers, batchOpts.Paths, batchOpts.CacheTTL, batchOpts.OutputFormat, batchOpts.Retrieval
+		if err := checkTranslationArg(batchOpts.Translate); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
 		}
 
-		var resultNumbers []int
-		if nums, ok := args["resultNumbers"].([]interface{}); ok {
-			for _, n := range nums {
-				if numFloat, ok := n.(float64); ok {
-					resultNumbers = append(resultNumbers, int(numFloat))
-				}
-			}
+		ctx, cancel, timeout, err := withCallTimeout(ctx, args)
+		defer cancel()
+		if err != nil {
+			log.Printf("❌ batchRetrievalTool failed: %v", err)
+			return mcp.NewToolResultError(err.Error()), nil
 		}
 
 		// Log batch retrieval start
-		if logger := GetLogger(); logger != nil {
+		if logger := LoggerFromContext(ctx); logger != nil {
 			logger.LogBatchRetrievalStart(query, resultNumbers)
 		}
+		ctx, rateLimits := withRateLimitRecorder(ctx)
 
 		log.Printf("🔍 Retrieving files for query: '%s', result numbers: %v", query, resultNumbers)
 
-		result, err := batchRetrieveFiles(ctx, ghClient, query, resultNumbers)
+		var result *BatchRetrievalResult
+		retryNote := ""
+		if batchOpts.RetryFailedOnly {
+			var retried, recovered int
+			result, retried, recovered, err = retryFailedFiles(ctx, githubClientFor(ctx, ghClient), query, opts)
+			if err == nil && result.Success {
+				retryNote = fmt.Sprintf("🔁 Retried %d failed files: %d now succeeded.", retried, recovered)
+			}
+		} else {
+			result, err = batchRetrieveFiles(ctx, githubClientFor(ctx, ghClient), query, resultNumbers, paths, cacheTTL, opts)
+			if err == nil {
+				recordBatchOutcomes(ctx, query, result.Files)
+			}
+		}
 		duration := time.Since(start)
 		
 		if err != nil {
 			log.Printf("❌ batchRetrievalTool failed after %v: %v", duration, err)
 			
 			// Log batch retrieval failure
-			if logger := GetLogger(); logger != nil {
+			if logger := LoggerFromContext(ctx); logger != nil {
 				batchData := BatchRetrievalLogData{
 					Query:         query,
 					RequestedNums: resultNumbers,
 					Duration:      duration,
 					Success:       false,
 					Error:         err.Error(),
+					Cancelled:     isCancelled(ctx, err),
 				}
 				logger.LogBatchRetrievalComplete(batchData)
 			}
@@ -1167,7 +2579,7 @@ func main() {
 		}
 
 		// Log batch retrieval completion
-		if logger := GetLogger(); logger != nil {
+		if logger := LoggerFromContext(ctx); logger != nil {
 			batchData := BatchRetrievalLogData{
 				Query:         query,
 				RequestedNums: resultNumbers,
@@ -1177,9 +2589,13 @@ func main() {
 				Duration:      duration,
 				Success:       result.Success,
 				Error:         result.Error,
+				Cancelled:     isCancelled(ctx, ctx.Err()),
 			}
 			logger.LogBatchRetrievalComplete(batchData)
 		}
+		if isCancelled(ctx, ctx.Err()) {
+			log.Printf("🚫 batchRetrievalTool cancelled by the client after %v: %d of %d files retrieved", duration, successCount, len(result.Files))
+		}
 
 		if result.Success {
 			log.Printf("🎯 batchRetrievalTool completed successfully in %v: %d files retrieved, %d errors", duration, successCount, errorCount)
@@ -1187,33 +2603,1100 @@ func main() {
 			log.Printf("⚠️ batchRetrievalTool completed with errors in %v: %s", duration, result.Error)
 		}
 
-		resultBytes, err := json.MarshalIndent(result, "", "  ")
+		if len(result.Files) > 0 {
+			addFileLanguages(result.Files)
+			result.Files, result.Repos = groupFilesByRepo(result.Files)
+			addRepoDetails(ctx, githubClientFor(ctx, ghClient), result.Repos)
+			// groupFilesByRepo returned this request's own copy, so cached contents stay intact
+			auditAndRedactFiles(ctx, "batchRetrievalTool", result.Files)
+			if batchOpts.ContextLines > 0 {
+				excerptMatchedLines(result.Files, query, cacheTTL, batchOpts.ContextLines)
+			}
+			if truncated, omitted := limitFileSizes(result.Files, GetConfig().MaxFileBytes, GetConfig().MaxBatchBytes); truncated+omitted > 0 {
+				log.Printf("✂️ Size limits truncated %d files and omitted %d", truncated, omitted)
+			}
+		}
+		result.RateLimit = rateLimits.rateLimit()
+
+		addBatchWarnings(ctx, result)
+		if isCallTimeout(ctx, ctx.Err()) {
+			addWarning(ctx, warnTimeout, fmt.Sprintf("timeoutSeconds (%s) expired; %d of %d files were retrieved", timeout, successCount, len(result.Files)))
+		}
+		output, err := formatBatchResult(result, outputFormat)
+		if err != nil {
+			log.Printf("❌ Formatting batch results failed: %v", err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if retryNote != "" {
+			output.Content = append([]mcp.Content{mcp.NewTextContent(retryNote)}, output.Content...)
+		}
+		if batchOpts.Translate {
+			output = withCommentTranslations(ctx, httpClient, output, collectFileComments(result.Files, maxTranslatedComments))
+		}
+
+		log.Printf("📤 Returning batch retrieval results as %s", outputFormat)
+		if isCallTimeout(ctx, ctx.Err()) {
+			return withTimeoutWarning(output, timeout, fmt.Sprintf("%d of %d files retrieved before the deadline", successCount, len(result.Files))), nil
+		}
+		return output, nil
+	})
+
+	// --- expandRepo Tool ---
+	logger.LogInfo("🔧 Registering expandRepo tool", "server", nil)
+	expandRepoTool := mcp.NewTool("expandRepo",
+		mcp.WithDescription("Drill into one repository of a previous searchCode call: list all of its cached hits with their result numbers for batchRetrievalTool. With fetchMore, also search grep.app scoped to the repository to find hits beyond the original page limit."),
+		mcp.WithString("query", mcp.Description("The searchCode query whose results to expand."), mcp.Required()),
+		mcp.WithString("repo", mcp.Description("The repository to expand, e.g. 'golang/go' or its GitHub URL."), mcp.Required()),
+		mcp.WithBoolean("fetchMore", mcp.Description("If true, also run the search with repoFilter set to the repository. Newly found files have no result number; retrieve them through batchRetrievalTool paths.")),
+		mcp.WithBoolean("caseSensitive", mcp.Description("With fetchMore, the caseSensitive value used with searchCode.")),
+		mcp.WithBoolean("useRegex", mcp.Description("With fetchMore, the useRegex value used with searchCode.")),
+		mcp.WithBoolean("wholeWords", mcp.Description("With fetchMore, the wholeWords value used with searchCode.")),
+		mcp.WithString("pathFilter", mcp.Description("With fetchMore, the pathFilter used with searchCode.")),
+		mcp.WithString("langFilter", mcp.Description("With fetchMore, the langFilter used with searchCode.")),
+		mcp.WithNumber("maxPages", mcp.Description(fmt.Sprintf("With fetchMore, the maximum repo-scoped pages to fetch, 1-%d (default %d).", maxPagesLimit, GetConfig().MaxPages))),
+		mcp.WithString("cacheTTL", mcp.Description("Override the maximum age of the cached results, e.g. '2h'.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the files as JSON.")),
+	)
+
+	s.AddTool(expandRepoTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		query, _ := args["query"].(string)
+		repo, _ := args["repo"].(string)
+		if strings.TrimSpace(query) == "" || strings.TrimSpace(repo) == "" {
+			return mcp.NewToolResultError("query and repo must be non-empty strings"), nil
+		}
+		if _, err := parseCacheTTLArg(args); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if _, err := parseMaxPagesArg(args); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if langFilter, ok := args["langFilter"].(string); ok && langFilter != "" {
+			args = copyArgs(args)
+			args["langFilter"], _ = canonicalizeLangFilter(langFilter)
+		}
+
+		expansion, err := expandRepo(ctx, httpClient, args)
+		if err != nil {
+			logger.LogErrorMsg("❌ expandRepo failed", "expandRepo", err, map[string]interface{}{"query": query, "repo": repo})
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("📂 Expanded %s for '%s': %d files (%d newly fetched)", expansion.Repo, query, len(expansion.Files), expansion.FetchedFiles), "expandRepo", map[string]interface{}{
+			"query":         query,
+			"repo":          expansion.Repo,
+			"files":         len(expansion.Files),
+			"fetched_files": expansion.FetchedFiles,
+			"pages":         expansion.PagesFetched,
+		})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(expansion, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatRepoExpansion(expansion)), nil
+	})
+
+	// --- listDirectory Tool ---
+	logger.LogInfo("🔧 Registering listDirectory tool", "server", nil)
+	listDirectoryTool := mcp.NewTool("listDirectory",
+		mcp.WithDescription("List a GitHub repository directory through the Git Trees API, which handles directories with more than 1000 entries. Long listings are paged with offset and limit; recursive listings GitHub truncates report the subdirectories to list separately."),
+		mcp.WithString("repo", mcp.Description("The repository as owner/repo."), mcp.Required()),
+		mcp.WithString("path", mcp.Description("Directory path within the repository; empty lists the root.")),
+		mcp.WithString("ref", mcp.Description("Branch, tag or commit SHA to list (default: the default branch).")),
+		mcp.WithBoolean("recursive", mcp.Description("If true, list every entry below the directory.")),
+		mcp.WithNumber("offset", mcp.Description("Index of the first entry to return, from next_offset of a previous call.")),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum entries to return (default %d, max %d).", defaultListLimit, maxListLimit))),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the listing as a JSON object.")),
+		timeoutSecondsOption(),
+	)
+
+	s.AddTool(listDirectoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		repoArg, _ := args["repo"].(string)
+		owner, repo, _ := strings.Cut(canonicalRepo(repoArg), "/")
+		if err := validateOwner(owner); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := validateRepoName(repo); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		rawPath, _ := args["path"].(string)
+		dirPath, err := canonicalFilePath(rawPath)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ref, _ := args["ref"].(string)
+		recursive, _ := args["recursive"].(bool)
+		offset, limit := 0, defaultListLimit
+		if v, ok := args["offset"].(float64); ok {
+			if v < 0 {
+				return mcp.NewToolResultError("offset must not be negative"), nil
+			}
+			offset = int(v)
+		}
+		if v, ok := args["limit"].(float64); ok {
+			if v < 1 || v > maxListLimit {
+				return mcp.NewToolResultError(fmt.Sprintf("limit must be between 1 and %d", maxListLimit)), nil
+			}
+			limit = int(v)
+		}
+
+		ctx, cancel, _, err := withCallTimeout(ctx, args)
+		defer cancel()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		listing, err := listDirectoryTree(ctx, githubClientFor(ctx, ghClient), owner, repo, dirPath, ref, recursive)
+		if err != nil {
+			logger.LogErrorMsg("❌ listDirectory failed", "listDirectory", err, map[string]interface{}{"repo": repoArg, "path": dirPath})
+			return mcp.NewToolResultError(fmt.Sprintf("failed to list directory: %v", err)), nil
+		}
+		listing.page(offset, limit)
+		if listing.Truncated {
+			addWarning(ctx, warnResultsTruncated, fmt.Sprintf("GitHub truncated the recursive listing; list the %d paths in continue_paths separately", len(listing.ContinuePaths)))
+		}
+		logger.LogInfo(fmt.Sprintf("📂 listDirectory returned %d of %d entries for %s/%s", len(listing.Entries), listing.Total, repoArg, dirPath), "listDirectory", map[string]interface{}{
+			"repo":      repoArg,
+			"path":      dirPath,
+			"recursive": recursive,
+			"total":     listing.Total,
+			"truncated": listing.Truncated,
+		})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(listing, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatDirectoryTree(listing)), nil
+	})
+
+	// --- fetchFile Tool ---
+	logger.LogInfo("🔧 Registering fetchFile tool", "server", nil)
+	fetchFileTool := mcp.NewTool("fetchFile",
+		mcp.WithDescription("Retrieve one file from a GitHub repository directly, without a previous search, for example to follow an import found in a retrieved file. A directory path returns its listing. Files are cached like batchRetrievalTool files."),
+		mcp.WithString("repo", mcp.Description("The repository as owner/repo or its GitHub URL."), mcp.Required()),
+		mcp.WithString("path", mcp.Description("The file path within the repository."), mcp.Required()),
+		mcp.WithString("ref", mcp.Description("Branch, tag or commit SHA to read the file at (default: the default branch).")),
+		mcp.WithBoolean("keepNotebookOutputs", mcp.Description("Keep Jupyter notebook cell outputs. By default outputs are stripped.")),
+		mcp.WithString("cacheTTL", mcp.Description("Override the maximum age of a cached copy of the file, e.g. '10m'.")),
+		mcp.WithBoolean("forceRefresh", mcp.Description("If true, ignore a cached copy and fetch the file from GitHub again.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the file as a JSON object.")),
+		timeoutSecondsOption(),
+	)
+
+	s.AddTool(fetchFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		start := time.Now()
+		repoArg, err := argString(args, "repo")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		pathArg, err := argString(args, "path")
 		if err != nil {
-			log.Printf("❌ JSON marshaling failed: %v", err)
-			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		fileRequest, err := sanitizeFileRequest(repoArg, pathArg)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if fileRequest.Path == "" {
+			return mcp.NewToolResultError("path must name a file; use listDirectory for the repository root"), nil
+		}
+		opts, err := parseRetrievalOptions(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		fileRequest.Ref = opts.Ref
+		cacheTTL, err := parseCacheTTLArg(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		ctx, cancel, _, err := withCallTimeout(ctx, args)
+		defer cancel()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
 		}
 
-		log.Printf("📤 Returning batch retrieval results")
-		return mcp.NewToolResultText(string(resultBytes)), nil
+		file, cached := fetchSingleFile(ctx, githubClientFor(ctx, ghClient), fileRequest, cacheTTL, opts)
+		location := fmt.Sprintf("%s/%s", file.Repo, file.Path)
+		if file.Error != "" {
+			auditRetrievals(ctx, "fetchFile", []RetrievedFile{file})
+			logger.LogErrorMsg("❌ fetchFile failed", "fetchFile", fmt.Errorf("%s", file.Error), map[string]interface{}{"file": location, "ref": fileRequest.Ref})
+			return mcp.NewToolResultError(fmt.Sprintf("failed to fetch %s: %s", location, file.Error)), nil
+		}
+		files := []RetrievedFile{file}
+		addFileLanguages(files)
+		auditAndRedactFiles(ctx, "fetchFile", files)
+		limitFileSizes(files, GetConfig().MaxFileBytes, 0)
+		file = files[0]
+		logger.LogInfo(fmt.Sprintf("📄 fetchFile returned %s in %v", location, time.Since(start)), "fetchFile", map[string]interface{}{
+			"file":        location,
+			"ref":         fileRequest.Ref,
+			"type":        file.Type,
+			"bytes":       len(file.Content),
+			"cached":      cached,
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(file, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatFetchedFile(file, cached)), nil
 	})
 
+	// --- compareLocal Tool ---
+	logger.LogInfo("🔧 Registering compareLocal tool", "server", nil)
+	compareLocalTool := mcp.NewTool("compareLocal",
+		mcp.WithDescription("Compare upstream files from a cached search with a local file or directory, for example to check a port or how far a fork has drifted. Reports how similar each upstream file is, lines most upstream files share that the local code lacks, local lines no upstream file has, and a unified diff against the closest upstream file. In a directory, upstream files are compared with the local file of the same name."),
+		mcp.WithString("query", mcp.Description("The searchCode query whose results to compare with."), mcp.Required()),
+		mcp.WithArray("resultNumbers", mcp.Description(fmt.Sprintf("Result numbers of the upstream files to compare (default: the first %d).", maxCompareFiles))),
+		mcp.WithString("localPath", mcp.Description("A local file or directory, absolute or relative to the directory set with -workspace-root. Only available when the server has one.")),
+		mcp.WithString("localContent", mcp.Description("The local file's content, instead of localPath.")),
+		mcp.WithString("localName", mcp.Description("With localContent, the file name shown in the report (default 'local').")),
+		mcp.WithString("ref", mcp.Description("Branch, tag or commit SHA to read the upstream files at (default: the default branch).")),
+		mcp.WithString("cacheTTL", mcp.Description("Override the maximum age of the cached search results, e.g. '1h'.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the comparison as JSON.")),
+		timeoutSecondsOption(),
+	)
+
+	s.AddTool(compareLocalTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		start := time.Now()
+		query, err := argString(args, "query")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if strings.TrimSpace(query) == "" {
+			return mcp.NewToolResultError("query parameter is required"), nil
+		}
+		resultNumbers, err := parseResultNumbers(args["resultNumbers"])
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if len(resultNumbers) == 0 {
+			for n := 1; n <= maxCompareFiles; n++ {
+				resultNumbers = append(resultNumbers, n)
+			}
+		}
+		localPath, err := argString(args, "localPath")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		localContent, err := argString(args, "localContent")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		localName, err := argString(args, "localName")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if (localPath == "") == (localContent == "") {
+			return mcp.NewToolResultError("pass exactly one of localPath and localContent"), nil
+		}
+		opts, err := parseRetrievalOptions(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		cacheTTL, err := parseCacheTTLArg(args)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		var local []localFile
+		if localPath != "" {
+			if local, err = loadLocalFiles(GetConfig().WorkspaceRoot, localPath); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		} else {
+			if localName == "" {
+				localName = "local"
+			}
+			local = []localFile{{Path: localName, Content: localContent}}
+		}
+
+		ctx, cancel, _, err := withCallTimeout(ctx, args)
+		defer cancel()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		result, err := batchRetrieveFiles(ctx, githubClientFor(ctx, ghClient), query, resultNumbers, nil, cacheTTL, opts)
+		if err != nil {
+			logger.LogErrorMsg("❌ compareLocal failed", "compareLocal", err, map[string]interface{}{"query": query})
+			return mcp.NewToolResultError(fmt.Sprintf("comparison failed: %v", err)), nil
+		}
+		if !result.Success {
+			return mcp.NewToolResultError(result.Error), nil
+		}
+		hashFiles(result.Files)
+		auditRetrievals(ctx, "compareLocal", result.Files)
+
+		report := buildLocalComparison(query, local, result.Files)
+		logger.LogInfo(fmt.Sprintf("🔀 compareLocal compared %d local files with %d upstream files in %v", len(local), len(result.Files), time.Since(start)), "compareLocal", map[string]interface{}{
+			"query":       query,
+			"local_files": len(local),
+			"upstream":    len(result.Files),
+			"compared":    len(report.Comparisons),
+			"unpaired":    len(report.Unpaired),
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+		if len(report.Comparisons) == 0 {
+			return mcp.NewToolResultText("No upstream file could be paired with a local file.\n\n" + formatLocalComparison(report)), nil
+		}
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatLocalComparison(report)), nil
+	})
+
+	// --- recentSearches Tool ---
+	logger.LogInfo("🔧 Registering recentSearches tool", "server", nil)
+	recentSearchesTool := mcp.NewTool("recentSearches",
+		mcp.WithDescription("List the most recent distinct searchCode queries across all sessions, with timestamps, result counts and whether complete results are still cached for batch retrieval."),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of queries to return (default %d, max %d).", defaultRecentSearches, maxRecentSearches))),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return results as a JSON array.")),
+	)
+
+	s.AddTool(recentSearchesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		limit := defaultRecentSearches
+		if v, ok := args["limit"].(float64); ok && v > 0 {
+			limit = int(v)
+		}
+		if limit > maxRecentSearches {
+			limit = maxRecentSearches
+		}
+
+		searches, err := listRecentSearches(logger.logDir, limit)
+		if err != nil {
+			logger.LogErrorMsg("❌ recentSearches failed", "recentSearches", err, nil)
+			return mcp.NewToolResultError(fmt.Sprintf("failed to read search history: %v", err)), nil
+		}
+		logger.LogInfo(fmt.Sprintf("📜 recentSearches returned %d queries", len(searches)), "recentSearches", map[string]interface{}{"limit": limit})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(searches, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatRecentSearches(searches)), nil
+	})
+
+	// --- suggestQueries Tool ---
+	logger.LogInfo("🔧 Registering suggestQueries tool", "server", nil)
+	suggestQueriesTool := mcp.NewTool("suggestQueries",
+		mcp.WithDescription("Suggest alternative searchCode queries for a query that returned no results, based on follow-up queries that succeeded in past sessions. Uses the knowledge base exported by the log analyzer."),
+		mcp.WithString("query", mcp.Description("The query that returned no or poor results."), mcp.Required()),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of suggestions (default %d, max %d).", defaultSuggestions, maxSuggestions))),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return suggestions as a JSON array.")),
+	)
+
+	s.AddTool(suggestQueriesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		query, _ := args["query"].(string)
+		if strings.TrimSpace(query) == "" {
+			return mcp.NewToolResultError("query must be a non-empty string"), nil
+		}
+		limit := defaultSuggestions
+		if v, ok := args["limit"].(float64); ok && v > 0 {
+			limit = int(v)
+		}
+		if limit > maxSuggestions {
+			limit = maxSuggestions
+		}
+
+		path := knowledgeBaseFile()
+		kb, err := loadKnowledgeBase(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return mcp.NewToolResultText(fmt.Sprintf("No recovery knowledge base found at %s. Export one with the analyzer's -export-kb option.", path)), nil
+		}
+		if err != nil {
+			logger.LogErrorMsg("❌ suggestQueries failed to load knowledge base", "suggestQueries", err, map[string]interface{}{"file": path})
+			return mcp.NewToolResultError(fmt.Sprintf("failed to load knowledge base: %v", err)), nil
+		}
+
+		suggestions := kb.suggest(query, limit)
+		logger.LogInfo(fmt.Sprintf("💡 suggestQueries returned %d suggestions", len(suggestions)), "suggestQueries", map[string]interface{}{
+			"query":       query,
+			"suggestions": len(suggestions),
+		})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(suggestions, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatQuerySuggestions(query, suggestions)), nil
+	})
+
+	// --- exportSnapshot Tool ---
+	logger.LogInfo("🔧 Registering exportSnapshot tool", "server", nil)
+	exportSnapshotTool := mcp.NewTool("exportSnapshot",
+		mcp.WithDescription("Export a search as a zip snapshot containing the query, its filters, the complete numbered results with GitHub permalinks, and optionally the contents of selected files. Import it with importSnapshot on another server to share an investigation."),
+		mcp.WithString("query", mcp.Description("A query whose complete results are cached by a previous searchCode call."), mcp.Required()),
+		mcp.WithArray("resultNumbers", mcp.Description("Result numbers whose file contents are fetched and bundled in the snapshot.")),
+		timeoutSecondsOption(),
+	)
+
+	s.AddTool(exportSnapshotTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		query, _ := args["query"].(string)
+		if strings.TrimSpace(query) == "" {
+			return mcp.NewToolResultError("query must be a non-empty string"), nil
+		}
+		resultNumbers, err := parseResultNumbers(args["resultNumbers"])
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		ctx, cancel, _, err := withCallTimeout(ctx, args)
+		defer cancel()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		var retrieved []RetrievedFile
+		if len(resultNumbers) > 0 {
+			result, err := batchRetrieveFiles(ctx, githubClientFor(ctx, ghClient), query, resultNumbers, nil, 0, retrievalOptions{MaxDirectoryBytes: defaultDirectoryBytes})
+			if err != nil {
+				logger.LogErrorMsg("❌ exportSnapshot failed to retrieve files", "exportSnapshot", err, map[string]interface{}{"query": query})
+				return mcp.NewToolResultError(fmt.Sprintf("failed to retrieve files: %v", err)), nil
+			}
+			if !result.Success && len(result.Files) == 0 {
+				return mcp.NewToolResultError(result.Error), nil
+			}
+			retrieved = result.Files
+			auditRetrievals(ctx, "exportSnapshot", retrieved)
+			redactFiles(ctx, retrieved)
+		}
+
+		// The archive is a blob tenantMiddleware cannot redact, so matched lines are masked here
+		tenant := tenantFromContext(ctx)
+		archive, manifest, err := buildSnapshot(query, latestSearchFilters(logger.logDir, query), retrieved, tenant != nil && tenant.RedactSecrets)
+		if err != nil {
+			logger.LogErrorMsg("❌ exportSnapshot failed", "exportSnapshot", err, map[string]interface{}{"query": query})
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("📦 Exported snapshot for '%s' (%d bytes)", query, len(archive)), "exportSnapshot", map[string]interface{}{
+			"query":   query,
+			"results": len(manifest.Results),
+			"files":   len(manifest.Files),
+			"bytes":   len(archive),
+		})
+		return snapshotToolResult(manifest, archive), nil
+	})
+
+	// --- importSnapshot Tool ---
+	logger.LogInfo("🔧 Registering importSnapshot tool", "server", nil)
+	importSnapshotTool := mcp.NewTool("importSnapshot",
+		mcp.WithDescription("Import a snapshot created by exportSnapshot. Its complete results are cached so batchRetrievalTool works with the original result numbers, and bundled files are returned."),
+		mcp.WithString("archive", mcp.Description("The base64-encoded snapshot zip archive."), mcp.Required()),
+		mcp.WithBoolean("overwrite", mcp.Description("Replace results already cached for the same query.")),
+		mcp.WithBoolean("includeFiles", mcp.Description("If true, return the bundled file contents as JSON in addition to the summary.")),
+	)
+
+	s.AddTool(importSnapshotTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		encoded, _ := args["archive"].(string)
+		archive, err := decodeSnapshotArchive(encoded)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		overwrite, _ := args["overwrite"].(bool)
+
+		manifest, files, err := importSnapshot(ctx, archive, overwrite)
+		if err != nil {
+			logger.LogErrorMsg("❌ importSnapshot failed", "importSnapshot", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("📥 Imported snapshot for '%s'", manifest.Query), "importSnapshot", map[string]interface{}{
+			"query":   manifest.Query,
+			"results": len(manifest.Results),
+			"files":   len(files),
+		})
+
+		note := "\nResults are cached; use batchRetrievalTool with the same query and result numbers."
+		if ttl := cacheTTLFor(cacheEntryComplete, 0); time.Since(manifest.CachedAt) > ttl {
+			note = fmt.Sprintf("\nResults are older than the %s complete-result TTL; pass a cacheTTL longer than their age to batchRetrievalTool to use them.", formatAge(ttl))
+		}
+		result := withCacheFreshness(mcp.NewToolResultText(formatSnapshotSummary("Imported", manifest, 0)+note), manifest.CachedAt)
+		if includeFiles, _ := args["includeFiles"].(bool); includeFiles && len(files) > 0 {
+			addFileLanguages(files)
+			filesBytes, err := json.MarshalIndent(BatchRetrievalResult{SchemaVersion: outputSchemaVersion, Success: true, Files: files}, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal files: %v", err)), nil
+			}
+			result.Content = append(result.Content, mcp.NewTextContent(string(filesBytes)))
+		}
+		return result, nil
+	})
+
+	// --- savePattern Tool ---
+	logger.LogInfo("🔧 Registering savePattern tool", "server", nil)
+	savePatternTool := mcp.NewTool("savePattern",
+		mcp.WithDescription("Save a named set of searchCode arguments to the pattern library: a search to rerun, a template whose query is completed when used, or a security check preset. A pattern with the same name is replaced."),
+		mcp.WithString("name", mcp.Description("Unique name of the pattern."), mcp.Required()),
+		mcp.WithString("kind", mcp.Description("Kind of pattern (default search)."), mcp.Enum(patternKinds...)),
+		mcp.WithString("description", mcp.Description("What the pattern finds and how to read its results.")),
+		mcp.WithObject("arguments", mcp.Description("The searchCode arguments, e.g. {\"query\": \"password\\\\s*=\", \"useRegex\": true}. query is required."), mcp.Required()),
+		mcp.WithArray("tags", mcp.Description("Tags for finding the pattern later.")),
+	)
+
+	s.AddTool(savePatternTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		pattern := SearchPattern{}
+		var err error
+		for name, target := range map[string]*string{"name": &pattern.Name, "kind": &pattern.Kind, "description": &pattern.Description} {
+			if *target, err = argString(args, name); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		if pattern.Tags, err = argStrings(args, "tags"); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		arguments, ok := args["arguments"].(map[string]interface{})
+		if !ok {
+			return mcp.NewToolResultError("arguments must be an object of searchCode arguments"), nil
+		}
+		pattern.Arguments = arguments
+		if err := savePattern(pattern); err != nil {
+			logger.LogErrorMsg("❌ savePattern failed", "savePattern", err, map[string]interface{}{"name": pattern.Name})
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("🔖 Saved pattern '%s'", pattern.Name), "savePattern", map[string]interface{}{"name": pattern.Name, "kind": pattern.Kind})
+		return mcp.NewToolResultText(fmt.Sprintf("🔖 Saved pattern '%s'. Run it by passing its arguments to searchCode, or share it with exportPatterns.", pattern.Name)), nil
+	})
+
+	// --- listPatterns Tool ---
+	logger.LogInfo("🔧 Registering listPatterns tool", "server", nil)
+	listPatternsTool := mcp.NewTool("listPatterns",
+		mcp.WithDescription("List the saved searches, templates and security presets in the pattern library with their searchCode arguments."),
+		mcp.WithString("kind", mcp.Description("Only list patterns of this kind."), mcp.Enum(patternKinds...)),
+		mcp.WithString("delete", mcp.Description("Name of a pattern to delete before listing.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the patterns as a JSON array.")),
+	)
+
+	s.AddTool(listPatternsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		kind, err := argString(args, "kind")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if name, _ := args["delete"].(string); name != "" {
+			if err := deletePattern(name); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			logger.LogInfo(fmt.Sprintf("🗑️ Deleted pattern '%s'", name), "listPatterns", map[string]interface{}{"name": name})
+		}
+		patterns, err := listPatterns(kind)
+		if err != nil {
+			logger.LogErrorMsg("❌ listPatterns failed", "listPatterns", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			encoded, err := json.MarshalIndent(patterns, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal patterns: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(encoded)), nil
+		}
+		return mcp.NewToolResultText(formatPatternList(patterns)), nil
+	})
+
+	// --- exportPatterns Tool ---
+	logger.LogInfo("🔧 Registering exportPatterns tool", "server", nil)
+	exportPatternsTool := mcp.NewTool("exportPatterns",
+		mcp.WithDescription("Export patterns from the library as a JSON bundle signed with this server's Ed25519 key. Import it with importPatterns on another server to share a curated pattern library."),
+		mcp.WithArray("names", mcp.Description("Names of the patterns to export. By default every pattern, or every pattern of kind, is exported.")),
+		mcp.WithString("kind", mcp.Description("Export only patterns of this kind."), mcp.Enum(patternKinds...)),
+		mcp.WithString("publisher", mcp.Description("Name of the team or person publishing the bundle, shown when it is imported.")),
+	)
+
+	s.AddTool(exportPatternsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		names, err := argStrings(args, "names")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		kind, _ := args["kind"].(string)
+		publisher, _ := args["publisher"].(string)
+		bundle, err := exportPatternBundle(names, kind, publisher)
+		if err != nil {
+			logger.LogErrorMsg("❌ exportPatterns failed", "exportPatterns", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		encoded, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal bundle: %v", err)), nil
+		}
+		logger.LogInfo(fmt.Sprintf("📤 Exported pattern bundle (%d bytes)", len(encoded)), "exportPatterns", map[string]interface{}{"public_key": bundle.PublicKey, "bytes": len(encoded)})
+		return mcp.NewToolResultText(string(encoded)), nil
+	})
+
+	// --- importPatterns Tool ---
+	logger.LogInfo("🔧 Registering importPatterns tool", "server", nil)
+	importPatternsTool := mcp.NewTool("importPatterns",
+		mcp.WithDescription("Import a signed pattern bundle created by exportPatterns. The signature is verified, and bundles signed by keys other than this server's or the -trusted-pattern-keys are refused unless allowUntrusted is set."),
+		mcp.WithString("bundle", mcp.Description("The JSON bundle returned by exportPatterns."), mcp.Required()),
+		mcp.WithBoolean("overwrite", mcp.Description("Replace patterns of the same name already in the library.")),
+		mcp.WithBoolean("allowUntrusted", mcp.Description("Import a bundle whose signature is valid but made with an unknown key.")),
+	)
+
+	s.AddTool(importPatternsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		bundle, _ := args["bundle"].(string)
+		overwrite, _ := args["overwrite"].(bool)
+		allowUntrusted, _ := args["allowUntrusted"].(bool)
+		result, err := importPatternBundle(bundle, overwrite, allowUntrusted)
+		if err != nil {
+			logger.LogErrorMsg("❌ importPatterns failed", "importPatterns", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("📥 Imported %d patterns from %s", len(result.Added)+len(result.Replaced), result.PublicKey), "importPatterns", map[string]interface{}{
+			"publisher": result.Publisher,
+			"trusted":   result.Trusted,
+			"added":     len(result.Added),
+			"replaced":  len(result.Replaced),
+			"skipped":   len(result.Skipped),
+		})
+		encoded, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to marshal import result: %v", err)), nil
+		}
+		return mcp.NewToolResultText(string(encoded)), nil
+	})
+
+	// --- saveCollection Tool ---
+	logger.LogInfo("🔧 Registering saveCollection tool", "server", nil)
+	saveCollectionTool := mcp.NewTool("saveCollection",
+		mcp.WithDescription("Save a named collection of repositories, such as CNCF projects or an organization's open source repositories, that searchCode searches as one with its collection argument. A collection with the same name is replaced. Collections saved with a tenant API key are visible only to that tenant."),
+		mcp.WithString("name", mcp.Description("Name of the collection, e.g. 'cncf'. Names are matched case-insensitively."), mcp.Required()),
+		mcp.WithArray("repos", mcp.Description(fmt.Sprintf("Repositories in the collection as owner/name or URLs, at most %d.", maxCollectionRepos)), mcp.Required()),
+		mcp.WithString("description", mcp.Description("What the collection holds.")),
+	)
+
+	s.AddTool(saveCollectionTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		collection := Collection{}
+		var err error
+		for name, target := range map[string]*string{"name": &collection.Name, "description": &collection.Description} {
+			if *target, err = argString(args, name); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		if collection.Repos, err = argStrings(args, "repos"); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		collection, err = saveCollection(ctx, collection)
+		if err != nil {
+			logger.LogErrorMsg("❌ saveCollection failed", "saveCollection", err, map[string]interface{}{"name": collection.Name})
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("📚 Saved collection '%s' of %d repositories", collection.Name, len(collection.Repos)), "saveCollection", map[string]interface{}{"name": collection.Name, "repos": len(collection.Repos)})
+		return mcp.NewToolResultText(fmt.Sprintf("📚 Saved collection '%s' of %d repositories. Search it by passing collection: %q to searchCode.", collection.Name, len(collection.Repos), collection.Name)), nil
+	})
+
+	// --- listCollections Tool ---
+	logger.LogInfo("🔧 Registering listCollections tool", "server", nil)
+	listCollectionsTool := mcp.NewTool("listCollections",
+		mcp.WithDescription("List the repository collections searchCode's collection argument accepts, with their repositories."),
+		mcp.WithString("delete", mcp.Description("Name of a collection to delete before listing.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the collections as a JSON array.")),
+	)
+
+	s.AddTool(listCollectionsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		if name, _ := args["delete"].(string); name != "" {
+			if err := deleteCollection(ctx, name); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			logger.LogInfo(fmt.Sprintf("🗑️ Deleted collection '%s'", name), "listCollections", map[string]interface{}{"name": name})
+		}
+		collections, err := listCollections(ctx)
+		if err != nil {
+			logger.LogErrorMsg("❌ listCollections failed", "listCollections", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			encoded, err := json.MarshalIndent(collections, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal collections: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(encoded)), nil
+		}
+		return mcp.NewToolResultText(formatCollections(collections)), nil
+	})
+
+	// --- debugCache Tool ---
+	logger.LogInfo("🔧 Registering debugCache tool", "server", nil)
+	debugCacheTool := mcp.NewTool("debugCache",
+		mcp.WithDescription("List the cache entries stored for a query with their keys, pages, ages and sizes, and flag inconsistencies such as cached pages without a complete entry. Use it when batchRetrievalTool reports no cached results."),
+		mcp.WithString("query", mcp.Description("The searchCode query to inspect."), mcp.Required()),
+		mcp.WithBoolean("caseSensitive", mcp.Description("The caseSensitive value used with searchCode.")),
+		mcp.WithBoolean("useRegex", mcp.Description("The useRegex value used with searchCode.")),
+		mcp.WithBoolean("wholeWords", mcp.Description("The wholeWords value used with searchCode.")),
+		mcp.WithString("repoFilter", mcp.Description("The repoFilter used with searchCode.")),
+		mcp.WithString("pathFilter", mcp.Description("The pathFilter used with searchCode.")),
+		mcp.WithString("langFilter", mcp.Description("The langFilter used with searchCode, for a single language.")),
+		mcp.WithString("cacheTTL", mcp.Description("Judge expiry against this TTL instead of the configured one, e.g. '2h'.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the report as JSON.")),
+	)
+
+	s.AddTool(debugCacheTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		query, _ := args["query"].(string)
+		if strings.TrimSpace(query) == "" {
+			return mcp.NewToolResultError("query must be a non-empty string"), nil
+		}
+		if _, err := parseCacheTTLArg(args); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if langFilter, ok := args["langFilter"].(string); ok && langFilter != "" {
+			args = copyArgs(args)
+			args["langFilter"], _ = canonicalizeLangFilter(langFilter)
+		}
+		if repoFilter, ok := args["repoFilter"].(string); ok && repoFilter != "" {
+			args = copyArgs(args)
+			args["repoFilter"] = canonicalRepo(repoFilter)
+		}
+
+		report, err := debugCacheEntries(args)
+		if err != nil {
+			logger.LogErrorMsg("❌ debugCache failed", "debugCache", err, map[string]interface{}{"query": query})
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("🩺 debugCache found %d entries and %d issues for '%s'", len(report.Entries), len(report.Issues), query), "debugCache", map[string]interface{}{
+			"query":   query,
+			"entries": len(report.Entries),
+			"issues":  len(report.Issues),
+		})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatCacheDebugReport(report)), nil
+	})
+
+	// --- cacheStatus Tool ---
+	logger.LogInfo("🔧 Registering cacheStatus tool", "server", nil)
+	cacheStatusTool := mcp.NewTool("cacheStatus",
+		mcp.WithDescription("Show the size of the cache: entries and bytes per entry type, how many are expired or unreadable, the oldest and newest entries, and the cache hit rate since startup. Entries and hits are also broken down by age, with suggested TTL changes once enough hits have been seen, e.g. a lower TTL when nearly all hits are on young entries."),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the status as JSON.")),
+	)
+
+	s.AddTool(cacheStatusTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		status, err := cacheStatus()
+		if err != nil {
+			logger.LogErrorMsg("❌ cacheStatus failed", "cacheStatus", err, nil)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("💾 cacheStatus found %d entries (%d bytes, %d expired)", status.Entries, status.Bytes, status.Expired), "cacheStatus", map[string]interface{}{
+			"entries": status.Entries,
+			"bytes":   status.Bytes,
+			"expired": status.Expired,
+		})
+
+		if jsonOutput, _ := request.GetArguments()["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatCacheStatus(status)), nil
+	})
+
+	// --- cacheClear Tool ---
+	logger.LogInfo("🔧 Registering cacheClear tool", "server", nil)
+	cacheClearTool := mcp.NewTool("cacheClear",
+		mcp.WithDescription("Delete cache entries to recover from stale or corrupt results. Without arguments the whole cache is cleared, including unreadable files; batchRetrievalTool then needs a new search."),
+		mcp.WithString("query", mcp.Description("Only delete the entries of this searchCode query.")),
+		mcp.WithBoolean("expiredOnly", mcp.Description("Only delete entries past their TTL.")),
+	)
+
+	s.AddTool(cacheClearTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		query, _ := args["query"].(string)
+		expiredOnly, _ := args["expiredOnly"].(bool)
+		result, err := clearCache(query, expiredOnly)
+		if err != nil {
+			logger.LogErrorMsg("❌ cacheClear failed", "cacheClear", err, map[string]interface{}{"query": query})
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		logger.LogInfo(fmt.Sprintf("🧹 cacheClear removed %d entries (%d bytes)", result.Removed, result.Bytes), "cacheClear", map[string]interface{}{
+			"query":        query,
+			"expired_only": expiredOnly,
+			"removed":      result.Removed,
+			"failed":       len(result.Failed),
+		})
+
+		text := fmt.Sprintf("🧹 Removed %d cache entries (%s).", result.Removed, formatBytes(result.Bytes))
+		for _, failure := range result.Failed {
+			text += "\n❌ " + failure
+		}
+		return mcp.NewToolResultText(text), nil
+	})
+
+	// --- estimate Tool ---
+	logger.LogInfo("🔧 Registering estimate tool", "server", nil)
+	estimateTool := mcp.NewTool("estimate",
+		mcp.WithDescription("Estimate the cost of a searchCode call before running it. Fetches only the first result page and reports the matches, the pages a full search would fetch, how many are already cached, the upstream requests and rough latency it would take, and whether to run the search in full, sample fewer pages or refine the query."),
+		mcp.WithString("query", mcp.Description("The searchCode query to estimate."), mcp.Required()),
+		mcp.WithBoolean("caseSensitive", mcp.Description("The caseSensitive value for searchCode.")),
+		mcp.WithBoolean("useRegex", mcp.Description("The useRegex value for searchCode.")),
+		mcp.WithBoolean("wholeWords", mcp.Description("The wholeWords value for searchCode.")),
+		mcp.WithString("repoFilter", mcp.Description("The repoFilter for searchCode.")),
+		mcp.WithString("pathFilter", mcp.Description("The pathFilter for searchCode.")),
+		mcp.WithString("langFilter", mcp.Description("The langFilter for searchCode, comma-separated. Each language is probed separately.")),
+		mcp.WithNumber("maxPages", mcp.Description(fmt.Sprintf("The maxPages value for searchCode, 1-%d (default %d).", maxPagesLimit, GetConfig().MaxPages))),
+		mcp.WithString("cacheTTL", mcp.Description("The cacheTTL value for searchCode; cached pages older than this do not count as cached.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the estimate as JSON.")),
+	)
+
+	s.AddTool(estimateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		query, _ := args["query"].(string)
+		if strings.TrimSpace(query) == "" {
+			return mcp.NewToolResultError("query must be a non-empty string"), nil
+		}
+		if _, err := parseCacheTTLArg(args); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if _, err := parseMaxPagesArg(args); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if useRegex, _ := args["useRegex"].(bool); useRegex {
+			if result := validateRegexPattern(query); !result.IsValid {
+				return mcp.NewToolResultError(fmt.Sprintf("Invalid regex pattern: %v", result.Error)), nil
+			}
+		}
+		if langFilter, ok := args["langFilter"].(string); ok && langFilter != "" {
+			args = copyArgs(args)
+			args["langFilter"], _ = canonicalizeLangFilter(langFilter)
+		}
+		if repoFilter, ok := args["repoFilter"].(string); ok && repoFilter != "" {
+			args = copyArgs(args)
+			args["repoFilter"] = canonicalRepo(repoFilter)
+		}
+
+		estimate, err := estimateSearch(ctx, httpClient, args)
+		if err != nil {
+			logger.LogErrorMsg("❌ estimate failed", "estimate", err, map[string]interface{}{"query": query})
+			return mcp.NewToolResultError(fmt.Sprintf("API fetch failed: %v", err)), nil
+		}
+		logger.LogInfo(fmt.Sprintf("🧮 Estimated %d upstream requests for '%s': %s", estimate.UpstreamRequests, query, estimate.Recommendation), "estimate", map[string]interface{}{
+			"query":             query,
+			"estimated_pages":   estimate.EstimatedPages,
+			"cached_pages":      estimate.CachedPages,
+			"upstream_requests": estimate.UpstreamRequests,
+			"recommendation":    estimate.Recommendation,
+		})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultBytes, err := json.MarshalIndent(estimate, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(string(resultBytes)), nil
+		}
+		return mcp.NewToolResultText(formatSearchEstimate(estimate)), nil
+	})
+
+	// --- selfCheck Tool ---
+	logger.LogInfo("🔧 Registering selfCheck tool", "server", nil)
+	selfCheckTool := mcp.NewTool("selfCheck",
+		mcp.WithDescription("Check that the server is ready: probes grep.app and api.github.com, validates the GitHub token and its scopes, and verifies the cache and log directories are writable."),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the report as a JSON object."+outputSchemaNote(outputSchemaStats))),
+	)
+
+	s.AddTool(selfCheckTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		report := runSelfCheck(ctx, httpClient, githubClientFor(ctx, ghClient), grepAppAPIBaseURL)
+		logSelfCheck(LoggerFromContext(ctx), report)
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultText, err := marshalStats("selfCheck", report)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(resultText), nil
+		}
+		return mcp.NewToolResultText(formatSelfCheck(report)), nil
+	})
+
+	// --- sessionStats Tool ---
+	logger.LogInfo("🔧 Registering sessionStats tool", "server", nil)
+	sessionStatsTool := mcp.NewTool("sessionStats",
+		mcp.WithDescription("Show per-client session statistics: request counts, recent search queries, and how many searches found results or returned nothing. Snapshots are also written to the log for the analyzer."),
+		mcp.WithBoolean("allSessions", mcp.Description("If true, list every client session seen by this server instead of only the current one.")),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the sessions as a JSON object."+outputSchemaNote(outputSchemaStats))),
+	)
+
+	s.AddTool(sessionStatsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		args := request.GetArguments()
+		currentID := clientSessionID(ctx)
+		filter := currentID
+		if all, _ := args["allSessions"].(bool); all {
+			filter = ""
+		}
+		sessions := clientSessions.snapshot(filter)
+		logger.LogInfo(fmt.Sprintf("🧑‍💻 sessionStats returned %d sessions", len(sessions)), "sessionStats", map[string]interface{}{"all_sessions": filter == ""})
+
+		if jsonOutput, _ := args["jsonOutput"].(bool); jsonOutput {
+			resultText, err := marshalStats("sessionStats", SessionStatsData{CurrentSession: currentID, Sessions: sessions})
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(resultText), nil
+		}
+		return mcp.NewToolResultText(formatSessionStats(sessions, currentID)), nil
+	})
+
+	// --- serverStats Tool ---
+	logger.LogInfo("🔧 Registering serverStats tool", "server", nil)
+	serverStatsTool := mcp.NewTool("serverStats",
+		mcp.WithDescription("Show aggregate server statistics kept across restarts: tool calls and errors, searches, cache hits and misses, and upstream requests and errors. Counts are saved to the log directory every minute and on shutdown."),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the statistics as a JSON object."+outputSchemaNote(outputSchemaStats))),
+	)
+
+	s.AddTool(serverStatsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		stats := serverStats.snapshot()
+		logger.LogInfo(fmt.Sprintf("📈 serverStats reported %d tool calls since %s", stats.ToolCalls, stats.Since.Format(time.RFC3339)), "serverStats", nil)
+
+		if jsonOutput, _ := request.GetArguments()["jsonOutput"].(bool); jsonOutput {
+			resultText, err := marshalStats("serverStats", stats)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(resultText), nil
+		}
+		return mcp.NewToolResultText(formatServerStats(stats)), nil
+	})
+
+	// --- listProviders Tool ---
+	logger.LogInfo("🔧 Registering listProviders tool", "server", nil)
+	listProvidersTool := mcp.NewTool("listProviders",
+		mcp.WithDescription("Describe each upstream provider: the tools that use it, its regex flavor, filters and options, how many pages a search can fetch, whether requests are authenticated and allowed for the caller, and its health from recent requests, including the remaining rate limit."),
+		mcp.WithBoolean("jsonOutput", mcp.Description("If true, return the providers as a JSON object."+outputSchemaNote(outputSchemaStats))),
+	)
+
+	s.AddTool(listProvidersTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := LoggerFromContext(ctx)
+		providers := listProviders(ctx)
+		logger.LogInfo(fmt.Sprintf("🧭 listProviders described %d providers", len(providers)), "listProviders", nil)
+
+		if jsonOutput, _ := request.GetArguments()["jsonOutput"].(bool); jsonOutput {
+			resultText, err := marshalStats("listProviders", ProvidersData{Providers: providers})
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to marshal result: %v", err)), nil
+			}
+			return mcp.NewToolResultText(resultText), nil
+		}
+		return mcp.NewToolResultText(formatProviders(providers)), nil
+	})
+
+	if len(disabledTools) > 0 {
+		// Removed after registration so they are neither listed nor callable
+		s.DeleteTools(disabledTools...)
+		logger.LogInfo(fmt.Sprintf("🚫 Disabled tools: %s", strings.Join(disabledTools, ", ")), "server", map[string]interface{}{"tools": disabledTools})
+	}
+
+	if !cfg.SkipSelfCheck {
+		// Runs in the background so a slow upstream does not delay the transport
+		go func() {
+			logSelfCheck(logger, runSelfCheck(context.Background(), httpClient, ghClient, grepAppAPIBaseURL))
+		}()
+	}
+
 	// --- Start Server ---
 	if transport == "http" {
 		logger.LogInfo("🚀 Starting HTTP server mode", "server", nil)
-		httpServer := server.NewStreamableHTTPServer(s)
-		addr := fmt.Sprintf(":%d", port)
-		logger.LogInfo(fmt.Sprintf("🌐 HTTP server listening on %s/mcp", addr), "server", map[string]interface{}{"addr": addr})
+		addr, err := parseListenAddress(listen, port)
+		if err != nil {
+			logger.LogErrorMsg("💥 Invalid listen address", "server", err, map[string]interface{}{"listen": listen})
+			fatalf("💥 Invalid listen address: %v", err)
+		}
+		logger.LogInfo(fmt.Sprintf("🌐 HTTP server listening on %s, endpoint %s", addr, mcpEndpointPath), "server", map[string]interface{}{"addr": addr.String()})
+		if cfg.CORS.Enabled() {
+			logger.LogInfo(fmt.Sprintf("🌍 CORS enabled for origins: %s", strings.Join(cfg.CORS.AllowedOrigins, ", ")), "server", map[string]interface{}{
+				"origins": cfg.CORS.AllowedOrigins,
+				"methods": cfg.CORS.AllowedMethods,
+				"headers": cfg.CORS.AllowedHeaders,
+			})
+		}
+		if cfg.ProfilesFile != "" {
+			profiles, err := loadProfiles(cfg.ProfilesFile)
+			if err != nil {
+				logger.LogErrorMsg("💥 Failed to load tenant profiles", "server", err, map[string]interface{}{"file": cfg.ProfilesFile})
+				fatalf("💥 Failed to load tenant profiles: %v", err)
+			}
+			tenantProfiles = profiles
+			names := make([]string, 0, len(profiles.profiles))
+			for _, profile := range profiles.profiles {
+				names = append(names, profile.Name)
+			}
+			logger.LogInfo(fmt.Sprintf("👥 Loaded %d tenant profiles; API key required: %s", len(names), strings.Join(names, ", ")), "server", map[string]interface{}{"profiles": names})
+		}
 		logger.LogInfo("📊 Server ready to handle MCP requests", "server", nil)
-		if err := httpServer.Start(addr); err != nil {
-			logger.LogErrorMsg("💥 Server startup failed", "server", err, map[string]interface{}{"addr": addr})
-			log.Fatalf("💥 Server startup failed: %v", err)
+		if err := serveHTTP(s, addr); err != nil {
+			logger.LogErrorMsg("💥 Server startup failed", "server", err, map[string]interface{}{"addr": addr.String()})
+			fatalf("💥 Server startup failed: %v", err)
 		}
 	} else {
 		logger.LogInfo("🚀 Starting STDIO server mode", "server", nil)
+		if cfg.ProfilesFile != "" {
+			logger.LogWarn("⚠️ Tenant profiles only apply to the http transport; ignoring "+cfg.ProfilesFile, "server", nil)
+		}
 		logger.LogInfo("📊 Server ready to handle MCP requests via stdin/stdout", "server", nil)
-		if err := server.ServeStdio(s); err != nil {
+		// ServeStdio returns context.Canceled when stopped by SIGINT or SIGTERM
+		if err := serveStdio(s); err != nil && !errors.Is(err, context.Canceled) {
 			logger.LogErrorMsg("💥 Server startup failed", "server", err, nil)
-			log.Fatalf("💥 Server startup failed: %v", err)
+			fatalf("💥 Server startup failed: %v", err)
 		}
 	}
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// In-Memory Hot Cache
+//================================================================================
+
+// memoryCache is a small LRU that sits in front of the disk cache so repeated lookups
+// skip file I/O and JSON decoding. Cached values are shared between callers and must
+// be treated as read-only.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is most recently used
+
+	memoryHits int64
+	diskHits   int64
+	misses     int64
+	evictions  int64
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     any
+	timestamp time.Time // Time the data was originally cached, so disk TTLs still apply
+	entryType cacheEntryType
+}
+
+// CacheLayerStats reports how lookups were served by each cache layer.
+type CacheLayerStats struct {
+	MemoryHits    int64   `json:"memory_hits"`
+	DiskHits      int64   `json:"disk_hits"`
+	Misses        int64   `json:"misses"`
+	Evictions     int64   `json:"evictions"`
+	MemoryEntries int     `json:"memory_entries"`
+	MemoryHitRate float64 `json:"memory_hit_rate"`
+	DiskHitRate   float64 `json:"disk_hit_rate"`
+}
+
+var hotCache = newMemoryCache()
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the value for key if present and younger than ttl. Expired entries are dropped.
+func (c *memoryCache) get(key string, ttl time.Duration) (any, bool) {
+	value, _, ok := c.getEntry(key, ttl)
+	return value, ok
+}
+
+// getEntry is get that also returns when the value was stored.
+func (c *memoryCache) getEntry(key string, ttl time.Duration) (any, time.Time, bool) {
+	value, timestamp, _, ok := c.getTypedEntry(key, ttl)
+	return value, timestamp, ok
+}
+
+// getTypedEntry is getEntry that also returns the entry type the value was stored with.
+func (c *memoryCache) getTypedEntry(key string, ttl time.Duration) (any, time.Time, cacheEntryType, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, "", false
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Since(entry.timestamp) > ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, time.Time{}, "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, entry.timestamp, entry.entryType, true
+}
+
+// put stores a value, evicting the least recently used entries beyond capacity.
+// A capacity of zero or less disables the layer.
+func (c *memoryCache) put(key string, value any, timestamp time.Time, capacity int) {
+	c.putTyped(key, value, timestamp, "", capacity)
+}
+
+// putTyped is put for a value of a known entry type.
+func (c *memoryCache) putTyped(key string, value any, timestamp time.Time, entryType cacheEntryType, capacity int) {
+	if capacity <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &memoryCacheEntry{key: key, value: value, timestamp: timestamp, entryType: entryType}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+		c.evictions++
+	}
+}
+
+// remove drops a key from the memory layer.
+func (c *memoryCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// clear drops every entry; the lookup counters are kept.
+func (c *memoryCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// record counts a lookup outcome for the given layer: "memory", "disk" or "miss".
+func (c *memoryCache) record(layer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch layer {
+	case "memory":
+		c.memoryHits++
+	case "disk":
+		c.diskHits++
+	default:
+		c.misses++
+	}
+}
+
+// stats returns a snapshot of the layer hit counters.
+func (c *memoryCache) stats() CacheLayerStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CacheLayerStats{
+		MemoryHits:    c.memoryHits,
+		DiskHits:      c.diskHits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		MemoryEntries: c.order.Len(),
+	}
+	if total := c.memoryHits + c.diskHits + c.misses; total > 0 {
+		stats.MemoryHitRate = float64(c.memoryHits) / float64(total)
+		stats.DiskHitRate = float64(c.diskHits) / float64(total)
+	}
+	return stats
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 )
 
 //================================================================================
@@ -26,7 +31,10 @@ const (
 )
 
 const (
-	logDir = "./logs"
+	fallbackLogDir = "./logs" // Used when the OS state directory cannot be determined
+
+	// defaultLogFilePattern names log files; see expandLogFilePattern for placeholders.
+	defaultLogFilePattern = "mcp-server-%date.jsonl"
 )
 
 // LogEntry represents a structured log entry
@@ -59,6 +67,9 @@ type SearchLogData struct {
 	APIRequests   int               `json:"api_requests"`
 	RegexFiltered bool              `json:"regex_filtered"`
 	Filters       map[string]string `json:"filters"`
+	CacheLayers   CacheLayerStats   `json:"cache_layers"`         // Process-wide cache layer counters at completion
+	PageError     string            `json:"page_error,omitempty"` // A page failed and the earlier pages were returned as partial results
+	Cancelled     bool              `json:"cancelled,omitempty"`  // The client cancelled the call
 }
 
 // BatchRetrievalLogData contains specific data for batch retrieval operations
@@ -71,9 +82,33 @@ type BatchRetrievalLogData struct {
 	Duration      time.Duration `json:"duration_ms"`
 	Success       bool          `json:"success"`
 	Error         string        `json:"error,omitempty"`
+	Cancelled     bool          `json:"cancelled,omitempty"` // The client cancelled the call
+}
+
+// APIRequestLogData describes one completed upstream API request
+type APIRequestLogData struct {
+	URL        string
+	StatusCode int // Zero when no response was received
+	Duration   time.Duration
+	Bytes      int64 // Response body size
+	Retries    int   // Attempts made before the logged one
+	Error      string
+}
+
+// HTTPAccessLogData contains one HTTP transport request
+type HTTPAccessLogData struct {
+	Tenant       string `json:"tenant,omitempty"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	MCPSessionID string `json:"mcp_session_id,omitempty"`
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	UserAgent    string `json:"user_agent,omitempty"`
+	Status       int    `json:"status"`
+	BytesWritten int64  `json:"bytes_written"`
+	DurationMs   int64  `json:"duration_ms"`
 }
 
-// ClientSessionData tracks client behavior patterns
+// ClientSessionData tracks client behavior patterns per MCP client session
 type ClientSessionData struct {
 	SessionID      string    `json:"session_id"`
 	FirstSeen      time.Time `json:"first_seen"`
@@ -88,21 +123,49 @@ type ClientSessionData struct {
 // Logger Interface
 //================================================================================
 
+// ObservabilityLogger writes structured entries to a JSONL file. It is safe for concurrent
+// use; child loggers created with WithFields share the parent's file.
 type ObservabilityLogger struct {
-	logFile   *os.File
+	sink      *logSink
 	logDir    string
 	sessionID string
+	fields    map[string]interface{} // Added to the data of every entry; never modified after creation
+}
+
+// expandLogFilePattern substitutes placeholders in a log file name pattern:
+// %date (YYYY-MM-DD), %hostname and %pid. The result always has a .jsonl extension
+// so the analyzer picks it up.
+func expandLogFilePattern(pattern string, now time.Time) string {
+	if pattern == "" {
+		pattern = defaultLogFilePattern
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown-host"
+	}
+	hostname = strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(hostname)
+
+	name := strings.NewReplacer(
+		"%date", now.Format("2006-01-02"),
+		"%hostname", hostname,
+		"%pid", strconv.Itoa(os.Getpid()),
+	).Replace(pattern)
+	name = filepath.Base(name)
+	if !strings.HasSuffix(name, ".jsonl") {
+		name += ".jsonl"
+	}
+	return name
 }
 
-// NewObservabilityLogger creates a new logger instance
-func NewObservabilityLogger(logDir string) (*ObservabilityLogger, error) {
+// NewObservabilityLogger creates a new logger instance writing to logDir with a file
+// named after filePattern, buffered or synchronous according to write
+func NewObservabilityLogger(logDir string, filePattern string, write LogWriteConfig) (*ObservabilityLogger, error) {
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
 	// Create log file with timestamp
-	timestamp := time.Now().Format("2006-01-02")
-	logPath := filepath.Join(logDir, fmt.Sprintf("mcp-server-%s.jsonl", timestamp))
+	logPath := filepath.Join(logDir, expandLogFilePattern(filePattern, time.Now()))
 	
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
@@ -112,24 +175,53 @@ func NewObservabilityLogger(logDir string) (*ObservabilityLogger, error) {
 	sessionID := uuid.New().String()[:8] // Short session ID
 
 	return &ObservabilityLogger{
-		logFile:   logFile,
+		sink:      newLogSink(logFile, write),
 		logDir:    logDir,
 		sessionID: sessionID,
 	}, nil
 }
 
-// Close closes the log file
-func (ol *ObservabilityLogger) Close() error {
-	if ol.logFile != nil {
-		return ol.logFile.Close()
+// WithFields returns a child logger that adds fields to the data of every entry it writes,
+// for example a request ID shared by all entries of one tool call. Fields already present
+// in an entry's data take precedence.
+func (ol *ObservabilityLogger) WithFields(fields map[string]interface{}) *ObservabilityLogger {
+	merged := make(map[string]interface{}, len(ol.fields)+len(fields))
+	for k, v := range ol.fields {
+		merged[k] = v
 	}
-	return nil
+	for k, v := range fields {
+		merged[k] = v
+	}
+	child := *ol
+	child.fields = merged
+	return &child
+}
+
+// Flush writes buffered entries to the log file and syncs it
+func (ol *ObservabilityLogger) Flush() error {
+	return ol.sink.flush()
+}
+
+// Close flushes buffered entries and closes the log file shared with any child loggers
+func (ol *ObservabilityLogger) Close() error {
+	return ol.sink.close()
 }
 
 // writeLogEntry writes a structured log entry to the file and console
 func (ol *ObservabilityLogger) writeLogEntry(entry LogEntry) error {
 	entry.SessionID = ol.sessionID
 	entry.Timestamp = time.Now()
+	if len(ol.fields) > 0 {
+		// Copy so callers' maps are not modified
+		data := make(map[string]interface{}, len(entry.Data)+len(ol.fields))
+		for k, v := range ol.fields {
+			data[k] = v
+		}
+		for k, v := range entry.Data {
+			data[k] = v
+		}
+		entry.Data = data
+	}
 	
 	// Write structured JSON to file
 	logLine, err := json.Marshal(entry)
@@ -137,14 +229,9 @@ func (ol *ObservabilityLogger) writeLogEntry(entry LogEntry) error {
 		return fmt.Errorf("failed to marshal log entry: %w", err)
 	}
 	
-	_, err = ol.logFile.WriteString(string(logLine) + "\n")
-	if err != nil {
-		return fmt.Errorf("failed to write log entry: %w", err)
-	}
-	
-	// Ensure immediate write to file
-	if err := ol.logFile.Sync(); err != nil {
-		return fmt.Errorf("failed to sync log file: %w", err)
+	// Errors are flushed at once so they survive a crash that follows them
+	if err := ol.sink.write(append(logLine, '\n'), entry.Level == LogLevelError); err != nil {
+		return err
 	}
 	
 	// Also write human-readable format to console
@@ -267,26 +354,46 @@ func (ol *ObservabilityLogger) LogBatchRetrievalComplete(logData BatchRetrievalL
 	ol.writeLogEntry(entry)
 }
 
-// LogAPIRequest logs individual API requests
-func (ol *ObservabilityLogger) LogAPIRequest(url string, duration time.Duration, statusCode int, err error) {
+// LogClientSession logs a snapshot of one client session's statistics
+func (ol *ObservabilityLogger) LogClientSession(session ClientSessionData) {
+	entry := LogEntry{
+		Level:   LogLevelInfo,
+		Message: fmt.Sprintf("Client session %s: %d requests, %d zero-result searches", session.SessionID, session.TotalRequests, session.ZeroResults),
+		Tool:    "session",
+		Data: map[string]interface{}{
+			"client_session": session,
+			"operation":      "client_session",
+		},
+	}
+
+	ol.writeLogEntry(entry)
+}
+
+// LogAPIRequest logs one completed API request. Requests that failed before a response
+// arrived have a zero status code and an error.
+func (ol *ObservabilityLogger) LogAPIRequest(logData APIRequestLogData) {
 	data := map[string]interface{}{
-		"url":          url,
-		"duration_ms":  duration.Milliseconds(),
-		"status_code":  statusCode,
-		"success":      err == nil,
-		"operation":    "api_request",
+		"url":         logData.URL,
+		"duration_ms": logData.Duration.Milliseconds(),
+		"status_code": logData.StatusCode,
+		"bytes":       logData.Bytes,
+		"retries":     logData.Retries,
+		"success":     logData.Error == "" && logData.StatusCode == 200,
+		"operation":   "api_request",
 	}
 	
-	if err != nil {
-		data["error"] = err.Error()
+	if logData.Error != "" {
+		data["error"] = logData.Error
 	}
 	
 	level := LogLevelInfo
-	message := fmt.Sprintf("API request to %s (%d) in %v", url, statusCode, duration)
+	message := fmt.Sprintf("API request to %s (%d, %d bytes) in %v", logData.URL, logData.StatusCode, logData.Bytes, logData.Duration)
 	
-	if err != nil {
+	if logData.Error != "" {
 		level = LogLevelError
-		message = fmt.Sprintf("API request failed: %s - %v", url, err)
+		message = fmt.Sprintf("API request failed: %s - %s", logData.URL, logData.Error)
+	} else if logData.StatusCode != 200 {
+		level = LogLevelWarn
 	}
 	
 	entry := LogEntry{
@@ -299,6 +406,30 @@ func (ol *ObservabilityLogger) LogAPIRequest(url string, duration time.Duration,
 	ol.writeLogEntry(entry)
 }
 
+// LogHTTPAccess logs a completed HTTP transport request
+func (ol *ObservabilityLogger) LogHTTPAccess(logData HTTPAccessLogData) {
+	data := map[string]interface{}{
+		"access_data": logData,
+		"operation":   "http_access",
+	}
+	
+	level := LogLevelDebug
+	if logData.Status >= 500 {
+		level = LogLevelError
+	} else if logData.Status >= 400 {
+		level = LogLevelWarn
+	}
+	
+	entry := LogEntry{
+		Level:   level,
+		Message: fmt.Sprintf("HTTP %s %s -> %d (%d bytes) in %dms", logData.Method, logData.Path, logData.Status, logData.BytesWritten, logData.DurationMs),
+		Tool:    "http",
+		Data:    data,
+	}
+	
+	ol.writeLogEntry(entry)
+}
+
 // LogCacheOperation logs cache hits/misses
 func (ol *ObservabilityLogger) LogCacheOperation(cacheKey string, hit bool, query string) {
 	data := map[string]interface{}{
@@ -416,9 +547,9 @@ func (ol *ObservabilityLogger) LogDebug(message string, tool string, data map[st
 var globalLogger *ObservabilityLogger
 
 // InitGlobalLogger initializes the global logger instance
-func InitGlobalLogger(logDir string) error {
+func InitGlobalLogger(logDir string, filePattern string, write LogWriteConfig) error {
 	var err error
-	globalLogger, err = NewObservabilityLogger(logDir)
+	globalLogger, err = NewObservabilityLogger(logDir, filePattern, write)
 	return err
 }
 
@@ -430,7 +561,53 @@ func CloseGlobalLogger() error {
 	return nil
 }
 
+// fatalf closes the global logger, so buffered entries reach the log file, then exits
+// like log.Fatalf
+func fatalf(format string, args ...interface{}) {
+	CloseGlobalLogger()
+	log.Fatalf(format, args...)
+}
+
 // GetLogger returns the global logger instance
 func GetLogger() *ObservabilityLogger {
 	return globalLogger
-}
\ No newline at end of file
+}
+
+type loggerContextKey struct{}
+
+// ContextWithLogger returns a context carrying logger for LoggerFromContext.
+func ContextWithLogger(ctx context.Context, logger *ObservabilityLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the request's child logger, or the global logger when the
+// context has none. Like GetLogger it returns nil before the logger is initialized.
+func LoggerFromContext(ctx context.Context) *ObservabilityLogger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*ObservabilityLogger); ok {
+		return logger
+	}
+	return GetLogger()
+}
+
+// requestLoggerMiddleware gives each tool call a child logger tagged with a request ID,
+// the tool name, the MCP session and the tenant, so entries from concurrent calls can be
+// told apart. Tool handlers log through LoggerFromContext to pick it up.
+func requestLoggerMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logger := GetLogger()
+		if logger == nil {
+			return next(ctx, request)
+		}
+		fields := map[string]interface{}{
+			"request_id": uuid.New().String()[:8],
+			"tool_name":  request.Params.Name,
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			fields["mcp_session_id"] = session.SessionID()
+		}
+		if tenant := tenantFromContext(ctx); tenant != nil {
+			fields["tenant"] = tenant.Name
+		}
+		return next(ContextWithLogger(ctx, logger.WithFields(fields)), request)
+	}
+}
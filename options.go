@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Typed Tool Options
+//================================================================================
+
+// Tool arguments arrive as decoded JSON, so numbers are float64 and flags are bool. Some
+// clients quote them, so numeric and boolean strings such as "5" or "true" are accepted
+// too. The readers below reject any other value of the wrong type instead of silently
+// treating it as absent.
+
+// argString reads an optional string argument.
+func argString(args map[string]interface{}, name string) (string, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return "", nil
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return "", &ValidationError{Field: name, Value: fmt.Sprintf("%v", raw), Reason: fmt.Sprintf("must be a string, got %T", raw)}
+	}
+	return s, nil
+}
+
+// argBool reads an optional boolean argument.
+func argBool(args map[string]interface{}, name string) (bool, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return false, nil
+	}
+	switch v := raw.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b, nil
+		}
+	}
+	return false, &ValidationError{Field: name, Value: fmt.Sprintf("%v", raw), Reason: fmt.Sprintf("must be a boolean, got %T", raw)}
+}
+
+// argStrings reads an optional array of strings.
+func argStrings(args map[string]interface{}, name string) ([]string, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, &ValidationError{Field: name, Value: fmt.Sprintf("%v", raw), Reason: "must be an array of strings"}
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, &ValidationError{Field: name, Value: fmt.Sprintf("%v", item), Reason: "must be an array of strings"}
+		}
+		values = append(values, s)
+	}
+	return values, nil
+}
+
+// argNumber reads an optional numeric argument. ok is false when the argument is absent.
+func argNumber(args map[string]interface{}, name string) (n float64, ok bool, err error) {
+	raw, present := args[name]
+	if !present || raw == nil {
+		return 0, false, nil
+	}
+	n, err = numberValue(name, raw)
+	return n, err == nil, err
+}
+
+// numberValue converts one decoded JSON value to a number. Go integers are accepted for
+// callers that build arguments themselves rather than decoding them, and numeric strings
+// for clients that quote numbers.
+func numberValue(name string, raw interface{}) (float64, error) {
+	switch v := raw.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+			return n, nil
+		}
+	}
+	return 0, &ValidationError{Field: name, Value: fmt.Sprintf("%v", raw), Reason: fmt.Sprintf("must be a number, got %T", raw)}
+}
+
+// searchFlagArgs are the other boolean searchCode arguments. They are validated and
+// canonicalized with the search options but read from the argument map by the handler.
+var searchFlagArgs = []string{"jsonOutput", "includeMetadata", "numberedOutput", "treeOutput", "autoEscape", "countOnly", "quickFirstPage", "explain", "interactive", "forceRefresh", "translateComments", "includeContext"}
+
+// SearchOptions are the arguments that shape a grep.app search: what is sent upstream,
+// how many pages are fetched and how cached pages and colliding lines are handled.
+type SearchOptions struct {
+	Query         string
+	CaseSensitive bool
+	UseRegex      bool
+	WholeWords    bool
+	RepoFilter    string // Canonical owner/repo form
+	PathFilter    string
+	LangFilter    string // One language, or several comma-separated for a fan-out scan
+	MaxPages      int
+	CacheTTL      time.Duration // Zero uses the configured TTLs
+	MergeStrategy lineMergeStrategy
+}
+
+// parseSearchOptions reads and validates the search arguments, applying the defaults.
+func parseSearchOptions(args map[string]interface{}) (SearchOptions, error) {
+	var opts SearchOptions
+	var err error
+	if opts.Query, err = argString(args, "query"); err != nil {
+		return opts, err
+	}
+	if opts.Query == "" {
+		return opts, fmt.Errorf("query parameter is required")
+	}
+	for name, flag := range map[string]*bool{"caseSensitive": &opts.CaseSensitive, "useRegex": &opts.UseRegex, "wholeWords": &opts.WholeWords} {
+		if *flag, err = argBool(args, name); err != nil {
+			return opts, err
+		}
+	}
+	for name, filter := range map[string]*string{"repoFilter": &opts.RepoFilter, "pathFilter": &opts.PathFilter, "langFilter": &opts.LangFilter} {
+		if *filter, err = argString(args, name); err != nil {
+			return opts, err
+		}
+	}
+	if opts.RepoFilter != "" {
+		opts.RepoFilter = canonicalRepo(opts.RepoFilter)
+	}
+	if opts.MaxPages, err = parseMaxPagesArg(args); err != nil {
+		return opts, err
+	}
+	if opts.CacheTTL, err = parseCacheTTLArg(args); err != nil {
+		return opts, err
+	}
+	if opts.MergeStrategy, err = parseMergeStrategy(args); err != nil {
+		return opts, err
+	}
+	for _, name := range searchFlagArgs {
+		if _, err := argBool(args, name); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// apply returns a copy of args with the parsed search options written back in their
+// canonical types, so code that still reads the argument map sees the same values.
+// Arguments the caller did not send stay absent, which keeps map-derived cache keys stable.
+func (o SearchOptions) apply(args map[string]interface{}) map[string]interface{} {
+	applied := copyArgs(args)
+	applied["query"] = o.Query
+	set := func(name string, value interface{}) {
+		if _, ok := args[name]; ok {
+			applied[name] = value
+		}
+	}
+	set("caseSensitive", o.CaseSensitive)
+	set("useRegex", o.UseRegex)
+	set("wholeWords", o.WholeWords)
+	set("repoFilter", o.RepoFilter)
+	set("pathFilter", o.PathFilter)
+	set("langFilter", o.LangFilter)
+	set("maxPages", float64(o.MaxPages))
+	for _, name := range searchFlagArgs {
+		v, _ := argBool(args, name) // Validated by parseSearchOptions
+		set(name, v)
+	}
+	return applied
+}
+
+// BatchOptions are the arguments of batchRetrievalTool.
+type BatchOptions struct {
+	Query           string
+	ResultNumbers   []int
+	Paths           []string // owner/repo/path entries
+	CacheTTL        time.Duration
+	OutputFormat    string
+	RetryFailedOnly bool
+	Translate       bool // Append translations of non-English comments in the retrieved files
+	ContextLines    int  // Lines kept around each matched line; 0 returns whole files
+	Retrieval       retrievalOptions
+}
+
+// parseBatchOptions reads and validates the batch retrieval arguments.
+func parseBatchOptions(args map[string]interface{}) (BatchOptions, error) {
+	var opts BatchOptions
+	var err error
+	if opts.Query, err = argString(args, "query"); err != nil {
+		return opts, err
+	}
+	if opts.Query == "" {
+		return opts, fmt.Errorf("query parameter is required")
+	}
+	if opts.CacheTTL, err = parseCacheTTLArg(args); err != nil {
+		return opts, err
+	}
+	if opts.OutputFormat, err = parseBatchOutputFormat(args); err != nil {
+		return opts, err
+	}
+	if opts.ResultNumbers, err = parseResultNumbers(args["resultNumbers"]); err != nil {
+		return opts, err
+	}
+	paths, err := argStrings(args, "paths")
+	if err != nil {
+		return opts, err
+	}
+	for _, path := range paths {
+		if path != "" {
+			opts.Paths = append(opts.Paths, path)
+		}
+	}
+	if len(opts.Paths) > maxBatchResults {
+		return opts, &ValidationError{Field: "paths", Value: fmt.Sprintf("%d entries", len(opts.Paths)), Reason: fmt.Sprintf("at most %d paths per request", maxBatchResults)}
+	}
+	if opts.RetryFailedOnly, err = argBool(args, "retryFailedOnly"); err != nil {
+		return opts, err
+	}
+	if opts.Translate, err = argBool(args, "translateComments"); err != nil {
+		return opts, err
+	}
+	v, ok, err := argNumber(args, "contextLines")
+	if err != nil {
+		return opts, err
+	}
+	if ok {
+		if v < 0 || v > maxContextLines || v != float64(int(v)) {
+			return opts, &ValidationError{Field: "contextLines", Value: fmt.Sprintf("%v", v), Reason: fmt.Sprintf("must be a whole number between 0 and %d", maxContextLines)}
+		}
+		opts.ContextLines = int(v)
+	}
+	if opts.Retrieval, err = parseRetrievalOptions(args); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Versioned Output Schemas
+//================================================================================
+
+// outputSchemaVersion is reported as schemaVersion in every versioned JSON output. Bump it
+// when a field is removed or changes meaning; adding optional fields keeps the version.
+const outputSchemaVersion = "1"
+
+// Output schema names, published as grep-app://schemas/<name>/v<version>.
+const (
+	outputSchemaResults = "results"
+	outputSchemaBatch   = "batch"
+	outputSchemaStats   = "stats"
+)
+
+// StatsOutput is the JSON envelope for the statistics and diagnostics tools.
+type StatsOutput struct {
+	SchemaVersion string      `json:"schemaVersion"`
+	Kind          string      `json:"kind"` // The tool that produced Data, e.g. "selfCheck"
+	GeneratedAt   time.Time   `json:"generated_at"`
+	Data          interface{} `json:"data"`
+}
+
+// SessionStatsData is the sessionStats payload of StatsOutput.
+type SessionStatsData struct {
+	CurrentSession string              `json:"current_session,omitempty"`
+	Sessions       []ClientSessionData `json:"sessions"`
+}
+
+// newStatsOutput wraps data in the versioned stats envelope.
+func newStatsOutput(kind string, data interface{}) StatsOutput {
+	return StatsOutput{SchemaVersion: outputSchemaVersion, Kind: kind, GeneratedAt: time.Now().UTC(), Data: data}
+}
+
+// outputSchemaURI is the resource URI under which a schema is published.
+func outputSchemaURI(name string) string {
+	return fmt.Sprintf("grep-app://schemas/%s/v%s", name, outputSchemaVersion)
+}
+
+// outputSchemaNote is appended to tool and argument descriptions that produce versioned JSON.
+func outputSchemaNote(name string) string {
+	return fmt.Sprintf(" JSON output carries schemaVersion %q and follows the schema at %s.", outputSchemaVersion, outputSchemaURI(name))
+}
+
+// outputSchemas holds the JSON Schema (draft 2020-12) for each versioned output.
+var outputSchemas = map[string]string{
+	outputSchemaResults: `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "grep-app://schemas/results/v1",
+  "title": "searchCode results",
+  "description": "searchCode output with jsonOutput and includeMetadata set.",
+  "type": "object",
+  "required": ["schemaVersion", "hits", "metadata"],
+  "properties": {
+    "schemaVersion": {"const": "1"},
+    "warnings": {
+      "description": "Problems that degraded this answer, added to every JSON tool result; empty when there were none.",
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["code", "message"],
+        "properties": {"code": {"type": "string"}, "message": {"type": "string"}}
+      }
+    },
+    "hits": {
+      "description": "Repository, then file path, then line number to line text.",
+      "type": "object",
+      "additionalProperties": {
+        "type": "object",
+        "additionalProperties": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "languages": {
+      "description": "Repository, then file path, to the language inferred from the file name. Unrecognized files are left out.",
+      "type": "object",
+      "additionalProperties": {"type": "object", "additionalProperties": {"type": "string"}}
+    },
+    "metadata": {
+      "type": "object",
+      "required": ["summary", "pages_fetched", "pages_available", "complete", "total_available",
+        "scanned_files", "returned_files", "returned_lines", "cached_pages", "timing"],
+      "properties": {
+        "summary": {"type": "string"},
+        "provider": {"type": "string", "description": "Provider that served the results: grepapp, or a fallback provider when grep.app failed."},
+        "page_error": {"type": "string", "description": "Why a result page failed; the pages fetched before it are returned as partial results."},
+        "pages_fetched": {"type": "integer"},
+        "pages_available": {"type": "integer"},
+        "complete": {"type": "boolean"},
+        "total_available": {"type": "integer"},
+        "scanned_files": {"type": "integer"},
+        "returned_files": {"type": "integer"},
+        "returned_lines": {"type": "integer"},
+        "cached_pages": {"type": "integer"},
+        "from_cache": {"type": "boolean"},
+        "shared_scan": {"type": "boolean"},
+        "cached_at": {"type": "string"},
+        "cache_age_seconds": {"type": "integer"},
+        "stale": {"type": "boolean"},
+        "pages": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["page", "hits", "cache_hit", "elapsed_ms"],
+            "properties": {
+              "language": {"type": "string"},
+              "page": {"type": "integer"},
+              "hits": {"type": "integer"},
+              "cache_hit": {"type": "boolean"},
+              "elapsed_ms": {"type": "integer"}
+            }
+          }
+        },
+        "timing": {
+          "type": "object",
+          "required": ["fetch_ms", "filter_ms", "total_ms"],
+          "properties": {
+            "fetch_ms": {"type": "integer"},
+            "filter_ms": {"type": "integer"},
+            "total_ms": {"type": "integer"}
+          }
+        },
+        "line_collisions": {"type": "integer"},
+        "collisions": {"type": "array"}
+      }
+    }
+  }
+}`,
+	outputSchemaBatch: `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "grep-app://schemas/batch/v1",
+  "title": "batchRetrievalTool results",
+  "description": "batchRetrievalTool output in the json format, also used by importSnapshot with includeFiles.",
+  "type": "object",
+  "required": ["schemaVersion", "success", "files"],
+  "properties": {
+    "schemaVersion": {"const": "1"},
+    "warnings": {
+      "description": "Problems that degraded this answer, added to every JSON tool result; empty when there were none.",
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["code", "message"],
+        "properties": {"code": {"type": "string"}, "message": {"type": "string"}}
+      }
+    },
+    "success": {"type": "boolean"},
+    "error": {"type": "string"},
+    "files": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["number", "repo", "path", "content"],
+        "properties": {
+          "number": {"type": "integer"},
+          "repo": {"type": "string"},
+          "path": {"type": "string"},
+          "content": {"type": "string"},
+          "type": {"enum": ["file", "dir"]},
+          "language": {"type": "string"},
+          "encoding": {"type": "string"},
+          "error": {"type": "string"},
+          "listing": {"type": "array"},
+          "skipped_entries": {"type": "integer"},
+          "sha256": {"type": "string"},
+          "duplicate_of": {"type": "string"},
+          "processing": {"type": "object"},
+          "truncated": {"type": "boolean"},
+          "original_bytes": {"type": "integer"},
+          "excerpt": {
+            "type": "object",
+            "required": ["context_lines", "total_lines", "ranges"],
+            "properties": {
+              "context_lines": {"type": "integer"},
+              "total_lines": {"type": "integer"},
+              "ranges": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["start", "end"],
+                  "properties": {"start": {"type": "integer"}, "end": {"type": "integer"}}
+                }
+              }
+            }
+          },
+          "validation_error": {"type": "object"}
+        }
+      }
+    },
+    "skipped": {"type": "array"},
+    "duplicates": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["sha256", "bytes", "locations"],
+        "properties": {
+          "sha256": {"type": "string"},
+          "bytes": {"type": "integer"},
+          "locations": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["number", "repo", "path"],
+              "properties": {"number": {"type": "integer"}, "repo": {"type": "string"}, "path": {"type": "string"}}
+            }
+          }
+        }
+      }
+    },
+    "repos": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["repo"],
+        "properties": {
+          "repo": {"type": "string"},
+          "provider": {"type": "string"},
+          "owner": {"type": "string"},
+          "name": {"type": "string"}
+        }
+      }
+    },
+    "rate_limit": {
+      "type": "object",
+      "required": ["limit", "remaining", "reset", "authenticated"],
+      "properties": {
+        "limit": {"type": "integer"},
+        "remaining": {"type": "integer"},
+        "reset": {"type": "string"},
+        "authenticated": {"type": "boolean"}
+      }
+    }
+  }
+}`,
+	outputSchemaStats: `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "grep-app://schemas/stats/v1",
+  "title": "Statistics and diagnostics",
+  "description": "selfCheck, sessionStats, serverStats and listProviders output with jsonOutput set. The shape of data depends on kind.",
+  "type": "object",
+  "required": ["schemaVersion", "kind", "generated_at", "data"],
+  "properties": {
+    "schemaVersion": {"const": "1"},
+    "warnings": {
+      "description": "Problems that degraded this answer, added to every JSON tool result; empty when there were none.",
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["code", "message"],
+        "properties": {"code": {"type": "string"}, "message": {"type": "string"}}
+      }
+    },
+    "kind": {"enum": ["selfCheck", "sessionStats", "serverStats", "listProviders"]},
+    "generated_at": {"type": "string"},
+    "data": {
+      "type": "object",
+      "properties": {
+        "ready": {"type": "boolean"},
+        "checks": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["name", "ok", "detail", "duration_ns"],
+            "properties": {
+              "name": {"type": "string"},
+              "ok": {"type": "boolean"},
+              "detail": {"type": "string"},
+              "duration_ns": {"type": "integer"}
+            }
+          }
+        },
+        "disk": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["store", "degraded", "write_failures", "skipped_writes"],
+            "properties": {
+              "store": {"enum": ["cache", "log"]},
+              "degraded": {"type": "boolean"},
+              "reason": {"type": "string"},
+              "degraded_since": {"type": "string"},
+              "write_failures": {"type": "integer"},
+              "skipped_writes": {"type": "integer"},
+              "free_bytes": {"type": "integer"}
+            }
+          }
+        },
+        "current_session": {"type": "string"},
+        "since": {"type": "string"},
+        "last_checkpoint": {"type": "string"},
+        "starts": {"type": "integer"},
+        "tool_calls": {"type": "integer"},
+        "tool_errors": {"type": "integer"},
+        "searches": {"type": "integer"},
+        "cache_hits": {"type": "integer"},
+        "cache_misses": {"type": "integer"},
+        "upstream_requests": {"type": "integer"},
+        "upstream_errors": {"type": "integer"},
+        "providers": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["name", "description", "tools", "auth", "allowed", "health"],
+            "properties": {
+              "name": {"type": "string"},
+              "description": {"type": "string"},
+              "tools": {"type": "array", "items": {"type": "string"}},
+              "regex_flavor": {"type": "string"},
+              "filters": {"type": "array", "items": {"type": "string"}},
+              "options": {"type": "array", "items": {"type": "string"}},
+              "max_pages": {"type": "integer"},
+              "results_per_page": {"type": "integer"},
+              "auth": {"type": "string"},
+              "allowed": {"type": "boolean"},
+              "health": {
+                "type": "object",
+                "required": ["status", "requests", "errors", "consecutive_errors"],
+                "properties": {
+                  "status": {"enum": ["unknown", "healthy", "failing"]},
+                  "requests": {"type": "integer"},
+                  "errors": {"type": "integer"},
+                  "consecutive_errors": {"type": "integer"},
+                  "last_success": {"type": "string"},
+                  "last_error": {"type": "string"},
+                  "last_error_at": {"type": "string"},
+                  "rate_limit_remaining": {"type": "integer"},
+                  "rate_limit_reset": {"type": "string"}
+                }
+              }
+            }
+          }
+        },
+        "sessions": {
+          "type": ["array", "null"],
+          "items": {
+            "type": "object",
+            "required": ["session_id", "first_seen", "last_seen", "total_requests", "zero_results", "success_results"],
+            "properties": {
+              "session_id": {"type": "string"},
+              "first_seen": {"type": "string"},
+              "last_seen": {"type": "string"},
+              "total_requests": {"type": "integer"},
+              "search_queries": {"type": ["array", "null"], "items": {"type": "string"}},
+              "zero_results": {"type": "integer"},
+              "success_results": {"type": "integer"}
+            }
+          }
+        }
+      }
+    }
+  }
+}`,
+}
+
+// registerOutputSchemas publishes each output schema as an MCP resource. mcp-go does not
+// yet support a tool outputSchema field, so tool descriptions point at these URIs instead.
+func registerOutputSchemas(s *server.MCPServer) {
+	for _, name := range []string{outputSchemaResults, outputSchemaBatch, outputSchemaStats} {
+		uri, schema := outputSchemaURI(name), outputSchemas[name]
+		resource := mcp.NewResource(uri, name+" output schema",
+			mcp.WithResourceDescription(fmt.Sprintf("JSON Schema for %s JSON output, version %s.", name, outputSchemaVersion)),
+			mcp.WithMIMEType("application/schema+json"),
+		)
+		s.AddResource(resource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "application/schema+json", Text: schema}}, nil
+		})
+	}
+}
+
+// marshalStats encodes a stats envelope as indented JSON.
+func marshalStats(kind string, data interface{}) (string, error) {
+	out, err := json.MarshalIndent(newStatsOutput(kind, data), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
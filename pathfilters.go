@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+//================================================================================
+// Path Post-Filters
+//================================================================================
+
+// pathPostFilter drops files by path shape after the search, independently of grep.app's
+// substring path filter.
+type pathPostFilter struct {
+	MaxDepth   int            // Maximum number of path segments; 1 keeps only top-level files
+	FilenameRe *regexp.Regexp // Matched against the file name only
+	Extensions []string       // Lowercase extensions with a leading dot
+}
+
+// parsePathPostFilter reads maxPathDepth, filenameRegex and extensionFilter. It returns nil
+// when none of them is set.
+func parsePathPostFilter(args map[string]interface{}) (*pathPostFilter, error) {
+	filter := &pathPostFilter{}
+	if v, ok := args["maxPathDepth"].(float64); ok {
+		if v < 1 {
+			return nil, fmt.Errorf("maxPathDepth must be at least 1")
+		}
+		filter.MaxDepth = int(v)
+	}
+	if v, _ := args["filenameRegex"].(string); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filenameRegex: %w", err)
+		}
+		filter.FilenameRe = re
+	}
+	if v, _ := args["extensionFilter"].(string); v != "" {
+		for _, ext := range splitCommaList(v) {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			filter.Extensions = append(filter.Extensions, ext)
+		}
+	}
+	if filter.MaxDepth == 0 && filter.FilenameRe == nil && len(filter.Extensions) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// matches reports whether a file path passes every configured filter.
+func (f *pathPostFilter) matches(filePath string) bool {
+	filePath = strings.Trim(filePath, "/")
+	if f.MaxDepth > 0 && strings.Count(filePath, "/")+1 > f.MaxDepth {
+		return false
+	}
+	name := path.Base(filePath)
+	if f.FilenameRe != nil && !f.FilenameRe.MatchString(name) {
+		return false
+	}
+	if len(f.Extensions) > 0 && !containsString(f.Extensions, strings.ToLower(path.Ext(name))) {
+		return false
+	}
+	return true
+}
+
+// describe lists the configured filters for log messages.
+func (f *pathPostFilter) describe() string {
+	var parts []string
+	if f.MaxDepth > 0 {
+		parts = append(parts, fmt.Sprintf("maxPathDepth=%d", f.MaxDepth))
+	}
+	if f.FilenameRe != nil {
+		parts = append(parts, fmt.Sprintf("filenameRegex=%s", f.FilenameRe))
+	}
+	if len(f.Extensions) > 0 {
+		parts = append(parts, "extensionFilter="+strings.Join(f.Extensions, ","))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// applyPathPostFilter keeps the files whose paths pass the filter.
+func applyPathPostFilter(hits *Hits, filter *pathPostFilter) *Hits {
+	filteredHits := &Hits{Hits: make(map[string]map[string]map[string]string), Context: hits.Context}
+	for repo, pathData := range hits.Hits {
+		for filePath, lines := range pathData {
+			if !filter.matches(filePath) {
+				continue
+			}
+			if filteredHits.Hits[repo] == nil {
+				filteredHits.Hits[repo] = make(map[string]map[string]string)
+			}
+			filteredHits.Hits[repo][filePath] = lines
+		}
+	}
+	return filteredHits
+}
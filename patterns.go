@@ -0,0 +1,389 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Pattern Library
+//================================================================================
+
+const (
+	patternBundleFormat  = "grepapp-patterns"
+	patternBundleVersion = 1
+	patternLibraryName   = "patterns.json"
+	patternKeyFileName   = "signing.key"
+)
+
+// patternKinds are the kinds of saved pattern: a search to rerun, a template whose query
+// the caller completes, and a security check preset.
+var patternKinds = []string{"search", "template", "security"}
+
+// SearchPattern is a named set of searchCode arguments kept in the pattern library.
+type SearchPattern struct {
+	Name        string                 `json:"name"`
+	Kind        string                 `json:"kind"`
+	Description string                 `json:"description,omitempty"`
+	Arguments   map[string]interface{} `json:"arguments"` // searchCode arguments
+	Tags        []string               `json:"tags,omitempty"`
+	Source      string                 `json:"source,omitempty"` // Publisher of the bundle the pattern was imported from
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// validate checks the pattern's name, kind and searchCode arguments.
+func (p *SearchPattern) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("pattern name must not be empty")
+	}
+	if p.Kind == "" {
+		p.Kind = "search"
+	}
+	if !containsString(patternKinds, p.Kind) {
+		return fmt.Errorf("unknown pattern kind %q (expected one of %s)", p.Kind, strings.Join(patternKinds, ", "))
+	}
+	if _, err := parseSearchOptions(p.Arguments); err != nil {
+		return fmt.Errorf("pattern %q: %w", p.Name, err)
+	}
+	return nil
+}
+
+// patternLibraryMu serializes reads and writes of the library file.
+var patternLibraryMu sync.Mutex
+
+// patternDir holds the library and the signing key. It is a subdirectory of the cache
+// directory, so clearing the cache leaves it alone.
+func patternDir() string {
+	if path := GetConfig().PatternsFile; path != "" {
+		return filepath.Dir(path)
+	}
+	return filepath.Join(GetConfig().CacheDir, "patterns")
+}
+
+func patternLibraryFile() string {
+	if path := GetConfig().PatternsFile; path != "" {
+		return path
+	}
+	return filepath.Join(patternDir(), patternLibraryName)
+}
+
+// loadPatterns reads the library. A missing file is an empty library.
+func loadPatterns() (map[string]SearchPattern, error) {
+	patterns := make(map[string]SearchPattern)
+	data, err := os.ReadFile(patternLibraryFile())
+	if os.IsNotExist(err) {
+		return patterns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []SearchPattern
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse pattern library %s: %w", patternLibraryFile(), err)
+	}
+	for _, p := range list {
+		patterns[p.Name] = p
+	}
+	return patterns, nil
+}
+
+// storePatterns replaces the library file atomically, with patterns sorted by name.
+func storePatterns(patterns map[string]SearchPattern) error {
+	encoded, err := json.MarshalIndent(sortedPatterns(patterns, ""), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := patternLibraryFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encoded, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// sortedPatterns lists the patterns of a kind, or all when kind is empty, by name.
+func sortedPatterns(patterns map[string]SearchPattern, kind string) []SearchPattern {
+	list := make([]SearchPattern, 0, len(patterns))
+	for _, p := range patterns {
+		if kind == "" || p.Kind == kind {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// savePattern validates a pattern and adds it to the library, replacing one of the same name.
+func savePattern(p SearchPattern) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.UpdatedAt = time.Now().UTC()
+	patternLibraryMu.Lock()
+	defer patternLibraryMu.Unlock()
+	patterns, err := loadPatterns()
+	if err != nil {
+		return err
+	}
+	patterns[p.Name] = p
+	return storePatterns(patterns)
+}
+
+// deletePattern removes a pattern from the library.
+func deletePattern(name string) error {
+	patternLibraryMu.Lock()
+	defer patternLibraryMu.Unlock()
+	patterns, err := loadPatterns()
+	if err != nil {
+		return err
+	}
+	if _, ok := patterns[name]; !ok {
+		return fmt.Errorf("no pattern named %q", name)
+	}
+	delete(patterns, name)
+	return storePatterns(patterns)
+}
+
+// listPatterns returns the library's patterns of a kind, or all when kind is empty.
+func listPatterns(kind string) ([]SearchPattern, error) {
+	patternLibraryMu.Lock()
+	defer patternLibraryMu.Unlock()
+	patterns, err := loadPatterns()
+	if err != nil {
+		return nil, err
+	}
+	return sortedPatterns(patterns, kind), nil
+}
+
+//================================================================================
+// Signed Pattern Bundles
+//================================================================================
+
+// PatternBundle is the signed form in which patterns are shared between servers. The
+// signature covers the payload bytes exactly as they appear in the bundle.
+type PatternBundle struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	Payload   json.RawMessage `json:"payload"`    // Encoded patternPayload
+	PublicKey string          `json:"public_key"` // Base64 Ed25519 key that verifies the signature
+	Signature string          `json:"signature"`  // Base64 Ed25519 signature of the payload
+}
+
+type patternPayload struct {
+	Publisher string          `json:"publisher,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Patterns  []SearchPattern `json:"patterns"`
+}
+
+// patternSigningKey loads the server's signing key, creating one on first use. The file
+// holds the base64 Ed25519 seed.
+func patternSigningKey() (ed25519.PrivateKey, error) {
+	path := GetConfig().PatternKeyFile
+	if path == "" {
+		path = filepath.Join(patternDir(), patternKeyFileName)
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("signing key %s is not a base64 Ed25519 seed", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	log.Printf("🔑 Created pattern signing key %s", path)
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// exportPatternBundle signs the named patterns, or every pattern of kind when names is
+// empty, into a bundle.
+func exportPatternBundle(names []string, kind, publisher string) (*PatternBundle, error) {
+	all, err := listPatterns(kind)
+	if err != nil {
+		return nil, err
+	}
+	payload := patternPayload{Publisher: publisher, CreatedAt: time.Now().UTC()}
+	if len(names) == 0 {
+		payload.Patterns = all
+	} else {
+		byName := make(map[string]SearchPattern, len(all))
+		for _, p := range all {
+			byName[p.Name] = p
+		}
+		for _, name := range names {
+			p, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("no pattern named %q", name)
+			}
+			payload.Patterns = append(payload.Patterns, p)
+		}
+	}
+	if len(payload.Patterns) == 0 {
+		return nil, fmt.Errorf("no patterns to export")
+	}
+	for i := range payload.Patterns {
+		payload.Patterns[i].Source = "" // The bundle's publisher replaces it on import
+	}
+
+	key, err := patternSigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &PatternBundle{
+		Format:    patternBundleFormat,
+		Version:   patternBundleVersion,
+		Payload:   encoded,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, encoded)),
+	}, nil
+}
+
+// PatternImportResult reports what importPatternBundle changed.
+type PatternImportResult struct {
+	Publisher string   `json:"publisher,omitempty"`
+	PublicKey string   `json:"public_key"`
+	Trusted   bool     `json:"trusted"` // Signed by this server or a configured trusted key
+	Added     []string `json:"added,omitempty"`
+	Replaced  []string `json:"replaced,omitempty"`
+	Skipped   []string `json:"skipped,omitempty"` // Names already in the library, kept without overwrite
+}
+
+var errUntrustedBundle = errors.New("bundle is signed by an untrusted key")
+
+// verifyPatternBundle checks the bundle's format and signature and decodes its payload.
+// trusted reports whether the signing key is this server's own or a configured trusted key.
+func verifyPatternBundle(bundle *PatternBundle) (payload *patternPayload, trusted bool, err error) {
+	if bundle.Format != patternBundleFormat || bundle.Version != patternBundleVersion {
+		return nil, false, fmt.Errorf("not a version %d %s bundle", patternBundleVersion, patternBundleFormat)
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(bundle.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, false, fmt.Errorf("bundle public key is not a base64 Ed25519 key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(bundle.Signature)
+	if err != nil || !ed25519.Verify(publicKey, bundle.Payload, signature) {
+		return nil, false, fmt.Errorf("bundle signature does not match its payload")
+	}
+	if err := json.Unmarshal(bundle.Payload, &payload); err != nil {
+		return nil, false, fmt.Errorf("failed to parse bundle payload: %w", err)
+	}
+
+	trusted = containsString(GetConfig().TrustedPatternKeys, bundle.PublicKey)
+	if own, err := patternSigningKey(); err == nil && bundle.PublicKey == base64.StdEncoding.EncodeToString(own.Public().(ed25519.PublicKey)) {
+		trusted = true
+	}
+	return payload, trusted, nil
+}
+
+// importPatternBundle verifies a bundle and adds its patterns to the library. Bundles
+// signed by an unknown key are refused unless allowUntrusted is set; existing patterns are
+// kept unless overwrite is set.
+func importPatternBundle(encoded string, overwrite, allowUntrusted bool) (*PatternImportResult, error) {
+	var bundle PatternBundle
+	if err := json.Unmarshal([]byte(encoded), &bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	payload, trusted, err := verifyPatternBundle(&bundle)
+	if err != nil {
+		return nil, err
+	}
+	if !trusted && !allowUntrusted {
+		return nil, fmt.Errorf("%w %s; add it to -trusted-pattern-keys or set allowUntrusted", errUntrustedBundle, bundle.PublicKey)
+	}
+	for i := range payload.Patterns {
+		if err := payload.Patterns[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	patternLibraryMu.Lock()
+	defer patternLibraryMu.Unlock()
+	patterns, err := loadPatterns()
+	if err != nil {
+		return nil, err
+	}
+	result := &PatternImportResult{Publisher: payload.Publisher, PublicKey: bundle.PublicKey, Trusted: trusted}
+	source := payload.Publisher
+	if source == "" {
+		source = bundle.PublicKey
+	}
+	for _, p := range payload.Patterns {
+		_, exists := patterns[p.Name]
+		switch {
+		case exists && !overwrite:
+			result.Skipped = append(result.Skipped, p.Name)
+			continue
+		case exists:
+			result.Replaced = append(result.Replaced, p.Name)
+		default:
+			result.Added = append(result.Added, p.Name)
+		}
+		p.Source = source
+		patterns[p.Name] = p
+	}
+	if len(result.Added)+len(result.Replaced) > 0 {
+		if err := storePatterns(patterns); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// formatPatternList renders the library as a readable list.
+func formatPatternList(patterns []SearchPattern) string {
+	if len(patterns) == 0 {
+		return "📚 The pattern library is empty. Save one with savePattern or import a bundle with importPatterns."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "📚 %d saved patterns:\n", len(patterns))
+	for _, p := range patterns {
+		args, _ := json.Marshal(p.Arguments)
+		fmt.Fprintf(&b, "\n🔖 %s [%s]", p.Name, p.Kind)
+		if len(p.Tags) > 0 {
+			fmt.Fprintf(&b, " #%s", strings.Join(p.Tags, " #"))
+		}
+		if p.Source != "" {
+			fmt.Fprintf(&b, " (from %s)", p.Source)
+		}
+		b.WriteString("\n")
+		if p.Description != "" {
+			fmt.Fprintf(&b, "   %s\n", p.Description)
+		}
+		fmt.Fprintf(&b, "   searchCode %s\n", args)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
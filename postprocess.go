@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+//================================================================================
+// Retrieved Content Post-Processing
+//================================================================================
+
+// minSummarizedBlobChars is the shortest base64 payload replaced by a summary; small
+// inline icons are left alone.
+const minSummarizedBlobChars = 256
+
+// ContentProcessing records how a retrieved file was rewritten to keep it readable.
+type ContentProcessing struct {
+	Kind            string `json:"kind"` // "notebook" or "svg"
+	OriginalBytes   int    `json:"original_bytes"`
+	Cells           int    `json:"cells,omitempty"`
+	CodeCells       int    `json:"code_cells,omitempty"`
+	MarkdownCells   int    `json:"markdown_cells,omitempty"`
+	OutputsStripped int    `json:"outputs_stripped,omitempty"`
+	BlobsSummarized int    `json:"blobs_summarized,omitempty"`
+	Note            string `json:"note,omitempty"`
+}
+
+var dataURIPattern = regexp.MustCompile(fmt.Sprintf(`data:([A-Za-z0-9.+/-]+);base64,[A-Za-z0-9+/=\s]{%d,}`, minSummarizedBlobChars))
+
+// postProcessContent applies content-type-aware rewriting to notebooks and SVGs. Other
+// files are returned unchanged with a nil summary.
+func postProcessContent(filePath, content string, opts retrievalOptions) (string, *ContentProcessing) {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".ipynb":
+		return processNotebook(content, opts.KeepNotebookOutputs)
+	case ".svg":
+		processed, blobs := summarizeDataURIs(content)
+		if blobs == 0 {
+			return content, nil
+		}
+		return processed, &ContentProcessing{Kind: "svg", OriginalBytes: len(content), BlobsSummarized: blobs}
+	}
+	return content, nil
+}
+
+// summarizeDataURIs replaces large base64 data URIs with a short placeholder.
+func summarizeDataURIs(content string) (string, int) {
+	count := 0
+	processed := dataURIPattern.ReplaceAllStringFunc(content, func(match string) string {
+		count++
+		mime := dataURIPattern.FindStringSubmatch(match)[1]
+		payload := match[strings.Index(match, ",")+1:]
+		return fmt.Sprintf("data:%s;base64,[%d bytes omitted]", mime, base64DecodedSize(payload))
+	})
+	return processed, count
+}
+
+// processNotebook strips cell outputs (or summarizes binary blobs within them when
+// keepOutputs is set) and counts cells by type.
+func processNotebook(content string, keepOutputs bool) (string, *ContentProcessing) {
+	summary := &ContentProcessing{Kind: "notebook", OriginalBytes: len(content)}
+
+	var notebook map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &notebook); err != nil {
+		summary.Note = "notebook JSON could not be parsed; returned unchanged"
+		return content, summary
+	}
+	var cells []map[string]interface{}
+	if err := json.Unmarshal(notebook["cells"], &cells); err != nil {
+		summary.Note = "notebook has no readable cells; returned unchanged"
+		return content, summary
+	}
+
+	for _, cell := range cells {
+		summary.Cells++
+		switch cell["cell_type"] {
+		case "code":
+			summary.CodeCells++
+		case "markdown":
+			summary.MarkdownCells++
+		}
+		if outputs, ok := cell["outputs"].([]interface{}); ok && len(outputs) > 0 {
+			if keepOutputs {
+				summary.BlobsSummarized += summarizeNotebookBlobs(outputs)
+			} else {
+				summary.OutputsStripped += len(outputs)
+				cell["outputs"] = []interface{}{}
+			}
+		}
+		if attachments, ok := cell["attachments"].(map[string]interface{}); ok {
+			for _, attachment := range attachments {
+				if data, ok := attachment.(map[string]interface{}); ok {
+					summary.BlobsSummarized += summarizeMimeBundle(data)
+				}
+			}
+		}
+	}
+
+	cellsJSON, err := marshalNotebookJSON(cells, "")
+	if err != nil {
+		summary.Note = "failed to re-encode cells; returned unchanged"
+		return content, summary
+	}
+	notebook["cells"] = cellsJSON
+	processed, err := marshalNotebookJSON(notebook, " ")
+	if err != nil {
+		summary.Note = "failed to re-encode notebook; returned unchanged"
+		return content, summary
+	}
+	return string(processed), summary
+}
+
+// marshalNotebookJSON encodes without HTML escaping so source and outputs stay verbatim.
+func marshalNotebookJSON(v interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// summarizeNotebookBlobs summarizes binary payloads in the data bundle of each output.
+func summarizeNotebookBlobs(outputs []interface{}) int {
+	count := 0
+	for _, output := range outputs {
+		if out, ok := output.(map[string]interface{}); ok {
+			if data, ok := out["data"].(map[string]interface{}); ok {
+				count += summarizeMimeBundle(data)
+			}
+		}
+	}
+	return count
+}
+
+// summarizeMimeBundle replaces base64 values of binary MIME types with a placeholder.
+// Text types such as text/plain and image/svg+xml are kept.
+func summarizeMimeBundle(data map[string]interface{}) int {
+	count := 0
+	for mime, value := range data {
+		if !isBinaryMime(mime) {
+			continue
+		}
+		var payload string
+		switch v := value.(type) {
+		case string:
+			payload = v
+		case []interface{}:
+			for _, part := range v {
+				if s, ok := part.(string); ok {
+					payload += s
+				}
+			}
+		}
+		if len(payload) < minSummarizedBlobChars {
+			continue
+		}
+		data[mime] = fmt.Sprintf("[base64 %s, %d bytes omitted]", mime, base64DecodedSize(payload))
+		count++
+	}
+	return count
+}
+
+func isBinaryMime(mime string) bool {
+	if mime == "image/svg+xml" {
+		return false
+	}
+	return strings.HasPrefix(mime, "image/") || strings.HasPrefix(mime, "audio/") ||
+		strings.HasPrefix(mime, "video/") || mime == "application/pdf"
+}
+
+// base64DecodedSize estimates the decoded size of a base64 payload, ignoring whitespace.
+func base64DecodedSize(payload string) int {
+	n := 0
+	for i := 0; i < len(payload); i++ {
+		switch payload[i] {
+		case ' ', '\n', '\r', '\t', '=':
+		default:
+			n++
+		}
+	}
+	return n * 3 / 4
+}
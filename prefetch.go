@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Background Complete-Result Prefetch
+//================================================================================
+
+// prefetchTimeout bounds a background scan; it runs detached from the caller's context.
+const prefetchTimeout = 2 * time.Minute
+
+// inflightPrefetches holds the complete cache keys currently being fetched in the background.
+var inflightPrefetches sync.Map
+
+// startCompletePrefetch scans all result pages in the background and stores the merged
+// hits as the complete result of cacheQuery, the query as the caller sent it, so a follow-up
+// search or batch retrieval can use them. It returns false when a prefetch for the same query is already running.
+func startCompletePrefetch(client *http.Client, args map[string]interface{}, cacheQuery string) bool {
+	query, _ := args["query"].(string)
+	cacheKey := completeCacheKey(cacheQuery)
+	if _, running := inflightPrefetches.LoadOrStore(cacheKey, struct{}{}); running {
+		log.Printf("⏭️ Background prefetch already running for query '%s'", query)
+		return false
+	}
+
+	go func() {
+		defer inflightPrefetches.Delete(cacheKey)
+		if err := runCompletePrefetch(client, copyArgs(args), cacheQuery); err != nil {
+			log.Printf("⚠️ Background prefetch failed for query '%s': %v", query, err)
+			if logger := GetLogger(); logger != nil {
+				logger.LogErrorMsg(fmt.Sprintf("❌ Background prefetch failed: %v", err), "searchCode", err, map[string]interface{}{"query": query})
+			}
+		}
+	}()
+	return true
+}
+
+// runCompletePrefetch performs the full scan and caches it as the complete result of
+// cacheQuery. Incomplete scans are not cached because their result numbers would not match
+// a later full search.
+func runCompletePrefetch(client *http.Client, args map[string]interface{}, cacheQuery string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+	defer cancel()
+
+	query, _ := args["query"].(string)
+	start := time.Now()
+	log.Printf("🔄 Background prefetch started for query '%s'", query)
+
+	maxPages, _ := parseMaxPagesArg(args) // Validated by the tool handler
+	scan, err := scanGrepAppLanguages(ctx, client, args, maxPages)
+	if err != nil {
+		return err
+	}
+	if len(scan.SchemaIssues) > 0 {
+		return fmt.Errorf("upstream schema issues: %v", scan.SchemaIssues)
+	}
+
+	fullRes := fullSearchResult{Hits: *scan.Hits, Count: scan.TotalCount}
+	if err := cacheData(completeCacheKey(cacheQuery), fullRes, cacheQuery, cacheEntryComplete); err != nil {
+		return fmt.Errorf("failed to cache complete results: %w", err)
+	}
+
+	log.Printf("💾 Background prefetch cached %d files from %d pages in %v", countFiles(scan.Hits), scan.PagesScanned, time.Since(start))
+	if logger := GetLogger(); logger != nil {
+		logger.LogInfo("💾 Background prefetch cached complete results", "searchCode", map[string]interface{}{
+			"query":        query,
+			"pages":        scan.PagesScanned,
+			"api_requests": scan.APIRequests,
+			"duration_ms":  time.Since(start).Milliseconds(),
+		})
+	}
+	return nil
+}
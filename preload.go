@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Cache Preload
+//================================================================================
+
+// preloadedFiles holds file contents bundled in preloaded snapshots, keyed by repository
+// and path, so batch retrieval can serve them without calling GitHub.
+var preloadedFiles = struct {
+	sync.RWMutex
+	files map[string]string
+}{files: make(map[string]string)}
+
+// PreloadSummary counts what was imported from the preloaded snapshots.
+type PreloadSummary struct {
+	Archives int
+	Queries  []string
+	Files    int
+	Expired  []string // Queries whose results are older than the complete-result TTL
+}
+
+func preloadedFileKey(repo, filePath string) string {
+	return canonicalRepo(repo) + "/" + strings.TrimPrefix(filePath, "/")
+}
+
+// preloadedFile returns the bundled content of a file from a preloaded snapshot.
+func preloadedFile(repo, filePath string) (string, bool) {
+	preloadedFiles.RLock()
+	defer preloadedFiles.RUnlock()
+	content, ok := preloadedFiles.files[preloadedFileKey(repo, filePath)]
+	return content, ok
+}
+
+// preloadArchivePaths expands each path into snapshot archives: a file is used as is and a
+// directory contributes its *.zip files in name order.
+func preloadArchivePaths(paths []string) ([]string, error) {
+	var archives []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			archives = append(archives, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.zip"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no snapshot archives (*.zip) in %s", p)
+		}
+		sort.Strings(matches)
+		archives = append(archives, matches...)
+	}
+	return archives, nil
+}
+
+// preloadSnapshots imports snapshot archives exported by exportSnapshot at startup. Each
+// query's complete results are cached for batch retrieval and, with the filters recorded
+// in the snapshot, as a complete scan so a repeated searchCode is served without calling
+// grep.app. Bundled files are kept in memory for batch retrieval. Preloaded results
+// replace cached results for the same query.
+func preloadSnapshots(paths []string) (*PreloadSummary, error) {
+	if GetConfig().NoCache {
+		return nil, fmt.Errorf("preloading snapshots requires the cache, which is disabled")
+	}
+	archives, err := preloadArchivePaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	summary := &PreloadSummary{}
+	for _, archivePath := range archives {
+		archive, err := os.ReadFile(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		manifest, result, files, err := restoreSnapshot(archive, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", archivePath, err)
+		}
+		if ttl := cacheTTLFor(cacheEntryComplete, 0); !manifest.CachedAt.IsZero() && time.Since(manifest.CachedAt) > ttl {
+			summary.Expired = append(summary.Expired, manifest.Query)
+		}
+		if err := seedSnapshotScan(manifest, result); err != nil {
+			return nil, fmt.Errorf("%s: %w", archivePath, err)
+		}
+
+		preloadedFiles.Lock()
+		for _, file := range files {
+			if file.Type == "file" && file.Error == "" {
+				preloadedFiles.files[preloadedFileKey(file.Repo, file.Path)] = file.Content
+				summary.Files++
+			}
+		}
+		preloadedFiles.Unlock()
+
+		summary.Archives++
+		summary.Queries = append(summary.Queries, manifest.Query)
+	}
+	return summary, nil
+}
+
+// seedSnapshotScan caches a snapshot's complete results under the scan key of the search
+// that produced them. Snapshots do not record regex or case options, so the scan is
+// cached for a plain search. Multi-language searches are scanned per language and cannot
+// be rebuilt from merged results; they are only cached for batch retrieval.
+func seedSnapshotScan(manifest *SnapshotManifest, result *fullSearchResult) error {
+	args := map[string]interface{}{"query": manifest.Query}
+	if v := manifest.Filters["repo"]; v != "" {
+		args["repoFilter"] = v
+	}
+	if v := manifest.Filters["path"]; v != "" {
+		args["pathFilter"] = v
+	}
+	if v := manifest.Filters["lang"]; v != "" {
+		lang, _ := canonicalizeLangFilter(v)
+		if strings.Contains(lang, ",") {
+			return nil
+		}
+		args["langFilter"] = lang
+	}
+
+	fetchedAt := manifest.CachedAt
+	if fetchedAt.IsZero() {
+		fetchedAt = time.Now()
+	}
+	return cacheDataAt(scanCacheKey(args), completeScan{Hits: result.Hits, TotalCount: result.Count}, manifest.Query, cacheEntrySearchScan, fetchedAt)
+}
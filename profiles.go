@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Tenant Profiles
+//================================================================================
+
+// Upstream providers a profile can be allowed to call.
+const (
+	providerGrepApp = "grepapp"
+	providerGitHub  = "github"
+)
+
+// errProviderNotAllowed is returned when a tenant's profile does not permit a provider.
+var errProviderNotAllowed = errors.New("provider not allowed for this tenant")
+
+// errSnapshotImportNotAllowed is returned when a tenant without allowSnapshotImport, or an
+// HTTP caller without a tenant while -allow-snapshot-import is off, imports a snapshot.
+var errSnapshotImportNotAllowed = errors.New("snapshot import not allowed for this caller")
+
+// TenantProfile is the policy applied to HTTP callers presenting one of its API keys.
+// Zero limits fall back to the server-wide budget.
+type TenantProfile struct {
+	Name                string   `json:"name"`
+	APIKeys             []string `json:"apiKeys"`
+	GitHubToken         string   `json:"githubToken,omitempty"`
+	AllowedProviders    []string `json:"allowedProviders,omitempty"` // Empty allows every provider
+	MaxRequestsPerCall  int      `json:"maxRequestsPerCall,omitempty"`
+	MaxRequestsPerHour  int      `json:"maxRequestsPerHour,omitempty"`
+	RedactSecrets       bool     `json:"redactSecrets,omitempty"`       // Mask credentials found in returned file contents
+	AllowSnapshotImport bool     `json:"allowSnapshotImport,omitempty"` // Let importSnapshot replace the complete results every tenant shares
+
+	stats        *apiStatsRegistry
+	githubOnce   sync.Once
+	githubClient *github.Client
+}
+
+// profileSet indexes the configured profiles by API key.
+type profileSet struct {
+	profiles []*TenantProfile
+	byKey    map[string]*TenantProfile
+}
+
+// tenantProfiles is nil when no profiles file is configured, leaving the HTTP transport open.
+var tenantProfiles *profileSet
+
+// loadProfiles reads and validates a profiles file of the form {"profiles": [...]}.
+func loadProfiles(path string) (*profileSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %w", err)
+	}
+	var file struct {
+		Profiles []*TenantProfile `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles file: %w", err)
+	}
+	if len(file.Profiles) == 0 {
+		return nil, fmt.Errorf("profiles file %s defines no profiles", path)
+	}
+
+	set := &profileSet{byKey: make(map[string]*TenantProfile)}
+	names := make(map[string]bool)
+	for i, profile := range file.Profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("profile %d has no name", i+1)
+		}
+		if names[profile.Name] {
+			return nil, fmt.Errorf("duplicate profile name %q", profile.Name)
+		}
+		names[profile.Name] = true
+		if len(profile.APIKeys) == 0 {
+			return nil, fmt.Errorf("profile %q has no API keys", profile.Name)
+		}
+		for _, key := range profile.APIKeys {
+			if key == "" {
+				return nil, fmt.Errorf("profile %q has an empty API key", profile.Name)
+			}
+			if other, ok := set.byKey[key]; ok {
+				return nil, fmt.Errorf("profiles %q and %q share an API key", other.Name, profile.Name)
+			}
+			set.byKey[key] = profile
+		}
+		for _, provider := range profile.AllowedProviders {
+			if provider != providerGrepApp && provider != providerGitHub {
+				return nil, fmt.Errorf("profile %q allows unknown provider %q (expected %s or %s)", profile.Name, provider, providerGrepApp, providerGitHub)
+			}
+		}
+		if profile.MaxRequestsPerCall < 0 || profile.MaxRequestsPerHour < 0 {
+			return nil, fmt.Errorf("profile %q has a negative request limit", profile.Name)
+		}
+		profile.stats = &apiStatsRegistry{}
+		set.profiles = append(set.profiles, profile)
+	}
+	return set, nil
+}
+
+// lookup returns the profile owning the API key.
+func (ps *profileSet) lookup(key string) (*TenantProfile, bool) {
+	if ps == nil || key == "" {
+		return nil, false
+	}
+	profile, ok := ps.byKey[key]
+	return profile, ok
+}
+
+// allowsProvider reports whether the profile may call the provider.
+func (p *TenantProfile) allowsProvider(provider string) bool {
+	return len(p.AllowedProviders) == 0 || containsString(p.AllowedProviders, provider)
+}
+
+// providerForHost maps an upstream host to its provider name.
+func providerForHost(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case host == "grep.app" || strings.HasSuffix(host, ".grep.app"):
+		return providerGrepApp
+	case host == "github.com" || strings.HasSuffix(host, ".github.com") || strings.HasSuffix(host, ".githubusercontent.com"):
+		return providerGitHub
+	default:
+		return host
+	}
+}
+
+// githubClientFor returns the tenant's token-authenticated GitHub client, or fallback when
+// the call has no tenant or the tenant has no token.
+func githubClientFor(ctx context.Context, fallback *github.Client) *github.Client {
+	tenant := tenantFromContext(ctx)
+	if tenant == nil || tenant.GitHubToken == "" {
+		return fallback
+	}
+	tenant.githubOnce.Do(func() {
+		client := github.NewClient(&http.Client{Transport: newBudgetTransport(newHeaderTransport(newStatsTransport(nil)))})
+		tenant.githubClient = client.WithAuthToken(tenant.GitHubToken)
+	})
+	return tenant.githubClient
+}
+
+//================================================================================
+// Tenant Context
+//================================================================================
+
+type tenantKey struct{}
+
+// withTenant attaches the caller's profile to the context.
+func withTenant(ctx context.Context, profile *TenantProfile) context.Context {
+	return context.WithValue(ctx, tenantKey{}, profile)
+}
+
+// tenantFromContext returns the caller's profile, or nil outside a tenant request.
+func tenantFromContext(ctx context.Context) *TenantProfile {
+	profile, _ := ctx.Value(tenantKey{}).(*TenantProfile)
+	return profile
+}
+
+// tenantNameFromContext returns the caller's profile name, or "" outside a tenant request.
+func tenantNameFromContext(ctx context.Context) string {
+	if profile := tenantFromContext(ctx); profile != nil {
+		return profile.Name
+	}
+	return ""
+}
+
+// apiKeyFromRequest reads the API key from "Authorization: Bearer" or X-API-Key.
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// profileAuthMiddleware rejects requests without a known API key and attaches the matching
+// profile to the request context. It is a pass-through when no profiles are configured.
+func profileAuthMiddleware(ps *profileSet, next http.Handler) http.Handler {
+	if ps == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		profile, ok := ps.lookup(apiKeyFromRequest(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="grep-app-mcp"`)
+			http.Error(w, "missing or unknown API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withTenant(r.Context(), profile)))
+	})
+}
+
+// httpCallKey marks tool calls that arrived over the HTTP transport.
+type httpCallKey struct{}
+
+// isHTTPCall reports whether the tool call arrived over the HTTP transport.
+func isHTTPCall(ctx context.Context) bool {
+	marked, _ := ctx.Value(httpCallKey{}).(bool)
+	return marked
+}
+
+// tenantHTTPContext carries the authenticated profile from the HTTP request into tool calls,
+// and marks them as HTTP calls.
+func tenantHTTPContext(ctx context.Context, r *http.Request) context.Context {
+	ctx = context.WithValue(ctx, httpCallKey{}, true)
+	if profile := tenantFromContext(r.Context()); profile != nil {
+		return withTenant(ctx, profile)
+	}
+	return ctx
+}
+
+//================================================================================
+// Tenant Tool Policy
+//================================================================================
+
+// secretPatterns match common credential formats masked for profiles with redactSecrets.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),
+}
+
+// redactSecrets replaces credential-like substrings with a fixed marker.
+func redactSecrets(text string) (string, int) {
+	count := 0
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(string) string {
+			count++
+			return "[REDACTED]"
+		})
+	}
+	return text, count
+}
+
+// redactFiles masks credentials in retrieved file contents when the caller's tenant redacts
+// secrets. Outputs such as zip archives carry the contents in blobs that tenantMiddleware
+// cannot rewrite, so they must be redacted before they are formatted.
+func redactFiles(ctx context.Context, files []RetrievedFile) int {
+	if tenant := tenantFromContext(ctx); tenant == nil || !tenant.RedactSecrets {
+		return 0
+	}
+	redacted := 0
+	for i := range files {
+		var n int
+		files[i].Content, n = redactSecrets(files[i].Content)
+		redacted += n
+	}
+	return redacted
+}
+
+// auditAndRedactFiles hashes and audits files as retrieved upstream, then redacts them for
+// the caller's tenant. Redacted files are hashed again so each sha256 describes the content
+// returned, while the audit log keeps the upstream hashes.
+func auditAndRedactFiles(ctx context.Context, tool string, files []RetrievedFile) {
+	hashFiles(files)
+	auditRetrievals(ctx, tool, files)
+	if redactFiles(ctx, files) > 0 {
+		hashFiles(files)
+	}
+}
+
+// redactHitLines masks credentials in the matched and context lines of hits.
+func redactHitLines(hits *Hits) int {
+	redacted := 0
+	for _, m := range []map[string]map[string]map[string]string{hits.Hits, hits.Context} {
+		for _, files := range m {
+			for _, lines := range files {
+				for lineNum, line := range lines {
+					var n int
+					lines[lineNum], n = redactSecrets(line)
+					redacted += n
+				}
+			}
+		}
+	}
+	return redacted
+}
+
+// queryFingerprint identifies a query in tenant logs without recording its text.
+func queryFingerprint(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:6])
+}
+
+// tenantMiddleware applies the caller's redaction policy to tool results and writes one
+// per-tenant log entry per tool call. Calls without a tenant pass through unchanged.
+func tenantMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		tenant := tenantFromContext(ctx)
+		if tenant == nil {
+			return next(ctx, request)
+		}
+
+		start := time.Now()
+		result, err := next(ctx, request)
+
+		redacted := 0
+		if tenant.RedactSecrets && result != nil {
+			for i, content := range result.Content {
+				if text, ok := content.(mcp.TextContent); ok {
+					var n int
+					text.Text, n = redactSecrets(text.Text)
+					result.Content[i] = text
+					redacted += n
+				}
+			}
+		}
+
+		if logger := LoggerFromContext(ctx); logger != nil {
+			query, _ := request.GetArguments()["query"].(string)
+			data := map[string]interface{}{
+				"tenant":            tenant.Name,
+				"tool":              request.Params.Name,
+				"query_fingerprint": queryFingerprint(query),
+				"duration_ms":       time.Since(start).Milliseconds(),
+				"is_error":          err != nil || (result != nil && result.IsError),
+				"redacted_secrets":  redacted,
+			}
+			if budget, ok := ctx.Value(callBudgetKey{}).(*callBudget); ok {
+				data["api_requests"] = budget.status().CallRequests
+			}
+			logger.LogInfo(fmt.Sprintf("👥 Tool call %s for tenant %s", request.Params.Name, tenant.Name), "tenant", data)
+		}
+		return result, err
+	}
+}
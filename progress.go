@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Progress Notifications
+//================================================================================
+
+// scanProgress is how far one language's page scan has got.
+type scanProgress struct {
+	pages    int // Pages fetched
+	expected int // Pages the scan will fetch, known after the first page
+	files    int // Files collected so far
+}
+
+// progressReporter sends MCP progress notifications for one tool call whose request
+// carried a progress token. Concurrent language scans report into the same reporter.
+type progressReporter struct {
+	mu     sync.Mutex
+	server *server.MCPServer
+	token  mcp.ProgressToken
+	scans  map[string]scanProgress
+	failed bool // Set once a notification could not be sent, to stop trying
+}
+
+type progressReporterKey struct{}
+
+// withProgressReporter attaches a progress reporter that notifies through srv to the
+// context when the client asked for progress notifications.
+func withProgressReporter(ctx context.Context, srv *server.MCPServer, request mcp.CallToolRequest) context.Context {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return ctx
+	}
+	reporter := &progressReporter{server: srv, token: request.Params.Meta.ProgressToken, scans: make(map[string]scanProgress)}
+	return context.WithValue(ctx, progressReporterKey{}, reporter)
+}
+
+// reportPageProgress records a fetched page of the scan for lang and notifies the client
+// with the pages scanned out of those expected across all scans and the running file count.
+func reportPageProgress(ctx context.Context, lang string, pages, expected, files int) {
+	reporter, ok := ctx.Value(progressReporterKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	if reporter.failed {
+		return
+	}
+	reporter.scans[lang] = scanProgress{pages: pages, expected: expected, files: files}
+
+	var done, total, found int
+	for _, scan := range reporter.scans {
+		done += scan.pages
+		total += scan.expected
+		found += scan.files
+	}
+	message := fmt.Sprintf("Scanned %d of %d pages, %d files found", done, total, found)
+	if len(reporter.scans) > 1 {
+		message += fmt.Sprintf(" across %d languages", len(reporter.scans))
+	}
+	params := map[string]any{
+		"progressToken": reporter.token,
+		"progress":      done,
+		"total":         total,
+		"message":       message,
+	}
+	if err := reporter.server.SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+		log.Printf("⚠️ Stopped sending progress notifications: %v", err)
+		reporter.failed = true
+	}
+}
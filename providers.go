@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Provider Capabilities
+//================================================================================
+
+// ProviderHealth summarizes the recent upstream requests to a provider.
+type ProviderHealth struct {
+	Status             string    `json:"status"` // "unknown" before any request, then "healthy" or "failing"
+	Requests           int64     `json:"requests"`
+	Errors             int64     `json:"errors"`
+	ConsecutiveErrors  int       `json:"consecutive_errors"`
+	LastSuccess        time.Time `json:"last_success,omitempty"`
+	LastError          string    `json:"last_error,omitempty"`
+	LastErrorAt        time.Time `json:"last_error_at,omitempty"`
+	RateLimitRemaining *int      `json:"rate_limit_remaining,omitempty"` // From the last X-RateLimit-Remaining header
+	RateLimitReset     time.Time `json:"rate_limit_reset,omitempty"`
+}
+
+// providerHealthTracker records the outcome of every upstream request per provider.
+type providerHealthTracker struct {
+	mu        sync.Mutex
+	providers map[string]*ProviderHealth
+}
+
+var providerHealth = &providerHealthTracker{providers: make(map[string]*ProviderHealth)}
+
+// record notes the outcome of a request to provider. Responses of 300 and above count as
+// errors.
+func (t *providerHealthTracker) record(provider string, resp *http.Response, err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	health, ok := t.providers[provider]
+	if !ok {
+		health = &ProviderHealth{}
+		t.providers[provider] = health
+	}
+	health.Requests++
+	switch {
+	case err != nil:
+		health.LastError = err.Error()
+	case resp.StatusCode >= 300:
+		health.LastError = resp.Status
+	default:
+		health.LastError = ""
+	}
+	if health.LastError != "" {
+		health.Errors++
+		health.ConsecutiveErrors++
+		health.LastErrorAt = now
+	} else {
+		health.ConsecutiveErrors = 0
+		health.LastSuccess = now
+	}
+	if resp == nil {
+		return
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		health.RateLimitRemaining = &remaining
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		health.RateLimitReset = time.Unix(reset, 0).UTC()
+	}
+}
+
+// health returns a copy of the provider's health with its status filled in.
+func (t *providerHealthTracker) health(provider string) ProviderHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	health := ProviderHealth{Status: "unknown"}
+	if recorded, ok := t.providers[provider]; ok {
+		health = *recorded
+		health.Status = "healthy"
+		if health.ConsecutiveErrors > 0 {
+			health.Status = "failing"
+		}
+	}
+	return health
+}
+
+// ProviderInfo describes one upstream provider: what it is used for, which options it
+// supports and its current state.
+type ProviderInfo struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Tools          []string       `json:"tools"`
+	RegexFlavor    string         `json:"regex_flavor,omitempty"`
+	Filters        []string       `json:"filters,omitempty"`
+	Options        []string       `json:"options,omitempty"`
+	MaxPages       int            `json:"max_pages,omitempty"`
+	ResultsPerPage int            `json:"results_per_page,omitempty"`
+	Auth           string         `json:"auth"`
+	Allowed        bool           `json:"allowed"` // The caller's tenant profile may use the provider
+	Health         ProviderHealth `json:"health"`
+}
+
+// grepAppResultsPerPage is the number of hits grep.app returns per page.
+const grepAppResultsPerPage = 10
+
+// listProviders describes every provider as seen by the caller.
+func listProviders(ctx context.Context) []ProviderInfo {
+	tenant := tenantFromContext(ctx)
+	allowed := func(provider string) bool { return tenant == nil || tenant.allowsProvider(provider) }
+
+	githubAuth := "unauthenticated (60 requests per hour)"
+	if tenant != nil && tenant.GitHubToken != "" {
+		githubAuth = "authenticated with the tenant's token"
+	} else if GetConfig().GitHubToken != "" {
+		githubAuth = "authenticated with the server's token"
+	}
+
+	return []ProviderInfo{
+		{
+			Name:           providerGrepApp,
+			Description:    "Code search over public GitHub repositories through the grep.app API.",
+			Tools:          []string{"searchCode", "estimate"},
+			RegexFlavor:    "Go RE2 syntax, validated and re-checked client-side; no backreferences or lookaround",
+			Filters:        []string{"repoFilter", "pathFilter", "langFilter", "extensionFilter", "filenameRegex", "topicFilter"},
+			Options:        []string{"useRegex", "caseSensitive", "wholeWords", "countOnly", "quickFirstPage"},
+			MaxPages:       GetConfig().MaxPages,
+			ResultsPerPage: grepAppResultsPerPage,
+			Auth:           "none required",
+			Allowed:        allowed(providerGrepApp),
+			Health:         providerHealth.health(providerGrepApp),
+		},
+		{
+			Name:        providerGitHub,
+			Description: "File retrieval, directory listings and repository topics through the GitHub REST API.",
+			Tools:       githubTools(),
+			Options:     []string{"ref", "recursive"},
+			Auth:        githubAuth,
+			Allowed:     allowed(providerGitHub),
+			Health:      providerHealth.health(providerGitHub),
+		},
+	}
+}
+
+// githubTools lists the enabled tools that call GitHub, including searchCode when GitHub
+// code search is a configured fallback.
+func githubTools() []string {
+	var tools []string
+	for _, name := range []string{"batchRetrievalTool", "fetchFile", "listDirectory", "exportSnapshot"} {
+		if !toolDisabled(name) {
+			tools = append(tools, name)
+		}
+	}
+	if toolDisabled("searchCode") {
+		return tools
+	}
+	tools = append(tools, "searchCode (topicFilter)")
+	if containsString(GetConfig().Fallback, providerGitHub) {
+		tools = append(tools, "searchCode (fallback when grep.app fails)")
+	}
+	return tools
+}
+
+// ProvidersData is the listProviders payload of StatsOutput.
+type ProvidersData struct {
+	Providers []ProviderInfo `json:"providers"`
+}
+
+// formatProviders renders provider descriptions as a readable summary.
+func formatProviders(providers []ProviderInfo) string {
+	var b strings.Builder
+	for _, p := range providers {
+		icon := map[string]string{"healthy": "✅", "failing": "❌"}[p.Health.Status]
+		if icon == "" {
+			icon = "❔"
+		}
+		fmt.Fprintf(&b, "%s %s: %s\n", icon, p.Name, p.Description)
+		fmt.Fprintf(&b, "   Tools: %s\n", strings.Join(p.Tools, ", "))
+		if p.RegexFlavor != "" {
+			fmt.Fprintf(&b, "   Regex: %s\n", p.RegexFlavor)
+		}
+		if len(p.Filters) > 0 {
+			fmt.Fprintf(&b, "   Filters: %s\n", strings.Join(p.Filters, ", "))
+		}
+		if len(p.Options) > 0 {
+			fmt.Fprintf(&b, "   Options: %s\n", strings.Join(p.Options, ", "))
+		}
+		if p.MaxPages > 0 {
+			fmt.Fprintf(&b, "   Paging: up to %d pages of %d results\n", p.MaxPages, p.ResultsPerPage)
+		}
+		fmt.Fprintf(&b, "   Auth: %s\n", p.Auth)
+		if !p.Allowed {
+			b.WriteString("   🚫 Not allowed for this API key\n")
+		}
+		health := p.Health
+		fmt.Fprintf(&b, "   Health: %s, %d requests, %d errors", health.Status, health.Requests, health.Errors)
+		if health.LastError != "" {
+			fmt.Fprintf(&b, ", last error at %s: %s", health.LastErrorAt.Format(time.RFC3339), health.LastError)
+		}
+		if health.RateLimitRemaining != nil {
+			fmt.Fprintf(&b, ", %d rate-limited requests left until %s", *health.RateLimitRemaining, health.RateLimitReset.Format(time.RFC3339))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
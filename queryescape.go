@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Literal Query Escaping
+//================================================================================
+
+// regexSyntaxHints are constructs that suggest a literal query was meant as a regex.
+// Dots and parentheses are left out because they are common in literal code searches.
+var regexSyntaxHints = []struct {
+	pattern *regexp.Regexp
+	name    string
+}{
+	{regexp.MustCompile(`\.[*+]`), ".* or .+"},
+	{regexp.MustCompile(`\\[dwsbDWSB]`), `escapes such as \d, \w or \s`},
+	{regexp.MustCompile(`\[[^\]]+-[^\]]+\]`), "character ranges such as [a-z]"},
+	{regexp.MustCompile(`^\^|\$$`), "anchors ^ or $"},
+	{regexp.MustCompile(`\w\|\w|\)\|\(`), "alternation with |"},
+	{regexp.MustCompile(`\{\d+(,\d*)?\}`), "repetition such as {2,3}"},
+}
+
+// detectRegexSyntax names the regex constructs found in query.
+func detectRegexSyntax(query string) []string {
+	var found []string
+	for _, hint := range regexSyntaxHints {
+		if hint.pattern.MatchString(query) {
+			found = append(found, hint.name)
+		}
+	}
+	return found
+}
+
+// prepareQuery checks a query against its useRegex setting. Literal queries that look like
+// regexes get a warning suggesting useRegex. Regex queries that do not compile are escaped
+// and searched literally when autoEscape is set; otherwise they are returned unchanged for
+// validation to reject. It returns the query to search and notes for the agent.
+func prepareQuery(query string, useRegex, autoEscape bool) (string, []string) {
+	if !useRegex {
+		if hints := detectRegexSyntax(query); len(hints) > 0 {
+			return query, []string{fmt.Sprintf("⚠️ The query contains regex syntax (%s) but useRegex is false, so it was matched literally. Set useRegex to true to search it as a pattern.", strings.Join(hints, ", "))}
+		}
+		return query, nil
+	}
+	if !autoEscape {
+		return query, nil
+	}
+	if _, err := regexp.Compile(query); err != nil {
+		escaped := regexp.QuoteMeta(query)
+		return escaped, []string{fmt.Sprintf("🔡 The query is not a valid regex (%v), so its metacharacters were escaped and it was searched literally as %s.", err, escaped)}
+	}
+	return query, nil
+}
+
+// withQueryNotes appends query preparation notes to the tool result.
+func withQueryNotes(result *mcp.CallToolResult, notes []string) *mcp.CallToolResult {
+	if len(notes) == 0 || result == nil {
+		return result
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(strings.Join(notes, "\n")))
+	return result
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// GitHub Rate Limit
+//================================================================================
+
+// unauthenticatedGitHubLimit is GitHub's hourly core limit for requests without a token.
+const unauthenticatedGitHubLimit = 60
+
+// GitHubRateLimit is the GitHub core API quota left after a tool call's requests.
+type GitHubRateLimit struct {
+	Limit         int       `json:"limit"`
+	Remaining     int       `json:"remaining"`
+	Reset         time.Time `json:"reset"`
+	Authenticated bool      `json:"authenticated"`
+}
+
+// parseRateLimit reads the core rate limit from a GitHub response's X-RateLimit headers.
+func parseRateLimit(header http.Header) (GitHubRateLimit, bool) {
+	if resource := header.Get("X-RateLimit-Resource"); resource != "" && resource != "core" {
+		return GitHubRateLimit{}, false
+	}
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return GitHubRateLimit{}, false
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return GitHubRateLimit{}, false
+	}
+	rate := GitHubRateLimit{Limit: limit, Remaining: remaining, Authenticated: limit > unauthenticatedGitHubLimit}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rate.Reset = time.Unix(reset, 0).UTC()
+	}
+	return rate, true
+}
+
+// rateLimitRecorder keeps the lowest quota reported to a tool call's GitHub requests,
+// which run concurrently and may finish in any order.
+type rateLimitRecorder struct {
+	mu     sync.Mutex
+	latest *GitHubRateLimit
+}
+
+type rateLimitRecorderKey struct{}
+
+// withRateLimitRecorder attaches a fresh recorder to the context.
+func withRateLimitRecorder(ctx context.Context) (context.Context, *rateLimitRecorder) {
+	recorder := &rateLimitRecorder{}
+	return context.WithValue(ctx, rateLimitRecorderKey{}, recorder), recorder
+}
+
+// observeRateLimit records the quota in resp if its request carries a recorder.
+func observeRateLimit(req *http.Request, resp *http.Response) {
+	recorder, ok := req.Context().Value(rateLimitRecorderKey{}).(*rateLimitRecorder)
+	if !ok || resp == nil {
+		return
+	}
+	rate, ok := parseRateLimit(resp.Header)
+	if !ok {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.latest == nil || rate.Reset.After(recorder.latest.Reset) || (rate.Reset.Equal(recorder.latest.Reset) && rate.Remaining < recorder.latest.Remaining) {
+		recorder.latest = &rate
+	}
+}
+
+// rateLimit returns the recorded quota, or nil when no GitHub response reported one.
+func (r *rateLimitRecorder) rateLimit() *GitHubRateLimit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.latest == nil {
+		return nil
+	}
+	rate := *r.latest
+	return &rate
+}
+
+// String renders the quota as a short line.
+func (r GitHubRateLimit) String() string {
+	auth := "authenticated"
+	if !r.Authenticated {
+		auth = "unauthenticated; set GITHUB_TOKEN to raise the limit"
+	}
+	return fmt.Sprintf("🔑 GitHub rate limit: %d of %d requests left until %s (%s)", r.Remaining, r.Limit, r.Reset.Format(time.RFC3339), auth)
+}
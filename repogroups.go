@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Repository Grouping
+//================================================================================
+
+// RepoGroup summarizes the files retrieved from one repository.
+type RepoGroup struct {
+	Repo        string   `json:"repo"`
+	RepoRef              // Provider, owner and name of Repo
+	Stars       int      `json:"stars,omitempty"`
+	Ref         string   `json:"ref,omitempty"`    // Requested ref, or the default branch, the files were read from
+	Commit      string   `json:"commit,omitempty"` // Commit the ref resolved to
+	Description string   `json:"description,omitempty"`
+	Topics      []string `json:"topics,omitempty"`
+	Numbers     []int    `json:"numbers"` // Result numbers retrieved from the repository
+	Fetched     int      `json:"fetched"`
+	Failed      int      `json:"failed"`
+	Bytes       int      `json:"bytes"`
+}
+
+// repoMeta is the cached subset of GitHub repository metadata.
+type repoMeta struct {
+	Stars         int      `json:"stars"`
+	DefaultBranch string   `json:"default_branch"`
+	Description   string   `json:"description"`
+	Topics        []string `json:"topics"`
+}
+
+// groupFilesByRepo orders files by repository, with repositories in order of their lowest
+// result number, and returns one group per repository.
+func groupFilesByRepo(files []RetrievedFile) ([]RetrievedFile, []RepoGroup) {
+	var groups []RepoGroup
+	index := make(map[string]int)
+	byRepo := make(map[string][]RetrievedFile)
+	for _, file := range files {
+		g, ok := index[file.Repo]
+		if !ok {
+			g = len(groups)
+			index[file.Repo] = g
+			ref, _ := parseRepoRef(file.Repo)
+			groups = append(groups, RepoGroup{Repo: file.Repo, RepoRef: ref, Ref: file.Ref, Commit: file.CommitSHA})
+		}
+		group := &groups[g]
+		if n := len(group.Numbers); n == 0 || group.Numbers[n-1] != file.Number {
+			group.Numbers = append(group.Numbers, file.Number)
+		}
+		if file.Error != "" {
+			group.Failed++
+		} else {
+			group.Fetched++
+			group.Bytes += len(file.Content)
+		}
+		byRepo[file.Repo] = append(byRepo[file.Repo], file)
+	}
+
+	ordered := make([]RetrievedFile, 0, len(files))
+	for _, group := range groups {
+		ordered = append(ordered, byRepo[group.Repo]...)
+	}
+	return ordered, groups
+}
+
+// addRepoDetails fills in stars, default branch, description and topics for each group from cached or freshly
+// fetched repository metadata. Lookups that fail leave the fields empty.
+func addRepoDetails(ctx context.Context, ghClient *github.Client, groups []RepoGroup) {
+	var wg sync.WaitGroup
+	for i := range groups {
+		owner, repo, ok := strings.Cut(groups[i].Repo, "/")
+		if !ok || repoHost(groups[i].Repo) != githubHost {
+			continue
+		}
+		wg.Add(1)
+		go func(group *RepoGroup) {
+			defer wg.Done()
+			meta, err := loadRepoMeta(ctx, ghClient, owner, repo)
+			if err != nil {
+				log.Printf("⚠️ Failed to get repository metadata for %s: %v", group.Repo, err)
+				return
+			}
+			group.Stars = meta.Stars
+			if group.Ref == "" {
+				group.Ref = meta.DefaultBranch
+			}
+			group.Description = meta.Description
+			group.Topics = meta.Topics
+		}(&groups[i])
+	}
+	wg.Wait()
+}
+
+func loadRepoMeta(ctx context.Context, ghClient *github.Client, owner, repo string) (*repoMeta, error) {
+	// Version 2 added description and topics; older entries lack them
+	key := generateCacheKey(map[string]interface{}{"repo_meta": owner + "/" + repo, "version": 2})
+	if cached, err := getCachedData[repoMeta](key, cacheTTLFor(cacheEntryRepoMeta, 0)); err == nil && cached != nil {
+		return cached, nil
+	}
+	repository, _, err := ghClient.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	meta := repoMeta{
+		Stars:         repository.GetStargazersCount(),
+		DefaultBranch: repository.GetDefaultBranch(),
+		Description:   repository.GetDescription(),
+		Topics:        repository.Topics,
+	}
+	if err := cacheData(key, meta, owner+"/"+repo, cacheEntryRepoMeta); err != nil {
+		log.Printf("⚠️ Failed to cache repository metadata for %s/%s: %v", owner, repo, err)
+	}
+	return &meta, nil
+}
+
+// repoHeader renders the Markdown header introducing a repository's files.
+func repoHeader(group RepoGroup) string {
+	var details []string
+	if group.Stars > 0 {
+		details = append(details, fmt.Sprintf("★ %d", group.Stars))
+	}
+	if group.Ref != "" && group.Commit != "" {
+		details = append(details, fmt.Sprintf("ref %s @ %s", group.Ref, group.Commit[:min(12, len(group.Commit))]))
+	} else if group.Ref != "" {
+		details = append(details, "ref "+group.Ref)
+	}
+	details = append(details, fmt.Sprintf("%d fetched", group.Fetched))
+	if group.Failed > 0 {
+		details = append(details, fmt.Sprintf("%d failed", group.Failed))
+	}
+	details = append(details, fmt.Sprintf("%d bytes", group.Bytes))
+	header := fmt.Sprintf("# %s (%s)\n", group.Repo, strings.Join(details, ", "))
+	if group.Description != "" {
+		header += "> " + group.Description + "\n"
+	}
+	if len(group.Topics) > 0 {
+		header += "> Topics: " + strings.Join(group.Topics, ", ") + "\n"
+	}
+	return header
+}
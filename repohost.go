@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+//================================================================================
+// Repository Hosts
+//================================================================================
+
+// githubHost is the only host batch retrieval can currently fetch files from.
+const githubHost = "github.com"
+
+// SkippedHit is a requested result that batch retrieval did not attempt, with the reason.
+type SkippedHit struct {
+	Number int    `json:"number"`
+	Repo   string `json:"repo"`
+	Path   string `json:"path"`
+	Host   string `json:"host"`
+	Reason string `json:"reason"`
+}
+
+// RepoRef identifies a repository in canonical form.
+type RepoRef struct {
+	Provider string `json:"provider"` // Code host, e.g. github.com
+	Owner    string `json:"owner"`    // User, organization or, outside GitHub, group path
+	Name     string `json:"name"`
+}
+
+// String returns the canonical repository string used in results, cache keys and batch
+// retrieval: owner/name on GitHub and host/owner/name elsewhere, as grep.app reports them.
+func (r RepoRef) String() string {
+	if r.Provider == githubHost {
+		return r.Owner + "/" + r.Name
+	}
+	return r.Provider + "/" + r.Owner + "/" + r.Name
+}
+
+// parseRepoRef accepts owner/repo, host/owner/repo, web and clone URLs (https, ssh and
+// git@host:owner/repo) with or without a trailing .git, and returns the canonical form.
+// Paths below the repository in a web URL, such as /tree/main, are dropped.
+func parseRepoRef(repo string) (RepoRef, error) {
+	s := strings.TrimSpace(repo)
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+		if at := strings.Index(s, "@"); at >= 0 && at < strings.IndexAny(s+"/", "/") {
+			s = s[at+1:] // Drop user info, e.g. ssh://git@host/...
+		}
+	} else if at := strings.Index(s, "@"); at >= 0 && strings.Contains(s[at:], ":") {
+		s = strings.Replace(s[at+1:], ":", "/", 1) // git@host:owner/repo
+	}
+	segments := strings.Split(strings.Trim(s, "/"), "/")
+
+	ref := RepoRef{Provider: githubHost}
+	if len(segments) >= 3 && strings.Contains(segments[0], ".") {
+		ref.Provider = strings.TrimPrefix(strings.ToLower(segments[0]), "www.")
+		segments = segments[1:]
+	}
+	if ref.Provider == githubHost && len(segments) > 2 {
+		segments = segments[:2]
+	} else if i := slices.Index(segments, "-"); i >= 0 {
+		segments = segments[:i] // GitLab-style /-/tree/... suffix
+	}
+	if len(segments) < 2 {
+		return RepoRef{}, fmt.Errorf("invalid repository %q: expected owner/repo", repo)
+	}
+	ref.Owner = strings.Join(segments[:len(segments)-1], "/")
+	ref.Name = strings.TrimSuffix(segments[len(segments)-1], ".git")
+	if ref.Owner == "" || ref.Name == "" || strings.ContainsAny(ref.Owner+ref.Name, " \t") {
+		return RepoRef{}, fmt.Errorf("invalid repository %q: expected owner/repo", repo)
+	}
+	return ref, nil
+}
+
+// canonicalRepo normalizes a repository string, returning it trimmed but otherwise
+// unchanged when it cannot be parsed.
+func canonicalRepo(repo string) string {
+	ref, err := parseRepoRef(repo)
+	if err != nil {
+		return strings.TrimSpace(repo)
+	}
+	return ref.String()
+}
+
+// repoHost returns the code host of a search result's repository. grep.app reports GitHub
+// repositories as owner/repo; repositories elsewhere carry their host as the first path
+// segment, e.g. gitlab.com/group/project.
+func repoHost(repo string) string {
+	ref, err := parseRepoRef(repo)
+	if err != nil {
+		return githubHost
+	}
+	return ref.Provider
+}
+
+// skipUnsupportedHost reports whether hit is hosted somewhere batch retrieval cannot fetch
+// from, returning the skipped entry. Support for another host would route its hits to a
+// fetcher here instead of skipping them.
+func skipUnsupportedHost(hit NumberedHit) (SkippedHit, bool) {
+	host := repoHost(hit.Repo)
+	if host == githubHost {
+		return SkippedHit{}, false
+	}
+	return SkippedHit{
+		Number: hit.Number,
+		Repo:   hit.Repo,
+		Path:   hit.Path,
+		Host:   host,
+		Reason: fmt.Sprintf("hosted on %s; only GitHub repositories can be retrieved", host),
+	}, true
+}
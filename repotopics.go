@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Repository Topic Filter
+//================================================================================
+
+// topicLookupWorkers bounds concurrent repository metadata lookups for topicFilter.
+const topicLookupWorkers = 8
+
+// parseTopicFilter reads topicFilter as lowercase GitHub topics. It returns nil when unset.
+func parseTopicFilter(args map[string]interface{}) []string {
+	v, _ := args["topicFilter"].(string)
+	var topics []string
+	for _, topic := range splitCommaList(v) {
+		topics = append(topics, strings.ToLower(topic))
+	}
+	return topics
+}
+
+// applyTopicFilter keeps the repositories tagged with at least one of topics. Repositories
+// whose topics cannot be looked up, including those not hosted on GitHub, are left out and
+// returned as unchecked.
+func applyTopicFilter(ctx context.Context, ghClient *github.Client, hits *Hits, topics []string) (*Hits, []string) {
+	filteredHits := &Hits{Hits: make(map[string]map[string]map[string]string), Context: hits.Context}
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		unchecked []string
+	)
+	slots := make(chan struct{}, topicLookupWorkers)
+	for repoName, pathData := range hits.Hits {
+		owner, repo, ok := strings.Cut(repoName, "/")
+		if !ok || repoHost(repoName) != githubHost {
+			unchecked = append(unchecked, repoName)
+			continue
+		}
+		wg.Add(1)
+		go func(repoName string, pathData map[string]map[string]string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			meta, err := loadRepoMeta(ctx, ghClient, owner, repo)
+			<-slots
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("⚠️ Failed to get topics for %s: %v", repoName, err)
+				unchecked = append(unchecked, repoName)
+				return
+			}
+			if hasAnyTopic(meta.Topics, topics) {
+				filteredHits.Hits[repoName] = pathData
+			}
+		}(repoName, pathData)
+	}
+	wg.Wait()
+	sort.Strings(unchecked)
+	return filteredHits, unchecked
+}
+
+// hasAnyTopic reports whether repoTopics contains one of wanted. GitHub topics are lowercase.
+func hasAnyTopic(repoTopics, wanted []string) bool {
+	for _, topic := range repoTopics {
+		if containsString(wanted, strings.ToLower(topic)) {
+			return true
+		}
+	}
+	return false
+}
+
+// topicFilterNote explains that repositories were left out because their topics are unknown.
+func topicFilterNote(unchecked []string) string {
+	if len(unchecked) == 0 {
+		return ""
+	}
+	shown := unchecked
+	if len(shown) > 5 {
+		shown = shown[:5]
+	}
+	note := fmt.Sprintf("⚠️ topicFilter left out %d repositories whose topics could not be checked: %s", len(unchecked), strings.Join(shown, ", "))
+	if len(unchecked) > len(shown) {
+		note += ", ..."
+	}
+	return note
+}
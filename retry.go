@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//================================================================================
+// Upstream Retries
+//================================================================================
+
+// RetryConfig controls how transient grep.app failures are retried.
+type RetryConfig struct {
+	MaxRetries int           // Retries after the first attempt; 0 disables retrying
+	BaseDelay  time.Duration // Delay before the first retry, doubled for each one after it
+	MaxDelay   time.Duration // Upper bound on a single delay, including Retry-After
+}
+
+func defaultRetryConfig() RetryConfig {
+	return RetryConfig{MaxRetries: 2, BaseDelay: 500 * time.Millisecond, MaxDelay: 8 * time.Second}
+}
+
+// retryableStatus reports whether a response status is worth retrying: rate limiting and
+// server errors are usually transient, other client errors are not.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryableError reports whether a request error is worth retrying. Budget and tenant
+// refusals and a cancelled or expired call would fail again.
+func retryableError(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, errBudgetExceeded) && !errors.Is(err, errProviderNotAllowed)
+}
+
+// backoff returns the delay before retry number attempt (from 0): exponential from the base
+// delay with jitter between half and the full value, capped at the maximum. A Retry-After
+// header sent with the failed response takes precedence when it asks for longer.
+func (c RetryConfig) backoff(attempt int, header http.Header) time.Duration {
+	delay := c.BaseDelay << attempt
+	if delay <= 0 || delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+	delay = delay/2 + rand.N(delay/2+1)
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > delay {
+		delay = min(time.Duration(seconds)*time.Second, c.MaxDelay)
+	}
+	return delay
+}
+
+// getWithRetry GETs rawURL, retrying network errors, 429 and 5xx responses with backoff.
+// Each attempt is logged as its own API request. It returns the last response's status and
+// body; the error is set only when no response could be read.
+func getWithRetry(ctx context.Context, client *http.Client, rawURL string) (int, []byte, error) {
+	retry := GetConfig().Retry
+	for attempt := 0; ; attempt++ {
+		status, header, body, err := getOnce(ctx, client, rawURL, attempt)
+		retryable := (err != nil && retryableError(ctx, err)) || (err == nil && retryableStatus(status))
+		if !retryable || attempt >= retry.MaxRetries {
+			return status, body, err
+		}
+
+		delay := retry.backoff(attempt, header)
+		reason := fmt.Sprintf("status %d", status)
+		if err != nil {
+			reason = err.Error()
+		}
+		log.Printf("🔁 Retrying %s in %v after %s (retry %d of %d)", rawURL, delay, reason, attempt+1, retry.MaxRetries)
+		if logger := GetLogger(); logger != nil {
+			logger.LogWarn(fmt.Sprintf("🔁 Retrying upstream request after %s", reason), "api", map[string]interface{}{
+				"url":         rawURL,
+				"retry":       attempt + 1,
+				"max_retries": retry.MaxRetries,
+				"delay_ms":    delay.Milliseconds(),
+				"status_code": status,
+			})
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return status, body, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// getOnce makes a single attempt and logs it once the body is read, so the record carries
+// its size.
+func getOnce(ctx context.Context, client *http.Client, rawURL string, attempt int) (int, http.Header, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	start := time.Now()
+	apiLog := APIRequestLogData{URL: rawURL, Retries: attempt}
+	resp, err := client.Do(req)
+	if err != nil {
+		apiLog.Duration = time.Since(start)
+		apiLog.Error = err.Error()
+		if logger := GetLogger(); logger != nil {
+			logger.LogAPIRequest(apiLog)
+		}
+		log.Printf("HTTP request failed after %v: %v", apiLog.Duration, err)
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	apiLog.Duration = time.Since(start)
+	apiLog.StatusCode = resp.StatusCode
+	apiLog.Bytes = int64(len(body))
+	if err != nil {
+		apiLog.Error = fmt.Sprintf("failed to read response: %v", err)
+		err = fmt.Errorf("failed to read response: %w", err)
+	}
+	if logger := GetLogger(); logger != nil {
+		logger.LogAPIRequest(apiLog)
+	}
+	log.Printf("HTTP request completed in %v, status: %d", apiLog.Duration, resp.StatusCode)
+	return resp.StatusCode, resp.Header, body, err
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//================================================================================
+// Retrieval Input Validation
+//================================================================================
+
+// Limits follow GitHub's own naming rules where they exist.
+const (
+	maxOwnerLength       = 39
+	maxRepoNameLength    = 100
+	maxFilePathLength    = 4096
+	maxPathSegmentLength = 255
+	maxRefLength         = 255
+	maxBatchResults      = 500 // Upper bound on resultNumbers in one batch request
+)
+
+// ValidationError describes why a retrieval input was rejected.
+type ValidationError struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// sanitizeFileRequest validates a repository string and file path and returns the
+// canonical request sent to the GitHub API.
+func sanitizeFileRequest(repoString, filePath string) (GitHubFileRequest, error) {
+	owner, repo, err := parseGitHubRepo(strings.TrimSpace(repoString))
+	if err != nil {
+		return GitHubFileRequest{}, &ValidationError{Field: "repo", Value: repoString, Reason: "expected owner/repo"}
+	}
+	if err := validateOwner(owner); err != nil {
+		return GitHubFileRequest{}, err
+	}
+	if err := validateRepoName(repo); err != nil {
+		return GitHubFileRequest{}, err
+	}
+	cleanPath, err := canonicalFilePath(filePath)
+	if err != nil {
+		return GitHubFileRequest{}, err
+	}
+	return GitHubFileRequest{Owner: owner, Repo: repo, Path: cleanPath}, nil
+}
+
+// validateOwner checks a GitHub user or organization name.
+func validateOwner(owner string) error {
+	if len(owner) == 0 || len(owner) > maxOwnerLength {
+		return &ValidationError{Field: "owner", Value: owner, Reason: fmt.Sprintf("must be 1-%d characters", maxOwnerLength)}
+	}
+	for _, r := range owner {
+		if !isASCIIAlphanumeric(r) && r != '-' && r != '_' {
+			return &ValidationError{Field: "owner", Value: owner, Reason: "may only contain letters, digits, '-' and '_'"}
+		}
+	}
+	if strings.HasPrefix(owner, "-") || strings.HasSuffix(owner, "-") {
+		return &ValidationError{Field: "owner", Value: owner, Reason: "must not start or end with '-'"}
+	}
+	return nil
+}
+
+// validateRepoName checks a GitHub repository name.
+func validateRepoName(repo string) error {
+	if len(repo) == 0 || len(repo) > maxRepoNameLength {
+		return &ValidationError{Field: "repo", Value: repo, Reason: fmt.Sprintf("must be 1-%d characters", maxRepoNameLength)}
+	}
+	if repo == "." || repo == ".." {
+		return &ValidationError{Field: "repo", Value: repo, Reason: "must not be a relative path element"}
+	}
+	for _, r := range repo {
+		if !isASCIIAlphanumeric(r) && r != '-' && r != '_' && r != '.' {
+			return &ValidationError{Field: "repo", Value: repo, Reason: "may only contain letters, digits, '-', '_' and '.'"}
+		}
+	}
+	return nil
+}
+
+// validateRef checks a branch, tag or commit name against git's ref naming rules. An
+// empty ref is valid and means the default branch.
+func validateRef(ref string) error {
+	if len(ref) > maxRefLength {
+		return &ValidationError{Field: "ref", Value: ref[:64] + "...", Reason: fmt.Sprintf("longer than %d bytes", maxRefLength)}
+	}
+	for _, r := range ref {
+		if unicode.IsControl(r) || unicode.IsSpace(r) || strings.ContainsRune("~^:?*[\\", r) {
+			return &ValidationError{Field: "ref", Value: ref, Reason: "contains a character git does not allow in refs"}
+		}
+	}
+	if strings.Contains(ref, "..") || strings.Contains(ref, "@{") || strings.HasPrefix(ref, "/") || strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".lock") {
+		return &ValidationError{Field: "ref", Value: ref, Reason: "is not a valid git ref name"}
+	}
+	return nil
+}
+
+// canonicalFilePath rejects traversal and control characters and returns the path with
+// leading slashes, empty segments and "." segments removed.
+func canonicalFilePath(filePath string) (string, error) {
+	if len(filePath) > maxFilePathLength {
+		return "", &ValidationError{Field: "path", Value: filePath[:64] + "...", Reason: fmt.Sprintf("longer than %d bytes", maxFilePathLength)}
+	}
+	for _, r := range filePath {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return "", &ValidationError{Field: "path", Value: filePath, Reason: "contains control or invalid characters"}
+		}
+		if r == '\\' {
+			return "", &ValidationError{Field: "path", Value: filePath, Reason: "contains a backslash"}
+		}
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(filePath, "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", &ValidationError{Field: "path", Value: filePath, Reason: "must not contain '..'"}
+		}
+		if len(segment) > maxPathSegmentLength {
+			return "", &ValidationError{Field: "path", Value: filePath, Reason: fmt.Sprintf("has a segment longer than %d bytes", maxPathSegmentLength)}
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "", &ValidationError{Field: "path", Value: filePath, Reason: "is empty"}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// parseResultNumbers validates the resultNumbers argument: positive whole numbers, at
+// most maxBatchResults of them.
+func parseResultNumbers(raw interface{}) ([]int, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	nums, ok := raw.([]interface{})
+	if !ok {
+		return nil, &ValidationError{Field: "resultNumbers", Value: fmt.Sprintf("%v", raw), Reason: "must be an array of numbers"}
+	}
+	if len(nums) > maxBatchResults {
+		return nil, &ValidationError{Field: "resultNumbers", Value: fmt.Sprintf("%d entries", len(nums)), Reason: fmt.Sprintf("at most %d results per request", maxBatchResults)}
+	}
+	resultNumbers := make([]int, 0, len(nums))
+	for _, n := range nums {
+		f, err := numberValue("resultNumbers", n)
+		if err != nil || f < 1 || f != float64(int(f)) {
+			return nil, &ValidationError{Field: "resultNumbers", Value: fmt.Sprintf("%v", n), Reason: "must be a positive whole number"}
+		}
+		resultNumbers = append(resultNumbers, int(f))
+	}
+	return resultNumbers, nil
+}
+
+func isASCIIAlphanumeric(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
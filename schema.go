@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Upstream Schema Validation
+//================================================================================
+
+const (
+	// schemaSampleBytes caps how much of an unexpected payload is written to the diagnostics log.
+	schemaSampleBytes = 2048
+)
+
+// validateGrepAppPayload checks the raw grep.app JSON for the fields the server depends on.
+// It returns a list of human-readable issues; an empty list means the shape is as expected.
+func validateGrepAppPayload(body []byte) []string {
+	var issues []string
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(body, &top); err != nil {
+		return []string{fmt.Sprintf("response is not a JSON object: %v", err)}
+	}
+
+	hitsRaw, ok := top["hits"]
+	if !ok {
+		issues = append(issues, "missing top-level field 'hits'")
+	} else {
+		var hits map[string]json.RawMessage
+		if err := json.Unmarshal(hitsRaw, &hits); err != nil {
+			issues = append(issues, "field 'hits' is not an object")
+		} else if inner, ok := hits["hits"]; !ok {
+			issues = append(issues, "missing field 'hits.hits'")
+		} else {
+			var items []map[string]json.RawMessage
+			if err := json.Unmarshal(inner, &items); err != nil {
+				issues = append(issues, "field 'hits.hits' is not an array of objects")
+			} else {
+				issues = append(issues, validateHitItems(items)...)
+			}
+		}
+	}
+
+	facetsRaw, ok := top["facets"]
+	if !ok {
+		issues = append(issues, "missing top-level field 'facets'")
+	} else {
+		var facets map[string]json.RawMessage
+		if err := json.Unmarshal(facetsRaw, &facets); err != nil {
+			issues = append(issues, "field 'facets' is not an object")
+		} else {
+			for _, field := range []string{"count", "pages"} {
+				if _, ok := facets[field]; !ok {
+					issues = append(issues, fmt.Sprintf("missing field 'facets.%s'", field))
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// validateHitItems checks that each hit carries the nested raw/snippet fields, reporting
+// each missing field once rather than once per hit.
+func validateHitItems(items []map[string]json.RawMessage) []string {
+	var issues []string
+	checks := []struct {
+		field string
+		inner string
+	}{
+		{"repo", "raw"},
+		{"path", "raw"},
+		{"content", "snippet"},
+	}
+	for _, check := range checks {
+		missing := 0
+		for _, item := range items {
+			raw, ok := item[check.field]
+			if !ok {
+				missing++
+				continue
+			}
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				missing++
+				continue
+			}
+			if _, ok := nested[check.inner]; !ok {
+				missing++
+			}
+		}
+		if missing > 0 {
+			issues = append(issues, fmt.Sprintf("%d of %d hits missing field '%s.%s'", missing, len(items), check.field, check.inner))
+		}
+	}
+	return issues
+}
+
+// snippetLooksUnparseable reports whether a non-empty snippet lacks the table markup that
+// parseSnippet relies on, which indicates the snippet HTML format has changed.
+func snippetLooksUnparseable(snippet string) bool {
+	if strings.TrimSpace(snippet) == "" {
+		return false
+	}
+	return !strings.Contains(snippet, "<tr") || !strings.Contains(snippet, "lineno")
+}
+
+// truncateSample cuts sample to at most schemaSampleBytes, backing off to a rune boundary
+// so the log stays valid UTF-8.
+func truncateSample(sample string) string {
+	if len(sample) <= schemaSampleBytes {
+		return sample
+	}
+	cut := schemaSampleBytes
+	for cut > 0 && !utf8.RuneStart(sample[cut]) {
+		cut--
+	}
+	return sample[:cut] + "...(truncated)"
+}
+
+// logSchemaMismatch records a structured diagnostic with a truncated sample of the payload.
+func logSchemaMismatch(source string, issues []string, sample string) {
+	sample = truncateSample(sample)
+	if logger := GetLogger(); logger != nil {
+		logger.LogWarn(fmt.Sprintf("Provider schema mismatch in %s: %s", source, strings.Join(issues, "; ")), "schema", map[string]interface{}{
+			"operation": "schema_mismatch",
+			"source":    source,
+			"issues":    issues,
+			"sample":    sample,
+		})
+	}
+}
+
+// withSchemaWarning appends a provider schema mismatch warning to the tool result.
+func withSchemaWarning(result *mcp.CallToolResult, issues []string) *mcp.CallToolResult {
+	if len(issues) == 0 || result == nil {
+		return result
+	}
+	var b strings.Builder
+	b.WriteString("⚠️ Warning: provider schema mismatch. grep.app returned an unexpected response shape, so results may be incomplete.\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "  - %s\n", issue)
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(b.String()))
+	return result
+}
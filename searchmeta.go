@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//================================================================================
+// Search Fetch Metadata
+//================================================================================
+
+// PageFetch records how one grep.app result page was obtained.
+type PageFetch struct {
+	Language  string `json:"language,omitempty"` // Set when langFilter fanned out per language
+	Page      int    `json:"page"`
+	Hits      int    `json:"hits"` // Files returned on the page before client-side filtering
+	CacheHit  bool   `json:"cache_hit"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+// SearchTiming splits a search's elapsed time into fetching and client-side processing.
+type SearchTiming struct {
+	FetchMs  int64 `json:"fetch_ms"`
+	FilterMs int64 `json:"filter_ms"` // Regex, minMatchesPerFile and output preparation
+	TotalMs  int64 `json:"total_ms"`
+}
+
+// SearchMetadata lets agents judge how complete a search result is, e.g. that only 5 of
+// 37 pages were scanned.
+type SearchMetadata struct {
+	Summary        string       `json:"summary"`
+	Provider       string       `json:"provider"`             // Provider that served the results
+	PageError      string       `json:"page_error,omitempty"` // Why fetching stopped early; the pages before it are returned
+	PagesFetched   int          `json:"pages_fetched"`
+	PagesAvailable int          `json:"pages_available"` // 0 when served from a cached complete scan
+	Complete       bool         `json:"complete"`
+	TotalAvailable int          `json:"total_available"` // Matches grep.app reports for the query
+	ScannedFiles   int          `json:"scanned_files"`   // Files fetched before client-side filters
+	ReturnedFiles  int          `json:"returned_files"`
+	ReturnedLines  int          `json:"returned_lines"`
+	CachedPages    int          `json:"cached_pages"`
+	FromCache      bool         `json:"from_cache,omitempty"`  // Served from a cached complete scan without fetching pages
+	SharedScan     bool         `json:"shared_scan,omitempty"` // Reused the scan of an identical concurrent search
+	CachedAt       string       `json:"cached_at,omitempty"`   // When the oldest cached data served was stored
+	CacheAgeSec    int64        `json:"cache_age_seconds,omitempty"`
+	Stale          bool         `json:"stale,omitempty"` // Cached data is older than the staleness threshold
+	Pages          []PageFetch  `json:"pages,omitempty"`
+	Timing         SearchTiming `json:"timing"`
+
+	LineCollisions int             `json:"line_collisions,omitempty"` // Lines seen with different text on several pages or languages
+	Collisions     []LineCollision `json:"collisions,omitempty"`      // The first few, resolved per mergeStrategy
+}
+
+// newSearchMetadata describes scan and the hits left after client-side filtering.
+func newSearchMetadata(scan *searchScan, scanned, returned *Hits, fetch, total time.Duration) SearchMetadata {
+	meta := SearchMetadata{
+		Provider:       providerGrepApp,
+		PageError:      scan.PageError,
+		PagesFetched:   scan.PagesScanned,
+		PagesAvailable: scan.AvailablePages,
+		Complete:       scan.Complete,
+		TotalAvailable: scan.TotalCount,
+		ScannedFiles:   countFiles(scanned),
+		ReturnedFiles:  countFiles(returned),
+		FromCache:      len(scan.Pages) == 0,
+		SharedScan:     scan.Shared,
+		Pages:          scan.Pages,
+		LineCollisions: scan.LineCollisions,
+		Collisions:     scan.CollisionSamples,
+		Timing: SearchTiming{
+			FetchMs:  fetch.Milliseconds(),
+			FilterMs: (total - fetch).Milliseconds(),
+			TotalMs:  total.Milliseconds(),
+		},
+	}
+	for _, files := range returned.Hits {
+		for _, lines := range files {
+			meta.ReturnedLines += len(lines)
+		}
+	}
+	for _, page := range scan.Pages {
+		if page.CacheHit {
+			meta.CachedPages++
+		}
+	}
+	if scan.Provider != "" {
+		meta.Provider = scan.Provider
+	}
+	if !scan.CachedAt.IsZero() {
+		now := time.Now()
+		meta.CachedAt = scan.CachedAt.UTC().Format(time.RFC3339)
+		meta.CacheAgeSec = int64(now.Sub(scan.CachedAt).Seconds())
+		meta.Stale = isStale(scan.CachedAt, now)
+	}
+	meta.Summary = meta.summarize()
+	return meta
+}
+
+// summarize states completeness in one sentence.
+func (m SearchMetadata) summarize() string {
+	var b strings.Builder
+	switch {
+	case m.FromCache:
+		b.WriteString("Served from a cached complete scan")
+	case m.Complete:
+		fmt.Fprintf(&b, "All %d result pages were scanned", m.PagesFetched)
+	default:
+		fmt.Fprintf(&b, "Only %d of %d result pages were scanned", m.PagesFetched, m.PagesAvailable)
+	}
+	fmt.Fprintf(&b, "; returning %d of %d fetched files (%d matches available)", m.ReturnedFiles, m.ScannedFiles, m.TotalAvailable)
+	if m.CachedPages > 0 {
+		fmt.Fprintf(&b, "; %d pages came from cache", m.CachedPages)
+	}
+	if m.PageError != "" {
+		b.WriteString("; a later page failed, so results are partial")
+	}
+	if m.Provider != providerGrepApp {
+		fmt.Fprintf(&b, "; served by %s because grep.app failed", m.Provider)
+	}
+	return b.String() + "."
+}
+
+// encodeHitsWithMetadata encodes {"schemaVersion": ..., "hits": ..., "languages": ..., "metadata": ...}, keeping the indentation
+// choice encodeHitsJSON made for the hits.
+func encodeHitsWithMetadata(hits *Hits, meta SearchMetadata, limit int) (string, error) {
+	hitsJSON, err := encodeHitsJSON(hits, limit)
+	if err != nil {
+		return "", err
+	}
+	doc := struct {
+		SchemaVersion string                       `json:"schemaVersion"`
+		Hits          json.RawMessage              `json:"hits"`
+		Languages     map[string]map[string]string `json:"languages"` // Inferred per file; unrecognized files are left out
+		Metadata      SearchMetadata               `json:"metadata"`
+	}{outputSchemaVersion, json.RawMessage(hitsJSON), inferHitLanguages(hits), meta}
+
+	var out []byte
+	if strings.Contains(hitsJSON, "\n") {
+		out, err = json.MarshalIndent(doc, "", "  ")
+	} else {
+		out, err = json.Marshal(doc)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Self-Check
+//================================================================================
+
+// selfCheckTimeout bounds each network probe so a hung upstream cannot stall startup.
+const selfCheckTimeout = 10 * time.Second
+
+// SelfCheckResult is the outcome of one readiness check.
+type SelfCheckResult struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Detail   string        `json:"detail"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// SelfCheckReport collects every check. Ready is false when any check failed.
+type SelfCheckReport struct {
+	Ready  bool              `json:"ready"`
+	Checks []SelfCheckResult `json:"checks"`
+	Disk   []DiskWriteStats  `json:"disk,omitempty"` // Write failure counters for the cache and log directories
+}
+
+// runSelfCheck probes grep.app and the GitHub API, validates the GitHub token and checks
+// that the cache and log directories are writable.
+func runSelfCheck(ctx context.Context, httpClient *http.Client, ghClient *github.Client, grepAppURL string) SelfCheckReport {
+	cfg := GetConfig()
+	checks := []struct {
+		name string
+		run  func(context.Context) (string, error)
+	}{
+		{"grep.app", func(ctx context.Context) (string, error) { return probeGrepApp(ctx, httpClient, grepAppURL) }},
+		{"github", func(ctx context.Context) (string, error) { return probeGitHub(ctx, ghClient) }},
+		{"cache_dir", func(context.Context) (string, error) {
+			if cfg.NoCache {
+				return "disk cache disabled", nil
+			}
+			return checkWritable(cfg.CacheDir)
+		}},
+		{"log_dir", func(context.Context) (string, error) { return checkWritable(cfg.LogDir) }},
+	}
+
+	report := SelfCheckReport{Ready: true}
+	for _, check := range checks {
+		start := time.Now()
+		checkCtx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+		detail, err := check.run(checkCtx)
+		cancel()
+		result := SelfCheckResult{Name: check.name, OK: err == nil, Detail: detail, Duration: time.Since(start)}
+		if err != nil {
+			result.Detail = err.Error()
+			report.Ready = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	report.Disk = diskWriteStats()
+	return report
+}
+
+// probeGrepApp runs a one-page search to confirm grep.app answers.
+func probeGrepApp(ctx context.Context, httpClient *http.Client, baseURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"?q="+url.QueryEscape("func main"), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("grep.app unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("grep.app returned %s", resp.Status)
+	}
+	return "search API reachable", nil
+}
+
+// probeGitHub reads the rate limit, which does not count against it, and reports whether
+// requests are authenticated and with which token scopes.
+func probeGitHub(ctx context.Context, ghClient *github.Client) (string, error) {
+	limits, resp, err := ghClient.RateLimit.Get(ctx)
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusUnauthorized {
+			return "", fmt.Errorf("GitHub rejected the token: %s", errResp.Message)
+		}
+		return "", fmt.Errorf("api.github.com unreachable: %w", err)
+	}
+	core := limits.GetCore()
+	detail := fmt.Sprintf("%d of %d core requests remaining", core.Remaining, core.Limit)
+	if core.Limit <= 60 {
+		return detail + "; unauthenticated", nil
+	}
+	scopes := resp.Header.Get("X-OAuth-Scopes")
+	if scopes == "" {
+		return detail + "; authenticated without classic scopes (fine-grained or app token)", nil
+	}
+	return detail + "; token scopes: " + scopes, nil
+}
+
+// checkWritable creates dir if needed and writes and removes a probe file in it.
+func checkWritable(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".selfcheck-*")
+	if err != nil {
+		return "", fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	os.Remove(name)
+	return dir + " is writable", nil
+}
+
+// formatSelfCheck renders the report as a readiness summary.
+func formatSelfCheck(report SelfCheckReport) string {
+	var b strings.Builder
+	if report.Ready {
+		b.WriteString("✅ Ready: all checks passed\n")
+	} else {
+		b.WriteString("❌ Not ready: some checks failed\n")
+	}
+	for _, check := range report.Checks {
+		icon := "✅"
+		if !check.OK {
+			icon = "❌"
+		}
+		fmt.Fprintf(&b, "%s %s: %s (%v)\n", icon, check.Name, check.Detail, check.Duration.Round(time.Millisecond))
+	}
+	for _, disk := range report.Disk {
+		state := "writing"
+		if disk.Degraded {
+			state = "degraded since " + disk.DegradedSince + ": " + disk.Reason
+		}
+		fmt.Fprintf(&b, "💽 %s writes: %s; %d failures, %d skipped, %d MB free\n", disk.Store, state, disk.WriteFailures, disk.SkippedWrites, disk.FreeBytes>>20)
+	}
+	return b.String()
+}
+
+// logSelfCheck records the report, as a warning when any check failed.
+func logSelfCheck(logger *ObservabilityLogger, report SelfCheckReport) {
+	if logger == nil {
+		return
+	}
+	data := map[string]interface{}{"ready": report.Ready, "checks": report.Checks}
+	if report.Ready {
+		logger.LogInfo("🩺 Self-check passed", "selfCheck", data)
+		return
+	}
+	var failed []string
+	for _, check := range report.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name+": "+check.Detail)
+		}
+	}
+	logger.LogWarn("⚠️ Self-check failed: "+strings.Join(failed, "; "), "selfCheck", data)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//================================================================================
+// Persisted Server Statistics
+//================================================================================
+
+const (
+	serverStatsFileName     = "server_stats.json" // Written to the log directory
+	statsCheckpointInterval = time.Minute
+)
+
+// ServerStatsData holds aggregate counters that survive restarts. Servers sharing a log
+// directory add to the same totals.
+type ServerStatsData struct {
+	Since            time.Time `json:"since"` // When counting started
+	LastCheckpoint   time.Time `json:"last_checkpoint,omitempty"`
+	Starts           int64     `json:"starts"`
+	ToolCalls        int64     `json:"tool_calls"`
+	ToolErrors       int64     `json:"tool_errors"`
+	Searches         int64     `json:"searches"`
+	CacheHits        int64     `json:"cache_hits"`
+	CacheMisses      int64     `json:"cache_misses"`
+	UpstreamRequests int64     `json:"upstream_requests"`
+	UpstreamErrors   int64     `json:"upstream_errors"` // Failed requests and non-2xx responses
+}
+
+// add adds the counters of other and keeps the earlier start.
+func (d *ServerStatsData) add(other ServerStatsData) {
+	if d.Since.IsZero() || (!other.Since.IsZero() && other.Since.Before(d.Since)) {
+		d.Since = other.Since
+	}
+	if other.LastCheckpoint.After(d.LastCheckpoint) {
+		d.LastCheckpoint = other.LastCheckpoint
+	}
+	d.Starts += other.Starts
+	d.ToolCalls += other.ToolCalls
+	d.ToolErrors += other.ToolErrors
+	d.Searches += other.Searches
+	d.CacheHits += other.CacheHits
+	d.CacheMisses += other.CacheMisses
+	d.UpstreamRequests += other.UpstreamRequests
+	d.UpstreamErrors += other.UpstreamErrors
+}
+
+// serverStatsTracker counts in memory and periodically merges the counts into the stats
+// file. Each checkpoint rereads the file so counts from other servers are kept.
+type serverStatsTracker struct {
+	mu      sync.Mutex
+	path    string          // "" until persistence is started
+	totals  ServerStatsData // Persisted totals as of the last load or checkpoint
+	pending ServerStatsData // Counted since the last checkpoint
+}
+
+var serverStats = newServerStatsTracker()
+
+func newServerStatsTracker() *serverStatsTracker {
+	return &serverStatsTracker{pending: ServerStatsData{Since: time.Now().UTC()}}
+}
+
+func (t *serverStatsTracker) update(fn func(*ServerStatsData)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.pending)
+}
+
+// recordToolCall counts a finished tool call; searches are also counted separately.
+func (t *serverStatsTracker) recordToolCall(tool string, failed bool) {
+	t.update(func(d *ServerStatsData) {
+		d.ToolCalls++
+		if failed {
+			d.ToolErrors++
+		}
+		if tool == "searchCode" {
+			d.Searches++
+		}
+	})
+}
+
+// recordCacheLookup counts a cache lookup in either cache layer.
+func (t *serverStatsTracker) recordCacheLookup(hit bool) {
+	t.update(func(d *ServerStatsData) {
+		if hit {
+			d.CacheHits++
+		} else {
+			d.CacheMisses++
+		}
+	})
+}
+
+// recordUpstream counts a request sent to grep.app or GitHub.
+func (t *serverStatsTracker) recordUpstream(failed bool) {
+	t.update(func(d *ServerStatsData) {
+		d.UpstreamRequests++
+		if failed {
+			d.UpstreamErrors++
+		}
+	})
+}
+
+// snapshot returns the persisted totals plus everything counted since.
+func (t *serverStatsTracker) snapshot() ServerStatsData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	totals := t.totals
+	totals.add(t.pending)
+	return totals
+}
+
+// readStatsFile reads persisted totals; a missing file holds none.
+func readStatsFile(path string) (ServerStatsData, error) {
+	var data ServerStatsData
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return data, err
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return data, fmt.Errorf("invalid stats file %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// load reads the totals persisted in path and counts this start.
+func (t *serverStatsTracker) load(path string) error {
+	totals, err := readStatsFile(path)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.path = path
+	t.pending.Starts++
+	if err != nil {
+		return err
+	}
+	t.totals = totals
+	return nil
+}
+
+// checkpoint merges the counts since the last checkpoint into the stats file. The file is
+// replaced atomically so a crash cannot leave it half written.
+func (t *serverStatsTracker) checkpoint() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.path == "" || !logDiskGuard.allow() {
+		return nil
+	}
+	totals, err := readStatsFile(t.path)
+	if err != nil {
+		log.Printf("⚠️ Replacing unreadable stats file: %v", err)
+		totals = t.totals
+	}
+	totals.add(t.pending)
+	totals.LastCheckpoint = time.Now().UTC()
+
+	encoded, err := json.MarshalIndent(totals, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		logDiskGuard.recordFailure(err)
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, encoded, 0644); err != nil {
+		logDiskGuard.recordFailure(err)
+		return err
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		os.Remove(tmp)
+		logDiskGuard.recordFailure(err)
+		return err
+	}
+	t.totals = totals
+	t.pending = ServerStatsData{}
+	return nil
+}
+
+// startStatsPersistence merges the stats persisted in logDir into the counters and
+// checkpoints them every interval. The returned function stops it after a final
+// checkpoint.
+func startStatsPersistence(logDir string, interval time.Duration) func() {
+	if err := serverStats.load(filepath.Join(logDir, serverStatsFileName)); err != nil {
+		log.Printf("⚠️ Failed to load persisted server stats, starting from zero: %v", err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				checkpointServerStats()
+			case <-stop:
+				checkpointServerStats()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func checkpointServerStats() {
+	if err := serverStats.checkpoint(); err != nil {
+		log.Printf("⚠️ Failed to checkpoint server stats: %v", err)
+	}
+}
+
+// statsTransport counts upstream requests and their failures, overall and per provider,
+// and charges them to the tool call's cost.
+type statsTransport struct {
+	base http.RoundTripper
+}
+
+func newStatsTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &statsTransport{base: base}
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	serverStats.recordUpstream(err != nil || resp.StatusCode >= 300)
+	providerHealth.record(providerForHost(req.URL.Hostname()), resp, err, time.Now())
+	observeRateLimit(req, resp)
+	observeResponseCost(req, resp)
+	return resp, err
+}
+
+// formatServerStats renders the persisted statistics as a readable summary.
+func formatServerStats(d ServerStatsData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📈 Server statistics since %s (%d starts)\n", d.Since.Format(time.RFC3339), d.Starts)
+	fmt.Fprintf(&b, "🔧 Tool calls: %d (%d errors), searches: %d\n", d.ToolCalls, d.ToolErrors, d.Searches)
+	lookups := d.CacheHits + d.CacheMisses
+	hitRate := 0.0
+	if lookups > 0 {
+		hitRate = float64(d.CacheHits) * 100 / float64(lookups)
+	}
+	fmt.Fprintf(&b, "💾 Cache: %d hits, %d misses (%.1f%% hit rate)\n", d.CacheHits, d.CacheMisses, hitRate)
+	fmt.Fprintf(&b, "🌐 Upstream requests: %d (%d errors)\n", d.UpstreamRequests, d.UpstreamErrors)
+	if !d.LastCheckpoint.IsZero() {
+		fmt.Fprintf(&b, "🗄️ Last saved %s\n", d.LastCheckpoint.Format(time.RFC3339))
+	}
+	return b.String()
+}
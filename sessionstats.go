@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Client Session Statistics
+//================================================================================
+
+const (
+	maxSessionQueries      = 100 // Most recent queries kept per client session
+	sessionPersistInterval = time.Minute
+)
+
+// clientSessionTracker collects ClientSessionData per MCP client session in memory.
+// Sessions changed since the last persist are written to the log as snapshots.
+type clientSessionTracker struct {
+	mu       sync.Mutex
+	sessions map[string]*ClientSessionData
+	dirty    map[string]bool
+}
+
+var clientSessions = newClientSessionTracker()
+
+func newClientSessionTracker() *clientSessionTracker {
+	return &clientSessionTracker{
+		sessions: make(map[string]*ClientSessionData),
+		dirty:    make(map[string]bool),
+	}
+}
+
+// clientSessionID returns the MCP session of the call, or "" outside a client session.
+func clientSessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// session returns the data for id, creating it. The caller must hold t.mu.
+func (t *clientSessionTracker) session(id string, now time.Time) *ClientSessionData {
+	data, ok := t.sessions[id]
+	if !ok {
+		data = &ClientSessionData{SessionID: id, FirstSeen: now}
+		t.sessions[id] = data
+	}
+	data.LastSeen = now
+	t.dirty[id] = true
+	return data
+}
+
+// recordRequest counts a tool call by the session.
+func (t *clientSessionTracker) recordRequest(id string, now time.Time) {
+	if id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session(id, now).TotalRequests++
+}
+
+// recordSearch adds a completed search and whether it found results.
+func (t *clientSessionTracker) recordSearch(id, query string, results int, now time.Time) {
+	if id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data := t.session(id, now)
+	data.SearchQueries = append(data.SearchQueries, query)
+	if len(data.SearchQueries) > maxSessionQueries {
+		data.SearchQueries = data.SearchQueries[len(data.SearchQueries)-maxSessionQueries:]
+	}
+	if results == 0 {
+		data.ZeroResults++
+	} else {
+		data.SuccessResults++
+	}
+}
+
+// snapshot returns copies of the tracked sessions, most recently active first. A non-empty
+// id limits the result to that session.
+func (t *clientSessionTracker) snapshot(id string) []ClientSessionData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sessions []ClientSessionData
+	for sessionID, data := range t.sessions {
+		if id != "" && sessionID != id {
+			continue
+		}
+		copied := *data
+		copied.SearchQueries = append([]string(nil), data.SearchQueries...)
+		sessions = append(sessions, copied)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeen.After(sessions[j].LastSeen) })
+	return sessions
+}
+
+// persist logs a snapshot of every session changed since the last call and returns how
+// many were written.
+func (t *clientSessionTracker) persist(logger *ObservabilityLogger) int {
+	if logger == nil {
+		return 0
+	}
+	t.mu.Lock()
+	changed := make([]ClientSessionData, 0, len(t.dirty))
+	for id := range t.dirty {
+		data := *t.sessions[id]
+		data.SearchQueries = append([]string(nil), data.SearchQueries...)
+		changed = append(changed, data)
+	}
+	t.dirty = make(map[string]bool)
+	t.mu.Unlock()
+
+	for _, data := range changed {
+		logger.LogClientSession(data)
+	}
+	return len(changed)
+}
+
+// startSessionPersistence persists changed sessions every interval. The returned function
+// stops it after a final persist.
+func startSessionPersistence(logger *ObservabilityLogger, interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				clientSessions.persist(logger)
+			case <-stop:
+				clientSessions.persist(logger)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// sessionStatsMiddleware counts every tool call against the caller's client session and
+// in the persisted server statistics.
+func sessionStatsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		clientSessions.recordRequest(clientSessionID(ctx), time.Now())
+		result, err := next(ctx, request)
+		serverStats.recordToolCall(request.Params.Name, err != nil || (result != nil && result.IsError))
+		return result, err
+	}
+}
+
+// formatSessionStats renders client sessions as a readable summary.
+func formatSessionStats(sessions []ClientSessionData, currentID string) string {
+	if len(sessions) == 0 {
+		return "No client sessions recorded yet."
+	}
+	var b strings.Builder
+	for _, s := range sessions {
+		marker := ""
+		if s.SessionID == currentID {
+			marker = " (this session)"
+		}
+		fmt.Fprintf(&b, "🧑‍💻 %s%s: %d requests, %d searches (%d with results, %d zero results), active %s to %s\n",
+			s.SessionID, marker, s.TotalRequests, s.SuccessResults+s.ZeroResults, s.SuccessResults, s.ZeroResults,
+			s.FirstSeen.Format(time.RFC3339), s.LastSeen.Format(time.RFC3339))
+		if n := len(s.SearchQueries); n > 0 {
+			recent := s.SearchQueries[max(0, n-5):]
+			fmt.Fprintf(&b, "   Recent queries: %s\n", strings.Join(recent, " | "))
+		}
+	}
+	return b.String()
+}
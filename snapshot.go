@@ -0,0 +1,336 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Search Session Snapshots
+//================================================================================
+
+const (
+	snapshotFormatVersion = 1
+	snapshotManifestName  = "manifest.json"
+	snapshotHitsName      = "hits.json"
+	snapshotFilesDir      = "files/"
+	maxSnapshotBytes      = 64 << 20 // Uncompressed size accepted on import
+)
+
+// SnapshotResult is one numbered search result with a link to its first matched line.
+type SnapshotResult struct {
+	Number    int    `json:"number"`
+	Repo      string `json:"repo"`
+	Path      string `json:"path"`
+	Lines     int    `json:"lines"`
+	Permalink string `json:"permalink"`
+}
+
+// SnapshotFile records a retrieved file bundled in the archive, or why it could not be.
+type SnapshotFile struct {
+	Number      int    `json:"number"`
+	Repo        string `json:"repo"`
+	Path        string `json:"path"`
+	ArchivePath string `json:"archive_path,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// SnapshotManifest describes a snapshot archive. The archive also holds hits.json with the
+// complete result set and the retrieved files under files/.
+type SnapshotManifest struct {
+	FormatVersion int               `json:"format_version"`
+	Query         string            `json:"query"`
+	Filters       map[string]string `json:"filters,omitempty"` // From the latest logged run of the query
+	CachedAt      time.Time         `json:"cached_at"`         // When the complete results were fetched
+	TotalCount    int               `json:"total_count"`
+	Results       []SnapshotResult  `json:"results"`
+	Files         []SnapshotFile    `json:"files,omitempty"`
+}
+
+// loadCompleteResult reads the complete cached result for query along with its cache time.
+func loadCompleteResult(query string) (*CacheEntry[fullSearchResult], error) {
+	cacheKey := completeCacheKey(query)
+	data, err := os.ReadFile(cacheFilePath(cacheKey))
+	if err != nil {
+		return nil, err
+	}
+	var entry CacheEntry[fullSearchResult]
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse cached results: %w", err)
+	}
+	return &entry, nil
+}
+
+// githubPermalink links to a file on its default branch, anchored at line when positive.
+func githubPermalink(repo, filePath string, line int) string {
+	link := (&url.URL{Scheme: "https", Host: "github.com", Path: path.Join("/", repo, "blob/HEAD", filePath)}).String()
+	if line > 0 {
+		link += fmt.Sprintf("#L%d", line)
+	}
+	return link
+}
+
+// snapshotResults lists every numbered result with its permalink.
+func snapshotResults(hits *Hits) []SnapshotResult {
+	var results []SnapshotResult
+	for _, hit := range flattenHits(hits) {
+		lines := hits.Hits[hit.Repo][hit.Path]
+		first := 0
+		for lineNum := range lines {
+			if n, err := strconv.Atoi(lineNum); err == nil && (first == 0 || n < first) {
+				first = n
+			}
+		}
+		results = append(results, SnapshotResult{
+			Number:    hit.Number,
+			Repo:      hit.Repo,
+			Path:      hit.Path,
+			Lines:     len(lines),
+			Permalink: githubPermalink(hit.Repo, hit.Path, first),
+		})
+	}
+	return results
+}
+
+// buildSnapshot writes a zip archive for the complete cached results of query plus any
+// retrieved files. Entries are written in a fixed order with the cache time as their
+// modification time, so identical inputs produce identical archives. With redact set,
+// credentials in the matched lines are masked.
+func buildSnapshot(query string, filters map[string]string, retrieved []RetrievedFile, redact bool) ([]byte, *SnapshotManifest, error) {
+	entry, err := loadCompleteResult(query)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("no cached results found for query %q; run searchCode first", query)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if redact {
+		redactHitLines(&entry.Data.Hits)
+	}
+
+	manifest := &SnapshotManifest{
+		FormatVersion: snapshotFormatVersion,
+		Query:         query,
+		Filters:       filters,
+		CachedAt:      entry.Timestamp.UTC().Truncate(time.Second),
+		TotalCount:    entry.Data.Count,
+		Results:       snapshotResults(&entry.Data.Hits),
+	}
+	sort.SliceStable(retrieved, func(i, j int) bool { return retrieved[i].Number < retrieved[j].Number })
+	contents := make(map[string]string)
+	for _, file := range retrieved {
+		record := SnapshotFile{Number: file.Number, Repo: file.Repo, Path: file.Path, Error: file.Error}
+		if file.Error == "" && file.Type != "dir" {
+			record.ArchivePath = snapshotFilesDir + path.Join(file.Repo, file.Path)
+			contents[record.ArchivePath] = file.Content
+		}
+		manifest.Files = append(manifest.Files, record)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: manifest.CachedAt})
+		if err != nil {
+			return fmt.Errorf("failed to add %s to snapshot: %w", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write %s to snapshot: %w", name, err)
+		}
+		return nil
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal snapshot manifest: %w", err)
+	}
+	hitsBytes, err := json.Marshal(entry.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal snapshot hits: %w", err)
+	}
+	if err := add(snapshotManifestName, manifestBytes); err != nil {
+		return nil, nil, err
+	}
+	if err := add(snapshotHitsName, hitsBytes); err != nil {
+		return nil, nil, err
+	}
+	for _, file := range manifest.Files {
+		if file.ArchivePath == "" {
+			continue
+		}
+		if err := add(file.ArchivePath, []byte(contents[file.ArchivePath])); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to finalize snapshot: %w", err)
+	}
+	return buf.Bytes(), manifest, nil
+}
+
+// snapshotToolResult returns the summary with the archive embedded as a zip resource.
+func snapshotToolResult(manifest *SnapshotManifest, archive []byte) *mcp.CallToolResult {
+	return &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewTextContent(formatSnapshotSummary("Exported", manifest, len(archive))),
+		mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+			URI:      "grep-app://snapshot/" + queryFingerprint(manifest.Query) + ".zip",
+			MIMEType: "application/zip",
+			Blob:     base64.StdEncoding.EncodeToString(archive),
+		}),
+	}}
+}
+
+// decodeSnapshotArchive decodes the base64 archive argument of importSnapshot.
+func decodeSnapshotArchive(encoded string) ([]byte, error) {
+	archive, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(archive) == 0 {
+		return nil, errors.New("archive must be a base64-encoded snapshot zip")
+	}
+	return archive, nil
+}
+
+// readSnapshotEntry reads one archive entry, refusing entries beyond the remaining budget.
+func readSnapshotEntry(f *zip.File, budget *int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, *budget+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if int64(len(data)) > *budget {
+		return nil, fmt.Errorf("snapshot exceeds %d bytes uncompressed", maxSnapshotBytes)
+	}
+	*budget -= int64(len(data))
+	return data, nil
+}
+
+// importSnapshot restores a snapshot's complete results into the cache, so
+// batchRetrievalTool can use the original result numbers, and returns the bundled files.
+// An existing cached result for the same query is only replaced when overwrite is set.
+// The complete results are shared by every caller, so a tenant may only import when its
+// profile sets allowSnapshotImport, and an HTTP caller without a tenant only with
+// -allow-snapshot-import.
+func importSnapshot(ctx context.Context, archive []byte, overwrite bool) (*SnapshotManifest, []RetrievedFile, error) {
+	if tenant := tenantFromContext(ctx); tenant != nil && !tenant.AllowSnapshotImport {
+		return nil, nil, errSnapshotImportNotAllowed
+	} else if tenant == nil && isHTTPCall(ctx) && !GetConfig().AllowSnapshotImport {
+		return nil, nil, errSnapshotImportNotAllowed
+	}
+	manifest, _, files, err := restoreSnapshot(archive, overwrite)
+	return manifest, files, err
+}
+
+// restoreSnapshot caches a snapshot's complete results, stamped with the time they were
+// originally fetched so that their age and staleness are reported truthfully, and returns
+// them with the bundled files.
+func restoreSnapshot(archive []byte, overwrite bool) (*SnapshotManifest, *fullSearchResult, []RetrievedFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid snapshot archive: %w", err)
+	}
+	budget := int64(maxSnapshotBytes)
+	entries := make(map[string][]byte)
+	for _, f := range zr.File {
+		data, err := readSnapshotEntry(f, &budget)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		entries[f.Name] = data
+	}
+
+	var manifest SnapshotManifest
+	if err := json.Unmarshal(entries[snapshotManifestName], &manifest); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid snapshot manifest: %w", err)
+	}
+	if manifest.FormatVersion != snapshotFormatVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported snapshot format version %d (expected %d)", manifest.FormatVersion, snapshotFormatVersion)
+	}
+	if strings.TrimSpace(manifest.Query) == "" {
+		return nil, nil, nil, fmt.Errorf("snapshot manifest has no query")
+	}
+	var result fullSearchResult
+	if err := json.Unmarshal(entries[snapshotHitsName], &result); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid snapshot hits: %w", err)
+	}
+	if files := countFiles(&result.Hits); files != len(manifest.Results) {
+		return nil, nil, nil, fmt.Errorf("snapshot hits contain %d files but the manifest lists %d results", files, len(manifest.Results))
+	}
+
+	if !overwrite && hasCompleteResults(manifest.Query) {
+		return nil, nil, nil, fmt.Errorf("results for query %q are already cached; set overwrite to replace them", manifest.Query)
+	}
+	fetchedAt := manifest.CachedAt
+	if fetchedAt.IsZero() {
+		fetchedAt = time.Now()
+	}
+	if err := cacheDataAt(completeCacheKey(manifest.Query), result, manifest.Query, cacheEntryComplete, fetchedAt); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to cache snapshot results: %w", err)
+	}
+
+	var files []RetrievedFile
+	for _, file := range manifest.Files {
+		retrieved := RetrievedFile{Number: file.Number, Repo: file.Repo, Path: file.Path, Error: file.Error}
+		if file.ArchivePath != "" {
+			content, ok := entries[file.ArchivePath]
+			if !ok {
+				retrieved.Error = "file missing from snapshot archive"
+			} else {
+				retrieved.Type = "file"
+				retrieved.Content = string(content)
+			}
+		}
+		files = append(files, retrieved)
+	}
+	return &manifest, &result, files, nil
+}
+
+// latestSearchFilters returns the filters of the most recent logged run of query.
+func latestSearchFilters(logDir, query string) map[string]string {
+	searches, err := listRecentSearches(logDir, 0)
+	if err != nil {
+		return nil
+	}
+	for _, search := range searches {
+		if search.Query == query {
+			return search.Filters
+		}
+	}
+	return nil
+}
+
+// formatSnapshotSummary describes a snapshot in a few lines.
+func formatSnapshotSummary(verb string, manifest *SnapshotManifest, size int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s snapshot for query %q: %d results, %d bundled files", verb, manifest.Query, len(manifest.Results), len(manifest.Files))
+	if size > 0 {
+		fmt.Fprintf(&b, " (%d bytes)", size)
+	}
+	fmt.Fprintf(&b, ".\nResults cached at %s.", manifest.CachedAt.Format(time.RFC3339))
+	if len(manifest.Filters) > 0 {
+		keys := sortedKeys(manifest.Filters)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = fmt.Sprintf("%s=%q", k, manifest.Filters[k])
+		}
+		fmt.Fprintf(&b, "\nFilters: %s", strings.Join(parts, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+//================================================================================
+// Snippet Context Lines
+//================================================================================
+
+// parseSnippetLines extracts the numbered rows of a grep.app snippet, split into matched
+// rows, which contain a mark, and the unmarked context rows around them.
+func parseSnippetLines(snippet string) (matches, context map[string]string, err error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(snippet))
+	if err != nil {
+		return nil, nil, err
+	}
+	matches = make(map[string]string)
+	context = make(map[string]string)
+	doc.Find("tr").Each(func(i int, tr *goquery.Selection) {
+		lineNum := strings.TrimSpace(tr.Find("div.lineno").Text())
+		linePre := tr.Find("pre")
+		if lineNum == "" || linePre.Length() == 0 {
+			return
+		}
+		if linePre.Find("mark").Length() > 0 {
+			matches[lineNum] = strings.TrimSpace(linePre.Text())
+		} else {
+			context[lineNum] = strings.TrimSpace(linePre.Text())
+		}
+	})
+	return matches, context, nil
+}
+
+// addLines adds lines to the file's entry in a repository -> path -> line map.
+func addLines(m map[string]map[string]map[string]string, repo, path string, lines map[string]string) {
+	if m[repo] == nil {
+		m[repo] = make(map[string]map[string]string)
+	}
+	if m[repo][path] == nil {
+		m[repo][path] = make(map[string]string, len(lines))
+	}
+	for lineNum, line := range lines {
+		m[repo][path][lineNum] = line
+	}
+}
+
+// mergeContext adds source's context lines to target. Context rows of the same line are
+// the same source text, so there are no collisions to resolve.
+func mergeContext(target, source *Hits) {
+	if len(source.Context) == 0 {
+		return
+	}
+	if target.Context == nil {
+		target.Context = make(map[string]map[string]map[string]string, len(source.Context))
+	}
+	for repo, pathData := range source.Context {
+		for path, lines := range pathData {
+			addLines(target.Context, repo, path, lines)
+		}
+	}
+}
+
+// copyLines deep-copies a repository -> path -> line map.
+func copyLines(m map[string]map[string]map[string]string) map[string]map[string]map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]map[string]map[string]string, len(m))
+	for repo, files := range m {
+		for filePath, lines := range files {
+			addLines(copied, repo, filePath, lines)
+		}
+	}
+	return copied
+}
+
+// withoutContext returns hits with the context lines left out, sharing the matched lines.
+func (h *Hits) withoutContext() *Hits {
+	if h.Context == nil {
+		return h
+	}
+	return &Hits{Hits: h.Hits}
+}
+
+// fileLinesWithContext returns the file's matched lines interleaved with its context lines
+// in line order. Context rows that are also matched lines elsewhere on the page are skipped.
+func fileLinesWithContext(hits *Hits, repo string, file fileHits) []lineHit {
+	context := hits.Context[repo][file.Path]
+	if len(context) == 0 {
+		return file.Lines
+	}
+	matched := hits.Hits[repo][file.Path]
+	lines := make([]lineHit, 0, len(file.Lines)+len(context))
+	var extra []lineHit
+	for key, text := range context {
+		if _, ok := matched[key]; ok {
+			continue
+		}
+		num, _ := strconv.Atoi(key)
+		extra = append(extra, lineHit{Num: num, Key: key, Text: text, Context: true})
+	}
+	sortLineHits(extra)
+	i, j := 0, 0
+	for i < len(file.Lines) || j < len(extra) {
+		if j == len(extra) || (i < len(file.Lines) && file.Lines[i].Num <= extra[j].Num) {
+			lines = append(lines, file.Lines[i])
+			i++
+		} else {
+			lines = append(lines, extra[j])
+			j++
+		}
+	}
+	return lines
+}
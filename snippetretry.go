@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v58/github"
+)
+
+//================================================================================
+// Snippet Parse Recovery
+//================================================================================
+
+const (
+	maxSnippetRecoveries = 5  // Files per page fetched from GitHub to recover unparseable snippets
+	maxRecoveredLines    = 10 // Matched lines kept per file recovered from GitHub
+)
+
+// snippetFailure is a hit whose non-empty snippet yielded no matched lines.
+type snippetFailure struct {
+	repo, path string
+}
+
+type snippetRecoveryKey struct{}
+
+// withSnippetRecovery lets page scans under ctx fetch the files of unparseable snippets
+// from GitHub with ghClient, after re-requesting the page has not helped.
+func withSnippetRecovery(ctx context.Context, ghClient *github.Client) context.Context {
+	return context.WithValue(ctx, snippetRecoveryKey{}, ghClient)
+}
+
+// snippetRecoveryClient returns the GitHub client set by withSnippetRecovery, or nil.
+func snippetRecoveryClient(ctx context.Context) *github.Client {
+	ghClient, _ := ctx.Value(snippetRecoveryKey{}).(*github.Client)
+	return ghClient
+}
+
+// failedSnippets returns the page's hits with a non-empty snippet but no parsed lines,
+// either because parsing failed or because the markup was not recognized.
+func failedSnippets(results *GrepAppResponse, pageHits *Hits) []snippetFailure {
+	var failed []snippetFailure
+	for _, hit := range results.Hits.Hits {
+		if strings.TrimSpace(hit.Content.Snippet) == "" {
+			continue
+		}
+		repo := canonicalRepo(hit.Repo.Raw)
+		if len(pageHits.Hits[repo][hit.Path.Raw]) == 0 {
+			failed = append(failed, snippetFailure{repo: repo, path: hit.Path.Raw})
+		}
+	}
+	return failed
+}
+
+// snippetMatcher returns the expression that finds the query's matches in a file the way
+// grep.app matched them, or nil for an invalid regex.
+func snippetMatcher(opts SearchOptions) *regexp.Regexp {
+	if filter := buildLineFilter(opts.Query, opts.UseRegex, opts.WholeWords, opts.CaseSensitive); filter != nil {
+		return filter.CompiledRe
+	}
+	pattern := regexp.QuoteMeta(opts.Query)
+	if !opts.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// matchFileLines returns up to limit lines of content matching re, keyed by line number.
+func matchFileLines(content string, re *regexp.Regexp, limit int) map[string]string {
+	lines := make(map[string]string)
+	for i, line := range strings.Split(content, "\n") {
+		if len(lines) == limit {
+			break
+		}
+		if re.MatchString(line) {
+			lines[strconv.Itoa(i+1)] = strings.TrimSpace(line)
+		}
+	}
+	return lines
+}
+
+// recoverSnippets fills in the hits of a page whose snippets could not be parsed, instead of
+// leaving them out. The page is requested once more without the cache; hits still failing
+// then get their matched lines from the file on GitHub, when the context carries a client.
+// It returns the hits that stayed unrecovered and the grep.app requests made.
+func recoverSnippets(ctx context.Context, client *http.Client, opts SearchOptions, page int, pageHits *Hits, failed []snippetFailure) ([]snippetFailure, int) {
+	log.Printf("🔁 Re-requesting page %d without the cache for %d unparseable snippets", page, len(failed))
+	fresh := opts
+	fresh.CacheTTL = time.Nanosecond // Every cached page is older
+	requests := 1
+	if results, err := fetchGrepAppPage(ctx, client, fresh, page); err != nil {
+		log.Printf("⚠️ Re-requesting page %d failed: %v", page, err)
+	} else {
+		refetched, _, _ := parsePageHits(results)
+		var remaining []snippetFailure
+		for _, f := range failed {
+			lines := refetched.Hits[f.repo][f.path]
+			if len(lines) == 0 {
+				remaining = append(remaining, f)
+				continue
+			}
+			addLines(pageHits.Hits, f.repo, f.path, lines)
+			if contextLines := refetched.Context[f.repo][f.path]; len(contextLines) > 0 {
+				addLines(pageHits.Context, f.repo, f.path, contextLines)
+			}
+		}
+		failed = remaining
+	}
+
+	ghClient := snippetRecoveryClient(ctx)
+	re := snippetMatcher(opts)
+	if len(failed) == 0 || ghClient == nil || re == nil {
+		return failed, requests
+	}
+	var remaining []snippetFailure
+	for i, f := range failed {
+		if i >= maxSnippetRecoveries || ctx.Err() != nil {
+			remaining = append(remaining, f)
+			continue
+		}
+		if _, unsupported := skipUnsupportedHost(NumberedHit{Repo: f.repo, Path: f.path}); unsupported {
+			remaining = append(remaining, f)
+			continue
+		}
+		req, err := sanitizeFileRequest(f.repo, f.path)
+		if err != nil {
+			remaining = append(remaining, f)
+			continue
+		}
+		file, _ := fetchSingleFile(ctx, ghClient, req, 0, retrievalOptions{MaxDirectoryBytes: defaultDirectoryBytes})
+		lines := map[string]string{}
+		if file.Error == "" && file.Type != "dir" {
+			lines = matchFileLines(file.Content, re, maxRecoveredLines)
+		}
+		if len(lines) == 0 {
+			log.Printf("⚠️ Could not recover the matched lines of %s/%s from GitHub: %s", f.repo, f.path, file.Error)
+			remaining = append(remaining, f)
+			continue
+		}
+		log.Printf("🩹 Recovered %d matched lines of %s/%s from GitHub", len(lines), f.repo, f.path)
+		addLines(pageHits.Hits, f.repo, f.path, lines)
+	}
+	return remaining, requests
+}
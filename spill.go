@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+//================================================================================
+// Spill-to-Disk for Large Results
+//================================================================================
+
+const defaultMaxResultMemoryMB = 256 // Unmerged hits held in memory before spilling to disk
+
+// spoolBatch is one set of hits waiting to be merged, with the tag used for collisions.
+type spoolBatch struct {
+	Tag  string `json:"tag"`
+	Hits *Hits  `json:"hits"`
+}
+
+// hitSpool holds the hits of a fan-out search until they are merged. Once more than
+// limit bytes are held, later batches are written to temporary segment files and read
+// back one at a time when the spool is drained, so the unmerged copies never all sit in
+// memory next to the merged result. A limit of 0 keeps everything in memory.
+type hitSpool struct {
+	limit    int
+	held     int          // Estimated bytes of the batches in memory
+	batches  []spoolBatch // Held in memory; they arrived before any segment
+	dir      string       // Created on the first spill
+	segments []string     // Segment files in arrival order
+}
+
+func newHitSpool(limit int) *hitSpool {
+	return &hitSpool{limit: limit}
+}
+
+// add queues hits for merging. The caller must not use hits afterwards.
+func (s *hitSpool) add(tag string, hits *Hits) {
+	size := estimateHitsSize(hits)
+	// Once spilling starts every later batch spills too, which keeps arrival order
+	if s.limit > 0 && (len(s.segments) > 0 || s.held+size > s.limit) {
+		err := s.spill(spoolBatch{Tag: tag, Hits: hits})
+		if err == nil {
+			return
+		}
+		log.Printf("⚠️ Failed to spill %s hits to disk, keeping them in memory: %v", tag, err)
+	}
+	s.held += size
+	s.batches = append(s.batches, spoolBatch{Tag: tag, Hits: hits})
+}
+
+// spill writes a batch to a new segment file.
+func (s *hitSpool) spill(batch spoolBatch) error {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "grepapp-spill-*")
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("segment-%03d.json", len(s.segments)))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(batch); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	s.segments = append(s.segments, path)
+	log.Printf("💽 Spilled %s hits to %s (%d files)", batch.Tag, path, countFiles(batch.Hits))
+	return nil
+}
+
+// drain merges every batch into target in arrival order, reading segments one at a time,
+// and removes the segment files. It returns the number of segments that were spilled.
+func (s *hitSpool) drain(merger *lineMerger, target *Hits) (int, error) {
+	defer s.close()
+	for _, batch := range s.batches {
+		merger.merge(target, batch.Hits, batch.Tag)
+	}
+	s.batches, s.held = nil, 0
+	for _, path := range s.segments {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return len(s.segments), fmt.Errorf("failed to read spilled hits: %w", err)
+		}
+		var batch spoolBatch
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return len(s.segments), fmt.Errorf("failed to decode spilled hits: %w", err)
+		}
+		merger.merge(target, batch.Hits, batch.Tag)
+		os.Remove(path)
+	}
+	return len(s.segments), nil
+}
+
+// close removes the spill directory and anything left in it.
+func (s *hitSpool) close() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
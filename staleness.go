@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Cached Result Freshness
+//================================================================================
+
+// defaultStaleAfter is the cache age beyond which served results carry a staleness warning.
+const defaultStaleAfter = 6 * time.Hour
+
+// noteCachedAt records that the scan served data cached at cachedAt, keeping the oldest time.
+func (s *searchScan) noteCachedAt(cachedAt time.Time) {
+	if cachedAt.IsZero() {
+		return
+	}
+	if s.CachedAt.IsZero() || cachedAt.Before(s.CachedAt) {
+		s.CachedAt = cachedAt
+	}
+}
+
+// isStale reports whether data cached at cachedAt is older than the configured threshold.
+// A threshold of zero disables staleness warnings.
+func isStale(cachedAt, now time.Time) bool {
+	staleAfter := GetConfig().StaleAfter
+	return !cachedAt.IsZero() && staleAfter > 0 && now.Sub(cachedAt) > staleAfter
+}
+
+// cacheFreshnessNote describes when cached results were stored, with a warning when they
+// are stale. It returns "" for results fetched fresh.
+func cacheFreshnessNote(cachedAt, now time.Time) string {
+	if cachedAt.IsZero() {
+		return ""
+	}
+	age := now.Sub(cachedAt).Round(time.Second)
+	if isStale(cachedAt, now) {
+		return fmt.Sprintf("⚠️ These results come from a cache stored at %s and are %s old, past the %s staleness threshold. Set forceRefresh to true to fetch fresh results from grep.app.",
+			cachedAt.UTC().Format(time.RFC3339), age, GetConfig().StaleAfter)
+	}
+	return fmt.Sprintf("🕒 Results served from cache stored at %s (%s old).", cachedAt.UTC().Format(time.RFC3339), age)
+}
+
+// withCacheFreshness appends the cache age note to the tool result when results were cached.
+func withCacheFreshness(result *mcp.CallToolResult, cachedAt time.Time) *mcp.CallToolResult {
+	note := cacheFreshnessNote(cachedAt, time.Now())
+	if note == "" || result == nil {
+		return result
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(note))
+	return result
+}
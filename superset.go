@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+//================================================================================
+// Superset Scan Reuse
+//================================================================================
+
+// completeScan is a fully paged single-language scan, cached so that later searches
+// adding only client-side reducible filters can be answered without calling grep.app.
+type completeScan struct {
+	Hits       Hits `json:"hits"`
+	TotalCount int  `json:"total_count"`
+}
+
+// Filters that can be applied to cached hits without changing grep.app semantics.
+// Language is not among them: hits carry no language, and inferring one from the file
+// name disagrees with grep.app's classification for headers shared by C, C++ and
+// Objective-C, extensionless scripts and vendored files, so a reduced result would not
+// match a fresh search. Multi-language searches already reuse per-language scans.
+var reducibleFilters = []string{"repoFilter", "pathFilter"}
+
+// scanCacheKey normalizes the server-side search parameters of a single-language scan.
+func scanCacheKey(args map[string]interface{}) string {
+	key := map[string]interface{}{"scan": true}
+	if query, _ := args["query"].(string); query != "" {
+		key["query"] = query
+	}
+	for _, flag := range []string{"caseSensitive", "useRegex", "wholeWords"} {
+		if v, _ := args[flag].(bool); v {
+			key[flag] = true
+		}
+	}
+	for _, filter := range []string{"repoFilter", "pathFilter", "langFilter"} {
+		if v, _ := args[filter].(string); strings.TrimSpace(v) != "" {
+			if filter == "repoFilter" {
+				v = canonicalRepo(v)
+			}
+			key[filter] = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	// Merged hits depend on how colliding lines were resolved
+	if strategy, _ := parseMergeStrategy(args); strategy != mergeKeepLast {
+		key["mergeStrategy"] = string(strategy)
+	}
+	return generateCacheKey(key)
+}
+
+// supersetCandidates returns the argument sets whose results contain those of args,
+// narrowest first: args itself, then args with each combination of reducible filters removed.
+func supersetCandidates(args map[string]interface{}) []map[string]interface{} {
+	var present []string
+	for _, filter := range reducibleFilters {
+		if v, _ := args[filter].(string); strings.TrimSpace(v) != "" {
+			present = append(present, filter)
+		}
+	}
+	candidates := []map[string]interface{}{args}
+	// Enumerate subsets of the present filters to drop, fewest dropped first
+	for dropCount := 1; dropCount <= len(present); dropCount++ {
+		for mask := 1; mask < 1<<len(present); mask++ {
+			if bitCount(mask) != dropCount {
+				continue
+			}
+			candidate := copyArgs(args)
+			for i, filter := range present {
+				if mask&(1<<i) != 0 {
+					delete(candidate, filter)
+				}
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+func bitCount(n int) int {
+	count := 0
+	for ; n > 0; n &= n - 1 {
+		count++
+	}
+	return count
+}
+
+// lookupSupersetScan serves a scan from a cached complete scan of args or one of its
+// supersets, reducing the cached hits to the requested repo and path filters.
+func lookupSupersetScan(args map[string]interface{}) (*searchScan, bool) {
+	ttlOverride, _ := parseCacheTTLArg(args) // Validated by the tool handler
+	ttl := cacheTTLFor(cacheEntrySearchScan, ttlOverride)
+	for i, candidate := range supersetCandidates(args) {
+		cached, cachedAt, err := getCachedEntry[completeScan](scanCacheKey(candidate), ttl)
+		if err != nil || cached == nil {
+			continue
+		}
+		repoFilter, _ := args["repoFilter"].(string)
+		pathFilter, _ := args["pathFilter"].(string)
+		// Reducing also copies the hits, which the memory cache layer still holds
+		hits := reduceHits(&cached.Hits, repoFilter, pathFilter)
+		totalCount := cached.TotalCount
+		if i > 0 {
+			totalCount = reducedMatchCount(cached.TotalCount, &cached.Hits, hits)
+			log.Printf("♻️ Served search from cached superset %s (%d → %d files)", describeReducibleFilters(candidate), countFiles(&cached.Hits), countFiles(hits))
+		}
+		return &searchScan{Hits: hits, TotalCount: totalCount, Complete: true, FromSuperset: i > 0, CachedAt: cachedAt}, true
+	}
+	return nil, false
+}
+
+// describeReducibleFilters names the reducible filters still applied in a candidate.
+func describeReducibleFilters(candidate map[string]interface{}) string {
+	var parts []string
+	for _, filter := range reducibleFilters {
+		if v, _ := candidate[filter].(string); v != "" {
+			parts = append(parts, fmt.Sprintf("%s=%q", filter, v))
+		}
+	}
+	if len(parts) == 0 {
+		return "without repo or path filters"
+	}
+	return "with " + strings.Join(parts, ", ")
+}
+
+// reduceHits returns a copy of hits with repo and path filters applied client-side, keeping
+// the context lines of the files it keeps. repoFilter matches a repository name exactly and
+// pathFilter matches a path substring, both case-insensitively, mirroring grep.app's
+// f.repo and path parameters.
+func reduceHits(hits *Hits, repoFilter, pathFilter string) *Hits {
+	repoFilter = strings.TrimSpace(repoFilter)
+	pathFilter = strings.ToLower(strings.TrimSpace(pathFilter))
+	reduced := &Hits{Hits: make(map[string]map[string]map[string]string)}
+	for repo, pathData := range hits.Hits {
+		if repoFilter != "" && !strings.EqualFold(repo, repoFilter) {
+			continue
+		}
+		for path, lines := range pathData {
+			if pathFilter != "" && !strings.Contains(strings.ToLower(path), pathFilter) {
+				continue
+			}
+			addLines(reduced.Hits, repo, path, lines)
+			if contextLines := hits.Context[repo][path]; contextLines != nil {
+				if reduced.Context == nil {
+					reduced.Context = make(map[string]map[string]map[string]string)
+				}
+				addLines(reduced.Context, repo, path, contextLines)
+			}
+		}
+	}
+	return reduced
+}
+
+// reducedMatchCount scales grep.app's match count for a superset to the reduced hits, by
+// the share of matched lines they keep. The count covers matches grep.app did not return
+// lines for, so it cannot be recounted from the hits themselves.
+func reducedMatchCount(totalCount int, superset, reduced *Hits) int {
+	supersetLines := countMatchedLines(superset)
+	if supersetLines == 0 {
+		return 0
+	}
+	return int(math.Round(float64(totalCount) * float64(countMatchedLines(reduced)) / float64(supersetLines)))
+}
+
+// countMatchedLines returns the number of matched lines across all files.
+func countMatchedLines(hits *Hits) int {
+	total := 0
+	for _, pathData := range hits.Hits {
+		for _, lines := range pathData {
+			total += len(lines)
+		}
+	}
+	return total
+}
+
+// cacheCompleteScan stores a scan that covered every result page so later subset
+// searches can reuse it. Truncated scans or scans with schema issues are not stored.
+func cacheCompleteScan(args map[string]interface{}, scan *searchScan) {
+	if !scan.Complete || scan.FromSuperset || len(scan.SchemaIssues) > 0 {
+		return
+	}
+	query, _ := args["query"].(string)
+	if err := cacheData(scanCacheKey(args), completeScan{Hits: *scan.Hits, TotalCount: scan.TotalCount}, query, cacheEntrySearchScan); err != nil {
+		log.Printf("⚠️ Failed to cache complete scan: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Per-Call Deadlines
+//================================================================================
+
+const maxCallTimeout = 10 * time.Minute
+
+// timeoutSecondsOption declares the shared timeoutSeconds argument on a tool.
+func timeoutSecondsOption() mcp.ToolOption {
+	return mcp.WithNumber("timeoutSeconds", mcp.Description(fmt.Sprintf(
+		"Maximum time for this call in seconds (max %d). When it expires, results gathered so far are returned with a warning instead of an error where possible.",
+		int(maxCallTimeout.Seconds()))))
+}
+
+// parseTimeoutArg reads the optional timeoutSeconds argument. A zero result means no deadline.
+func parseTimeoutArg(args map[string]interface{}) (time.Duration, error) {
+	seconds, ok, err := argNumber(args, "timeoutSeconds")
+	if err != nil {
+		return 0, fmt.Errorf("timeoutSeconds must be a number, got %v", args["timeoutSeconds"])
+	}
+	if !ok {
+		return 0, nil
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf("timeoutSeconds must not be negative: %v", seconds)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > maxCallTimeout {
+		return 0, fmt.Errorf("timeoutSeconds must not exceed %d", int(maxCallTimeout.Seconds()))
+	}
+	return timeout, nil
+}
+
+// withCallTimeout derives the handler context from the timeoutSeconds argument. The
+// returned cancel function must always be called.
+func withCallTimeout(ctx context.Context, args map[string]interface{}) (context.Context, context.CancelFunc, time.Duration, error) {
+	timeout, err := parseTimeoutArg(args)
+	if err != nil {
+		return ctx, func() {}, 0, err
+	}
+	if timeout == 0 {
+		return ctx, func() {}, 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, timeout, nil
+}
+
+// isCallTimeout reports whether err was caused by the per-call deadline expiring.
+func isCallTimeout(ctx context.Context, err error) bool {
+	return err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// isCancelled reports whether err was caused by the client cancelling the call, as opposed
+// to the per-call deadline expiring.
+func isCancelled(ctx context.Context, err error) bool {
+	return err != nil && errors.Is(ctx.Err(), context.Canceled)
+}
+
+// withTimeoutWarning appends a note that the call hit its deadline and returned partial results.
+func withTimeoutWarning(result *mcp.CallToolResult, timeout time.Duration, detail string) *mcp.CallToolResult {
+	if result == nil {
+		return result
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf(
+		"⏱️ Warning: timeoutSeconds (%s) expired, so results are partial: %s.", timeout, detail)))
+	return result
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//================================================================================
+// Tool Selection
+//================================================================================
+
+// toolGroups name sets of tools that -enable-tools and -disable-tools accept in place of
+// listing each tool. Every registered tool belongs to at least one group, so the groups
+// also tell which tool names are known. A tool may be in several groups.
+var toolGroups = map[string][]string{
+	"search":      {"searchCode", "expandRepo", "suggestQueries", "recentSearches", "estimate"},
+	"github":      {"batchRetrievalTool", "fetchFile", "listDirectory", "exportSnapshot", "compareLocal"},
+	"cache":       {"debugCache", "cacheStatus", "cacheClear", "importSnapshot"},
+	"patterns":    {"savePattern", "listPatterns", "exportPatterns", "importPatterns"},
+	"collections": {"saveCollection", "listCollections"},
+	"admin":       {"selfCheck", "sessionStats", "serverStats", "listProviders"},
+	"write":       {"cacheClear", "importSnapshot", "savePattern", "importPatterns", "saveCollection"}, // Tools that change server state
+}
+
+// knownTools returns every tool name that appears in a group, sorted.
+func knownTools() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, tools := range toolGroups {
+		for _, name := range tools {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandToolNames resolves tool and group names into the set of tools they cover.
+func expandToolNames(entries []string) (map[string]bool, error) {
+	known := knownTools()
+	tools := make(map[string]bool)
+	for _, entry := range entries {
+		if group, ok := toolGroups[entry]; ok {
+			for _, name := range group {
+				tools[name] = true
+			}
+			continue
+		}
+		if !containsString(known, entry) {
+			groups := make([]string, 0, len(toolGroups))
+			for group := range toolGroups {
+				groups = append(groups, group)
+			}
+			sort.Strings(groups)
+			return nil, fmt.Errorf("unknown tool or group %q (tools: %s; groups: %s)", entry, strings.Join(known, ", "), strings.Join(groups, ", "))
+		}
+		tools[entry] = true
+	}
+	return tools, nil
+}
+
+// resolveDisabledTools returns the tools to hide, sorted. With an enabled list only the
+// tools it covers stay available; the disabled list is then taken away from those.
+func resolveDisabledTools(enabled, disabled []string) ([]string, error) {
+	enabledSet, err := expandToolNames(enabled)
+	if err != nil {
+		return nil, err
+	}
+	disabledSet, err := expandToolNames(disabled)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range knownTools() {
+		if disabledSet[name] || (len(enabled) > 0 && !enabledSet[name]) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// toolDisabled reports whether the configuration hides the tool.
+func toolDisabled(name string) bool {
+	cfg := GetConfig()
+	disabled, err := resolveDisabledTools(cfg.EnabledTools, cfg.DisabledTools)
+	return err == nil && containsString(disabled, name)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+//================================================================================
+// Comment Translation
+//================================================================================
+
+// maxTranslatedComments caps the distinct comments sent for translation per tool call.
+const maxTranslatedComments = 40
+
+// commentStart matches a comment marker at the start of a line or after whitespace, or a
+// leading * continuing a block comment.
+var commentStart = regexp.MustCompile(`(?:^\s*\*+|(?:^|\s)(?://+|/\*+|#+|--|<!--))\s*`)
+
+// CommentTranslation is one non-English comment with its English translation.
+type CommentTranslation struct {
+	Location    string `json:"location"` // owner/repo/path:line of the first occurrence
+	Occurrences int    `json:"occurrences"`
+	Original    string `json:"original"`
+	Translation string `json:"translation"`
+	Language    string `json:"language,omitempty"` // Source language detected by the endpoint
+}
+
+// extractComment returns the comment text on a line, or "" when it has none.
+func extractComment(line string) string {
+	loc := commentStart.FindStringIndex(line)
+	if loc == nil {
+		return ""
+	}
+	comment := strings.TrimSpace(line[loc[1]:])
+	comment = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(comment, "*/"), "-->"))
+	return comment
+}
+
+// maybeNonEnglish reports whether text contains letters outside ASCII. English comments
+// rarely do; the endpoint's language detection drops those that are English after all.
+func maybeNonEnglish(text string) bool {
+	for _, r := range text {
+		if r > unicode.MaxASCII && unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// commentCollector gathers distinct candidate comments in the order they are seen.
+type commentCollector struct {
+	comments []CommentTranslation
+	index    map[string]int
+	limit    int
+}
+
+func newCommentCollector(limit int) *commentCollector {
+	return &commentCollector{index: make(map[string]int), limit: limit}
+}
+
+func (c *commentCollector) add(location, line string) {
+	comment := extractComment(line)
+	if comment == "" || !maybeNonEnglish(comment) {
+		return
+	}
+	if i, ok := c.index[comment]; ok {
+		c.comments[i].Occurrences++
+		return
+	}
+	if len(c.comments) >= c.limit {
+		return
+	}
+	c.index[comment] = len(c.comments)
+	c.comments = append(c.comments, CommentTranslation{Location: location, Occurrences: 1, Original: comment})
+}
+
+// collectHitComments finds candidate comments in matched lines, in repository, path and
+// line order.
+func collectHitComments(hits *Hits, limit int) []CommentTranslation {
+	collector := newCommentCollector(limit)
+	repos := make([]string, 0, len(hits.Hits))
+	for repo := range hits.Hits {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		paths := make([]string, 0, len(hits.Hits[repo]))
+		for filePath := range hits.Hits[repo] {
+			paths = append(paths, filePath)
+		}
+		sort.Strings(paths)
+		for _, filePath := range paths {
+			lines := hits.Hits[repo][filePath]
+			numbers := make([]string, 0, len(lines))
+			for lineNum := range lines {
+				numbers = append(numbers, lineNum)
+			}
+			sort.Slice(numbers, func(i, j int) bool {
+				a, _ := strconv.Atoi(numbers[i])
+				b, _ := strconv.Atoi(numbers[j])
+				return a < b
+			})
+			for _, lineNum := range numbers {
+				collector.add(fmt.Sprintf("%s/%s:%s", repo, filePath, lineNum), lines[lineNum])
+			}
+		}
+	}
+	return collector.comments
+}
+
+// collectFileComments finds candidate comments in retrieved file contents.
+func collectFileComments(files []RetrievedFile, limit int) []CommentTranslation {
+	collector := newCommentCollector(limit)
+	for _, file := range files {
+		if file.Error != "" || file.Type == "dir" {
+			continue
+		}
+		for i, line := range strings.Split(file.Content, "\n") {
+			collector.add(fmt.Sprintf("%s/%s:%d", file.Repo, file.Path, i+1), line)
+		}
+	}
+	return collector.comments
+}
+
+// translateComments translates the comments to English with the configured endpoint in a
+// single request. The endpoint speaks the LibreTranslate API: it is sent the texts as q
+// with source "auto" and returns translatedText and detectedLanguage arrays. Comments
+// detected as English, or returned unchanged, are left out.
+func translateComments(ctx context.Context, client *http.Client, comments []CommentTranslation) ([]CommentTranslation, error) {
+	cfg := GetConfig()
+	texts := make([]string, len(comments))
+	for i, c := range comments {
+		texts[i] = c.Original
+	}
+	payload := map[string]interface{}{"q": texts, "source": "auto", "target": "en", "format": "text"}
+	if cfg.TranslateAPIKey != "" {
+		payload["api_key"] = cfg.TranslateAPIKey
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TranslateURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create translation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("translation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read translation response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("translation endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var decoded struct {
+		TranslatedText   []string `json:"translatedText"`
+		DetectedLanguage []struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("unexpected translation response: %w", err)
+	}
+	if len(decoded.TranslatedText) != len(comments) {
+		return nil, fmt.Errorf("translation endpoint returned %d translations for %d comments", len(decoded.TranslatedText), len(comments))
+	}
+
+	var translated []CommentTranslation
+	for i, c := range comments {
+		c.Translation = strings.TrimSpace(decoded.TranslatedText[i])
+		if i < len(decoded.DetectedLanguage) {
+			c.Language = decoded.DetectedLanguage[i].Language
+		}
+		if c.Language == "en" || c.Translation == "" || c.Translation == c.Original {
+			continue
+		}
+		translated = append(translated, c)
+	}
+	return translated, nil
+}
+
+// formatCommentTranslations renders translations as a readable block.
+func formatCommentTranslations(translations []CommentTranslation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🌐 Translated %d non-English comments:\n", len(translations))
+	for _, t := range translations {
+		fmt.Fprintf(&b, "📍 %s", t.Location)
+		if t.Language != "" {
+			fmt.Fprintf(&b, " (%s)", t.Language)
+		}
+		if t.Occurrences > 1 {
+			fmt.Fprintf(&b, " and %d more", t.Occurrences-1)
+		}
+		fmt.Fprintf(&b, "\n   %s\n   → %s\n", t.Original, t.Translation)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// withCommentTranslations appends translations of the comments to the result. A failed
+// translation is reported as a warning and leaves the result as it was.
+func withCommentTranslations(ctx context.Context, client *http.Client, result *mcp.CallToolResult, comments []CommentTranslation) *mcp.CallToolResult {
+	if result == nil || len(comments) == 0 {
+		return result
+	}
+	translations, err := translateComments(ctx, client, comments)
+	if err != nil {
+		log.Printf("⚠️ Comment translation failed: %v", err)
+		addWarning(ctx, warnTranslateFailed, fmt.Sprintf("non-English comments could not be translated: %v", err))
+		return result
+	}
+	log.Printf("🌐 Translated %d of %d candidate comments", len(translations), len(comments))
+	if len(translations) == 0 {
+		return result
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(formatCommentTranslations(translations)))
+	return result
+}
+
+// checkTranslationArg reports an error when translateComments is requested without a
+// translation endpoint configured.
+func checkTranslationArg(requested bool) error {
+	if requested && GetConfig().TranslateURL == "" {
+		return fmt.Errorf("translateComments needs a translation endpoint; start the server with -translate-url or %s", envTranslateURL)
+	}
+	return nil
+}
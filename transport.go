@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// HTTP Transport
+//================================================================================
+
+const (
+	mcpEndpointPath  = "/mcp"
+	unixListenPrefix = "unix:"
+)
+
+// listenAddress describes where the HTTP transport accepts connections.
+type listenAddress struct {
+	Network string // "tcp" or "unix"
+	Address string // host:port or socket path
+}
+
+// String renders the address in the same form accepted by --listen.
+func (a listenAddress) String() string {
+	if a.Network == "unix" {
+		return unixListenPrefix + a.Address
+	}
+	return a.Address
+}
+
+// parseListenAddress parses a --listen value. It accepts "host:port", ":port" and
+// "unix:/path/to/socket". An empty value falls back to all interfaces on port.
+func parseListenAddress(listen string, port int) (listenAddress, error) {
+	if listen == "" {
+		return listenAddress{Network: "tcp", Address: fmt.Sprintf(":%d", port)}, nil
+	}
+	if strings.HasPrefix(listen, unixListenPrefix) {
+		path := strings.TrimPrefix(listen, unixListenPrefix)
+		if path == "" {
+			return listenAddress{}, fmt.Errorf("unix listen address requires a socket path")
+		}
+		return listenAddress{Network: "unix", Address: path}, nil
+	}
+	if _, _, err := net.SplitHostPort(listen); err != nil {
+		return listenAddress{}, fmt.Errorf("invalid listen address %q: %w", listen, err)
+	}
+	return listenAddress{Network: "tcp", Address: listen}, nil
+}
+
+// listen opens the listener, removing a stale unix socket left by a previous run.
+func (a listenAddress) listen() (net.Listener, error) {
+	if a.Network == "unix" {
+		if info, err := os.Stat(a.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(a.Address); err != nil {
+				return nil, fmt.Errorf("failed to remove stale socket %s: %w", a.Address, err)
+			}
+		}
+	}
+	return net.Listen(a.Network, a.Address)
+}
+
+// newHTTPHandler builds the HTTP handler for the MCP endpoint.
+func newHTTPHandler(s *server.MCPServer) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(mcpEndpointPath, server.NewStreamableHTTPServer(s, server.WithHTTPContextFunc(tenantHTTPContext)))
+	return accessLogMiddleware(corsMiddleware(GetConfig().CORS, profileAuthMiddleware(tenantProfiles, subscriptionMiddleware(mux))))
+}
+
+// httpShutdownTimeout bounds how long in-flight requests may run after SIGINT or SIGTERM.
+const httpShutdownTimeout = 10 * time.Second
+
+// serveHTTP runs the streamable HTTP transport on the given address until it fails or the
+// process receives SIGINT or SIGTERM, in which case it shuts down gracefully.
+func serveHTTP(s *server.MCPServer, addr listenAddress) error {
+	listener, err := addr.listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if addr.Network == "unix" {
+		defer os.Remove(addr.Address)
+	}
+
+	httpServer := &http.Server{Handler: newHTTPHandler(s)}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigChan)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-sigChan
+		log.Printf("🛑 Shutting down HTTP server")
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-shutdownDone
+	return nil
+}
+
+//================================================================================
+// Stdio Transport
+//================================================================================
+
+// syncWriter serializes writes so responses written outside the stdio server are not
+// interleaved with its own.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// serveStdio runs the stdio transport until stdin closes or the process receives SIGINT
+// or SIGTERM, which returns context.Canceled. Subscription requests are answered before
+// messages reach the stdio server.
+func serveStdio(s *server.MCPServer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigChan)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	stdout := &syncWriter{w: os.Stdout}
+	stdioClient = newClientRequester(stdout)
+	defer func() { stdioClient = nil }()
+	stdin, pipe := io.Pipe()
+	forward := newQueuedWriter(pipe)
+	go func() {
+		forward.closeWithError(filterStdioLines(os.Stdin, forward, stdout, stdioSessionID, stdioClient))
+	}()
+	return server.NewStdioServer(s).Listen(ctx, stdin, stdout)
+}
+
+// filterStdioLines copies newline-delimited JSON-RPC messages from in to out. Subscription
+// requests are answered on responses and responses to server requests are handed to
+// requester instead of being forwarded.
+func filterStdioLines(in io.Reader, out, responses io.Writer, sessionID string, requester *clientRequester) error {
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if requester != nil && requester.observe([]byte(line)) {
+				// Consumed as the answer to a server request
+			} else if response, ok := handleSubscriptionMessage(sessionID, []byte(line)); ok {
+				encoded, _ := json.Marshal(response)
+				if _, werr := fmt.Fprintf(responses, "%s\n", encoded); werr != nil {
+					return werr
+				}
+			} else if _, werr := io.WriteString(out, line); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// stdioQueueSize bounds the client messages waiting for the stdio server.
+const stdioQueueSize = 256
+
+// queuedWriter hands writes to a goroutine, so stdin keeps being read while the stdio
+// server handles a tool call that waits for the client to answer a server request.
+type queuedWriter struct {
+	lines chan []byte
+	pipe  *io.PipeWriter
+	err   error
+}
+
+func newQueuedWriter(pipe *io.PipeWriter) *queuedWriter {
+	w := &queuedWriter{lines: make(chan []byte, stdioQueueSize), pipe: pipe}
+	go func() {
+		for line := range w.lines {
+			w.pipe.Write(line) // Fails only once the stdio server stopped reading
+		}
+		w.pipe.CloseWithError(w.err)
+	}()
+	return w
+}
+
+func (w *queuedWriter) Write(p []byte) (int, error) {
+	w.lines <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+// closeWithError closes the pipe with err after the queued messages were delivered.
+func (w *queuedWriter) closeWithError(err error) {
+	w.err = err
+	close(w.lines)
+}
+
+//================================================================================
+// HTTP Access Log
+//================================================================================
+
+const mcpSessionHeader = "Mcp-Session-Id"
+
+// accessLogWriter records the status code and body size written by a handler.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush forwards to the underlying writer so streamed SSE responses are not buffered.
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLogMiddleware writes one structured access log entry per HTTP request. The MCP
+// session is taken from the request header, or from the response for initialize calls.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		logger := GetLogger()
+		if logger == nil {
+			return
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		sessionID := r.Header.Get(mcpSessionHeader)
+		if sessionID == "" {
+			sessionID = recorder.Header().Get(mcpSessionHeader)
+		}
+		tenant := ""
+		if profile, ok := tenantProfiles.lookup(apiKeyFromRequest(r)); ok {
+			tenant = profile.Name
+		}
+		logger.LogHTTPAccess(HTTPAccessLogData{
+			Tenant:       tenant,
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			MCPSessionID: sessionID,
+			RemoteAddr:   r.RemoteAddr,
+			UserAgent:    r.UserAgent(),
+			Status:       status,
+			BytesWritten: recorder.bytes,
+			DurationMs:   time.Since(start).Milliseconds(),
+		})
+	})
+}
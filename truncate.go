@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//================================================================================
+// Retrieved File Size Limits
+//================================================================================
+
+const (
+	defaultMaxFileBytes  = 256 << 10 // Content kept per retrieved file
+	defaultMaxBatchBytes = 2 << 20   // Content kept across all files of a batch
+	minBudgetFileBytes   = 1 << 10   // Smaller remainders of the batch budget omit a file instead of truncating it
+)
+
+// truncateContent cuts content longer than limit bytes down to its head and tail, three
+// quarters from the head, with a marker line for the part left out. Cuts fall on line
+// boundaries where the kept parts have any, and never split a UTF-8 sequence.
+func truncateContent(content string, limit int) (string, bool) {
+	if len(content) <= limit {
+		return content, false
+	}
+	headBytes := limit * 3 / 4
+	tailBytes := limit - headBytes
+
+	head := content[:headBytes]
+	if i := strings.LastIndexByte(head, '\n'); i >= 0 {
+		head = head[:i+1]
+	} else {
+		for len(head) > 0 && !utf8.RuneStart(content[len(head)]) {
+			head = head[:len(head)-1]
+		}
+	}
+	tail := content[len(content)-tailBytes:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	} else {
+		for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+			tail = tail[1:]
+		}
+	}
+
+	omitted := content[len(head) : len(content)-len(tail)]
+	marker := fmt.Sprintf("⋯ %d bytes truncated ⋯", len(omitted))
+	if lines := strings.Count(omitted, "\n"); lines > 0 && strings.HasSuffix(head, "\n") {
+		first := strings.Count(head, "\n") + 1
+		marker = fmt.Sprintf("⋯ lines %d-%d truncated (%d bytes) ⋯", first, first+lines-1, len(omitted))
+	}
+	if !strings.HasSuffix(head, "\n") {
+		marker = "\n" + marker
+	}
+	return head + marker + "\n" + tail, true
+}
+
+// limitFileSizes truncates each file's content to maxFileBytes and then keeps the batch's
+// total content within maxBatchBytes, truncating the file that crosses the budget and
+// omitting the content of files after it. Files repeating an earlier file's content are
+// not counted, since the output shows them once. A zero limit disables it. It returns the
+// number of files truncated and omitted.
+func limitFileSizes(files []RetrievedFile, maxFileBytes, maxBatchBytes int) (truncated, omitted int) {
+	seen := make(map[string]bool)
+	used := 0
+	for i := range files {
+		file := &files[i]
+		if file.Error != "" || file.Type == "dir" || file.DuplicateOf != "" {
+			continue
+		}
+		if file.SHA256 != "" {
+			if seen[file.SHA256] {
+				continue
+			}
+			seen[file.SHA256] = true
+		}
+		original := len(file.Content)
+		limit := maxFileBytes
+		if maxBatchBytes > 0 {
+			remaining := maxBatchBytes - used
+			if remaining < minBudgetFileBytes && original > remaining {
+				file.Content = fmt.Sprintf("⋯ %d bytes omitted: the batch reached its %d byte limit ⋯\n", original, maxBatchBytes)
+				file.Truncated, file.OriginalBytes = true, original
+				omitted++
+				continue
+			}
+			if limit <= 0 || remaining < limit {
+				limit = remaining
+			}
+		}
+		if limit > 0 {
+			if content, cut := truncateContent(file.Content, limit); cut {
+				file.Content = content
+				file.Truncated, file.OriginalBytes = true, original
+				truncated++
+			}
+		}
+		used += len(file.Content)
+	}
+	return truncated, omitted
+}
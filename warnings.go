@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Structured Warnings
+//================================================================================
+
+// Warning codes. Agents can match on these; the messages are for people.
+const (
+	warnSnippetParse     = "snippet_parse_failed" // Result snippets that could not be parsed were left out
+	warnSchemaMismatch   = "schema_mismatch"      // grep.app returned an unexpected response shape
+	warnResultsTruncated = "results_truncated"    // More results exist than were fetched or listed
+	warnFirstPageOnly    = "first_page_only"      // quickFirstPage returned before the other pages
+	warnTimeout          = "timeout_partial"      // The call deadline cut the work short
+	warnBudgetExhausted  = "budget_exhausted"     // The upstream API budget ran out
+	warnStaleCache       = "stale_cache"          // Results came from a cache past the staleness threshold
+	warnReposSkipped     = "repos_skipped"        // Repositories were left out of the results
+	warnFilesSkipped     = "files_skipped"        // Requested files were not retrieved
+	warnRateLimited      = "rate_limited"         // GitHub rate limiting failed some requests
+	warnDiskDegraded     = "disk_degraded"        // Cache or log writes are disabled
+	warnProviderFallback = "provider_fallback"    // A fallback provider served the results
+	warnPageFailed       = "page_failed"          // A result page failed; the pages before it were returned
+	warnTranslateFailed  = "translation_failed"   // Non-English comments could not be translated
+	warnFilesTruncated   = "files_truncated"      // Retrieved file content was cut by the size limits
+)
+
+// ToolWarning is one entry of the warnings array in JSON tool results.
+type ToolWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// warningCollector gathers the warnings raised while a tool call runs.
+type warningCollector struct {
+	mu       sync.Mutex
+	warnings []ToolWarning
+	keepJSON bool // The JSON result must not gain a warnings field
+}
+
+type warningCollectorKey struct{}
+
+// addWarning records a warning for the current tool call. Repeated warnings are kept once.
+func addWarning(ctx context.Context, code, message string) {
+	collector, ok := ctx.Value(warningCollectorKey{}).(*warningCollector)
+	if !ok {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	warning := ToolWarning{Code: code, Message: message}
+	for _, existing := range collector.warnings {
+		if existing == warning {
+			return
+		}
+	}
+	collector.warnings = append(collector.warnings, warning)
+}
+
+// keepJSONUnchanged marks a JSON result whose top-level keys are data, such as the bare
+// hits map, so warnings are reported in a footer instead of a warnings field.
+func keepJSONUnchanged(ctx context.Context) {
+	if collector, ok := ctx.Value(warningCollectorKey{}).(*warningCollector); ok {
+		collector.mu.Lock()
+		collector.keepJSON = true
+		collector.mu.Unlock()
+	}
+}
+
+// warningsMiddleware collects the warnings raised by a tool call. A JSON object result
+// gains a warnings array, empty when nothing went wrong; other results gain a compact
+// warnings footer when there is something to report.
+func warningsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		collector := &warningCollector{}
+		result, err := next(context.WithValue(ctx, warningCollectorKey{}, collector), request)
+		if result == nil || result.IsError {
+			return result, err
+		}
+		collector.mu.Lock()
+		warnings, keepJSON := collector.warnings, collector.keepJSON
+		collector.mu.Unlock()
+		if !keepJSON && addJSONWarnings(result, warnings) {
+			return result, err
+		}
+		if footer := formatWarningsFooter(warnings); footer != "" {
+			result.Content = append(result.Content, mcp.NewTextContent(footer))
+		}
+		return result, err
+	}
+}
+
+// addJSONWarnings adds the warnings field to the first JSON object in the result, keeping
+// its formatting. It reports false when the result holds no JSON object.
+func addJSONWarnings(result *mcp.CallToolResult, warnings []ToolWarning) bool {
+	if warnings == nil {
+		warnings = []ToolWarning{}
+	}
+	for i, content := range result.Content {
+		text, ok := content.(mcp.TextContent)
+		if !ok {
+			continue
+		}
+		trimmed := strings.TrimSpace(text.Text)
+		if !strings.HasPrefix(trimmed, "{") || !json.Valid([]byte(trimmed)) {
+			continue
+		}
+		indented := strings.HasPrefix(trimmed, "{\n")
+		var encoded []byte
+		if indented {
+			encoded, _ = json.MarshalIndent(warnings, "  ", "  ")
+		} else {
+			encoded, _ = json.Marshal(warnings)
+		}
+		body := strings.TrimSpace(strings.TrimSuffix(trimmed, "}"))
+		separator := ","
+		if body == "{" {
+			separator = ""
+		}
+		if indented {
+			text.Text = fmt.Sprintf("%s%s\n  \"warnings\": %s\n}", body, separator, encoded)
+		} else {
+			text.Text = fmt.Sprintf("%s%s\"warnings\":%s}", body, separator, encoded)
+		}
+		result.Content[i] = text
+		return true
+	}
+	return false
+}
+
+// formatWarningsFooter lists warnings one per line, or returns "" when there are none.
+func formatWarningsFooter(warnings []ToolWarning) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "⚠️ Warnings (%d):", len(warnings))
+	for _, warning := range warnings {
+		fmt.Fprintf(&b, "\n- [%s] %s", warning.Code, warning.Message)
+	}
+	return b.String()
+}
+
+// addScanWarnings reports what a search scan lost or could not vouch for.
+func addScanWarnings(ctx context.Context, scan *searchScan) {
+	if scan.SnippetErrors > 0 {
+		addWarning(ctx, warnSnippetParse, fmt.Sprintf("%d result snippets could not be parsed and were left out", scan.SnippetErrors))
+	}
+	if len(scan.SchemaIssues) > 0 {
+		addWarning(ctx, warnSchemaMismatch, "grep.app returned an unexpected response shape: "+strings.Join(scan.SchemaIssues, "; "))
+	}
+	if !scan.Complete && scan.AvailablePages > scan.PagesScanned {
+		addWarning(ctx, warnResultsTruncated, fmt.Sprintf("results come from %d of %d available pages (%d matches in total); raise maxPages to fetch more", scan.PagesScanned, scan.AvailablePages, scan.TotalCount))
+	}
+	if scan.PageError != "" {
+		addWarning(ctx, warnPageFailed, fmt.Sprintf("fetching results failed after %d pages (%s); results are partial", scan.PagesScanned, scan.PageError))
+	}
+	if scan.Provider != "" {
+		addWarning(ctx, warnProviderFallback, fmt.Sprintf("grep.app failed (%s); results were served by %s, which does not support regex and may rank and count matches differently", scan.FallbackReason, scan.Provider))
+	}
+	if isStale(scan.CachedAt, time.Now()) {
+		addWarning(ctx, warnStaleCache, fmt.Sprintf("results were cached at %s, past the %s staleness threshold", scan.CachedAt.UTC().Format(time.RFC3339), GetConfig().StaleAfter))
+	}
+}
+
+// addBatchWarnings reports files that batch retrieval skipped or that failed because
+// GitHub rate limited the requests.
+func addBatchWarnings(ctx context.Context, result *BatchRetrievalResult) {
+	if len(result.Skipped) > 0 {
+		addWarning(ctx, warnFilesSkipped, fmt.Sprintf("%d files on hosts other than GitHub were skipped", len(result.Skipped)))
+	}
+	rateLimited, truncated := 0, 0
+	for _, file := range result.Files {
+		if strings.Contains(strings.ToLower(file.Error), "rate limit") {
+			rateLimited++
+		}
+		if file.Truncated {
+			truncated++
+		}
+	}
+	if truncated > 0 {
+		addWarning(ctx, warnFilesTruncated, fmt.Sprintf("%d files were truncated to fit the per-file or batch byte limits; request fewer files or use contextLines to see more of each", truncated))
+	}
+	if rateLimited > 0 {
+		message := fmt.Sprintf("%d files failed because GitHub rate limited the requests; retry later with retryFailedOnly", rateLimited)
+		if result.RateLimit != nil && !result.RateLimit.Authenticated {
+			message += ", or set GITHUB_TOKEN for a higher limit"
+		}
+		addWarning(ctx, warnRateLimited, message)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//================================================================================
+// Result Watching
+//================================================================================
+
+const (
+	resultsURIPrefix     = "grepapp://results/"
+	defaultWatchInterval = 15 * time.Minute // How often watched queries are searched again
+	watchRefreshTimeout  = 2 * time.Minute  // Bounds one background refresh of a watched query
+	stdioSessionID       = "stdio"          // mcp-go's session ID for the single stdio client
+)
+
+// Resource subscription methods. mcp-go does not route them, so the transports answer
+// them before messages reach the MCP server.
+const (
+	methodResourcesSubscribe   = "resources/subscribe"
+	methodResourcesUnsubscribe = "resources/unsubscribe"
+)
+
+// resultsURI is the resource URI of a query's complete cached results.
+func resultsURI(query string) string {
+	return resultsURIPrefix + url.PathEscape(query)
+}
+
+// queryFromResultsURI extracts the query from a results resource URI.
+func queryFromResultsURI(uri string) (string, error) {
+	if !strings.HasPrefix(uri, resultsURIPrefix) {
+		return "", fmt.Errorf("not a results resource: %s", uri)
+	}
+	query, err := url.PathUnescape(strings.TrimPrefix(uri, resultsURIPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid results resource %s: %w", uri, err)
+	}
+	if strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("results resource %s has no query", uri)
+	}
+	return query, nil
+}
+
+// ResultsResource is the content of a grepapp://results/<query> resource.
+type ResultsResource struct {
+	Query    string    `json:"query"`
+	Count    int       `json:"count"`
+	CachedAt time.Time `json:"cached_at"`
+	Hits     Hits      `json:"hits"`
+}
+
+// resultsFingerprint identifies a result set so refreshes can tell whether it changed.
+func resultsFingerprint(result *fullSearchResult) string {
+	if result == nil {
+		return ""
+	}
+	return generateCacheKey(map[string]interface{}{"hits": result.Hits, "count": result.Count})
+}
+
+// resultWatch is one watched query and the sessions subscribed to its results.
+type resultWatch struct {
+	subscribers map[string]struct{}
+	fingerprint string
+}
+
+// resultWatcher searches subscribed queries again in the background and notifies the
+// subscribed sessions when their complete results change. A query is watched while at
+// least one session is subscribed to it.
+type resultWatcher struct {
+	refresh func(ctx context.Context, query string) (*fullSearchResult, error)
+	notify  func(sessionID, uri string) error
+
+	mu      sync.Mutex
+	watches map[string]*resultWatch
+}
+
+var resultWatches = newResultWatcher(nil, nil)
+
+func newResultWatcher(refresh func(ctx context.Context, query string) (*fullSearchResult, error), notify func(sessionID, uri string) error) *resultWatcher {
+	return &resultWatcher{refresh: refresh, notify: notify, watches: make(map[string]*resultWatch)}
+}
+
+// subscribe starts watching the query of uri for sessionID.
+func (w *resultWatcher) subscribe(sessionID, uri string) error {
+	if w.refresh == nil {
+		return fmt.Errorf("result watching is disabled")
+	}
+	query, err := queryFromResultsURI(uri)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watch, ok := w.watches[query]
+	if !ok {
+		watch = &resultWatch{subscribers: make(map[string]struct{})}
+		// Changes are reported relative to the results the client can read now
+		cached, _ := getCachedData[fullSearchResult](completeCacheKey(query), cacheTTLFor(cacheEntryComplete, 0))
+		watch.fingerprint = resultsFingerprint(cached)
+		w.watches[query] = watch
+		log.Printf("👀 Watching query '%s' for result changes", query)
+	}
+	watch.subscribers[sessionID] = struct{}{}
+	return nil
+}
+
+// unsubscribe stops notifying sessionID about uri, and stops watching the query when no
+// sessions remain subscribed.
+func (w *resultWatcher) unsubscribe(sessionID, uri string) error {
+	query, err := queryFromResultsURI(uri)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeLocked(query, sessionID)
+	return nil
+}
+
+func (w *resultWatcher) removeLocked(query, sessionID string) {
+	watch, ok := w.watches[query]
+	if !ok {
+		return
+	}
+	delete(watch.subscribers, sessionID)
+	if len(watch.subscribers) == 0 {
+		delete(w.watches, query)
+		log.Printf("🙈 Stopped watching query '%s'", query)
+	}
+}
+
+// queries returns the watched queries in a stable order.
+func (w *resultWatcher) queries() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	queries := make([]string, 0, len(w.watches))
+	for query := range w.watches {
+		queries = append(queries, query)
+	}
+	sort.Strings(queries)
+	return queries
+}
+
+// refreshAll searches every watched query again and notifies the subscribers of queries
+// whose results changed. Sessions that have gone away are unsubscribed.
+func (w *resultWatcher) refreshAll(ctx context.Context) {
+	for _, query := range w.queries() {
+		refreshCtx, cancel := context.WithTimeout(ctx, watchRefreshTimeout)
+		result, err := w.refresh(refreshCtx, query)
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ Background refresh failed for watched query '%s': %v", query, err)
+			continue
+		}
+
+		fingerprint := resultsFingerprint(result)
+		w.mu.Lock()
+		watch, ok := w.watches[query]
+		if !ok || watch.fingerprint == fingerprint {
+			w.mu.Unlock()
+			continue
+		}
+		watch.fingerprint = fingerprint
+		subscribers := sortedKeys(watch.subscribers)
+		w.mu.Unlock()
+
+		uri := resultsURI(query)
+		log.Printf("🔔 Results changed for watched query '%s'; notifying %d sessions", query, len(subscribers))
+		for _, sessionID := range subscribers {
+			if err := w.notify(sessionID, uri); err != nil {
+				log.Printf("⚠️ Failed to notify session %s about %s: %v", sessionID, uri, err)
+				if errors.Is(err, server.ErrSessionNotFound) {
+					w.mu.Lock()
+					w.removeLocked(query, sessionID)
+					w.mu.Unlock()
+				}
+			}
+		}
+	}
+}
+
+// run refreshes the watched queries every interval until ctx is done.
+func (w *resultWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.refreshAll(ctx)
+		}
+	}
+}
+
+// refreshCompleteResults scans every page of query again, bypassing cached pages, and
+// caches the merged hits as its complete results.
+func refreshCompleteResults(ctx context.Context, client *http.Client, query string) (*fullSearchResult, error) {
+	scan, err := scanGrepAppLanguages(ctx, client, map[string]interface{}{"query": query, "forceRefresh": true}, GetConfig().MaxPages)
+	if err != nil {
+		return nil, err
+	}
+	if len(scan.SchemaIssues) > 0 {
+		return nil, fmt.Errorf("upstream schema issues: %v", scan.SchemaIssues)
+	}
+	result := &fullSearchResult{Hits: *scan.Hits, Count: scan.TotalCount}
+	if err := cacheData(completeCacheKey(query), *result, query, cacheEntryComplete); err != nil {
+		return nil, fmt.Errorf("failed to cache complete results: %w", err)
+	}
+	return result, nil
+}
+
+// startResultWatching publishes the results resource template and refreshes watched
+// queries every interval in the background.
+func startResultWatching(s *server.MCPServer, client *http.Client, interval time.Duration) {
+	resultWatches = newResultWatcher(
+		func(ctx context.Context, query string) (*fullSearchResult, error) {
+			return refreshCompleteResults(ctx, client, query)
+		},
+		func(sessionID, uri string) error {
+			return s.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+		},
+	)
+
+	template := mcp.NewResourceTemplate(resultsURIPrefix+"{query}", "Search results",
+		mcp.WithTemplateDescription(fmt.Sprintf("Complete cached searchCode results for a query. Subscribe to be notified when a background refresh, every %s, finds different results.", interval)),
+		mcp.WithTemplateMIMEType("application/json"),
+	)
+	s.AddResourceTemplate(template, readResultsResource)
+	go resultWatches.run(context.Background(), interval)
+}
+
+// readResultsResource returns the complete cached results of the query named in the URI.
+func readResultsResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := request.Params.URI
+	query, err := queryFromResultsURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	entry, cachedAt, err := getCachedEntry[fullSearchResult](completeCacheKey(query), cacheTTLFor(cacheEntryComplete, 0))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("no cached results for query %q; run searchCode first", query)
+	}
+	out, err := json.MarshalIndent(ResultsResource{Query: query, Count: entry.Count, CachedAt: cachedAt.UTC(), Hits: entry.Hits}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: string(out)}}, nil
+}
+
+//================================================================================
+// Resource Subscription Requests
+//================================================================================
+
+// subscriptionRequest is a resources/subscribe or resources/unsubscribe request.
+type subscriptionRequest struct {
+	ID     mcp.RequestId `json:"id"`
+	Method string        `json:"method"`
+	Params struct {
+		URI string `json:"uri"`
+	} `json:"params"`
+}
+
+// handleSubscriptionMessage answers a subscription request for sessionID. It reports false
+// for any other message, which is left to the MCP server.
+func handleSubscriptionMessage(sessionID string, raw []byte) (mcp.JSONRPCMessage, bool) {
+	var request subscriptionRequest
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return nil, false
+	}
+	var err error
+	switch request.Method {
+	case methodResourcesSubscribe:
+		err = resultWatches.subscribe(sessionID, request.Params.URI)
+	case methodResourcesUnsubscribe:
+		err = resultWatches.unsubscribe(sessionID, request.Params.URI)
+	default:
+		return nil, false
+	}
+	if err != nil {
+		response := mcp.JSONRPCError{JSONRPC: mcp.JSONRPC_VERSION, ID: request.ID}
+		response.Error.Code = mcp.INVALID_PARAMS
+		response.Error.Message = err.Error()
+		return response, true
+	}
+	return mcp.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: request.ID, Result: mcp.EmptyResult{}}, true
+}
+
+// subscriptionMiddleware answers subscription requests posted to the HTTP transport for
+// the session named in the Mcp-Session-Id header.
+func subscriptionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.Header.Get(mcpSessionHeader)
+		if r.Method != http.MethodPost || sessionID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		raw, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if response, ok := handleSubscriptionMessage(sessionID, raw); ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+		next.ServeHTTP(w, r)
+	})
+}